@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -18,8 +21,13 @@ import (
 	"live-chatter/internal/service"
 	"live-chatter/pkg"
 	"live-chatter/pkg/db"
+	"live-chatter/pkg/i18n"
+	"live-chatter/pkg/mail"
+	"live-chatter/pkg/metrics"
 	"live-chatter/pkg/middleware"
 	"live-chatter/pkg/model"
+	"live-chatter/pkg/storage"
+	"live-chatter/pkg/thumbnail"
 
 	Log "live-chatter/pkg/logger"
 
@@ -31,17 +39,10 @@ import (
 func main() {
 	printStartUpBanner()
 
-	cfg := loadConfig("config.xml")
+	cfgPath := configPath()
+	cfg := loadConfig(cfgPath)
 
 	debugMode := cfg.Context.Mode != gin.ReleaseMode
-	if cfg.Logging.MaxSizeMB <= 0 {
-		Log.Error("Invalid MAX_SIZE_MB in config, must be > 0")
-		os.Exit(1)
-	}
-	if cfg.Logging.MaxBackups < 0 || cfg.Logging.MaxAgeDays < 0 {
-		Log.Error("Invalid MAX_BACKUPS or MAX_AGE_DAYS in config, must be >= 0")
-		os.Exit(1)
-	}
 
 	Log.SetupLogging(Log.LoggingOptions{
 		LogDir: struct {
@@ -49,6 +50,7 @@ func main() {
 			Relative bool
 		}(cfg.Logging.LogDir),
 		EnableDebug:  debugMode,
+		JSON:         cfg.Logging.Format == "json",
 		MaxSizeMB:    cfg.Logging.MaxSizeMB,
 		MaxBackups:   cfg.Logging.MaxBackups,
 		MaxAgeDays:   cfg.Logging.MaxAgeDays,
@@ -57,32 +59,78 @@ func main() {
 
 	initDatabase(cfg)
 	initAuth(cfg)
+	initLocales(cfg)
 
 	// Auto-migrate database models
 	if err := autoMigrate(); err != nil {
 		Log.Error("Database migration failed: %v", err)
+		Log.FlushLogs()
 		os.Exit(1)
 	}
+	initSearch(cfg.Search)
+
+	clientCfg := newClientConfig(cfg.WebSocket)
 
-	userRepo, roomRepo, messageRepo := initializeRepos()
+	userRepo, roomRepo, messageRepo, privateMessageRepo := initializeRepos()
+
+	queueSize := cfg.WebSocket.BroadcastQueueSize
+	if queueSize <= 0 {
+		queueSize = pkg.DefaultBroadcastQueueSize
+	}
+	highWaterMark := cfg.WebSocket.ShedHighWaterMark
+	if highWaterMark <= 0 || highWaterMark > queueSize {
+		highWaterMark = queueSize * 3 / 4
+	}
 
 	clientsManager := &pkg.ClientManager{
-		Broadcast:   make(chan pkg.BroadcastMessage),
-		Register:    make(chan *pkg.Client),
-		Unregister:  make(chan *pkg.Client),
-		Clients:     make(map[*pkg.Client]bool),
-		Rooms:       make(map[string]map[*pkg.Client]bool),
-		UserClients: make(map[string]*pkg.Client),
-		RoomRepo:    roomRepo,
-		MessageRepo: messageRepo,
+		Broadcast:          make(chan pkg.BroadcastMessage, queueSize),
+		Register:           make(chan *pkg.Client),
+		Unregister:         make(chan *pkg.Client),
+		Clients:            make(map[*pkg.Client]bool),
+		Rooms:              make(map[string]map[*pkg.Client]bool),
+		UserClients:        make(map[string]*pkg.Client),
+		RoomRepo:           roomRepo,
+		MessageRepo:        messageRepo,
+		UserRepo:           userRepo,
+		PrivateMessageRepo: privateMessageRepo,
+		ActivityRepo:       repository.NewActivityLogRepository(),
+		ReactionRepo:       repository.NewReactionRepository(),
+		EmojiRepo:          repository.NewEmojiRepository(),
+		NotificationRepo:   repository.NewNotificationRepository(),
+		AttachmentRepo:     repository.NewAttachmentRepository(),
+		ShedHighWaterMark:  highWaterMark,
+		ThreadPolicy: pkg.ThreadPolicy{
+			AllowDeletedParent: cfg.Threads.AllowDeletedParent,
+			MaxDepth:           cfg.Threads.MaxDepth,
+		},
+		Pagination: cfg.Pagination,
+
+		MemberCountEvents:   cfg.WebSocket.MemberCountEvents,
+		MemberCountCoalesce: time.Duration(cfg.WebSocket.MemberCountCoalesce) * time.Millisecond,
+
+		TypingThrottle: time.Duration(cfg.WebSocket.TypingThrottle) * time.Millisecond,
+		TypingTimeout:  time.Duration(cfg.WebSocket.TypingTimeout) * time.Second,
+
+		RejectUnknownRooms: cfg.Rooms.RejectUnknown,
 	}
 
+	contentFilter, err := newContentFilter(cfg.MessageHooks.ContentFilter)
+	if err != nil {
+		Log.Error("Invalid CONTENT_FILTER config: %v", err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
+	registerPreSendHooks(clientsManager, cfg.MessageHooks, contentFilter)
+	clientsManager.RegisterMetrics(metrics.Default)
+
 	go clientsManager.Start()
 
 	r := initRouter(cfg)
-	setupRoutes(r, clientsManager, userRepo)
+	healthController := controller.NewHealthController(db.Health{})
+	setupRoutes(r, cfg, clientsManager, clientCfg, userRepo, healthController)
+	reloadOnHangup(cfgPath, cfg)
 
-	runServer(cfg, r)
+	runServer(cfg, r, clientsManager, healthController)
 }
 
 func printStartUpBanner() {
@@ -117,40 +165,100 @@ func printStartUpBanner() {
 	fmt.Printf("%s%s\n\n", strings.Repeat(" ", spaces), banner)
 }
 
-func initializeRepos() (repository.UserRepository, repository.RoomRepository, repository.MessageRepository) {
+func initializeRepos() (repository.UserRepository, repository.RoomRepository, repository.MessageRepository, repository.PrivateMessageRepository) {
 	userRepo := repository.NewUserRepository()
 	roomRepo := repository.NewRoomRepository()
 	messageRepo := repository.NewMessageRepository()
-	return userRepo, roomRepo, messageRepo
+	privateMessageRepo := repository.NewPrivateMessageRepository()
+	return userRepo, roomRepo, messageRepo, privateMessageRepo
 }
 
 func autoMigrate() error {
-	return db.GetDB().AutoMigrate(
+	removed, err := repository.DeduplicateUserRooms()
+	if err != nil {
+		return fmt.Errorf("failed to deduplicate room memberships: %w", err)
+	}
+	if removed > 0 {
+		Log.Warn("Removed %d duplicate room membership rows", removed)
+	}
+
+	if err := repository.DropLegacyEmailIndex(); err != nil {
+		return fmt.Errorf("failed to drop legacy email index: %w", err)
+	}
+
+	err = db.GetDB().AutoMigrate(
 		&model.User{},
 		&model.Room{},
 		&model.Message{},
+		&model.Attachment{},
 		&model.UserRoom{},
+		&model.RoomBan{},
+		&model.RoomInvite{},
+		&model.InviteToken{},
+		&model.PasswordResetToken{},
 		&model.PrivateMessage{},
-		//&model.UserSession{},
-		//&model.ActivityLog{}
+		&model.Notification{},
+		&model.UserSession{},
+		&model.ActivityLog{},
+		&model.CustomEmoji{},
+		&model.MessageReaction{},
+		&model.PinnedMessage{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Lookups expect lowercase usernames; accounts left mixed-case can only sign in by email
+	if err := repository.NormalizeUsernames(); err != nil {
+		Log.Warn("Usernames could not be lowercased; rename accounts whose names differ only in case: %v", err)
+	}
+
+	// Room names are still checked before every create and rename, so this is not fatal
+	if err := repository.EnsureRoomNameIndex(); err != nil {
+		Log.Warn("Room names are not unique-indexed; rename rooms sharing a name to add it: %v", err)
+	}
+	return nil
 }
 
-func setupRoutes(router *gin.Engine, clientsManager *pkg.ClientManager, userRepo repository.UserRepository) {
+func setupRoutes(router *gin.Engine, cfg *config.APIConfig, clientsManager *pkg.ClientManager, clientCfg pkg.ClientConfig, userRepo repository.UserRepository,
+	healthController *controller.HealthController) {
 	roomRepo := clientsManager.RoomRepo
 	messageRepo := clientsManager.MessageRepo
 
-	authService := service.NewAuthService(userRepo)
-	chatService := service.NewChatService(messageRepo, roomRepo, userRepo, clientsManager)
-
-	authController := controller.NewAuthController(authService)
-	chatController := controller.NewChatController(chatService)
+	sessionRepo := repository.NewSessionRepository()
+	middleware.SetSessionStore(sessionRepo)
+
+	activityRepo := clientsManager.ActivityRepo
+
+	authService := service.NewAuthService(userRepo, sessionRepo, activityRepo, repository.NewPasswordResetRepository(),
+		mail.NewMailer(cfg.Mail), cfg.Authentication, cfg.Registration, cfg.PasswordReset)
+	chatService := service.NewChatService(messageRepo, roomRepo, userRepo, clientsManager.PrivateMessageRepo, clientsManager.NotificationRepo, activityRepo, repository.NewInviteTokenRepository(), clientsManager, cfg.Rooms)
+	userService := service.NewUserService(userRepo, sessionRepo, roomRepo, clientsManager)
+	adminService := service.NewAdminService(activityRepo, clientsManager, db.Health{})
+	clientsManager.JoinLimit = chatService.CheckRoomJoinLimit
+	startAutoLeave(chatService, cfg.Rooms)
+	startRetention(chatService, cfg.Retention)
+	emojiService := service.NewEmojiService(clientsManager.EmojiRepo, roomRepo)
+	notificationService := service.NewNotificationService(clientsManager.NotificationRepo)
+	attachmentService := service.NewAttachmentService(clientsManager.AttachmentRepo, roomRepo, initStorage(cfg.Uploads),
+		thumbnail.NewStdProcessor(cfg.Uploads.ThumbnailSize, cfg.Uploads.MaxImageDimension), cfg.Uploads)
+
+	authController := controller.NewAuthController(authService, cfg.Registration, service.NewChallengeVerifier(cfg.Registration.Challenge))
+	chatController := controller.NewChatController(chatService, cfg.Pagination)
+	userController := controller.NewUserController(userService)
+	adminController := controller.NewAdminController(adminService, cfg.Pagination)
+	emojiController := controller.NewEmojiController(emojiService)
+	notificationController := controller.NewNotificationController(notificationService, cfg.Pagination)
+	attachmentController := controller.NewAttachmentController(attachmentService)
 
 	// WebSocket endpoint
 	router.GET("/ws", middleware.WebSocketAuthMiddleware(), func(c *gin.Context) {
-		server.WebSocket(c.Writer, c.Request, clientsManager)
+		server.WebSocket(c.Writer, c.Request, clientsManager, clientCfg)
 	})
 
+	// Attachment downloads, linked from messages by their attachment URL
+	router.GET("/download/:attachmentId", middleware.AuthMiddleware(), attachmentController.Download)
+
 	// API routes
 	api := router.Group("/api/v1")
 	{
@@ -160,6 +268,10 @@ func setupRoutes(router *gin.Engine, clientsManager *pkg.ClientManager, userRepo
 			auth.POST("/register", authController.Register)
 			auth.POST("/login", authController.Login)
 			auth.POST("/refresh", authController.Refresh)
+			auth.POST("/logout", middleware.AuthMiddleware(), authController.Logout)
+			auth.POST("/change-password", middleware.AuthMiddleware(), authController.ChangePassword)
+			auth.POST("/forgot-password", authController.ForgotPassword)
+			auth.POST("/reset-password", authController.ResetPassword)
 		}
 
 		// Chat routes
@@ -168,57 +280,194 @@ func setupRoutes(router *gin.Engine, clientsManager *pkg.ClientManager, userRepo
 		{
 			chat.GET("/rooms", chatController.GetRooms)
 			chat.POST("/rooms", chatController.CreateRoom)
+			chat.PUT("/rooms/:roomId", chatController.UpdateRoom)
+			chat.DELETE("/rooms/:roomId", chatController.DeleteRoom)
 			chat.GET("/rooms/:roomId/messages", chatController.GetRoomMessages)
+			chat.GET("/rooms/:roomId/export", chatController.ExportRoomMessages)
+			chat.POST("/rooms/:roomId/messages", chatController.SendMessage)
 			chat.POST("/rooms/:roomId/join", chatController.JoinRoom)
 			chat.POST("/rooms/:roomId/leave", chatController.LeaveRoom)
+			chat.GET("/rooms/:roomId/members", chatController.GetRoomMembers)
+			chat.GET("/rooms/:roomId/pins", chatController.GetPinnedMessages)
+			chat.POST("/rooms/:roomId/pins/:messageId", chatController.PinMessage)
+			chat.DELETE("/rooms/:roomId/pins/:messageId", chatController.UnpinMessage)
+			chat.PATCH("/rooms/:roomId/members/:userId", chatController.ChangeMemberRole)
+			chat.POST("/rooms/:roomId/kick", chatController.KickUser)
+			chat.POST("/rooms/:roomId/invite", chatController.InviteUser)
+			chat.POST("/rooms/:roomId/invites", chatController.CreateInviteToken)
+			chat.POST("/invites/:token/accept", chatController.AcceptInviteToken)
+			chat.DELETE("/rooms/:roomId/bans/:userId", chatController.UnbanUser)
+			chat.POST("/rooms/:roomId/mute", chatController.MuteRoom)
+			chat.DELETE("/rooms/:roomId/mute", chatController.UnmuteRoom)
+			chat.POST("/rooms/:roomId/favorite", chatController.FavoriteRoom)
+			chat.DELETE("/rooms/:roomId/favorite", chatController.UnfavoriteRoom)
+			chat.GET("/rooms/:roomId/emoji", emojiController.GetRoomEmoji)
+			chat.GET("/emoji", emojiController.GetEmoji)
 			chat.GET("/users/online", chatController.GetOnlineUsers)
+			chat.PATCH("/messages/:messageId", chatController.EditMessage)
+			chat.DELETE("/messages/:messageId", chatController.DeleteMessage)
+			chat.GET("/messages/search", chatController.SearchMessages)
+			chat.GET("/messages/:messageId", chatController.GetMessage)
+			chat.POST("/messages/batch", chatController.GetMessagesBatch)
+			chat.POST("/upload", attachmentController.Upload)
+			chat.GET("/messages/:messageId/replies", chatController.GetMessageReplies)
+			chat.POST("/messages/:messageId/reactions", chatController.AddReaction)
+			chat.DELETE("/messages/:messageId/reactions", chatController.RemoveReaction)
+			chat.GET("/private/:username", chatController.GetPrivateMessages)
+			chat.POST("/private/conversations/:username/read", chatController.MarkPrivateMessagesRead)
+			chat.POST("/private/:messageId/read", chatController.MarkPrivateMessageRead)
+		}
+
+		// User routes
+		users := api.Group("/users")
+		users.Use(middleware.AuthMiddleware())
+		{
+			users.PATCH("/me", userController.UpdateProfile)
+			users.DELETE("/me", userController.DeactivateAccount)
+			users.PATCH("/me/presence-visibility", userController.SetPresenceVisibility)
+		}
+
+		// Notification routes
+		notifications := api.Group("/notifications")
+		notifications.Use(middleware.AuthMiddleware())
+		{
+			notifications.GET("", notificationController.GetNotifications)
+			notifications.POST("/read-all", notificationController.MarkAllRead)
+			notifications.POST("/:notificationId/read", notificationController.MarkRead)
+		}
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware(userRepo))
+		{
+			admin.GET("/activity", adminController.GetActivityLogs)
+			admin.GET("/stats", adminController.GetServerStats)
+			admin.GET("/db/stats", adminController.GetDatabaseStats)
+			admin.POST("/emoji", emojiController.CreateEmoji)
+			admin.DELETE("/emoji/:emojiId", emojiController.DeleteEmoji)
 		}
 	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
-	})
+	// Health check endpoints
+	router.GET("/health", healthController.Health)
+	router.GET("/livez", healthController.Livez)
+	router.GET("/readyz", healthController.Readyz)
+
+	// Prometheus scrape endpoint
+	router.GET("/metrics", gin.WrapH(metrics.Default.Handler()))
 }
 
-func runServer(cfg *config.APIConfig, router *gin.Engine) {
-	addr := fmt.Sprintf("%s:%d", cfg.Context.Host, cfg.Context.Port)
-	srv := &http.Server{
-		Addr:         addr,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+func runServer(cfg *config.APIConfig, router *gin.Engine, clientsManager *pkg.ClientManager,
+	healthController *controller.HealthController) {
+	srv := newHTTPServer(cfg.Context, router)
+	tlsEnabled := cfg.Context.TLSEnabled()
+	if tlsEnabled {
+		Log.Info("Server starting on %s (HTTPS)", srv.Addr)
+	} else {
+		Log.Info("Server starting on %s", srv.Addr)
 	}
 
-	Log.Info("Server starting on %s", addr)
-
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := listenAndServe(srv, cfg.Context); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			Log.Error("Server failed: %v", err)
+			Log.FlushLogs()
 			os.Exit(1)
 		}
 	}()
 
+	var redirectSrv *http.Server
+	if tlsEnabled && cfg.Context.HTTPRedirectPort > 0 {
+		redirectSrv = startHTTPSRedirect(cfg.Context)
+	}
+
+	// Migrations and the initial database ping are done by now, so traffic may be routed here
+	healthController.SetReady(true)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	Log.Info("Shutting down server...")
+	healthController.SetReady(false)
 
-	err := db.CloseDB()
-	if err != nil {
-		Log.Warn("Failed to close DB: %v", err)
-	}
-
-	// Give outstanding requests 30 seconds to complete
+	// Give outstanding requests and WebSocket clients 30 seconds to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		Log.Error("Server forced to shutdown: %v", err)
 	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			Log.Warn("HTTP redirect server forced to shutdown: %v", err)
+		}
+	}
+
+	// Hijacked WebSocket connections are not covered by srv.Shutdown
+	if err := clientsManager.Shutdown(ctx); err != nil {
+		Log.Warn("WebSocket clients did not close in time: %v", err)
+	}
+
+	// The database goes last, once nothing can still be using it
+	if err := db.CloseDB(); err != nil {
+		Log.Warn("Failed to close DB: %v", err)
+	}
 
 	Log.Info("Server exiting")
+	Log.Close()
+}
+
+// newHTTPServer builds the API server for the configured address, requiring TLS 1.2 or later
+// when HTTPS is enabled
+func newHTTPServer(ctxCfg config.ContextConfig, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", ctxCfg.Host, ctxCfg.Port),
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	if ctxCfg.TLSEnabled() {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return srv
+}
+
+// listenAndServe serves HTTPS with the configured certificate when one is set and plain HTTP
+// otherwise, returning when the server stops
+func listenAndServe(srv *http.Server, ctxCfg config.ContextConfig) error {
+	if ctxCfg.TLSEnabled() {
+		return srv.ListenAndServeTLS(ctxCfg.TLSCertFile, ctxCfg.TLSKeyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+// startHTTPSRedirect listens for plain HTTP on the redirect port and permanently redirects every
+// request to the same host and path over HTTPS
+func startHTTPSRedirect(ctxCfg config.ContextConfig) *http.Server {
+	httpsPort := strconv.Itoa(ctxCfg.Port)
+	srv := &http.Server{
+		Addr: fmt.Sprintf("%s:%d", ctxCfg.Host, ctxCfg.HTTPRedirectPort),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	Log.Info("Redirecting HTTP on %s to HTTPS", srv.Addr)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Log.Error("HTTP redirect server failed: %v", err)
+		}
+	}()
+	return srv
 }
 
 func initRouter(cfg *config.APIConfig) *gin.Engine {
@@ -230,6 +479,7 @@ func initRouter(cfg *config.APIConfig) *gin.Engine {
 	}
 
 	middlewares := []gin.HandlerFunc{
+		middleware.RequestIDMiddleware(),
 		middleware.CORSMiddleware(),
 		middleware.RateLimitMiddleware(),
 		gin.Recovery(),
@@ -248,23 +498,224 @@ func initRouter(cfg *config.APIConfig) *gin.Engine {
 	return router
 }
 
+// configFiles are the config files looked for in the working directory, in order of preference
+var configFiles = []string{"config.xml", "config.yaml", "config.yml", "config.json"}
+
+// configPath returns the first config file that exists, or config.xml when there is none so that
+// loading falls back to the environment
+func configPath() string {
+	for _, path := range configFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return configFiles[0]
+}
+
 func loadConfig(path string) *config.APIConfig {
 	cfg, err := config.LoadConfig(path)
 	if err != nil {
-		Log.Error("Error loading config:", err)
+		Log.Error("Error loading config: %v", err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
+	if err := cfg.ResolveSecrets(); err != nil {
+		Log.Error("Failed to resolve config secrets: %v", err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		Log.Error("Invalid configuration in %s:\n%v", path, err)
+		Log.FlushLogs()
 		os.Exit(1)
 	}
 	return cfg
 }
 
 func initDatabase(cfg *config.APIConfig) {
+	// The pool reconnects on its own once running; an initial failure is fatal so that
+	// misconfiguration surfaces here rather than as a confusing migration error
 	err := db.InitDBFromConfig(cfg)
 	if err != nil {
-		Log.Error("Error initializing DB: %v", err)
+		Log.Error("Failed to connect to the database (%s), check the <DB> config section: %v", db.RedactedDSN(cfg), err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
+}
+
+// initStorage opens the local directory attachments are kept in
+func initStorage(uploads config.UploadsConfig) storage.Storage {
+	dir := uploads.Dir
+	if dir == "" {
+		dir = "uploads"
+	}
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		Log.Error("Failed to open attachment storage, check the <UPLOADS> config section: %v", err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
+	return store
+}
+
+// registerPreSendHooks installs the built-in message hooks enabled in config.
+// Sanitizing runs first so the filters see the text recipients will see, and custom emoji are
+// expanded last, in the text as it will be delivered.
+func registerPreSendHooks(clientsManager *pkg.ClientManager, hooksCfg config.MessageHooksConfig, contentFilter pkg.ContentFilter) {
+	if hooksCfg.SanitizeHTML {
+		clientsManager.RegisterPreSendHook(pkg.NewHTMLSanitizerHook())
+	}
+	if contentFilter != nil {
+		clientsManager.RegisterPreSendHook(pkg.NewContentFilterHook("content_filter", contentFilter))
+	}
+	if clientsManager.EmojiRepo != nil {
+		clientsManager.RegisterPreSendHook(pkg.NewCustomEmojiHook(clientsManager.EmojiRepo))
+	}
+}
+
+// newContentFilter builds the word-list content filter, or returns nil when nothing is configured
+func newContentFilter(filterCfg config.ContentFilterConfig) (pkg.ContentFilter, error) {
+	if len(filterCfg.Words) == 0 && len(filterCfg.Rooms) == 0 {
+		return nil, nil
+	}
+
+	action, err := pkg.ParseFilterAction(filterCfg.Action, pkg.FilterMask)
+	if err != nil {
+		return nil, err
+	}
+	filter := pkg.NewWordListFilter(action, filterCfg.Words)
+	for _, room := range filterCfg.Rooms {
+		if room.ID == "" {
+			return nil, errors.New("a ROOM entry is missing its ID attribute")
+		}
+		roomAction, err := pkg.ParseFilterAction(room.Action, action)
+		if err != nil {
+			return nil, fmt.Errorf("room %s: %w", room.ID, err)
+		}
+		filter.SetRoomPolicy(room.ID, roomAction, room.Words)
+	}
+	return filter, nil
+}
+
+// initSearch enables full-text message search when configured. Search falls back to
+// substring matching if the index cannot be created.
+func initSearch(search config.SearchConfig) {
+	if !search.FullText {
+		return
+	}
+	language := search.Language
+	if language == "" {
+		language = "english"
+	}
+	if err := repository.EnableFullTextSearch(language); err != nil {
+		Log.Warn("Full-text search unavailable, using substring search: %v", err)
+	}
+}
+
+// startAutoLeave runs the inactivity sweep for rooms that opted into auto-leave, if enabled
+func startAutoLeave(chatService service.ChatService, rooms config.RoomPolicyConfig) {
+	if rooms.AutoLeaveAfter <= 0 {
 		return
 	}
+	inactiveFor := time.Duration(rooms.AutoLeaveAfter) * time.Second
+	interval := time.Hour
+	if rooms.AutoLeaveInterval > 0 {
+		interval = time.Duration(rooms.AutoLeaveInterval) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := chatService.AutoLeaveInactiveMembers(inactiveFor)
+			if err != nil {
+				Log.Error("Auto-leave sweep failed: %v", err)
+			} else if removed > 0 {
+				Log.Info("Auto-left %d inactive room memberships", removed)
+			}
+		}
+	}()
+}
+
+// startRetention runs the scheduled purge of messages past their room type's retention period, if enabled
+func startRetention(chatService service.ChatService, retention config.RetentionConfig) {
+	if retention.PublicRooms <= 0 && retention.PrivateRooms <= 0 {
+		return
+	}
+	periods := map[string]time.Duration{
+		"public":  time.Duration(max(retention.PublicRooms, 0)) * time.Second,
+		"private": time.Duration(max(retention.PrivateRooms, 0)) * time.Second,
+	}
+	interval := time.Hour
+	if retention.Interval > 0 {
+		interval = time.Duration(retention.Interval) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := chatService.PurgeExpiredMessages(periods, retention.HardDelete)
+			if err != nil {
+				Log.Error("Message retention purge failed: %v", err)
+			} else if purged > 0 {
+				Log.Info("Purged %d expired messages", purged)
+			}
+		}
+	}()
+}
+
+// newClientConfig applies the configured WebSocket settings over the defaults.
+// When only PONG_WAIT is set, the ping period follows it at 90%.
+func newClientConfig(wsCfg config.WebSocketConfig) pkg.ClientConfig {
+	clientCfg := pkg.DefaultClientConfig()
+	if wsCfg.WriteWait > 0 {
+		clientCfg.WriteWait = time.Duration(wsCfg.WriteWait) * time.Second
+	}
+	if wsCfg.PongWait > 0 {
+		clientCfg.PongWait = time.Duration(wsCfg.PongWait) * time.Second
+		clientCfg.PingPeriod = (clientCfg.PongWait * 9) / 10
+	}
+	if wsCfg.PingPeriod != 0 {
+		clientCfg.PingPeriod = time.Duration(wsCfg.PingPeriod) * time.Second
+	}
+	if wsCfg.SendBufferSize != 0 {
+		clientCfg.SendBufferSize = wsCfg.SendBufferSize
+	}
+	if wsCfg.MaxMessageSize != 0 {
+		clientCfg.MaxMessageSize = wsCfg.MaxMessageSize
+	}
+	if wsCfg.MessageRate != 0 {
+		clientCfg.MessageRate = max(wsCfg.MessageRate, 0)
+	}
+	if wsCfg.MessageBurst != 0 {
+		clientCfg.MessageBurst = wsCfg.MessageBurst
+	}
+	if wsCfg.MaxRateViolations != 0 {
+		clientCfg.MaxRateViolations = max(wsCfg.MaxRateViolations, 0)
+	}
+	if wsCfg.HeartbeatEnabled {
+		clientCfg.HeartbeatInterval = pkg.DefaultHeartbeatInterval
+		if wsCfg.HeartbeatInterval != 0 {
+			clientCfg.HeartbeatInterval = time.Duration(wsCfg.HeartbeatInterval) * time.Second
+		}
+	}
+	return clientCfg
+}
+
+func initLocales(cfg *config.APIConfig) {
+	if cfg.Context.LocalesDir == "" {
+		return
+	}
+	if err := i18n.LoadDir(cfg.Context.LocalesDir); err != nil {
+		Log.Error("Failed to load message catalogs from %s: %v", cfg.Context.LocalesDir, err)
+		Log.FlushLogs()
+		os.Exit(1)
+	}
 }
 
 func initAuth(cfg *config.APIConfig) {
 	middleware.InitAuthConfig(cfg)
+	middleware.InitOriginConfig(cfg)
+	middleware.InitRateLimitConfig(cfg)
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg"
+)
+
+func TestNewClientConfigMaxMessageSize(t *testing.T) {
+	if got := newClientConfig(config.WebSocketConfig{}).MaxMessageSize; got != pkg.DefaultMaxMessageSize {
+		t.Fatalf("unset MAX_MESSAGE_SIZE gave %d, want the default %d", got, pkg.DefaultMaxMessageSize)
+	}
+
+	clientCfg := newClientConfig(config.WebSocketConfig{MaxMessageSize: 16384})
+	if clientCfg.MaxMessageSize != 16384 {
+		t.Fatalf("MaxMessageSize = %d, want 16384", clientCfg.MaxMessageSize)
+	}
+	if err := clientCfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+// writeSelfSignedCert writes a certificate and key for 127.0.0.1 to dir and returns their paths
+// along with a pool that trusts the certificate
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chatter test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+
+// freePort returns a local port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// getWithRetry issues a GET until the server starts accepting connections
+func getWithRetry(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res, err := client.Get(url)
+		if err == nil {
+			return res
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServerServesTLSWithConfiguredCertificate(t *testing.T) {
+	certFile, keyFile, roots := writeSelfSignedCert(t, t.TempDir())
+	ctxCfg := config.ContextConfig{Host: "127.0.0.1", Port: freePort(t), TLSCertFile: certFile, TLSKeyFile: keyFile}
+
+	srv := newHTTPServer(ctxCfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			t.Error("request did not arrive over TLS")
+		}
+		io.WriteString(w, "secure")
+	}))
+	served := make(chan error, 1)
+	go func() { served <- listenAndServe(srv, ctxCfg) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("server stopped with %v", err)
+		}
+	})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	res := getWithRetry(t, client, "https://"+srv.Addr+"/")
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "secure" || res.TLS == nil {
+		t.Fatalf("got %d %q over TLS %v", res.StatusCode, body, res.TLS != nil)
+	}
+	if res.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("negotiated TLS version %x, want at least 1.2", res.TLS.Version)
+	}
+
+	// Plain HTTP on the TLS port is refused rather than served
+	plain, err := http.Get("http://" + srv.Addr + "/")
+	if err == nil {
+		defer plain.Body.Close()
+		if plain.StatusCode != http.StatusBadRequest {
+			t.Fatalf("plain HTTP on the TLS port answered %d", plain.StatusCode)
+		}
+	}
+}
+
+func TestHTTPRedirectsToHTTPS(t *testing.T) {
+	ctxCfg := config.ContextConfig{Host: "127.0.0.1", Port: 8443, HTTPRedirectPort: freePort(t)}
+	srv := startHTTPSRedirect(ctxCfg)
+	t.Cleanup(func() { srv.Close() })
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res := getWithRetry(t, client, "http://"+srv.Addr+"/api/v1/rooms?limit=5")
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusPermanentRedirect {
+		t.Fatalf("status %d, want 308", res.StatusCode)
+	}
+	if got, want := res.Header.Get("Location"), "https://127.0.0.1:8443/api/v1/rooms?limit=5"; got != want {
+		t.Fatalf("Location = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"live-chatter/internal/config"
+	Log "live-chatter/pkg/logger"
+	"live-chatter/pkg/middleware"
+)
+
+// reloadMu serializes reloads, which update the live config in place
+var reloadMu sync.Mutex
+
+// reloadOnHangup re-reads the config file whenever the process receives SIGHUP
+func reloadOnHangup(path string, cfg *config.APIConfig) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			Log.Info("SIGHUP received, reloading %s", path)
+			if err := reloadConfig(path, cfg); err != nil {
+				Log.Error("Config reload failed, keeping the current settings: %v", err)
+			}
+		}
+	}()
+}
+
+// reloadConfig parses the config at path and applies the settings that are safe to change while
+// running: the HTTP rate limits and the allowed origins. Other changes, MODE included since it
+// also picks the log level and the router's middleware, are logged as needing a restart. An
+// invalid file changes nothing.
+func reloadConfig(path string, cfg *config.APIConfig) error {
+	next, err := config.LoadConfigFrom(path)
+	if err != nil {
+		return err
+	}
+	if err := next.ResolveSecrets(); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	var applied []string
+	if !slices.Equal(next.Context.AllowedOrigins.Origins, cfg.Context.AllowedOrigins.Origins) {
+		// The wildcard is only honoured outside release mode, so keep judging it by the running mode
+		live := *next
+		live.Context.Mode = cfg.Context.Mode
+		middleware.InitOriginConfig(&live)
+		applied = append(applied, "CONTEXT/ALLOWED_ORIGINS")
+	}
+	if next.RateLimit != cfg.RateLimit {
+		middleware.InitRateLimitConfig(next)
+		applied = append(applied, "RATE_LIMIT")
+	}
+
+	restart := restartRequired(*cfg, *next)
+
+	cfg.Context.AllowedOrigins = next.Context.AllowedOrigins
+	cfg.RateLimit = next.RateLimit
+
+	if len(applied) == 0 {
+		Log.Info("Config reloaded, no live settings changed")
+	} else {
+		Log.Info("Config reloaded, applied: %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		Log.Warn("Config changes in %s take effect after a restart", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// restartRequired names the top-level config sections that differ between the running and the
+// reloaded config, ignoring the settings reloadConfig applies live
+func restartRequired(current, next config.APIConfig) []string {
+	next.Context.AllowedOrigins = current.Context.AllowedOrigins
+	next.RateLimit = current.RateLimit
+
+	var changed []string
+	currentValue, nextValue := reflect.ValueOf(current), reflect.ValueOf(next)
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		if field.Name == "XMLName" {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			name, _, _ := strings.Cut(field.Tag.Get("xml"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
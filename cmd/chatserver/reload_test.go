@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRestartRequiredIgnoresLiveSettings(t *testing.T) {
+	current := config.APIConfig{}
+	next := current
+	next.Context.AllowedOrigins.Origins = []string{"https://chat.example.com"}
+	next.RateLimit.AnonRPS = 10
+
+	if changed := restartRequired(current, next); len(changed) != 0 {
+		t.Fatalf("live settings reported as needing a restart: %v", changed)
+	}
+}
+
+func TestRestartRequiredListsModeAndOtherSections(t *testing.T) {
+	current := config.APIConfig{}
+	current.Context.Mode = "release"
+	next := current
+	next.Context.Mode = "debug"
+	next.DB.Host = "db.internal"
+
+	changed := restartRequired(current, next)
+	if !slices.Equal(changed, []string{"CONTEXT", "DB"}) {
+		t.Fatalf("restartRequired = %v, want [CONTEXT DB]", changed)
+	}
+}
+
+// writeRateLimitedConfig writes the example config with the anonymous burst replaced
+func writeRateLimitedConfig(t *testing.T, path, burst string) {
+	t.Helper()
+	example, err := os.ReadFile("../../config-example.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Replace(string(example), "<ANON_RPS>5</ANON_RPS>", "<ANON_RPS>1</ANON_RPS>", 1)
+	data = strings.Replace(data, "<ANON_BURST>10</ANON_BURST>", "<ANON_BURST>"+burst+"</ANON_BURST>", 1)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// allowedRequests counts how many of n back-to-back requests from addr get past the limiter
+func allowedRequests(router *gin.Engine, addr string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = addr
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if res.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestReloadConfigUpdatesRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "config.xml")
+	writeRateLimitedConfig(t, path, "2")
+
+	cfg, err := config.LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom: %v", err)
+	}
+	middleware.InitRateLimitConfig(cfg)
+	router := gin.New()
+	router.Use(middleware.RateLimitMiddleware())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if got := allowedRequests(router, "192.0.2.1:1000", 6); got != 2 {
+		t.Fatalf("%d requests allowed before the reload, want 2", got)
+	}
+
+	writeRateLimitedConfig(t, path, "4")
+	if err := reloadConfig(path, cfg); err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if cfg.RateLimit.AnonBurst != 4 {
+		t.Fatalf("live config burst = %d, want 4", cfg.RateLimit.AnonBurst)
+	}
+	if got := allowedRequests(router, "192.0.2.2:1000", 6); got != 4 {
+		t.Fatalf("%d requests allowed after the reload, want 4", got)
+	}
+}
+
+func TestReloadConfigKeepsSettingsWhenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	writeRateLimitedConfig(t, path, "2")
+	cfg, err := config.LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("<API><CONTEXT><PORT>0</PORT></CONTEXT></API>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(path, cfg); err == nil {
+		t.Fatal("an invalid config was reloaded")
+	}
+	if cfg.RateLimit.AnonBurst != 2 {
+		t.Fatalf("live config changed by a failed reload: burst %d", cfg.RateLimit.AnonBurst)
+	}
+}
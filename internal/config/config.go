@@ -2,8 +2,8 @@ package config
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"sync"
 
@@ -13,71 +13,114 @@ import (
 )
 
 var (
-	cfg  *APIConfig
-	once sync.Once
+	cfg        *APIConfig
+	loadErr    error
+	loadedPath string
+	once       sync.Once
 )
 
 // APIConfig represents the root element.
 type APIConfig struct {
-	XMLName        xml.Name             `xml:"API"`
-	RequestDump    bool                 `xml:"REQUEST_DUMP,attr"`
-	Context        ContextConfig        `xml:"CONTEXT"`
-	Authentication AuthenticationConfig `xml:"AUTHENTICATION"`
-	Pagination     PaginationConfig     `xml:"PAGINATION"`
-	DB             DBConfig             `xml:"DB"`
-	Logging        LoggingConfig        `xml:"LOGGING"`
+	XMLName        xml.Name             `xml:"API" yaml:"-" json:"-"`
+	RequestDump    bool                 `xml:"REQUEST_DUMP,attr" yaml:"request_dump" json:"request_dump"`
+	Context        ContextConfig        `xml:"CONTEXT" yaml:"context" json:"context"`
+	Authentication AuthenticationConfig `xml:"AUTHENTICATION" yaml:"authentication" json:"authentication"`
+	Pagination     PaginationConfig     `xml:"PAGINATION" yaml:"pagination" json:"pagination"`
+	Registration   RegistrationConfig   `xml:"REGISTRATION" yaml:"registration" json:"registration"`
+	PasswordReset  PasswordResetConfig  `xml:"PASSWORD_RESET" yaml:"password_reset" json:"password_reset"`
+	Mail           MailConfig           `xml:"MAIL" yaml:"mail" json:"mail"`
+	Uploads        UploadsConfig        `xml:"UPLOADS" yaml:"uploads" json:"uploads"`
+	Rooms          RoomPolicyConfig     `xml:"ROOMS" yaml:"rooms" json:"rooms"`
+	Threads        ThreadsConfig        `xml:"THREADS" yaml:"threads" json:"threads"`
+	Retention      RetentionConfig      `xml:"RETENTION" yaml:"retention" json:"retention"`
+	Search         SearchConfig         `xml:"SEARCH" yaml:"search" json:"search"`
+	WebSocket      WebSocketConfig      `xml:"WEBSOCKET" yaml:"websocket" json:"websocket"`
+	RateLimit      RateLimitConfig      `xml:"RATE_LIMIT" yaml:"rate_limit" json:"rate_limit"`
+	MessageHooks   MessageHooksConfig   `xml:"MESSAGE_HOOKS" yaml:"message_hooks" json:"message_hooks"`
+	DB             DBConfig             `xml:"DB" yaml:"db" json:"db"`
+	Logging        LoggingConfig        `xml:"LOGGING" yaml:"logging" json:"logging"`
 }
 
 // ContextConfig holds basic server settings.
 type ContextConfig struct {
-	Port            int                  `xml:"PORT"`
-	Host            string               `xml:"HOST"`
-	Path            string               `xml:"PATH"`
-	TimeZone        string               `xml:"TIME_ZONE"`
-	EnableBasicAuth bool                 `xml:"ENABLE_BASIC_AUTH"`
-	Mode            string               `xml:"MODE"` // "release" or "debug"
-	TrustedProxies  TrustedProxiesConfig `xml:"TRUSTED_PROXIES"`
+	Port            int                  `xml:"PORT" yaml:"port" json:"port"`
+	Host            string               `xml:"HOST" yaml:"host" json:"host"`
+	Path            string               `xml:"PATH" yaml:"path" json:"path"`
+	TimeZone        string               `xml:"TIME_ZONE" yaml:"time_zone" json:"time_zone"`
+	EnableBasicAuth bool                 `xml:"ENABLE_BASIC_AUTH" yaml:"enable_basic_auth" json:"enable_basic_auth"`
+	Mode            string               `xml:"MODE" yaml:"mode" json:"mode"` // "release" or "debug"
+	TrustedProxies  TrustedProxiesConfig `xml:"TRUSTED_PROXIES" yaml:"trusted_proxies" json:"trusted_proxies"`
+	AllowedOrigins  AllowedOriginsConfig `xml:"ALLOWED_ORIGINS" yaml:"allowed_origins" json:"allowed_origins"`
+	LocalesDir      string               `xml:"LOCALES_DIR" yaml:"locales_dir" json:"locales_dir"` // Optional directory of <locale>.json message catalogs
+
+	// HTTPS is served when both files are set; HTTP_REDIRECT_PORT, if set, also listens for plain
+	// HTTP on that port and redirects every request to HTTPS
+	TLSCertFile      string `xml:"TLS_CERT_FILE" yaml:"tls_cert_file" json:"tls_cert_file"`
+	TLSKeyFile       string `xml:"TLS_KEY_FILE" yaml:"tls_key_file" json:"tls_key_file"`
+	HTTPRedirectPort int    `xml:"HTTP_REDIRECT_PORT" yaml:"http_redirect_port" json:"http_redirect_port"`
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (c ContextConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
 }
 
 // TrustedProxiesConfig holds a list of trusted proxy IP addresses.
 type TrustedProxiesConfig struct {
-	Proxies []string `xml:"PROXY"`
+	Proxies []string `xml:"PROXY" yaml:"proxy" json:"proxy"`
+}
+
+// AllowedOriginsConfig holds the browser origins permitted for CORS and WebSocket connections.
+// A "*" entry allows any origin, but only outside release mode.
+type AllowedOriginsConfig struct {
+	Origins []string `xml:"ORIGIN" yaml:"origin" json:"origin"`
 }
 
 // AuthenticationConfig holds authentication settings.
 type AuthenticationConfig struct {
-	MultipleSameUserSessions bool              `xml:"MULTIPLE_SAME_USER_SESSIONS,attr"`
-	EnableTokenAuth          bool              `xml:"ENABLE_TOKEN_AUTH"`
-	SessionTimeouts          map[string]int    `xml:"SESSION_TIMEOUT"`
-	SecretKeys               map[string]string `xml:"SECRET_KEY"`
+	MultipleSameUserSessions bool              `xml:"MULTIPLE_SAME_USER_SESSIONS,attr" yaml:"multiple_same_user_sessions" json:"multiple_same_user_sessions"`
+	EnableTokenAuth          bool              `xml:"ENABLE_TOKEN_AUTH" yaml:"enable_token_auth" json:"enable_token_auth"`
+	SessionTimeouts          map[string]int    `xml:"SESSION_TIMEOUT" yaml:"session_timeout" json:"session_timeout"`
+	SecretKeys               map[string]string `xml:"SECRET_KEY" yaml:"secret_key" json:"secret_key"`
 	TimeUnits                map[string]string
+	SecretSources            map[string]string // Where each secret key is read from; see ResolveSecret
 }
 
 // LoggingConfig holds logging configuration.
 type LoggingConfig struct {
 	LogDir struct {
-		Path     string `xml:",chardata"`
-		Relative bool   `xml:"RELATIVE,attr"`
-	} `xml:"LOG_DIR"`
-	MaxSizeMB    int  `xml:"MAX_SIZE_MB"`
-	MaxBackups   int  `xml:"MAX_BACKUPS"`
-	MaxAgeDays   int  `xml:"MAX_AGE_DAYS"`
-	CompressLogs bool `xml:"COMPRESS_LOGS"`
+		Path     string `xml:",chardata" yaml:"path" json:"path"`
+		Relative bool   `xml:"RELATIVE,attr" yaml:"relative" json:"relative"`
+	} `xml:"LOG_DIR" yaml:"log_dir" json:"log_dir"`
+	MaxSizeMB    int  `xml:"MAX_SIZE_MB" yaml:"max_size_mb" json:"max_size_mb"`
+	MaxBackups   int  `xml:"MAX_BACKUPS" yaml:"max_backups" json:"max_backups"`
+	MaxAgeDays   int  `xml:"MAX_AGE_DAYS" yaml:"max_age_days" json:"max_age_days"`
+	CompressLogs bool `xml:"COMPRESS_LOGS" yaml:"compress_logs" json:"compress_logs"`
+
+	// Format is "text" (the default) or "json" for one JSON object per line
+	Format string `xml:"FORMAT" yaml:"format" json:"format"`
+}
+
+// sessionTimeoutEntry and secretKeyEntry are how session timeouts and secret keys are written in
+// every config format, as lists of typed entries that AuthenticationConfig collects into maps.
+type sessionTimeoutEntry struct {
+	Type     string `xml:"TYPE,attr" yaml:"type" json:"type"`
+	TimeUnit string `xml:"TIME-UNIT,attr" yaml:"time_unit" json:"time_unit"`
+	Value    int    `xml:",chardata" yaml:"value" json:"value"`
+}
+
+type secretKeyEntry struct {
+	Type   string `xml:"TYPE,attr" yaml:"type" json:"type"`
+	Source string `xml:"SOURCE,attr" yaml:"source" json:"source"`
+	Value  string `xml:",chardata" yaml:"value" json:"value"`
 }
 
 // UnmarshalXML customizes XML parsing for AuthenticationConfig.
 func (a *AuthenticationConfig) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	type Alias AuthenticationConfig
 	aux := &struct {
-		SessionTimeouts []struct {
-			Type     string `xml:"TYPE,attr"`
-			TimeUnit string `xml:"TIME-UNIT,attr"`
-			Value    int    `xml:",chardata"`
-		} `xml:"SESSION_TIMEOUT"`
-		SecretKeys []struct {
-			Type  string `xml:"TYPE,attr"`
-			Value string `xml:",chardata"`
-		} `xml:"SECRET_KEY"`
+		SessionTimeouts []sessionTimeoutEntry `xml:"SESSION_TIMEOUT"`
+		SecretKeys      []secretKeyEntry      `xml:"SECRET_KEY"`
 		*Alias
 	}{
 		Alias: (*Alias)(a),
@@ -87,106 +130,304 @@ func (a *AuthenticationConfig) UnmarshalXML(d *xml.Decoder, start xml.StartEleme
 		return err
 	}
 
+	a.collect(aux.SessionTimeouts, aux.SecretKeys)
+	return nil
+}
+
+// collect fills the session timeout, time unit and secret key maps from their entries
+func (a *AuthenticationConfig) collect(timeouts []sessionTimeoutEntry, keys []secretKeyEntry) {
 	// Initialize maps
 	a.SessionTimeouts = make(map[string]int)
 	a.TimeUnits = make(map[string]string)
 	a.SecretKeys = make(map[string]string)
+	a.SecretSources = make(map[string]string)
 
 	// Populate session timeouts and time units
-	for _, t := range aux.SessionTimeouts {
+	for _, t := range timeouts {
 		a.SessionTimeouts[t.Type] = t.Value
 		a.TimeUnits[t.Type] = t.TimeUnit
 	}
 
 	// Populate secret keys
-	for _, k := range aux.SecretKeys {
+	for _, k := range keys {
 		a.SecretKeys[k.Type] = k.Value
+		a.SecretSources[k.Type] = k.Source
 	}
-
-	return nil
 }
 
 // PaginationConfig holds pagination settings.
 type PaginationConfig struct {
-	PageSize int `xml:"PAGE_SIZE"`
+	PageSize    int `xml:"PAGE_SIZE" yaml:"page_size" json:"page_size"`
+	MaxPageSize int `xml:"MAX_PAGE_SIZE" yaml:"max_page_size" json:"max_page_size"`
+}
+
+// Fallbacks used when the PAGINATION section leaves sizes unset
+const (
+	DefaultPageSize    = 50
+	DefaultMaxPageSize = 100
+)
+
+// PageLimit resolves a requested page size against the configured default and ceiling. Zero or
+// negative requests get the default; oversized ones are clamped to the ceiling. REST and
+// WebSocket history both page through it so their limits cannot drift apart.
+func (p PaginationConfig) PageLimit(requested int) int {
+	maxSize := p.MaxPageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPageSize
+	}
+
+	defaultSize := p.PageSize
+	if defaultSize <= 0 {
+		defaultSize = DefaultPageSize
+	}
+	if defaultSize > maxSize {
+		defaultSize = maxSize
+	}
+
+	if requested <= 0 {
+		return defaultSize
+	}
+	if requested > maxSize {
+		return maxSize
+	}
+	return requested
+}
+
+// RegistrationConfig holds sign-up policy settings.
+type RegistrationConfig struct {
+	Username       UsernamePolicyConfig `xml:"USERNAME" yaml:"username" json:"username"`
+	Password       PasswordPolicyConfig `xml:"PASSWORD" yaml:"password" json:"password"`
+	IdempotencyTTL int                  `xml:"IDEMPOTENCY_TTL" yaml:"idempotency_ttl" json:"idempotency_ttl"` // Seconds an Idempotency-Key result is kept
+	Challenge      ChallengeConfig      `xml:"CHALLENGE" yaml:"challenge" json:"challenge"`
+}
+
+// ChallengeConfig enables a CAPTCHA-style challenge that sign-ups must pass. The verify URL is
+// a siteverify endpoint such as https://hcaptcha.com/siteverify.
+type ChallengeConfig struct {
+	Enabled   bool   `xml:"ENABLED" yaml:"enabled" json:"enabled"`
+	VerifyURL string `xml:"VERIFY_URL" yaml:"verify_url" json:"verify_url"`
+	Secret    string `xml:"SECRET" yaml:"secret" json:"secret"`
+	Timeout   int    `xml:"TIMEOUT" yaml:"timeout" json:"timeout"` // Seconds to wait for the verifier
+}
+
+// UsernamePolicyConfig restricts which usernames may be registered.
+// Usernames are limited to ASCII letters, digits and the configured separators.
+type UsernamePolicyConfig struct {
+	MinLength     int      `xml:"MIN_LENGTH" yaml:"min_length" json:"min_length"`
+	MaxLength     int      `xml:"MAX_LENGTH" yaml:"max_length" json:"max_length"`
+	Separators    string   `xml:"SEPARATORS" yaml:"separators" json:"separators"`
+	ReservedNames []string `xml:"RESERVED>NAME" yaml:"reserved" json:"reserved"`
+}
+
+// PasswordResetConfig controls forgotten-password recovery. The emailed link is ResetURL with
+// the token appended as a "token" query parameter.
+type PasswordResetConfig struct {
+	TokenTTL int    `xml:"TOKEN_TTL" yaml:"token_ttl" json:"token_ttl"` // Minutes a reset token stays valid
+	ResetURL string `xml:"RESET_URL" yaml:"reset_url" json:"reset_url"` // Client page that completes the reset
+}
+
+// MailConfig holds the SMTP server used for outgoing email. With no host, email is not sent and
+// only its recipient and subject are logged.
+type MailConfig struct {
+	SMTPHost string `xml:"SMTP_HOST" yaml:"smtp_host" json:"smtp_host"`
+	SMTPPort int    `xml:"SMTP_PORT" yaml:"smtp_port" json:"smtp_port"`
+	Username string `xml:"USERNAME" yaml:"username" json:"username"`
+	Password string `xml:"PASSWORD" yaml:"password" json:"password"`
+	From     string `xml:"FROM" yaml:"from" json:"from"`
+}
+
+// UploadsConfig controls file and image attachments. Files are kept on local disk under Dir;
+// a type is accepted when it matches an ALLOWED_TYPES entry, where "image/*" matches any image.
+type UploadsConfig struct {
+	Dir          string   `xml:"DIR" yaml:"dir" json:"dir"`
+	MaxSize      int64    `xml:"MAX_SIZE" yaml:"max_size" json:"max_size"` // Maximum file size in bytes
+	AllowedTypes []string `xml:"ALLOWED_TYPES>TYPE" yaml:"allowed_types" json:"allowed_types"`
+
+	ThumbnailSize     int `xml:"THUMBNAIL_SIZE" yaml:"thumbnail_size" json:"thumbnail_size"`                // Longest side of image thumbnails in pixels
+	MaxImageDimension int `xml:"MAX_IMAGE_DIMENSION" yaml:"max_image_dimension" json:"max_image_dimension"` // Images wider or taller than this get no thumbnail
+}
+
+// PasswordPolicyConfig sets the strength rules new passwords must meet, at sign-up and when
+// a password is changed.
+type PasswordPolicyConfig struct {
+	MinLength     int  `xml:"MIN_LENGTH" yaml:"min_length" json:"min_length"`
+	RequireUpper  bool `xml:"REQUIRE_UPPER" yaml:"require_upper" json:"require_upper"`
+	RequireLower  bool `xml:"REQUIRE_LOWER" yaml:"require_lower" json:"require_lower"`
+	RequireDigit  bool `xml:"REQUIRE_DIGIT" yaml:"require_digit" json:"require_digit"`
+	RequireSymbol bool `xml:"REQUIRE_SYMBOL" yaml:"require_symbol" json:"require_symbol"`
+}
+
+// RoomPolicyConfig limits room names and descriptions, and how many rooms each user may have.
+type RoomPolicyConfig struct {
+	NameMaxLength        int `xml:"NAME_MAX_LENGTH" yaml:"name_max_length" json:"name_max_length"`
+	DescriptionMaxLength int `xml:"DESCRIPTION_MAX_LENGTH" yaml:"description_max_length" json:"description_max_length"`
+
+	AutoLeaveAfter    int `xml:"AUTO_LEAVE_AFTER" yaml:"auto_leave_after" json:"auto_leave_after"`          // Seconds of inactivity before members of opted-in rooms are removed (0 disables)
+	AutoLeaveInterval int `xml:"AUTO_LEAVE_INTERVAL" yaml:"auto_leave_interval" json:"auto_leave_interval"` // Seconds between inactivity sweeps
+
+	MaxRoomsJoined  int `xml:"MAX_ROOMS_JOINED" yaml:"max_rooms_joined" json:"max_rooms_joined"`    // Rooms a user may belong to at once (0 is unlimited)
+	MaxRoomsCreated int `xml:"MAX_ROOMS_CREATED" yaml:"max_rooms_created" json:"max_rooms_created"` // Undeleted rooms a user may have created (0 is unlimited)
+
+	// RejectUnknown answers chat messages for rooms that do not exist with room_not_found; when
+	// off they get not_a_member like any other room the sender has not joined
+	RejectUnknown bool `xml:"REJECT_UNKNOWN" yaml:"reject_unknown" json:"reject_unknown"`
+}
+
+// RetentionConfig controls the scheduled purge of old messages. Periods are per room type; a
+// period of 0 keeps that type's messages forever, and the purge is off when both are 0.
+type RetentionConfig struct {
+	PublicRooms  int  `xml:"PUBLIC_ROOMS" yaml:"public_rooms" json:"public_rooms"`    // Seconds messages in public rooms are kept
+	PrivateRooms int  `xml:"PRIVATE_ROOMS" yaml:"private_rooms" json:"private_rooms"` // Seconds messages in private rooms are kept
+	HardDelete   bool `xml:"HARD_DELETE" yaml:"hard_delete" json:"hard_delete"`       // Remove rows instead of soft-deleting them
+	Interval     int  `xml:"INTERVAL" yaml:"interval" json:"interval"`                // Seconds between purges
+}
+
+// ThreadsConfig controls which messages replies may be attached to.
+type ThreadsConfig struct {
+	AllowDeletedParent bool `xml:"ALLOW_DELETED_PARENT" yaml:"allow_deleted_parent" json:"allow_deleted_parent"` // Accept replies to deleted messages
+	MaxDepth           int  `xml:"MAX_DEPTH" yaml:"max_depth" json:"max_depth"`                                  // Maximum ancestors above a reply
+}
+
+// SearchConfig selects how message search is performed.
+type SearchConfig struct {
+	FullText bool   `xml:"FULL_TEXT" yaml:"full_text" json:"full_text"` // Use Postgres full-text search with relevance ranking
+	Language string `xml:"LANGUAGE" yaml:"language" json:"language"`    // Text search configuration, e.g. english or simple
+}
+
+// WebSocketConfig holds WebSocket transport and broadcast settings.
+type WebSocketConfig struct {
+	BroadcastQueueSize int `xml:"BROADCAST_QUEUE_SIZE" yaml:"broadcast_queue_size" json:"broadcast_queue_size"`
+	ShedHighWaterMark  int `xml:"SHED_HIGH_WATER_MARK" yaml:"shed_high_water_mark" json:"shed_high_water_mark"` // Queue length at which typing/presence events are dropped
+	MaxMessageSize     int `xml:"MAX_MESSAGE_SIZE" yaml:"max_message_size" json:"max_message_size"`             // Maximum message content size in bytes
+	WriteWait          int `xml:"WRITE_WAIT" yaml:"write_wait" json:"write_wait"`                               // Seconds allowed for a write to the peer
+	PongWait           int `xml:"PONG_WAIT" yaml:"pong_wait" json:"pong_wait"`                                  // Seconds to wait for a pong before dropping the peer
+	PingPeriod         int `xml:"PING_PERIOD" yaml:"ping_period" json:"ping_period"`                            // Seconds between pings, must be less than PONG_WAIT
+	SendBufferSize     int `xml:"SEND_BUFFER_SIZE" yaml:"send_buffer_size" json:"send_buffer_size"`             // Outgoing frames buffered per client
+
+	HeartbeatEnabled  bool `xml:"HEARTBEAT_ENABLED" yaml:"heartbeat_enabled" json:"heartbeat_enabled"`    // Send application-level heartbeat frames
+	HeartbeatInterval int  `xml:"HEARTBEAT_INTERVAL" yaml:"heartbeat_interval" json:"heartbeat_interval"` // Seconds between heartbeat frames
+
+	MemberCountEvents   bool `xml:"MEMBER_COUNT_EVENTS" yaml:"member_count_events" json:"member_count_events"`       // Broadcast live member counts on join/leave
+	MemberCountCoalesce int  `xml:"MEMBER_COUNT_COALESCE" yaml:"member_count_coalesce" json:"member_count_coalesce"` // Milliseconds over which rapid changes are merged
+
+	TypingThrottle int `xml:"TYPING_THROTTLE" yaml:"typing_throttle" json:"typing_throttle"` // Milliseconds between typing broadcasts per user and room
+	TypingTimeout  int `xml:"TYPING_TIMEOUT" yaml:"typing_timeout" json:"typing_timeout"`    // Seconds of silence before a typist is reported as stopped
+
+	MessageRate       float64 `xml:"MESSAGE_RATE" yaml:"message_rate" json:"message_rate"`                      // Incoming frames per second per connection; negative disables
+	MessageBurst      int     `xml:"MESSAGE_BURST" yaml:"message_burst" json:"message_burst"`                   // Frames a connection may send at once
+	MaxRateViolations int     `xml:"MAX_RATE_VIOLATIONS" yaml:"max_rate_violations" json:"max_rate_violations"` // Consecutive limited frames before disconnecting; negative never does
+}
+
+// RateLimitConfig holds the HTTP rate limiter settings. Anonymous callers are limited per IP,
+// authenticated callers per user ID with their own quota.
+type RateLimitConfig struct {
+	AnonRPS    float64 `xml:"ANON_RPS" yaml:"anon_rps" json:"anon_rps"`
+	AnonBurst  int     `xml:"ANON_BURST" yaml:"anon_burst" json:"anon_burst"`
+	AuthRPS    float64 `xml:"AUTH_RPS" yaml:"auth_rps" json:"auth_rps"`
+	AuthBurst  int     `xml:"AUTH_BURST" yaml:"auth_burst" json:"auth_burst"`
+	IdleTTL    int     `xml:"IDLE_TTL" yaml:"idle_ttl" json:"idle_ttl"`          // Seconds before an unused limiter is evicted
+	MaxEntries int     `xml:"MAX_ENTRIES" yaml:"max_entries" json:"max_entries"` // Tracked callers before the least recently used are evicted
+
+	// Deprecated: the single-tier keys, read as ANON_RPS and ANON_BURST when those are unset
+	RequestsPerSecond float64 `xml:"REQUESTS_PER_SECOND" yaml:"requests_per_second" json:"requests_per_second"`
+	Burst             int     `xml:"BURST" yaml:"burst" json:"burst"`
+}
+
+// MessageHooksConfig enables the built-in pre-send hooks run on every chat message and DM.
+type MessageHooksConfig struct {
+	SanitizeHTML  bool                `xml:"SANITIZE_HTML" yaml:"sanitize_html" json:"sanitize_html"`
+	ContentFilter ContentFilterConfig `xml:"CONTENT_FILTER" yaml:"content_filter" json:"content_filter"`
+}
+
+// ContentFilterConfig sets up the word-list content filter. ACTION is mask (the default),
+// reject or off; rooms can override it and block extra words of their own.
+type ContentFilterConfig struct {
+	Action string                    `xml:"ACTION" yaml:"action" json:"action"`
+	Words  []string                  `xml:"WORDS>WORD" yaml:"words" json:"words"`
+	Rooms  []RoomContentFilterConfig `xml:"ROOM" yaml:"room" json:"room"`
+}
+
+// RoomContentFilterConfig overrides the content filter in one room. An empty ACTION keeps the
+// global one; the room's words are blocked in addition to the global list.
+type RoomContentFilterConfig struct {
+	ID     string   `xml:"ID,attr" yaml:"id" json:"id"`
+	Action string   `xml:"ACTION" yaml:"action" json:"action"`
+	Words  []string `xml:"WORDS>WORD" yaml:"words" json:"words"`
 }
 
 // DBConfig holds database connection settings.
 type DBConfig struct {
-	Initialize bool         `xml:"INITIALIZE"`
-	Server     string       `xml:"SERVER"`
-	Host       string       `xml:"HOST"`
-	Port       int          `xml:"PORT"`
-	Driver     string       `xml:"DRIVER"`
-	SSLMode    string       `xml:"SSL_MODE"`
-	Names      DBNames      `xml:"NAMES"`
-	Username   string       `xml:"USERNAME"`
-	Password   DBPassword   `xml:"PASSWORD"`
-	Pool       DBPoolConfig `xml:"POOL"`
+	Initialize bool         `xml:"INITIALIZE" yaml:"initialize" json:"initialize"`
+	Server     string       `xml:"SERVER" yaml:"server" json:"server"`
+	Host       string       `xml:"HOST" yaml:"host" json:"host"`
+	Port       int          `xml:"PORT" yaml:"port" json:"port"`
+	Driver     string       `xml:"DRIVER" yaml:"driver" json:"driver"`
+	SSLMode    string       `xml:"SSL_MODE" yaml:"ssl_mode" json:"ssl_mode"`
+	Names      DBNames      `xml:"NAMES" yaml:"names" json:"names"`
+	Username   string       `xml:"USERNAME" yaml:"username" json:"username"`
+	Password   DBPassword   `xml:"PASSWORD" yaml:"password" json:"password"`
+	Pool       DBPoolConfig `xml:"POOL" yaml:"pool" json:"pool"`
 }
 
 // DBNames holds the names defined in the DB section.
 type DBNames struct {
-	LIVECHAT string `xml:"LIVECHAT,attr"`
+	LIVECHAT string `xml:"LIVECHAT,attr" yaml:"livechat" json:"livechat"`
 }
 
-// DBPassword holds password details.
+// DBPassword holds password details. Type says how Value is resolved: plain, env or file.
 type DBPassword struct {
-	Type  string `xml:"TYPE,attr"`
-	Value string `xml:",chardata"`
+	Type  string `xml:"TYPE,attr" yaml:"type" json:"type"`
+	Value string `xml:",chardata" yaml:"value" json:"value"`
 }
 
 // DBPoolConfig holds database connection pooling settings.
 type DBPoolConfig struct {
-	MaxOpenConns    int `xml:"MAX_OPEN_CONNS"`
-	MaxIdleConns    int `xml:"MAX_IDLE_CONNS"`
-	ConnMaxLifetime int `xml:"CONN_MAX_LIFETIME"`
+	MaxOpenConns    int `xml:"MAX_OPEN_CONNS" yaml:"max_open_conns" json:"max_open_conns"`
+	MaxIdleConns    int `xml:"MAX_IDLE_CONNS" yaml:"max_idle_conns" json:"max_idle_conns"`
+	ConnMaxLifetime int `xml:"CONN_MAX_LIFETIME" yaml:"conn_max_lifetime" json:"conn_max_lifetime"`
 }
 
-// LoadConfig loads and parses the XML configuration from the given file.
-func LoadConfig(xmlPath string) (*APIConfig, error) {
+// LoadConfig loads the configuration once, caching it for GetConfig; later calls return the
+// cached result whatever path they name. Use LoadConfigFrom to load a file independently.
+func LoadConfig(path string) (*APIConfig, error) {
 	once.Do(func() {
-		f, err := os.Open(xmlPath)
-		if err == nil {
-			defer func(f *os.File) {
-				if err := f.Close(); err != nil {
-					Log.Error("failed to close file: %v", err)
-				}
-			}(f)
-
-			data, err := io.ReadAll(f)
-			if err == nil {
-				var newCfg APIConfig
-				if err := xml.Unmarshal(data, &newCfg); err == nil {
-					cfg = &newCfg
-					return
-				}
-			}
-		}
-
-		// If XML file is not found, try loading from .env
-		Log.Warn("Config file not found, attempting to load from environment...")
-
-		_ = godotenv.Load() // Load .env file if present
-		xmlConfig := os.Getenv("CONFIG_XML")
-
-		if xmlConfig == "" {
-			fmt.Println("No XML configuration found in environment variables")
-			return
-		}
-
-		var newCfg APIConfig
-		if err := xml.Unmarshal([]byte(xmlConfig), &newCfg); err == nil {
-			cfg = &newCfg
-		}
+		loadedPath = path
+		cfg, loadErr = LoadConfigFrom(path)
 	})
 
-	if cfg == nil {
-		return nil, os.ErrInvalid
+	if path != loadedPath {
+		Log.Warn("Config already loaded from %s, ignoring %s", loadedPath, path)
+	}
+	if loadErr != nil {
+		return nil, loadErr
 	}
 	return cfg, nil
 }
 
+// LoadConfigFrom loads and parses the configuration from the given file, in the format its
+// extension names (see FormatOf), without touching the cached configuration. When the file does
+// not exist it falls back to XML in the CONFIG_XML environment variable (or .env).
+func LoadConfigFrom(path string) (*APIConfig, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return parseConfig(data, path, FormatOf(path))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// If the file is not found, try loading from .env
+	Log.Warn("Config file not found, attempting to load from environment...")
+
+	_ = godotenv.Load() // Load .env file if present
+	xmlConfig := os.Getenv("CONFIG_XML")
+
+	if xmlConfig == "" {
+		return nil, fmt.Errorf("%s not found and CONFIG_XML is not set", path)
+	}
+	return parseConfig([]byte(xmlConfig), "CONFIG_XML", FormatXML)
+}
+
 // GetConfig returns the loaded configuration.
 func GetConfig() *APIConfig {
 	return cfg
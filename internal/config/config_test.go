@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFromLoadsEachFile(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.xml")
+	second := filepath.Join(dir, "second.yaml")
+	if err := os.WriteFile(first, []byte(`<API><CONTEXT><PORT>8080</PORT></CONTEXT></API>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("context:\n  port: 9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading one file must not stop the next from being read, in either order
+	for _, load := range []struct {
+		path string
+		port int
+	}{{first, 8080}, {second, 9090}, {first, 8080}} {
+		cfg, err := LoadConfigFrom(load.path)
+		if err != nil {
+			t.Fatalf("LoadConfigFrom(%s): %v", load.path, err)
+		}
+		if cfg.Context.Port != load.port {
+			t.Fatalf("LoadConfigFrom(%s) port = %d, want %d", load.path, cfg.Context.Port, load.port)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+import "testing"
+
+// The shipped example must start as copied, without environment variables or secret files
+func TestExampleConfigLoads(t *testing.T) {
+	cfg, err := LoadConfigFrom("../../config-example.xml")
+	if err != nil {
+		t.Fatalf("LoadConfigFrom: %v", err)
+	}
+	if err := cfg.ResolveSecrets(); err != nil {
+		t.Fatalf("ResolveSecrets: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats, chosen by file extension
+const (
+	FormatXML  = "xml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// FormatOf returns the config format for path's extension: YAML for .yaml and .yml, JSON for
+// .json, and XML for anything else.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatXML
+	}
+}
+
+// parseConfig decodes configuration in the given format, naming source in any error. YAML and JSON
+// use the lowercased XML element names as keys and reject keys that match no setting.
+func parseConfig(data []byte, source, format string) (*APIConfig, error) {
+	var newCfg APIConfig
+	var err error
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&newCfg)
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&newCfg)
+	default:
+		err = xml.Unmarshal(data, &newCfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	return &newCfg, nil
+}
+
+// authenticationDocument is AuthenticationConfig as written in YAML and JSON, with session
+// timeouts and secret keys listed as entries the way the XML format has them
+type authenticationDocument struct {
+	MultipleSameUserSessions bool                  `yaml:"multiple_same_user_sessions" json:"multiple_same_user_sessions"`
+	EnableTokenAuth          bool                  `yaml:"enable_token_auth" json:"enable_token_auth"`
+	SessionTimeouts          []sessionTimeoutEntry `yaml:"session_timeout" json:"session_timeout"`
+	SecretKeys               []secretKeyEntry      `yaml:"secret_key" json:"secret_key"`
+}
+
+// UnmarshalYAML customizes YAML parsing for AuthenticationConfig.
+func (a *AuthenticationConfig) UnmarshalYAML(value *yaml.Node) error {
+	// Node.Decode ignores the decoder's KnownFields, so unknown keys are checked here
+	if err := checkYAMLKeys(value, reflect.TypeOf(authenticationDocument{})); err != nil {
+		return err
+	}
+	var doc authenticationDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	a.fromDocument(doc)
+	return nil
+}
+
+// checkYAMLKeys rejects keys in node, or in the mappings nested in it, that name no yaml field
+// of the struct type t describes
+func checkYAMLKeys(node *yaml.Node, t reflect.Type) error {
+	switch {
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				return fmt.Errorf("line %d: unknown key %q in authentication", key.Line, key.Value)
+			}
+			if err := checkYAMLKeys(node.Content[i+1], fieldType); err != nil {
+				return err
+			}
+		}
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			if err := checkYAMLKeys(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON customizes JSON parsing for AuthenticationConfig.
+func (a *AuthenticationConfig) UnmarshalJSON(data []byte) error {
+	var doc authenticationDocument
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+	a.fromDocument(doc)
+	return nil
+}
+
+func (a *AuthenticationConfig) fromDocument(doc authenticationDocument) {
+	a.MultipleSameUserSessions = doc.MultipleSameUserSessions
+	a.EnableTokenAuth = doc.EnableTokenAuth
+	a.collect(doc.SessionTimeouts, doc.SecretKeys)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const xmlConfig = `<API REQUEST_DUMP="true">
+    <CONTEXT>
+        <PORT>8080</PORT>
+        <MODE>release</MODE>
+        <ALLOWED_ORIGINS>
+            <ORIGIN>https://chat.example.com</ORIGIN>
+        </ALLOWED_ORIGINS>
+    </CONTEXT>
+    <AUTHENTICATION MULTIPLE_SAME_USER_SESSIONS="true">
+        <ENABLE_TOKEN_AUTH>true</ENABLE_TOKEN_AUTH>
+        <SESSION_TIMEOUT TYPE="ACCESS" TIME-UNIT="MINUTES">15</SESSION_TIMEOUT>
+        <SESSION_TIMEOUT TYPE="REFRESH" TIME-UNIT="HOURS">168</SESSION_TIMEOUT>
+        <SECRET_KEY TYPE="ACCESS" SOURCE="env">ACCESS_SECRET</SECRET_KEY>
+        <SECRET_KEY TYPE="REFRESH" SOURCE="env">REFRESH_SECRET</SECRET_KEY>
+    </AUTHENTICATION>
+    <RATE_LIMIT>
+        <ANON_RPS>5</ANON_RPS>
+        <ANON_BURST>10</ANON_BURST>
+    </RATE_LIMIT>
+</API>`
+
+const yamlConfig = `request_dump: true
+context:
+  port: 8080
+  mode: release
+  allowed_origins:
+    origin: [https://chat.example.com]
+authentication:
+  multiple_same_user_sessions: true
+  enable_token_auth: true
+  session_timeout:
+    - {type: ACCESS, time_unit: MINUTES, value: 15}
+    - {type: REFRESH, time_unit: HOURS, value: 168}
+  secret_key:
+    - {type: ACCESS, source: env, value: ACCESS_SECRET}
+    - {type: REFRESH, source: env, value: REFRESH_SECRET}
+rate_limit:
+  anon_rps: 5
+  anon_burst: 10
+`
+
+const jsonConfig = `{
+  "request_dump": true,
+  "context": {"port": 8080, "mode": "release", "allowed_origins": {"origin": ["https://chat.example.com"]}},
+  "authentication": {
+    "multiple_same_user_sessions": true,
+    "enable_token_auth": true,
+    "session_timeout": [
+      {"type": "ACCESS", "time_unit": "MINUTES", "value": 15},
+      {"type": "REFRESH", "time_unit": "HOURS", "value": 168}
+    ],
+    "secret_key": [
+      {"type": "ACCESS", "source": "env", "value": "ACCESS_SECRET"},
+      {"type": "REFRESH", "source": "env", "value": "REFRESH_SECRET"}
+    ]
+  },
+  "rate_limit": {"anon_rps": 5, "anon_burst": 10}
+}`
+
+func TestParseConfigFormatsAgree(t *testing.T) {
+	fromXML, err := parseConfig([]byte(xmlConfig), "config.xml", FormatXML)
+	if err != nil {
+		t.Fatalf("xml: %v", err)
+	}
+	if fromXML.Authentication.SessionTimeouts["REFRESH"] != 168 || fromXML.Authentication.SecretSources["ACCESS"] != "env" {
+		t.Fatalf("xml authentication parsed as %+v", fromXML.Authentication)
+	}
+
+	for _, format := range []struct{ name, data string }{{FormatYAML, yamlConfig}, {FormatJSON, jsonConfig}} {
+		parsed, err := parseConfig([]byte(format.data), "config."+format.name, format.name)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		parsed.XMLName = fromXML.XMLName
+		if !reflect.DeepEqual(parsed, fromXML) {
+			t.Errorf("%s config differs from xml:\n%+v\n%+v", format.name, parsed, fromXML)
+		}
+	}
+}
+
+func TestParseConfigRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name, format, data, want string
+	}{
+		{"yaml top level", FormatYAML, "contxt:\n  port: 1\n", "contxt"},
+		{"yaml authentication", FormatYAML, "authentication:\n  enable_token_auht: true\n", "enable_token_auht"},
+		{"yaml authentication entry", FormatYAML, "authentication:\n  secret_key:\n    - {type: ACCESS, sauce: env}\n", "sauce"},
+		{"json authentication", FormatJSON, `{"authentication": {"session_timeouts": []}}`, "session_timeouts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tt.data), "config", tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("parseConfig() = %v, want an error naming %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"config.yml": FormatYAML, "config.YAML": FormatYAML, "config.json": FormatJSON, "config.xml": FormatXML, "config": FormatXML,
+	} {
+		if got := FormatOf(path); got != want {
+			t.Errorf("FormatOf(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sources a secret value in the config can be read from
+const (
+	SecretPlain = "plain" // The value is the secret itself
+	SecretEnv   = "env"   // The value names an environment variable holding the secret
+	SecretFile  = "file"  // The value is the path of a file holding the secret
+)
+
+// ResolveSecret returns the secret that value refers to under the given source. An empty source,
+// and the legacy UNENCRYPTED type, mean plain. A trailing newline in a secret file is dropped.
+func ResolveSecret(source, value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(source)) {
+	case "", SecretPlain, "unencrypted":
+		return value, nil
+	case SecretEnv:
+		name := strings.TrimSpace(value)
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return secret, nil
+	case SecretFile:
+		path := strings.TrimSpace(value)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		secret := strings.TrimRight(string(data), "\r\n")
+		if secret == "" {
+			return "", fmt.Errorf("secret file %s is empty", path)
+		}
+		return secret, nil
+	default:
+		return "", fmt.Errorf("unknown secret type %q, expected plain, env or file", source)
+	}
+}
+
+// ResolveSecrets replaces the DB password and the secret keys with the secrets they refer to,
+// marking each as plain afterwards so that resolving again changes nothing.
+func (c *APIConfig) ResolveSecrets() error {
+	password, err := ResolveSecret(c.DB.Password.Type, c.DB.Password.Value)
+	if err != nil {
+		return fmt.Errorf("DB password: %w", err)
+	}
+	c.DB.Password = DBPassword{Type: SecretPlain, Value: password}
+
+	for name, value := range c.Authentication.SecretKeys {
+		key, err := ResolveSecret(c.Authentication.SecretSources[name], value)
+		if err != nil {
+			return fmt.Errorf("%s secret key: %w", name, err)
+		}
+		c.Authentication.SecretKeys[name] = key
+		if c.Authentication.SecretSources != nil {
+			c.Authentication.SecretSources[name] = SecretPlain
+		}
+	}
+	return nil
+}
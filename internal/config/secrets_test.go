@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("LIVE_CHAT_TEST_SECRET", "from-env")
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"plain", SecretPlain, "literal", "literal", false},
+		{"empty source is plain", "", "literal", "literal", false},
+		{"legacy unencrypted is plain", "UNENCRYPTED", "literal", "literal", false},
+		{"env", SecretEnv, "LIVE_CHAT_TEST_SECRET", "from-env", false},
+		{"unset env", SecretEnv, "LIVE_CHAT_TEST_UNSET", "", true},
+		{"file drops the trailing newline", SecretFile, secretFile, "from-file", false},
+		{"missing file", SecretFile, filepath.Join(dir, "missing"), "", true},
+		{"empty file", SecretFile, emptyFile, "", true},
+		{"unknown source", "vault", "path", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSecret(tt.source, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSecret error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ResolveSecret = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretsReplacesPasswordAndKeys(t *testing.T) {
+	t.Setenv("LIVE_CHAT_TEST_DB_PASSWORD", "db-secret")
+	t.Setenv("LIVE_CHAT_TEST_REFRESH", "refresh-secret")
+
+	cfg := &APIConfig{}
+	cfg.DB.Password = DBPassword{Type: SecretEnv, Value: "LIVE_CHAT_TEST_DB_PASSWORD"}
+	cfg.Authentication.SecretKeys = map[string]string{"ACCESS": "access-secret", "REFRESH": "LIVE_CHAT_TEST_REFRESH"}
+	cfg.Authentication.SecretSources = map[string]string{"ACCESS": SecretPlain, "REFRESH": SecretEnv}
+
+	if err := cfg.ResolveSecrets(); err != nil {
+		t.Fatalf("ResolveSecrets: %v", err)
+	}
+	if cfg.DB.Password.Value != "db-secret" || cfg.Authentication.SecretKeys["REFRESH"] != "refresh-secret" {
+		t.Fatalf("secrets not resolved: %+v, %v", cfg.DB.Password, cfg.Authentication.SecretKeys)
+	}
+
+	// Resolved secrets are marked plain, so resolving again is harmless
+	if err := cfg.ResolveSecrets(); err != nil || cfg.Authentication.SecretKeys["REFRESH"] != "refresh-secret" {
+		t.Fatalf("second ResolveSecrets = %v, keys %v", err, cfg.Authentication.SecretKeys)
+	}
+}
+
+func TestResolveSecretsNamesTheFailingSecret(t *testing.T) {
+	cfg := &APIConfig{}
+	cfg.DB.Password = DBPassword{Type: SecretEnv, Value: "LIVE_CHAT_TEST_UNSET"}
+
+	err := cfg.ResolveSecrets()
+	if err == nil || !strings.HasPrefix(err.Error(), "DB password") {
+		t.Fatalf("ResolveSecrets = %v, want an error naming the DB password", err)
+	}
+}
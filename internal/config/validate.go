@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sessionTypes are the session timeouts and secret keys the authentication section must define
+var sessionTypes = []string{"ACCESS", "REFRESH"}
+
+// defaultPongWait is the pong wait in seconds used when WEBSOCKET/PONG_WAIT is unset, matching
+// pkg.DefaultPongWait
+const defaultPongWait = 60
+
+// Validate checks the settings the server cannot start without and returns every problem found,
+// joined into one error, naming the element to fix. Secrets are checked as resolved, so call it
+// after ResolveSecrets.
+func (c *APIConfig) Validate() error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Context.Port < 1 || c.Context.Port > 65535 {
+		add("CONTEXT/PORT must be between 1 and 65535, got %d", c.Context.Port)
+	}
+	if c.Context.Mode != "release" && c.Context.Mode != "debug" {
+		add("CONTEXT/MODE must be release or debug, got %q", c.Context.Mode)
+	}
+	if (c.Context.TLSCertFile == "") != (c.Context.TLSKeyFile == "") {
+		add("CONTEXT/TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	for _, file := range []string{c.Context.TLSCertFile, c.Context.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			add("CONTEXT TLS file %s cannot be read: %v", file, err)
+		}
+	}
+	if port := c.Context.HTTPRedirectPort; port != 0 {
+		if !c.Context.TLSEnabled() {
+			add("CONTEXT/HTTP_REDIRECT_PORT needs TLS_CERT_FILE and TLS_KEY_FILE")
+		} else if port < 1 || port > 65535 || port == c.Context.Port {
+			add("CONTEXT/HTTP_REDIRECT_PORT must be between 1 and 65535 and differ from PORT, got %d", port)
+		}
+	}
+
+	for _, name := range sessionTypes {
+		timeout, ok := c.Authentication.SessionTimeouts[name]
+		if !ok {
+			add("AUTHENTICATION/SESSION_TIMEOUT with TYPE=%q is missing", name)
+		} else if timeout <= 0 {
+			add("AUTHENTICATION/SESSION_TIMEOUT %s must be positive, got %d", name, timeout)
+		}
+		switch unit := c.Authentication.TimeUnits[name]; unit {
+		case "SECONDS", "MINUTES", "HOURS", "":
+		default:
+			add("AUTHENTICATION/SESSION_TIMEOUT %s TIME-UNIT must be SECONDS, MINUTES or HOURS, got %q", name, unit)
+		}
+		if strings.TrimSpace(c.Authentication.SecretKeys[name]) == "" {
+			add("AUTHENTICATION/SECRET_KEY with TYPE=%q is missing or empty", name)
+		}
+	}
+
+	if c.Pagination.PageSize < 0 || c.Pagination.MaxPageSize < 0 {
+		add("PAGINATION/PAGE_SIZE and MAX_PAGE_SIZE cannot be negative")
+	} else if c.Pagination.MaxPageSize > 0 && c.Pagination.PageSize > c.Pagination.MaxPageSize {
+		add("PAGINATION/PAGE_SIZE (%d) cannot exceed MAX_PAGE_SIZE (%d)", c.Pagination.PageSize, c.Pagination.MaxPageSize)
+	}
+
+	if strings.TrimSpace(c.DB.Host) == "" {
+		add("DB/HOST is required")
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		add("DB/PORT must be between 1 and 65535, got %d", c.DB.Port)
+	}
+	if strings.TrimSpace(c.DB.Names.LIVECHAT) == "" {
+		add("DB/NAMES LIVECHAT attribute is required")
+	}
+	if strings.TrimSpace(c.DB.Username) == "" {
+		add("DB/USERNAME is required")
+	}
+
+	ws := c.WebSocket
+	if ws.PingPeriod != 0 {
+		pongWait := defaultPongWait
+		if ws.PongWait > 0 {
+			pongWait = ws.PongWait
+		}
+		if ws.PingPeriod < 0 || ws.PingPeriod >= pongWait {
+			add("WEBSOCKET/PING_PERIOD must be positive and less than PONG_WAIT (%d), got %d", pongWait, ws.PingPeriod)
+		}
+	}
+	if ws.SendBufferSize < 0 || ws.MaxMessageSize < 0 {
+		add("WEBSOCKET/SEND_BUFFER_SIZE and MAX_MESSAGE_SIZE cannot be negative")
+	}
+	if ws.HeartbeatEnabled && ws.HeartbeatInterval < 0 {
+		add("WEBSOCKET/HEARTBEAT_INTERVAL cannot be negative, got %d", ws.HeartbeatInterval)
+	}
+	if ws.MessageBurst < 0 && ws.MessageRate >= 0 {
+		add("WEBSOCKET/MESSAGE_BURST must be positive while a MESSAGE_RATE applies, got %d", ws.MessageBurst)
+	}
+
+	pool := c.DB.Pool
+	if pool.MaxOpenConns < 0 || pool.MaxIdleConns < 0 || pool.ConnMaxLifetime < 0 {
+		add("DB/POOL values cannot be negative")
+	} else if pool.MaxOpenConns > 0 && pool.MaxIdleConns > pool.MaxOpenConns {
+		add("DB/POOL/MAX_IDLE_CONNS (%d) cannot exceed MAX_OPEN_CONNS (%d)", pool.MaxIdleConns, pool.MaxOpenConns)
+	}
+
+	if c.Logging.MaxSizeMB <= 0 {
+		add("LOGGING/MAX_SIZE_MB must be positive, got %d", c.Logging.MaxSizeMB)
+	}
+	if c.Logging.MaxBackups < 0 || c.Logging.MaxAgeDays < 0 {
+		add("LOGGING/MAX_BACKUPS and MAX_AGE_DAYS cannot be negative")
+	}
+	if format := c.Logging.Format; format != "" && format != "text" && format != "json" {
+		add("LOGGING/FORMAT must be text or json, got %q", format)
+	}
+
+	if challenge := c.Registration.Challenge; challenge.Enabled && (challenge.VerifyURL == "" || challenge.Secret == "") {
+		add("REGISTRATION/CHALLENGE is enabled but VERIFY_URL or SECRET is missing")
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig returns a config that passes Validate, for tests to break one setting at a time
+func validConfig() *APIConfig {
+	c := &APIConfig{}
+	c.Context.Port = 8080
+	c.Context.Mode = "release"
+	c.Authentication.SessionTimeouts = map[string]int{"ACCESS": 15, "REFRESH": 7}
+	c.Authentication.TimeUnits = map[string]string{"ACCESS": "MINUTES", "REFRESH": "HOURS"}
+	c.Authentication.SecretKeys = map[string]string{"ACCESS": "access-secret", "REFRESH": "refresh-secret"}
+	c.DB.Host = "localhost"
+	c.DB.Port = 5432
+	c.DB.Names.LIVECHAT = "livechat"
+	c.DB.Username = "chat"
+	c.Logging.MaxSizeMB = 10
+	return c
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+}
+
+func TestValidateReportsEachProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *APIConfig)
+		want   string
+	}{
+		{"port", func(c *APIConfig) { c.Context.Port = 70000 }, "CONTEXT/PORT"},
+		{"mode", func(c *APIConfig) { c.Context.Mode = "prod" }, "CONTEXT/MODE"},
+		{"tls pair", func(c *APIConfig) { c.Context.TLSCertFile = "cert.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE"},
+		{"redirect without tls", func(c *APIConfig) { c.Context.HTTPRedirectPort = 80 }, "CONTEXT/HTTP_REDIRECT_PORT"},
+		{"session timeout", func(c *APIConfig) { delete(c.Authentication.SessionTimeouts, "ACCESS") }, `SESSION_TIMEOUT with TYPE="ACCESS"`},
+		{"time unit", func(c *APIConfig) { c.Authentication.TimeUnits["REFRESH"] = "DAYS" }, "TIME-UNIT"},
+		{"page size", func(c *APIConfig) {
+			c.Pagination.PageSize = 200
+			c.Pagination.MaxPageSize = 100
+		}, "PAGINATION/PAGE_SIZE"},
+		{"db host", func(c *APIConfig) { c.DB.Host = "" }, "DB/HOST"},
+		{"db port", func(c *APIConfig) { c.DB.Port = 0 }, "DB/PORT"},
+		{"db name", func(c *APIConfig) { c.DB.Names.LIVECHAT = "" }, "DB/NAMES"},
+		{"log size", func(c *APIConfig) { c.Logging.MaxSizeMB = 0 }, "LOGGING/MAX_SIZE_MB"},
+		{"log backups", func(c *APIConfig) { c.Logging.MaxBackups = -1 }, "LOGGING/MAX_BACKUPS"},
+		{"log format", func(c *APIConfig) { c.Logging.Format = "xml" }, "LOGGING/FORMAT"},
+		{"challenge", func(c *APIConfig) { c.Registration.Challenge.Enabled = true }, "REGISTRATION/CHALLENGE"},
+		{"ping period", func(c *APIConfig) { c.WebSocket.PingPeriod = 60 }, "WEBSOCKET/PING_PERIOD"},
+		{"ping period over pong wait", func(c *APIConfig) {
+			c.WebSocket.PongWait = 20
+			c.WebSocket.PingPeriod = 30
+		}, "WEBSOCKET/PING_PERIOD"},
+		{"send buffer", func(c *APIConfig) { c.WebSocket.SendBufferSize = -1 }, "WEBSOCKET/SEND_BUFFER_SIZE"},
+		{"message burst", func(c *APIConfig) { c.WebSocket.MessageBurst = -1 }, "WEBSOCKET/MESSAGE_BURST"},
+		{"secret key", func(c *APIConfig) { c.Authentication.SecretKeys["REFRESH"] = " " }, `TYPE="REFRESH"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() = %v, want an error mentioning %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAllowsDisabledMessageRateWithoutBurst(t *testing.T) {
+	c := validConfig()
+	c.WebSocket.MessageRate = -1
+	c.WebSocket.MessageBurst = -1
+	if err := c.Validate(); err != nil {
+		t.Fatalf("burst checked although the message rate is disabled: %v", err)
+	}
+}
+
+func TestValidateReportsAllProblemsTogether(t *testing.T) {
+	c := validConfig()
+	c.Context.Port = 0
+	c.DB.Host = ""
+	c.Authentication.SecretKeys = nil
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("malformed config accepted")
+	}
+	for _, want := range []string{"CONTEXT/PORT", "DB/HOST", `SECRET_KEY with TYPE="ACCESS"`, `SECRET_KEY with TYPE="REFRESH"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	Log "live-chatter/pkg/logger"
+	"net/http"
+	"strconv"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	AdminService service.AdminService
+	Pagination   config.PaginationConfig
+}
+
+func NewAdminController(adminService service.AdminService, pagination config.PaginationConfig) *AdminController {
+	return &AdminController{AdminService: adminService, Pagination: pagination}
+}
+
+// GetActivityLogs returns a page of the activity log, optionally filtered by user and action
+func (ac *AdminController) GetActivityLogs(c *gin.Context) {
+	var filter repository.ActivityLogFilter
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+	filter.Action = c.Query("action")
+
+	limit := resolvePageLimit(c.Query("limit"), ac.Pagination)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	logs, total, err := ac.AdminService.GetActivityLogs(filter, limit, offset)
+	if err != nil {
+		Log.Error("Error getting activity logs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":   logs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetServerStats returns live connection, room and broadcast counts
+func (ac *AdminController) GetServerStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"stats": ac.AdminService.GetServerStats()})
+}
+
+// GetDatabaseStats returns the database connection pool statistics, for watching pool pressure
+func (ac *AdminController) GetDatabaseStats(c *gin.Context) {
+	stats, err := ac.AdminService.GetDatabaseStats()
+	if err != nil {
+		Log.Error("Error getting database pool stats: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database stats unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
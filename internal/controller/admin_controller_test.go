@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/service"
+	"live-chatter/pkg/db"
+)
+
+// unavailableDatabase has no pool to report on
+type unavailableDatabase struct{}
+
+func (unavailableDatabase) PoolStats() (db.PoolStats, error) {
+	return db.PoolStats{}, errors.New("database connection is not initialized")
+}
+
+func TestDatabaseStatsReportEveryPoolField(t *testing.T) {
+	ac := NewAdminController(service.NewAdminService(nil, nil, stubDatabase{}), config.PaginationConfig{})
+	code, body := serveHealth(t, ac.GetDatabaseStats)
+	if code != http.StatusOK {
+		t.Fatalf("got %d %v, want 200", code, body)
+	}
+
+	stats, _ := body["stats"].(map[string]any)
+	for _, field := range []string{
+		"max_open_connections", "open_connections", "in_use", "idle", "wait_count",
+		"wait_duration_ms", "max_idle_closed", "max_idle_time_closed", "max_lifetime_closed",
+	} {
+		if _, ok := stats[field].(float64); !ok {
+			t.Errorf("stats[%q] = %v, want a number", field, stats[field])
+		}
+	}
+	if stats["open_connections"] != float64(3) || stats["in_use"] != float64(1) {
+		t.Fatalf("stats = %v, want the values reported by the pool", stats)
+	}
+}
+
+func TestDatabaseStatsWithoutADatabase(t *testing.T) {
+	ac := NewAdminController(service.NewAdminService(nil, nil, unavailableDatabase{}), config.PaginationConfig{})
+	if code, body := serveHealth(t, ac.GetDatabaseStats); code != http.StatusServiceUnavailable || body["error"] == nil {
+		t.Fatalf("got %d %v, want 503 with an error", code, body)
+	}
+}
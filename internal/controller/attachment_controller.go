@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	Log "live-chatter/pkg/logger"
+	"mime"
+	"net/http"
+	"strings"
+
+	"live-chatter/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead allows for the form fields and boundaries around an uploaded file
+const multipartOverhead = 1 << 20
+
+type AttachmentController struct {
+	AttachmentService service.AttachmentService
+}
+
+func NewAttachmentController(attachmentService service.AttachmentService) *AttachmentController {
+	return &AttachmentController{AttachmentService: attachmentService}
+}
+
+// Upload stores a multipart "file" for the room named by the "room_id" field and returns the
+// attachment, whose ID can then be sent with a message
+func (ac *AttachmentController) Upload(c *gin.Context) {
+	maxSize := ac.AttachmentService.MaxSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAttachmentTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAttachmentTooLarge.Error()})
+		return
+	}
+
+	roomID := c.PostForm("room_id")
+	if roomID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		Log.Error("Error opening uploaded file: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file"})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := ac.AttachmentService.Upload(roomID, c.GetUint("user_id"), header.Filename, file)
+	if err != nil {
+		Log.Error("Error uploading attachment to room %s: %v", roomID, err)
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+}
+
+// Download streams an attachment to a member of its room. Range requests are honoured so media
+// can be seeked; images are shown inline and everything else is offered as a download.
+// ?size=thumb serves the thumbnail of an image instead. Like exports, downloads extend their write
+// deadline as they go rather than being bound by the server's WriteTimeout.
+func (ac *AttachmentController) Download(c *gin.Context) {
+	attachmentID := c.Param("attachmentId")
+	size := c.Query("size")
+	if size != "" && size != "thumb" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be thumb"})
+		return
+	}
+	thumb := size == "thumb"
+
+	attachment, content, err := ac.AttachmentService.Open(attachmentID, c.GetUint("user_id"), thumb)
+	if err != nil {
+		Log.Error("Error opening attachment %s: %v", attachmentID, err)
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+
+	contentType := attachment.ContentType
+	if thumb {
+		contentType = attachment.ThumbnailType
+	}
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}); formatted != "" {
+		disposition = formatted
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", disposition)
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(newDeadlineWriter(c.Writer), c.Request, attachment.FileName, attachment.CreatedAt, content)
+}
+
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrAttachmentType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrRoomNotFound),
+		errors.Is(err, service.ErrAttachmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrNotRoomMember):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/internal/service"
+	"live-chatter/pkg/model"
+	"live-chatter/pkg/storage"
+	"live-chatter/pkg/thumbnail"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryAttachmentRepository keeps attachment rows in memory
+type memoryAttachmentRepository struct {
+	mu          sync.Mutex
+	attachments map[string]model.Attachment
+}
+
+func (r *memoryAttachmentRepository) CreateAttachment(attachment *model.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.attachments == nil {
+		r.attachments = make(map[string]model.Attachment)
+	}
+	r.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+func (r *memoryAttachmentRepository) GetAttachment(attachmentID string) (*model.Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attachment, ok := r.attachments[attachmentID]
+	if !ok {
+		return nil, nil
+	}
+	return &attachment, nil
+}
+
+// memberRoomRepository knows the rooms named in members and who belongs to each
+type memberRoomRepository struct {
+	repository.RoomRepository
+	members map[string][]uint
+}
+
+func (r *memberRoomRepository) GetRoomByID(roomID string) (*model.Room, error) {
+	if _, ok := r.members[roomID]; !ok {
+		return nil, nil
+	}
+	return &model.Room{ID: roomID}, nil
+}
+
+func (r *memberRoomRepository) IsUserInRoom(roomID string, userID uint) (bool, error) {
+	for _, member := range r.members[roomID] {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// attachmentRouter serves uploads and downloads from a temporary directory to the user named by
+// the X-User-ID header. Users 1 and 2 belong to the lobby.
+func attachmentRouter(t *testing.T, uploads config.UploadsConfig, processor thumbnail.Processor) (*gin.Engine, *memoryAttachmentRepository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachments := &memoryAttachmentRepository{}
+	rooms := &memberRoomRepository{members: map[string][]uint{"lobby": {1, 2}}}
+	ac := NewAttachmentController(service.NewAttachmentService(attachments, rooms, store, processor, uploads))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+		c.Set("user_id", uint(userID))
+	})
+	router.POST("/upload", ac.Upload)
+	router.GET("/download/:attachmentId", ac.Download)
+	return router, attachments, dir
+}
+
+// upload posts a file to the room as user 1 and decodes the JSON answer
+func upload(t *testing.T, router *gin.Engine, roomID, fileName string, content []byte) (int, map[string]any) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("room_id", roomID)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(content)
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-User-ID", "1")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", res.Body, err)
+	}
+	return res.Code, decoded
+}
+
+// storedFiles lists the files in the storage directory
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestUploadStoresTheFile(t *testing.T) {
+	router, attachments, dir := attachmentRouter(t, config.UploadsConfig{}, nil)
+
+	code, body := upload(t, router, "lobby", "../notes.txt", []byte("meeting at noon"))
+	if code != http.StatusCreated {
+		t.Fatalf("upload got %d %v", code, body)
+	}
+	attachment, _ := body["attachment"].(map[string]any)
+	id, _ := attachment["id"].(string)
+	if attachment["content_type"] != "text/plain" || attachment["file_name"] != "notes.txt" || attachment["size"] != float64(15) {
+		t.Fatalf("attachment %v, want a 15 byte text/plain notes.txt", attachment)
+	}
+	if stored, err := os.ReadFile(dir + "/" + id); err != nil || string(stored) != "meeting at noon" {
+		t.Fatalf("stored file %q, %v", stored, err)
+	}
+	if saved, _ := attachments.GetAttachment(id); saved == nil || saved.UploaderID != 1 || saved.RoomID != "lobby" {
+		t.Fatalf("recorded attachment %+v", saved)
+	}
+}
+
+func TestUploadRejectsOversizedAndUnwantedFiles(t *testing.T) {
+	router, attachments, dir := attachmentRouter(t, config.UploadsConfig{MaxSize: 16, AllowedTypes: []string{"text/plain"}}, nil)
+
+	if code, body := upload(t, router, "lobby", "long.txt", bytes.Repeat([]byte("a"), 17)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload got %d %v, want 413", code, body)
+	}
+	if code, body := upload(t, router, "lobby", "exact.txt", bytes.Repeat([]byte("a"), 16)); code != http.StatusCreated {
+		t.Fatalf("upload at the limit got %d %v, want 201", code, body)
+	}
+	if code, body := upload(t, router, "lobby", "doc.pdf", []byte("%PDF-1.4 tiny")); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("disallowed type got %d %v, want 415", code, body)
+	}
+	if code, body := upload(t, router, "staff", "notes.txt", []byte("hello")); code != http.StatusNotFound {
+		t.Fatalf("upload to an unknown room got %d %v, want 404", code, body)
+	}
+
+	if len(attachments.attachments) != 1 || len(storedFiles(t, dir)) != 1 {
+		t.Fatalf("%d attachments recorded and files %v stored, want only the one at the limit",
+			len(attachments.attachments), storedFiles(t, dir))
+	}
+}
+
+// download fetches an attachment as the given user with optional extra headers
+func download(router *gin.Engine, path, userID string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-User-ID", userID)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestDownloadServesMembersInRanges(t *testing.T) {
+	router, _, _ := attachmentRouter(t, config.UploadsConfig{}, nil)
+	code, body := upload(t, router, "lobby", "alphabet.txt", []byte("abcdefghijklmnopqrstuvwxyz"))
+	if code != http.StatusCreated {
+		t.Fatalf("upload got %d %v", code, body)
+	}
+	path := "/download/" + body["attachment"].(map[string]any)["id"].(string)
+
+	res := download(router, path, "2", nil)
+	if res.Code != http.StatusOK || res.Body.String() != "abcdefghijklmnopqrstuvwxyz" {
+		t.Fatalf("download by a member got %d %q", res.Code, res.Body)
+	}
+	if got := res.Header().Get("Content-Type"); got != "text/plain" {
+		t.Fatalf("Content-Type %q, want text/plain", got)
+	}
+	if got := res.Header().Get("Content-Disposition"); got != `attachment; filename=alphabet.txt` {
+		t.Fatalf("Content-Disposition %q, want a download named alphabet.txt", got)
+	}
+	if res.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatal("ranges are not advertised")
+	}
+
+	res = download(router, path, "2", map[string]string{"Range": "bytes=10-14"})
+	if res.Code != http.StatusPartialContent || res.Body.String() != "klmno" || res.Header().Get("Content-Range") != "bytes 10-14/26" {
+		t.Fatalf("range request got %d %q %q, want 206 klmno", res.Code, res.Body, res.Header().Get("Content-Range"))
+	}
+	res = download(router, path, "2", map[string]string{"Range": "bytes=-3"})
+	if res.Code != http.StatusPartialContent || res.Body.String() != "xyz" {
+		t.Fatalf("suffix range got %d %q, want 206 xyz", res.Code, res.Body)
+	}
+	res = download(router, path, "2", map[string]string{"Range": "bytes=100-"})
+	if res.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("range past the end got %d, want 416", res.Code)
+	}
+
+	if res := download(router, path, "3", nil); res.Code != http.StatusForbidden {
+		t.Fatalf("download by an outsider got %d %q, want 403", res.Code, res.Body)
+	}
+	if res := download(router, "/download/missing", "1", nil); res.Code != http.StatusNotFound {
+		t.Fatalf("download of an unknown attachment got %d, want 404", res.Code)
+	}
+}
+
+func TestImageUploadsGetAThumbnail(t *testing.T) {
+	router, _, _ := attachmentRouter(t, config.UploadsConfig{}, thumbnail.NewStdProcessor(32, 0))
+	img := image.NewRGBA(image.Rect(0, 0, 128, 64))
+	var fixture bytes.Buffer
+	if err := png.Encode(&fixture, img); err != nil {
+		t.Fatal(err)
+	}
+
+	code, body := upload(t, router, "lobby", "wide.png", fixture.Bytes())
+	attachment, _ := body["attachment"].(map[string]any)
+	if code != http.StatusCreated || attachment["thumbnail_url"] != attachment["url"].(string)+"?size=thumb" {
+		t.Fatalf("upload got %d %v, want an attachment with a thumbnail URL", code, body)
+	}
+
+	res := download(router, attachment["thumbnail_url"].(string), "2", nil)
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("thumbnail download got %d %q", res.Code, res.Header().Get("Content-Type"))
+	}
+	thumb, err := png.DecodeConfig(res.Body)
+	if err != nil {
+		t.Fatalf("thumbnail is not a PNG: %v", err)
+	}
+	if thumb.Width != 32 || thumb.Height != 16 {
+		t.Fatalf("thumbnail is %dx%d, want 32x16", thumb.Width, thumb.Height)
+	}
+
+	code, body = upload(t, router, "lobby", "notes.txt", []byte("no pictures here"))
+	if code != http.StatusCreated || body["attachment"].(map[string]any)["thumbnail_url"] != nil {
+		t.Fatalf("text upload got %d %v, want no thumbnail", code, body)
+	}
+	path := body["attachment"].(map[string]any)["url"].(string) + "?size=thumb"
+	if res := download(router, path, "2", nil); res.Code != http.StatusNotFound {
+		t.Fatalf("thumbnail of a text file got %d, want 404", res.Code)
+	}
+	if res := download(router, path[:len(path)-len("thumb")]+"huge", "2", nil); res.Code != http.StatusBadRequest {
+		t.Fatalf("unknown size got %d, want 400", res.Code)
+	}
+}
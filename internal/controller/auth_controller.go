@@ -2,30 +2,41 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"live-chatter/internal/config"
 	"live-chatter/internal/service"
 	"live-chatter/pkg/model"
 	"net/http"
-
-	Log "live-chatter/pkg/logger"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthController struct {
 	AuthService service.AuthService
+	Challenge   service.ChallengeVerifier // Checked before an account is created
+
+	registrations *idempotencyStore
 }
 
-func NewAuthController(authService service.AuthService) *AuthController {
-	return &AuthController{AuthService: authService}
+func NewAuthController(authService service.AuthService, registration config.RegistrationConfig, challenge service.ChallengeVerifier) *AuthController {
+	return &AuthController{
+		AuthService:   authService,
+		Challenge:     challenge,
+		registrations: newIdempotencyStore(time.Duration(registration.IdempotencyTTL) * time.Second),
+	}
 }
 
 type registerRequest struct {
 	Username  string `json:"username" binding:"required,min=3,max=50"`
 	Email     string `json:"email" binding:"omitempty,email,max=254"`
-	Password  string `json:"password" binding:"required,min=8,max=128"`
+	Password  string `json:"password" binding:"required,max=128"` // Strength is checked against the configured policy
 	FirstName string `json:"first_name" binding:"omitempty,max=100"`
 	LastName  string `json:"last_name" binding:"omitempty,max=100"`
+	Locale    string `json:"locale" binding:"omitempty,max=16"`
+
+	ChallengeToken string `json:"challenge_token" binding:"omitempty,max=4096"`
 }
 
 func (ac *AuthController) Register(c *gin.Context) {
@@ -33,20 +44,66 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		Log.Error("[Register] Failed to read body: %v", err)
+		requestLog(c).Error("[Register] Failed to read body: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
-	Log.Debug("[Register] Raw payload: %s", string(body))
+	requestLog(c).Debug("[Register] Raw payload: %s", string(body))
 
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		Log.Error("[Register] Binding into struct failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+	// A retry carrying the same Idempotency-Key replays the original outcome instead of
+	// failing with a conflict against the account the first attempt created
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
 		return
 	}
-	Log.Debug("[Register] Parsed request: %+v", req)
+	if idempotencyKey != "" {
+		stored, mismatch, inFlight := ac.registrations.begin(idempotencyKey, requestFingerprint(body))
+		switch {
+		case mismatch:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			return
+		case inFlight:
+			c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			return
+		case stored != nil:
+			requestLog(c).Info("[Register] Replaying response for idempotency key")
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(stored.Status, stored.Body)
+			return
+		}
+	}
+
+	status, response := ac.register(c, &req)
+	if idempotencyKey != "" {
+		if status == http.StatusCreated {
+			ac.registrations.complete(idempotencyKey, status, response)
+		} else {
+			ac.registrations.release(idempotencyKey)
+		}
+	}
+	c.JSON(status, response)
+}
+
+// register binds and performs a registration, returning the status and body to respond with
+func (ac *AuthController) register(c *gin.Context, req *registerRequest) (int, gin.H) {
+	if err := c.ShouldBindJSON(req); err != nil {
+		requestLog(c).Error("[Register] Binding into struct failed: %v", err)
+		return http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()}
+	}
+	requestLog(c).Debug("[Register] Parsed request: %+v", req)
+
+	if ac.Challenge != nil {
+		if err := ac.Challenge.Verify(req.ChallengeToken); err != nil {
+			requestLog(c).Warn("[Register] Challenge not passed: %v", err)
+			if errors.Is(err, service.ErrChallengeFailed) {
+				return http.StatusBadRequest, gin.H{"error": service.ErrChallengeFailed.Error()}
+			}
+			return http.StatusServiceUnavailable, gin.H{"error": "Challenge verification is unavailable"}
+		}
+	}
 
 	user := model.User{
 		Username:  req.Username,
@@ -54,59 +111,178 @@ func (ac *AuthController) Register(c *gin.Context) {
 		Password:  req.Password,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
+		Locale:    req.Locale,
 	}
 
 	if err := ac.AuthService.Register(&user); err != nil {
-		Log.Error("[Register] Service error: %v", err)
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-		return
+		requestLog(c).Error("[Register] Service error: %v", err)
+		status := http.StatusConflict
+		if errors.Is(err, service.ErrInvalidUsername) || errors.Is(err, service.ErrInvalidPassword) {
+			status = http.StatusBadRequest
+		}
+		return status, gin.H{"error": err.Error()}
 	}
 
-	Log.Info("[Register] Success: user %s registered", user.Username)
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+	requestLog(c).Info("[Register] Success: user %s registered", user.Username)
+	return http.StatusCreated, gin.H{"message": "User registered successfully"}
 }
 
+// Login signs a user in by email or username; the email wins when both are sent
 func (ac *AuthController) Login(c *gin.Context) {
 	var creds struct {
 		Email    string `json:"email"`
+		Username string `json:"username"`
 		AuthHash string `json:"authhash"`
 	}
 	if err := c.ShouldBindJSON(&creds); err != nil {
-		Log.Error("[Login] Invalid input: %v", err)
+		requestLog(c).Error("[Login] Invalid input: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
-	Log.Debug("[Login] Payload: %+v", creds)
+	requestLog(c).Debug("[Login] Payload: %+v", creds)
 
-	user, err := ac.AuthService.Login(creds.Email, creds.AuthHash)
+	user, err := ac.AuthService.Login(service.LoginCredentials{
+		Email:    creds.Email,
+		Username: creds.Username,
+		AuthHash: creds.AuthHash,
+	}, service.SessionClient{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
 	if err != nil {
-		Log.Error("[Login] Auth failed: %v", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		requestLog(c).Error("[Login] Auth failed: %v", err)
+		status := http.StatusUnauthorized
+		if errors.Is(err, service.ErrMissingIdentifier) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	Log.Info("[Login] Success: %+v", user)
+	requestLog(c).Info("[Login] Success: %+v", user)
 	c.JSON(http.StatusOK, user)
 }
 
+// Logout revokes the session of the presented token
+func (ac *AuthController) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	client := service.SessionClient{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if err := ac.AuthService.Logout(c.GetUint("user_id"), sessionID, client); err != nil {
+		requestLog(c).Error("[Logout] Failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	requestLog(c).Info("[Logout] Success: user %d logged out", c.GetUint("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// ChangePassword replaces the caller's password after verifying the current one. Every session,
+// including the caller's, is revoked, so the client must log in again.
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req struct {
+		OldAuthHash string `json:"old_authhash" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required,max=128"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Error("[ChangePassword] Invalid input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := ac.AuthService.ChangePassword(userID, req.OldAuthHash, req.NewPassword); err != nil {
+		requestLog(c).Error("[ChangePassword] Failed for user %d: %v", userID, err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			status = http.StatusUnauthorized
+		case errors.Is(err, service.ErrInvalidPassword):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrUserNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	requestLog(c).Info("[ChangePassword] Success: user %d changed their password", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed; please log in again"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether or not the
+// email belongs to an account.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email,max=254"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Error("[ForgotPassword] Invalid input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.ForgotPassword(req.Email); err != nil {
+		requestLog(c).Error("[ForgotPassword] Failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a token from a reset email. Every session is revoked,
+// so the user must log in again.
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token" binding:"required,max=128"`
+		NewPassword string `json:"new_password" binding:"required,max=128"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Error("[ResetPassword] Invalid input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.ResetPassword(req.Token, req.NewPassword, c.ClientIP()); err != nil {
+		requestLog(c).Error("[ResetPassword] Failed: %v", err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrResetTokenInvalid), errors.Is(err, service.ErrInvalidPassword):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrResetTokenExpired), errors.Is(err, service.ErrResetTokenUsed):
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	requestLog(c).Info("[ResetPassword] Success")
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset; please log in again"})
+}
+
 func (ac *AuthController) Refresh(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Log.Error("[Refresh] Invalid input: %v", err)
+		requestLog(c).Error("[Refresh] Invalid input: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
-	Log.Debug("[Refresh] Payload: %+v", req)
+	requestLog(c).Debug("[Refresh] Payload: %+v", req)
 
 	newTokens, err := ac.AuthService.RefreshTokens(req.RefreshToken)
 	if err != nil {
-		Log.Error("[Refresh] Token refresh failed: %v", err)
+		requestLog(c).Error("[Refresh] Token refresh failed: %v", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	Log.Info("[Refresh] Success: %+v", newTokens)
+	requestLog(c).Info("[Refresh] Success: %+v", newTokens)
 	c.JSON(http.StatusOK, newTokens)
 }
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/service"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAuthService creates accounts in memory and rejects usernames it has already seen
+type fakeAuthService struct {
+	service.AuthService
+	mu        sync.Mutex
+	usernames map[string]bool
+	calls     int
+}
+
+func (s *fakeAuthService) Register(user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.usernames[user.Username] {
+		return service.ErrUsernameTaken
+	}
+	if s.usernames == nil {
+		s.usernames = make(map[string]bool)
+	}
+	s.usernames[user.Username] = true
+	return nil
+}
+
+// authEndpoint mounts a single controller handler for the tests to call
+func authEndpoint(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth", handler)
+	return router
+}
+
+// serveAuth sends a JSON body to the endpoint with the given headers
+func serveAuth(router *gin.Engine, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+const registration = `{"username":"alice","email":"alice@example.com","password":"Correct-Horse-9"}`
+
+func TestRegistrationRetryReplaysTheFirstResult(t *testing.T) {
+	auth := &fakeAuthService{}
+	register := authEndpoint(NewAuthController(auth, config.RegistrationConfig{}, nil).Register)
+	key := map[string]string{IdempotencyKeyHeader: "signup-1"}
+
+	first := serveAuth(register, registration, key)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first attempt got %d %s", first.Code, first.Body)
+	}
+	retry := serveAuth(register, registration, key)
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry got %d %s, want a replayed 201", retry.Code, retry.Body)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry body %s differs from %s", retry.Body, first.Body)
+	}
+	if auth.calls != 1 {
+		t.Fatalf("service called %d times, want once", auth.calls)
+	}
+
+	// Without a key the same request is a plain duplicate
+	if res := serveAuth(register, registration, nil); res.Code != http.StatusConflict {
+		t.Fatalf("keyless duplicate got %d, want 409", res.Code)
+	}
+}
+
+func TestIdempotencyKeyReusedWithDifferentBodyIsRejected(t *testing.T) {
+	register := authEndpoint(NewAuthController(&fakeAuthService{}, config.RegistrationConfig{}, nil).Register)
+	key := map[string]string{IdempotencyKeyHeader: "signup-1"}
+
+	serveAuth(register, registration, key)
+	other := strings.Replace(registration, "alice", "bob", 2)
+	if res := serveAuth(register, other, key); res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key got %d, want 422", res.Code)
+	}
+
+	long := map[string]string{IdempotencyKeyHeader: strings.Repeat("k", maxIdempotencyKeyLen+1)}
+	if res := serveAuth(register, other, long); res.Code != http.StatusBadRequest {
+		t.Fatalf("oversized key got %d, want 400", res.Code)
+	}
+}
+
+func TestFailedRegistrationReleasesItsKey(t *testing.T) {
+	auth := &fakeAuthService{usernames: map[string]bool{"alice": true}}
+	register := authEndpoint(NewAuthController(auth, config.RegistrationConfig{}, nil).Register)
+	key := map[string]string{IdempotencyKeyHeader: "signup-1"}
+
+	if res := serveAuth(register, registration, key); res.Code != http.StatusConflict {
+		t.Fatalf("taken username got %d, want 409", res.Code)
+	}
+
+	// The failure was not stored, so the retry reaches the service again
+	delete(auth.usernames, "alice")
+	if res := serveAuth(register, registration, key); res.Code != http.StatusCreated {
+		t.Fatalf("retry after failure got %d %s", res.Code, res.Body)
+	}
+	if auth.calls != 2 {
+		t.Fatalf("service called %d times, want twice", auth.calls)
+	}
+}
+
+func TestConcurrentRetriesCreateOneAccount(t *testing.T) {
+	auth := &fakeAuthService{}
+	register := authEndpoint(NewAuthController(auth, config.RegistrationConfig{}, nil).Register)
+	key := map[string]string{IdempotencyKeyHeader: "signup-1"}
+
+	codes := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serveAuth(register, registration, key).Code
+		}()
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != http.StatusCreated && code != http.StatusConflict {
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if auth.calls != 1 {
+		t.Fatalf("service called %d times, want once", auth.calls)
+	}
+}
+
+// stubChallenge answers every verification with a fixed error and remembers the token it saw
+type stubChallenge struct {
+	err   error
+	token string
+}
+
+func (c *stubChallenge) Verify(token string) error {
+	c.token = token
+	return c.err
+}
+
+func TestRegistrationChallenge(t *testing.T) {
+	withToken := `{"username":"alice","password":"Correct-Horse-9","challenge_token":"tok-123"}`
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		created bool
+	}{
+		{"accepted", nil, http.StatusCreated, true},
+		{"rejected", fmt.Errorf("%w: invalid-input-response", service.ErrChallengeFailed), http.StatusBadRequest, false},
+		{"verifier unreachable", errors.New("dial tcp: connection refused"), http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		auth := &fakeAuthService{}
+		challenge := &stubChallenge{err: tt.err}
+		register := authEndpoint(NewAuthController(auth, config.RegistrationConfig{}, challenge).Register)
+
+		res := serveAuth(register, withToken, nil)
+		if res.Code != tt.status {
+			t.Errorf("%s: got %d %s, want %d", tt.name, res.Code, res.Body, tt.status)
+		}
+		if challenge.token != "tok-123" {
+			t.Errorf("%s: verifier saw token %q", tt.name, challenge.token)
+		}
+		if created := auth.calls > 0; created != tt.created {
+			t.Errorf("%s: account created = %v, want %v", tt.name, created, tt.created)
+		}
+	}
+}
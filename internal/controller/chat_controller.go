@@ -1,12 +1,15 @@
 package controller
 
 import (
-	Log "live-chatter/pkg/logger"
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
 
+	"live-chatter/internal/config"
 	"live-chatter/internal/service"
+	"live-chatter/pkg"
 	"live-chatter/pkg/model"
 
 	"github.com/gin-gonic/gin"
@@ -14,17 +17,18 @@ import (
 
 type ChatController struct {
 	ChatService service.ChatService
+	Pagination  config.PaginationConfig
 }
 
-func NewChatController(chatService service.ChatService) *ChatController {
-	return &ChatController{ChatService: chatService}
+func NewChatController(chatService service.ChatService, pagination config.PaginationConfig) *ChatController {
+	return &ChatController{ChatService: chatService, Pagination: pagination}
 }
 
-// GetRooms returns all available chat rooms
+// GetRooms returns all available chat rooms with their live user counts
 func (cc *ChatController) GetRooms(c *gin.Context) {
-	rooms, err := cc.ChatService.GetAllRooms()
+	rooms, err := cc.ChatService.ListRooms()
 	if err != nil {
-		Log.Error("Error getting rooms: ", err)
+		requestLog(c).Error("Error getting rooms: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms"})
 		return
 	}
@@ -35,30 +39,34 @@ func (cc *ChatController) GetRooms(c *gin.Context) {
 // CreateRoom creates a new chat room
 func (cc *ChatController) CreateRoom(c *gin.Context) {
 	var req struct {
-		Name        string `json:"name" binding:"required,min=1,max=50"`
-		Description string `json:"description" binding:"omitempty,max=255"`
-		Type        string `json:"type" binding:"omitempty,oneof=public private"`
+		Name           string `json:"name" binding:"required"`
+		Description    string `json:"description"`
+		Type           string `json:"type" binding:"omitempty,oneof=public private"`
+		NotifyOnChange bool   `json:"notify_on_change"`
+		AutoLeave      bool   `json:"auto_leave"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Log.Error("Error binding json: ", err)
+		requestLog(c).Error("Error binding json: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		Log.Error("Required User ID not found")
+		requestLog(c).Error("Required User ID not found")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
 	userIDUint := userID.(uint)
 	room := &model.Room{
-		Name:        req.Name,
-		Description: req.Description,
-		Type:        req.Type,
-		CreatedBy:   userIDUint,
+		Name:           req.Name,
+		Description:    req.Description,
+		Type:           req.Type,
+		CreatedBy:      userIDUint,
+		NotifyOnChange: req.NotifyOnChange,
+		AutoLeave:      req.AutoLeave,
 	}
 
 	if room.Type == "" {
@@ -67,8 +75,17 @@ func (cc *ChatController) CreateRoom(c *gin.Context) {
 
 	createdRoom, err := cc.ChatService.CreateRoom(room)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
-		Log.Error("Error creating Room", err)
+		requestLog(c).Error("Error creating Room: %v", err)
+		switch {
+		case errors.Is(err, service.ErrInvalidRoomName), errors.Is(err, service.ErrInvalidRoomDescription):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrRoomNameTaken),
+			errors.Is(err, service.ErrTooManyRoomsCreated),
+			errors.Is(err, service.ErrTooManyRoomsJoined):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+		}
 		return
 	}
 
@@ -79,44 +96,240 @@ func (cc *ChatController) CreateRoom(c *gin.Context) {
 func (cc *ChatController) GetRoomMessages(c *gin.Context) {
 	roomID := c.Param("roomId")
 	if roomID == "" {
-		Log.Error("Invalid roomId")
+		requestLog(c).Error("Invalid roomId")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-	beforeStr := c.Query("before")
+	limit := cc.pageLimit(c.Query("limit"))
+	userID := c.GetUint("user_id")
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 100 {
-		limit = 50
+	// A cursor, even an empty one for the first page, selects keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		page, err := cc.ChatService.GetRoomMessagesByCursor(roomID, userID, limit, cursor)
+		if err != nil {
+			requestLog(c).Error("Error getting room [%s] messages: %v", roomID, err)
+			c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+		return
 	}
 
+	offsetStr := c.DefaultQuery("offset", "0")
+	beforeStr := c.Query("before")
+
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil || offset < 0 {
-		Log.Warn("Invalid offset: ", err)
+		requestLog(c).Warn("Invalid offset: %v", err)
 		offset = 0
 	}
 
 	var before *time.Time
 	if beforeStr != "" {
-		if parsedTime, err := time.Parse(time.RFC3339, beforeStr); err == nil {
+		if parsedTime, err := model.ParseTimestamp(beforeStr); err == nil {
 			before = &parsedTime
 		}
 	}
 
-	messages, err := cc.ChatService.GetRoomMessages(roomID, limit, offset, before)
+	page, err := cc.ChatService.GetRoomMessages(roomID, userID, limit, offset, before)
+	if err != nil {
+		requestLog(c).Error("Error getting room [%s] messages: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ExportRoomMessages streams a room's full history as a downloadable JSON or CSV file, chosen by
+// ?format=json|csv. Only room admins may export. Once streaming has begun a failure can only cut
+// the file short, so it is logged rather than reported. The write deadline is extended as each
+// batch is written, so large rooms are not cut off by the server's WriteTimeout.
+func (cc *ChatController) ExportRoomMessages(c *gin.Context) {
+	roomID := c.Param("roomId")
+	format := c.DefaultQuery("format", "json")
+	exporter := newMessageExporter(format, newDeadlineWriter(c.Writer))
+	if exporter == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", exporter.contentType())
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment",
+			map[string]string{"filename": "room-" + roomID + "." + exporter.extension()}))
+		c.Status(http.StatusOK)
+		return exporter.begin()
+	}
+
+	err := cc.ChatService.ExportRoomMessages(roomID, c.GetUint("user_id"), func(messages []model.Message) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, message := range messages {
+			if err := exporter.write(message); err != nil {
+				return err
+			}
+		}
+		if err := exporter.flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Error("Error exporting messages of room [%s]: %v", roomID, err)
+		if !started {
+			c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			requestLog(c).Error("Error exporting messages of room [%s]: %v", roomID, err)
+			return
+		}
+	}
+	if err := exporter.end(); err != nil {
+		requestLog(c).Error("Error exporting messages of room [%s]: %v", roomID, err)
+	}
+}
+
+// pageLimit resolves the requested page size against the controller's pagination settings
+func (cc *ChatController) pageLimit(raw string) int {
+	return resolvePageLimit(raw, cc.Pagination)
+}
+
+// resolvePageLimit resolves the requested page size against the configured default and ceiling.
+// Missing or invalid values fall back to the default; oversized ones are clamped to the ceiling.
+func resolvePageLimit(raw string, pagination config.PaginationConfig) int {
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		limit = 0
+	}
+	return pagination.PageLimit(limit)
+}
+
+// SendMessage posts a message (or a threaded reply) to a room
+func (cc *ChatController) SendMessage(c *gin.Context) {
+	roomID := c.Param("roomId")
+	if roomID == "" {
+		requestLog(c).Error("Invalid roomId")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
+		return
+	}
+
+	var req struct {
+		Content      string  `json:"content" binding:"required_without=AttachmentID"`
+		ParentID     *uint   `json:"parent_id"`
+		AttachmentID *string `json:"attachment_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Error("Error binding json: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	message := &model.Message{
+		Content:  req.Content,
+		UserID:   userID.(uint),
+		Username: c.GetString("username"),
+		RoomID:   roomID,
+		ParentID: req.ParentID,
+
+		AttachmentID: req.AttachmentID,
+	}
+
+	savedMessage, err := cc.ChatService.SaveMessage(message, c.ClientIP())
+	if err != nil {
+		requestLog(c).Error("Error sending message to room [%s]: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": savedMessage})
+}
+
+// GetMessage returns a single message with its author, parent and replies
+func (cc *ChatController) GetMessage(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		requestLog(c).Error("Invalid messageId: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := cc.ChatService.GetMessage(uint(messageID), c.GetUint("user_id"))
+	if err != nil {
+		requestLog(c).Error("Error getting message %d: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// GetMessagesBatch returns the messages whose IDs are posted as a JSON array, in that order
+func (cc *ChatController) GetMessagesBatch(c *gin.Context) {
+	var ids []uint
+	if err := c.ShouldBindJSON(&ids); err != nil {
+		requestLog(c).Error("Error binding json: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	messages, err := cc.ChatService.GetMessagesByIDs(ids, c.GetUint("user_id"))
 	if err != nil {
-		Log.Error("Error getting room [%s] messages: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		requestLog(c).Error("Error getting message batch: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"messages": messages,
-		"limit":    limit,
-		"offset":   offset,
+		"count":    len(messages),
+	})
+}
+
+// GetMessageReplies returns the threaded replies to a message with pagination
+func (cc *ChatController) GetMessageReplies(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		requestLog(c).Error("Invalid messageId: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	limit := cc.pageLimit(c.Query("limit"))
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	replies, err := cc.ChatService.GetMessageReplies(uint(messageID), c.GetUint("user_id"), limit, offset)
+	if err != nil {
+		requestLog(c).Error("Error getting replies for message %d: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"replies": replies,
+		"limit":   limit,
+		"offset":  offset,
 	})
 }
 
@@ -124,22 +337,22 @@ func (cc *ChatController) GetRoomMessages(c *gin.Context) {
 func (cc *ChatController) JoinRoom(c *gin.Context) {
 	roomID := c.Param("roomId")
 	if roomID == "" {
-		Log.Error("Room ID is required")
+		requestLog(c).Error("Room ID is required")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
 		return
 	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		Log.Error("Required User ID not found")
+		requestLog(c).Error("Required User ID not found")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	err := cc.ChatService.JoinRoom(roomID, userID.(uint))
+	err := cc.ChatService.JoinRoom(roomID, userID.(uint), c.ClientIP())
 	if err != nil {
-		Log.Error("Error joining room: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		requestLog(c).Error("Error joining room: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -150,22 +363,22 @@ func (cc *ChatController) JoinRoom(c *gin.Context) {
 func (cc *ChatController) LeaveRoom(c *gin.Context) {
 	roomID := c.Param("roomId")
 	if roomID == "" {
-		Log.Error("Room ID is required")
+		requestLog(c).Error("Room ID is required")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
 		return
 	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		Log.Error("Required User ID not found")
+		requestLog(c).Error("Required User ID not found")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
 	userIDUint := userID.(uint)
-	err := cc.ChatService.LeaveRoom(roomID, userIDUint)
+	err := cc.ChatService.LeaveRoom(roomID, userIDUint, c.ClientIP())
 	if err != nil {
-		Log.Error("Error leaving room: ", err)
+		requestLog(c).Error("Error leaving room: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -173,10 +386,301 @@ func (cc *ChatController) LeaveRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully left room"})
 }
 
+// MuteRoom stops notifications from a room for the current user
+func (cc *ChatController) MuteRoom(c *gin.Context) {
+	cc.setRoomMuted(c, true)
+}
+
+// UnmuteRoom resumes notifications from a room for the current user
+func (cc *ChatController) UnmuteRoom(c *gin.Context) {
+	cc.setRoomMuted(c, false)
+}
+
+func (cc *ChatController) setRoomMuted(c *gin.Context, muted bool) {
+	roomID := c.Param("roomId")
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := cc.ChatService.SetRoomMuted(roomID, userID.(uint), muted); err != nil {
+		requestLog(c).Error("Error updating mute setting: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "muted": muted})
+}
+
+// FavoriteRoom marks a room as a favorite, exempting the membership from auto-leave
+func (cc *ChatController) FavoriteRoom(c *gin.Context) {
+	cc.setRoomFavorite(c, true)
+}
+
+// UnfavoriteRoom clears the favorite mark on a room
+func (cc *ChatController) UnfavoriteRoom(c *gin.Context) {
+	cc.setRoomFavorite(c, false)
+}
+
+func (cc *ChatController) setRoomFavorite(c *gin.Context, favorite bool) {
+	roomID := c.Param("roomId")
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := cc.ChatService.SetRoomFavorite(roomID, userID.(uint), favorite); err != nil {
+		requestLog(c).Error("Error updating favorite setting: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "favorite": favorite})
+}
+
+// UpdateRoom changes a room's settings; the caller must be a room admin. Omitted fields are
+// left unchanged.
+func (cc *ChatController) UpdateRoom(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req struct {
+		Name           *string `json:"name"`
+		Description    *string `json:"description"`
+		Type           *string `json:"type" binding:"omitempty,oneof=public private"`
+		NotifyOnChange *bool   `json:"notify_on_change"`
+		AutoLeave      *bool   `json:"auto_leave"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	result, err := cc.ChatService.UpdateRoom(roomID, c.GetUint("user_id"), service.RoomUpdate{
+		Name:           req.Name,
+		Description:    req.Description,
+		Type:           req.Type,
+		NotifyOnChange: req.NotifyOnChange,
+		AutoLeave:      req.AutoLeave,
+	})
+	if err != nil {
+		requestLog(c).Error("Error updating room %s: %v", roomID, err)
+		switch {
+		case errors.Is(err, service.ErrInvalidRoomName), errors.Is(err, service.ErrInvalidRoomDescription):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrRoomNameTaken),
+			errors.Is(err, service.ErrTooManyRoomsCreated),
+			errors.Is(err, service.ErrTooManyRoomsJoined):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteRoom deletes a room; the caller must be its creator or a room admin
+func (cc *ChatController) DeleteRoom(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	if err := cc.ChatService.DeleteRoom(roomID, c.GetUint("user_id")); err != nil {
+		requestLog(c).Error("Error deleting room %s: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "deleted": true})
+}
+
+// GetRoomMembers lists a room's members with their admin, moderator or member roles
+func (cc *ChatController) GetRoomMembers(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	members, err := cc.ChatService.GetRoomMembers(roomID, c.GetUint("user_id"))
+	if err != nil {
+		requestLog(c).Error("Error getting members of room %s: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "members": members})
+}
+
+// ChangeMemberRole promotes or demotes a room member; the caller must be a room admin
+func (cc *ChatController) ChangeMemberRole(c *gin.Context) {
+	roomID := c.Param("roomId")
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := cc.ChatService.ChangeMemberRole(roomID, c.GetUint("user_id"), uint(targetID), req.Role); err != nil {
+		requestLog(c).Error("Error changing role of user %d in room %s: %v", targetID, roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "user_id": targetID, "role": req.Role})
+}
+
+// KickUser removes a member from the room, optionally banning them; the caller must be a room
+// admin or moderator
+func (cc *ChatController) KickUser(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+		Ban    bool `json:"ban"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := cc.ChatService.KickUser(roomID, c.GetUint("user_id"), req.UserID, req.Ban); err != nil {
+		requestLog(c).Error("Error kicking user %d from room %s: %v", req.UserID, roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "user_id": req.UserID, "banned": req.Ban})
+}
+
+// InviteUser invites a user to a private room; the caller must be a room admin
+func (cc *ChatController) InviteUser(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := cc.ChatService.InviteUser(roomID, c.GetUint("user_id"), req.Username); err != nil {
+		requestLog(c).Error("Error inviting %s to room %s: %v", req.Username, roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "username": req.Username, "invited": true})
+}
+
+// CreateInviteToken mints a shareable invite link; the caller must be a room admin
+func (cc *ChatController) CreateInviteToken(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req struct {
+		ExpiresIn int `json:"expires_in"` // Seconds; 0 uses the default lifetime
+		MaxUses   int `json:"max_uses"`   // 0 allows unlimited uses
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	token, err := cc.ChatService.CreateInviteToken(roomID, c.GetUint("user_id"),
+		time.Duration(req.ExpiresIn)*time.Second, req.MaxUses)
+	if err != nil {
+		requestLog(c).Error("Error creating invite for room %s: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invite": token})
+}
+
+// AcceptInviteToken joins the caller to the room an invite link points to
+func (cc *ChatController) AcceptInviteToken(c *gin.Context) {
+	room, err := cc.ChatService.AcceptInviteToken(c.Param("token"), c.GetUint("user_id"), c.ClientIP())
+	if err != nil {
+		requestLog(c).Error("Error accepting invite: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+// UnbanUser lifts a user's ban from the room
+func (cc *ChatController) UnbanUser(c *gin.Context) {
+	roomID := c.Param("roomId")
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := cc.ChatService.UnbanUser(roomID, c.GetUint("user_id"), uint(targetID)); err != nil {
+		requestLog(c).Error("Error unbanning user %d from room %s: %v", targetID, roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "user_id": targetID, "banned": false})
+}
+
+// GetPinnedMessages lists the messages pinned in a room
+func (cc *ChatController) GetPinnedMessages(c *gin.Context) {
+	roomID := c.Param("roomId")
+	pins, err := cc.ChatService.GetPinnedMessages(roomID, c.GetUint("user_id"))
+	if err != nil {
+		requestLog(c).Error("Error getting pins of room %s: %v", roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "pins": pins})
+}
+
+// PinMessage pins a message of the room; only room admins and moderators may pin
+func (cc *ChatController) PinMessage(c *gin.Context) {
+	cc.setPinned(c, true)
+}
+
+// UnpinMessage removes a pin from the room
+func (cc *ChatController) UnpinMessage(c *gin.Context) {
+	cc.setPinned(c, false)
+}
+
+func (cc *ChatController) setPinned(c *gin.Context, pinned bool) {
+	roomID := c.Param("roomId")
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	if err := cc.ChatService.PinMessage(roomID, uint(messageID), c.GetUint("user_id"), pinned); err != nil {
+		requestLog(c).Error("Error updating pin of message %d in room %s: %v", messageID, roomID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "message_id": messageID, "pinned": pinned})
+}
+
 func (cc *ChatController) GetUserRooms(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		Log.Error("Required User ID not found")
+		requestLog(c).Error("Required User ID not found")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
@@ -184,7 +688,7 @@ func (cc *ChatController) GetUserRooms(c *gin.Context) {
 	userIDUint := userID.(uint)
 	rooms, err := cc.ChatService.GetUserRooms(userIDUint)
 	if err != nil {
-		Log.Error("Error getting rooms: ", err)
+		requestLog(c).Error("Error getting rooms: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user rooms"})
 		return
 	}
@@ -192,26 +696,33 @@ func (cc *ChatController) GetUserRooms(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
 }
 
-// GetOnlineUsers returns currently online users
+// GetOnlineUsers returns currently online users. ?source=live reads the open WebSocket
+// connections instead of the stored status, and ?source=merged combines both.
 func (cc *ChatController) GetOnlineUsers(c *gin.Context) {
-	users, err := cc.ChatService.GetOnlineUsers()
+	source := c.DefaultQuery("source", service.PresenceSourceDB)
+	users, err := cc.ChatService.GetOnlineUsers(source)
+	if errors.Is(err, service.ErrInvalidPresenceSource) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		Log.Error("Error getting online users: ", err)
+		requestLog(c).Error("Error getting online users: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch online users"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"users": users,
-		"count": len(users),
+		"users":  users,
+		"count":  len(users),
+		"source": source,
 	})
 }
 
-// SearchMessages searches for messages containing specific text
+// SearchMessages searches the caller's rooms for messages containing specific text
 func (cc *ChatController) SearchMessages(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		Log.Error("Query is required")
+		requestLog(c).Error("Query is required")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
 		return
 	}
@@ -219,16 +730,26 @@ func (cc *ChatController) SearchMessages(c *gin.Context) {
 	roomID := c.Query("room_id")
 	limitStr := c.DefaultQuery("limit", "20")
 
+	var authorID uint
+	if raw := c.Query("user_id"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		authorID = uint(parsed)
+	}
+
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil || limit <= 0 || limit > 50 {
-		Log.Warn("Invalid limit: ", err)
+		requestLog(c).Warn("Invalid limit: %v", err)
 		limit = 20
 	}
 
-	messages, err := cc.ChatService.SearchMessages(query, roomID, limit)
+	messages, err := cc.ChatService.SearchMessages(query, roomID, authorID, c.GetUint("user_id"), limit)
 	if err != nil {
-		Log.Error("Error searching messages: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		requestLog(c).Error("Error searching messages: %v", err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -238,3 +759,241 @@ func (cc *ChatController) SearchMessages(c *gin.Context) {
 		"count":    len(messages),
 	})
 }
+
+// AddReaction reacts to a message with an emoji; reacting twice with the same emoji is a no-op
+func (cc *ChatController) AddReaction(c *gin.Context) {
+	cc.react(c, true)
+}
+
+// RemoveReaction withdraws the caller's reaction to a message
+func (cc *ChatController) RemoveReaction(c *gin.Context) {
+	cc.react(c, false)
+}
+
+func (cc *ChatController) react(c *gin.Context, add bool) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	// DELETE clients often cannot send a body, so the emoji may also come as a query parameter
+	var req struct {
+		Emoji string `json:"emoji" binding:"max=64"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	if req.Emoji == "" {
+		req.Emoji = c.Query("emoji")
+	}
+	if req.Emoji == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Emoji is required"})
+		return
+	}
+
+	counts, err := cc.ChatService.ReactToMessage(uint(messageID), c.GetUint("user_id"), req.Emoji, add)
+	if err != nil {
+		requestLog(c).Error("Error updating reaction on message %d: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message_id": messageID, "reactions": counts})
+}
+
+// EditMessage updates the content of a message authored by the caller, answering 409 when the
+// message changed since the version the client sent
+func (cc *ChatController) EditMessage(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		requestLog(c).Error("Invalid messageId: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Version uint   `json:"version"` // Version the edit was based on; omit to skip the check
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Error("Error binding json: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	message, err := cc.ChatService.EditMessage(uint(messageID), userID.(uint), req.Content, req.Version)
+	if err != nil {
+		requestLog(c).Error("Error editing message %d: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// DeleteMessage removes a message authored by the caller or moderated by them
+func (cc *ChatController) DeleteMessage(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		requestLog(c).Error("Invalid messageId: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := cc.ChatService.DeleteMessage(uint(messageID), userID.(uint)); err != nil {
+		requestLog(c).Error("Error deleting message %d: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message deleted"})
+}
+
+// GetPrivateMessages returns the direct message history with another user
+func (cc *ChatController) GetPrivateMessages(c *gin.Context) {
+	username := c.Param("username")
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit := cc.pageLimit(c.Query("limit"))
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	messages, err := cc.ChatService.GetPrivateConversation(userID.(uint), username, limit, offset)
+	if err != nil {
+		requestLog(c).Error("Error getting private messages with %s: %v", username, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// MarkPrivateMessagesRead marks every message received from another user as read
+func (cc *ChatController) MarkPrivateMessagesRead(c *gin.Context) {
+	username := c.Param("username")
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	updated, err := cc.ChatService.MarkConversationRead(userID.(uint), username)
+	if err != nil {
+		requestLog(c).Error("Error marking messages from %s as read: %v", username, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
+
+// MarkPrivateMessageRead marks a single private message addressed to the caller as read
+func (cc *ChatController) MarkPrivateMessageRead(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		requestLog(c).Error("Invalid messageId: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		requestLog(c).Error("Required User ID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := cc.ChatService.MarkPrivateMessageRead(uint(messageID), userID.(uint)); err != nil {
+		requestLog(c).Error("Error marking private message %d as read: %v", messageID, err)
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message marked as read"})
+}
+
+// messageErrorStatus maps message service errors to HTTP status codes
+func messageErrorStatus(err error) int {
+	var rejection *pkg.HookRejection
+	var violation *pkg.ThreadViolation
+	var reactionErr *pkg.ReactionError
+	switch {
+	case errors.As(err, &rejection):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &reactionErr):
+		switch reactionErr.Code {
+		case "message_not_found":
+			return http.StatusNotFound
+		case "not_room_member":
+			return http.StatusForbidden
+		default:
+			return http.StatusBadRequest
+		}
+	case errors.Is(err, service.ErrEmptyContent),
+		errors.Is(err, pkg.ErrInvalidAttachment),
+		errors.Is(err, service.ErrTooManyMessages),
+		errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidInvite),
+		errors.Is(err, service.ErrInvalidRoomType),
+		errors.As(err, &violation):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrMessageNotFound),
+		errors.Is(err, service.ErrRoomNotFound),
+		errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrInviteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInviteExpired),
+		errors.Is(err, service.ErrInviteExhausted):
+		return http.StatusGone
+	case errors.Is(err, service.ErrNotMessageAuthor),
+		errors.Is(err, service.ErrCannotDelete),
+		errors.Is(err, service.ErrNotRecipient),
+		errors.Is(err, service.ErrNotRoomMember),
+		errors.Is(err, service.ErrNotRoomAdmin),
+		errors.Is(err, service.ErrNotRoomModerator),
+		errors.Is(err, service.ErrCannotKick),
+		errors.Is(err, service.ErrBannedFromRoom),
+		errors.Is(err, service.ErrInviteRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrLastRoomAdmin),
+		errors.Is(err, service.ErrAlreadyRoomMember),
+		errors.Is(err, service.ErrTooManyRoomsJoined),
+		errors.Is(err, service.ErrMessageConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/service"
+	"live-chatter/pkg"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeChatService answers edits and reply listings with fixed errors, exports with fixed batches and records the
+// page size it is asked for; other methods panic on the nil interface
+type fakeChatService struct {
+	service.ChatService
+	editErr    error
+	batches    [][]model.Message
+	exportErr  error
+	repliesErr error
+	pageLimits []int
+}
+
+func (s *fakeChatService) EditMessage(messageID, userID uint, newContent string, version uint) (*model.Message, error) {
+	if s.editErr != nil {
+		return nil, s.editErr
+	}
+	return &model.Message{ID: messageID, UserID: userID, Content: newContent, Version: version + 1}, nil
+}
+
+func (s *fakeChatService) ExportRoomMessages(roomID string, userID uint, emit func([]model.Message) error) error {
+	if s.exportErr != nil {
+		return s.exportErr
+	}
+	for _, batch := range s.batches {
+		if err := emit(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeChatService) GetMessageReplies(parentID, userID uint, limit, offset int) ([]model.Message, error) {
+	s.pageLimits = append(s.pageLimits, limit)
+	return nil, s.repliesErr
+}
+
+func TestEditMessageConflictIs409(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusOK},
+		{service.ErrMessageConflict, http.StatusConflict},
+	} {
+		controller := &ChatController{ChatService: &fakeChatService{editErr: tt.err}}
+		router := gin.New()
+		router.PUT("/messages/:messageId", func(c *gin.Context) { c.Set("user_id", uint(1)) }, controller.EditMessage)
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/messages/9", strings.NewReader(`{"content":"edited","version":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(res, req)
+
+		if res.Code != tt.status {
+			t.Fatalf("edit failing with %v answered %d, want %d", tt.err, res.Code, tt.status)
+		}
+	}
+}
+
+func TestMessageErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{service.ErrMessageConflict, http.StatusConflict},
+		{service.ErrLastRoomAdmin, http.StatusConflict},
+		{fmt.Errorf("%w (maximum 2)", service.ErrTooManyRoomsJoined), http.StatusConflict},
+		{service.ErrNotRoomMember, http.StatusForbidden},
+		{service.ErrMessageNotFound, http.StatusNotFound},
+		{service.ErrTooManyMessages, http.StatusBadRequest},
+		{service.ErrRoomNotFound, http.StatusNotFound},
+		{&pkg.HookRejection{Hook: "content_filter", Reason: "blocked"}, http.StatusUnprocessableEntity},
+		{&pkg.ReactionError{Code: "not_room_member"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := messageErrorStatus(tt.err); got != tt.status {
+			t.Errorf("messageErrorStatus(%v) = %d, want %d", tt.err, got, tt.status)
+		}
+	}
+}
+
+func TestResolvePageLimit(t *testing.T) {
+	configured := config.PaginationConfig{PageSize: 25, MaxPageSize: 60}
+	tests := []struct {
+		name       string
+		raw        string
+		pagination config.PaginationConfig
+		want       int
+	}{
+		{"configured default", "", configured, 25},
+		{"invalid falls back to the configured default", "lots", configured, 25},
+		{"negative falls back to the configured default", "-5", configured, 25},
+		{"within the configured ceiling", "60", configured, 60},
+		{"over the configured ceiling", "100", configured, 60},
+		{"abusive size", "1000000000", configured, 60},
+		{"hardcoded default when unset", "", config.PaginationConfig{}, config.DefaultPageSize},
+		{"hardcoded ceiling when unset", "500", config.PaginationConfig{}, config.DefaultMaxPageSize},
+		{"default above the ceiling is clamped", "", config.PaginationConfig{PageSize: 80, MaxPageSize: 60}, 60},
+	}
+	for _, tt := range tests {
+		if got := resolvePageLimit(tt.raw, tt.pagination); got != tt.want {
+			t.Errorf("%s: resolvePageLimit(%q) = %d, want %d", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestRepliesUseConfiguredPageSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	chat := &fakeChatService{}
+	controller := &ChatController{ChatService: chat, Pagination: config.PaginationConfig{PageSize: 25, MaxPageSize: 60}}
+	router := gin.New()
+	router.GET("/messages/:messageId/replies", controller.GetMessageReplies)
+
+	for query, want := range map[string]float64{"": 25, "?limit=500": 60} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/messages/9/replies"+query, nil))
+		var body struct{ Limit float64 }
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil || res.Code != http.StatusOK {
+			t.Fatalf("status %d, body %s", res.Code, res.Body)
+		}
+		if body.Limit != want {
+			t.Fatalf("response limit %v for %q, want the effective %v", body.Limit, query, want)
+		}
+	}
+
+	sort.Ints(chat.pageLimits)
+	if len(chat.pageLimits) != 2 || chat.pageLimits[0] != 25 || chat.pageLimits[1] != 60 {
+		t.Fatalf("service asked for %v, want 25 and 60", chat.pageLimits)
+	}
+}
+
+func TestRepliesOfAnotherRoomAre403(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controller := &ChatController{ChatService: &fakeChatService{repliesErr: service.ErrNotRoomMember}}
+	router := gin.New()
+	router.GET("/messages/:messageId/replies", func(c *gin.Context) { c.Set("user_id", uint(3)) }, controller.GetMessageReplies)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/messages/9/replies", nil))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("replies for a non-member answered %d, want 403", res.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	Log "live-chatter/pkg/logger"
+	"net/http"
+	"strconv"
+
+	"live-chatter/internal/service"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmojiController struct {
+	EmojiService service.EmojiService
+}
+
+func NewEmojiController(emojiService service.EmojiService) *EmojiController {
+	return &EmojiController{EmojiService: emojiService}
+}
+
+// CreateEmoji registers a custom emoji; omit room_id for a global one
+func (ec *EmojiController) CreateEmoji(c *gin.Context) {
+	var req struct {
+		Name   string  `json:"name" binding:"required"`
+		URL    string  `json:"url" binding:"required,max=2048"`
+		RoomID *string `json:"room_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Log.Error("Error binding json: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	emoji, err := ec.EmojiService.CreateEmoji(&model.CustomEmoji{
+		Name:      req.Name,
+		URL:       req.URL,
+		RoomID:    req.RoomID,
+		CreatedBy: c.GetUint("user_id"),
+	})
+	if err != nil {
+		Log.Error("Error creating emoji %q: %v", req.Name, err)
+		c.JSON(emojiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"emoji": emoji})
+}
+
+// DeleteEmoji removes a custom emoji
+func (ec *EmojiController) DeleteEmoji(c *gin.Context) {
+	emojiID, err := strconv.ParseUint(c.Param("emojiId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid emoji ID"})
+		return
+	}
+
+	if err := ec.EmojiService.DeleteEmoji(uint(emojiID)); err != nil {
+		Log.Error("Error deleting emoji %d: %v", emojiID, err)
+		c.JSON(emojiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Emoji deleted"})
+}
+
+// GetEmoji lists the global custom emoji
+func (ec *EmojiController) GetEmoji(c *gin.Context) {
+	ec.listEmoji(c, "")
+}
+
+// GetRoomEmoji lists the custom emoji usable in a room, for clients to render reactions
+func (ec *EmojiController) GetRoomEmoji(c *gin.Context) {
+	ec.listEmoji(c, c.Param("roomId"))
+}
+
+func (ec *EmojiController) listEmoji(c *gin.Context, roomID string) {
+	emoji, err := ec.EmojiService.ListEmoji(roomID, c.GetUint("user_id"))
+	if err != nil {
+		Log.Error("Error listing emoji for room %q: %v", roomID, err)
+		c.JSON(emojiErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"emoji": emoji})
+}
+
+// emojiErrorStatus maps emoji service errors to HTTP statuses
+func emojiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmoji):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrEmojiNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrEmojiNotFound),
+		errors.Is(err, service.ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrNotRoomMember):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"live-chatter/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthPingTimeout bounds the database check so a hung database cannot hang the probe
+const healthPingTimeout = 2 * time.Second
+
+// DatabaseHealth is the database check behind the health endpoints
+type DatabaseHealth interface {
+	Ping(ctx context.Context) error
+	PoolStats() (db.PoolStats, error)
+}
+
+type HealthController struct {
+	Database DatabaseHealth
+
+	ready atomic.Bool // Set once startup has finished, cleared when shutdown begins
+}
+
+func NewHealthController(database DatabaseHealth) *HealthController {
+	return &HealthController{Database: database}
+}
+
+// Health reports whether the server can do useful work: 200 when the database answers a ping,
+// 503 "degraded" when it does not. The connection pool statistics are included either way; the
+// ping error is only logged, since the endpoint is public.
+func (hc *HealthController) Health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthPingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	pingErr := hc.Database.Ping(ctx)
+	latency := time.Since(start)
+
+	database := gin.H{"status": "up", "latency_ms": latency.Milliseconds()}
+	if stats, err := hc.Database.PoolStats(); err == nil {
+		database["pool"] = stats
+	}
+
+	if pingErr != nil {
+		requestLog(c).Warn("Health check failed, database unreachable: %v", pingErr)
+		database["status"] = "down"
+		database["error"] = "unavailable"
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "database": database})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "healthy", "database": database})
+}
+
+// SetReady marks whether the server should receive traffic: true once migrations have run and
+// the database answered, false again when shutdown begins
+func (hc *HealthController) SetReady(ready bool) {
+	hc.ready.Store(ready)
+}
+
+// Readyz reports 200 once startup has completed and 503 before that or while shutting down,
+// so orchestrators only route traffic to a server that can serve it
+func (hc *HealthController) Readyz(c *gin.Context) {
+	if !hc.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// Livez only reports that the process is up and serving requests
+func (hc *HealthController) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
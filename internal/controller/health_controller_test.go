@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"live-chatter/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubDatabase answers pings with a fixed error and reports fixed pool statistics
+type stubDatabase struct {
+	pingErr error
+}
+
+func (d stubDatabase) Ping(ctx context.Context) error { return d.pingErr }
+
+func (d stubDatabase) PoolStats() (db.PoolStats, error) {
+	return db.PoolStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}, nil
+}
+
+// serveHealth calls one of the controller's endpoints and decodes the JSON body
+func serveHealth(t *testing.T, handler gin.HandlerFunc) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/probe", handler)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/probe", nil))
+	var body map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", res.Body, err)
+	}
+	return res.Code, body
+}
+
+func TestHealthWithDatabaseUp(t *testing.T) {
+	hc := NewHealthController(stubDatabase{})
+	code, body := serveHealth(t, hc.Health)
+
+	database, _ := body["database"].(map[string]any)
+	if code != http.StatusOK || body["status"] != "healthy" || database["status"] != "up" {
+		t.Fatalf("got %d %v, want 200 healthy", code, body)
+	}
+	pool, _ := database["pool"].(map[string]any)
+	if pool["open_connections"] != float64(3) || pool["max_open_connections"] != float64(10) {
+		t.Fatalf("pool stats missing: %v", database)
+	}
+}
+
+func TestHealthWithDatabaseDown(t *testing.T) {
+	hc := NewHealthController(stubDatabase{pingErr: errors.New("dial tcp 10.0.0.5:5432: connection refused")})
+	code, body := serveHealth(t, hc.Health)
+
+	database, _ := body["database"].(map[string]any)
+	if code != http.StatusServiceUnavailable || body["status"] != "degraded" || database["status"] != "down" {
+		t.Fatalf("got %d %v, want 503 degraded", code, body)
+	}
+	if _, ok := database["pool"]; !ok {
+		t.Fatalf("pool stats missing while degraded: %v", database)
+	}
+	encoded, _ := json.Marshal(body)
+	if strings.Contains(string(encoded), "10.0.0.5") {
+		t.Fatalf("the database error leaked into the public response: %s", encoded)
+	}
+}
+
+func TestLivezIgnoresTheDatabase(t *testing.T) {
+	hc := NewHealthController(stubDatabase{pingErr: errors.New("down")})
+	if code, body := serveHealth(t, hc.Livez); code != http.StatusOK || body["status"] != "alive" {
+		t.Fatalf("got %d %v, want 200 alive", code, body)
+	}
+}
+
+func TestReadyzFollowsReadiness(t *testing.T) {
+	hc := NewHealthController(stubDatabase{})
+
+	for _, step := range []struct {
+		ready  bool
+		code   int
+		status string
+	}{
+		{false, http.StatusServiceUnavailable, "not_ready"}, // Before startup has finished
+		{true, http.StatusOK, "ready"},
+		{false, http.StatusServiceUnavailable, "not_ready"}, // Once shutdown begins
+	} {
+		hc.SetReady(step.ready)
+		if code, body := serveHealth(t, hc.Readyz); code != step.code || body["status"] != step.status {
+			t.Fatalf("ready=%v: got %d %v, want %d %s", step.ready, code, body, step.code, step.status)
+		}
+	}
+}
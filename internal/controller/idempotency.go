@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key that makes a retried request safe
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	defaultIdempotencyTTL  = 24 * time.Hour
+	maxIdempotencyKeyLen   = 255
+	idempotencySweepPeriod = time.Minute
+)
+
+// idempotentResponse is the stored outcome of a completed request
+type idempotentResponse struct {
+	Status int
+	Body   interface{}
+}
+
+type idempotencyEntry struct {
+	fingerprint string
+	response    *idempotentResponse // nil while the first request is still in flight
+	expiresAt   time.Time
+}
+
+// idempotencyStore maps Idempotency-Key values to the response of the request that first used them.
+// Entries expire after the configured TTL.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+	}
+}
+
+// requestFingerprint identifies a request body so a reused key with a different payload can be rejected
+func requestFingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// begin claims key for a request. It returns the stored response when the key was already used
+// with the same payload; mismatch reports a different payload and inFlight a request still running.
+// When all results are false/nil the caller owns the key and must call complete or release.
+func (s *idempotencyStore) begin(key, fingerprint string) (stored *idempotentResponse, mismatch, inFlight bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if entry, exists := s.entries[key]; exists && now.Before(entry.expiresAt) {
+		if entry.fingerprint != fingerprint {
+			return nil, true, false
+		}
+		if entry.response == nil {
+			return nil, false, true
+		}
+		return entry.response, false, false
+	}
+
+	s.entries[key] = &idempotencyEntry{fingerprint: fingerprint, expiresAt: now.Add(s.ttl)}
+	return nil, false, false
+}
+
+// complete records the response for a claimed key so retries can replay it
+func (s *idempotencyStore) complete(key string, status int, body interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[key]; exists {
+		entry.response = &idempotentResponse{Status: status, Body: body}
+		entry.expiresAt = time.Now().Add(s.ttl)
+	}
+}
+
+// release frees a claimed key after a failed request so the client may retry it
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep drops expired entries; callers must hold mu
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepPeriod {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
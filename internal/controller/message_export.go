@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"live-chatter/pkg/model"
+)
+
+// messageExporter writes exported messages in one file format as they are streamed
+type messageExporter interface {
+	contentType() string
+	extension() string
+	begin() error
+	write(message model.Message) error
+	flush() error
+	end() error
+}
+
+// newMessageExporter returns the exporter for a format, or nil for an unknown one
+func newMessageExporter(format string, w io.Writer) messageExporter {
+	switch format {
+	case "json":
+		return &jsonMessageExporter{w: w}
+	case "csv":
+		return &csvMessageExporter{w: csv.NewWriter(w)}
+	default:
+		return nil
+	}
+}
+
+// exportedMessage is the record written for each message in an export
+type exportedMessage struct {
+	ID        uint   `json:"id"`
+	UserID    uint   `json:"user_id"`
+	Author    string `json:"author"`
+	Type      string `json:"type"`
+	Content   string `json:"content"`
+	ParentID  *uint  `json:"parent_id,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func toExportedMessage(message model.Message) exportedMessage {
+	return exportedMessage{
+		ID:        message.ID,
+		UserID:    message.UserID,
+		Author:    message.Username,
+		Type:      message.Type,
+		Content:   message.Content,
+		ParentID:  message.ParentID,
+		Timestamp: model.FormatTimestamp(message.CreatedAt),
+	}
+}
+
+// jsonMessageExporter writes a JSON array, one element at a time
+type jsonMessageExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonMessageExporter) contentType() string { return "application/json" }
+func (e *jsonMessageExporter) extension() string   { return "json" }
+
+func (e *jsonMessageExporter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonMessageExporter) write(message model.Message) error {
+	data, err := json.Marshal(toExportedMessage(message))
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonMessageExporter) flush() error { return nil }
+
+func (e *jsonMessageExporter) end() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// csvMessageExporter writes RFC 4180 CSV with a header row; content containing commas, quotes
+// or newlines is quoted by the csv package
+type csvMessageExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvMessageExporter) contentType() string { return "text/csv; charset=utf-8" }
+func (e *csvMessageExporter) extension() string   { return "csv" }
+
+func (e *csvMessageExporter) begin() error {
+	return e.w.Write([]string{"id", "user_id", "author", "type", "content", "parent_id", "timestamp"})
+}
+
+func (e *csvMessageExporter) write(message model.Message) error {
+	record := toExportedMessage(message)
+	parentID := ""
+	if record.ParentID != nil {
+		parentID = strconv.FormatUint(uint64(*record.ParentID), 10)
+	}
+	return e.w.Write([]string{
+		strconv.FormatUint(uint64(record.ID), 10),
+		strconv.FormatUint(uint64(record.UserID), 10),
+		record.Author,
+		record.Type,
+		record.Content,
+		parentID,
+		record.Timestamp,
+	})
+}
+
+// flush writes out the rows the csv package has buffered
+func (e *csvMessageExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvMessageExporter) end() error {
+	return e.flush()
+}
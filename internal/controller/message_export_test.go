@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"live-chatter/internal/service"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// seededRoom is two batches of history whose content needs escaping in CSV
+var seededRoom = [][]model.Message{
+	{
+		{ID: 1, UserID: 1, Username: "alice", Type: "text", Content: "hello, world", CreatedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{ID: 2, UserID: 2, Username: "bob", Type: "text", Content: "line one\nline \"two\"", CreatedAt: time.Date(2024, 3, 1, 9, 1, 0, 0, time.UTC)},
+	},
+	{
+		{ID: 3, UserID: 1, Username: "alice", Type: "text", Content: "plain", ParentID: uintPtr(2), CreatedAt: time.Date(2024, 3, 1, 9, 2, 0, 0, time.UTC)},
+	},
+}
+
+func uintPtr(v uint) *uint { return &v }
+
+// exportRoom requests an export of the seeded room in the given format
+func exportRoom(t *testing.T, chat service.ChatService, format string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	controller := &ChatController{ChatService: chat}
+	router := gin.New()
+	router.GET("/rooms/:roomId/export", func(c *gin.Context) { c.Set("user_id", uint(1)) }, controller.ExportRoomMessages)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/rooms/lobby/export?format="+format, nil))
+	return res
+}
+
+func TestExportRoomMessagesAsCSV(t *testing.T) {
+	res := exportRoom(t, &fakeChatService{batches: seededRoom}, "csv")
+
+	if res.Code != http.StatusOK || !strings.HasPrefix(res.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("status %d, content type %q", res.Code, res.Header().Get("Content-Type"))
+	}
+	if got := res.Header().Get("Content-Disposition"); got != `attachment; filename=room-lobby.csv` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"id", "user_id", "author", "type", "content", "parent_id", "timestamp"},
+		{"1", "1", "alice", "text", "hello, world", "", "2024-03-01T09:00:00.000Z"},
+		{"2", "2", "bob", "text", "line one\nline \"two\"", "", "2024-03-01T09:01:00.000Z"},
+		{"3", "1", "alice", "text", "plain", "2", "2024-03-01T09:02:00.000Z"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d:\n%v", len(records), len(want), records)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestExportRoomMessagesAsJSON(t *testing.T) {
+	res := exportRoom(t, &fakeChatService{batches: seededRoom}, "json")
+
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", res.Code, res.Header().Get("Content-Type"))
+	}
+	var exported []exportedMessage
+	if err := json.Unmarshal(res.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("export is not a JSON array: %v\n%s", err, res.Body)
+	}
+	if len(exported) != 3 {
+		t.Fatalf("got %d messages, want 3", len(exported))
+	}
+	if exported[1].Author != "bob" || exported[1].Content != "line one\nline \"two\"" || exported[1].Timestamp != "2024-03-01T09:01:00.000Z" {
+		t.Fatalf("unexpected message %+v", exported[1])
+	}
+	if exported[2].ParentID == nil || *exported[2].ParentID != 2 {
+		t.Fatalf("reply lost its parent: %+v", exported[2])
+	}
+}
+
+func TestExportEmptyRoomIsAnEmptyFile(t *testing.T) {
+	if res := exportRoom(t, &fakeChatService{}, "json"); res.Body.String() != "[]\n" {
+		t.Fatalf("empty JSON export = %q", res.Body)
+	}
+	if res := exportRoom(t, &fakeChatService{}, "csv"); res.Body.String() != "id,user_id,author,type,content,parent_id,timestamp\n" {
+		t.Fatalf("empty CSV export = %q", res.Body)
+	}
+}
+
+func TestExportRoomMessagesErrors(t *testing.T) {
+	if res := exportRoom(t, &fakeChatService{}, "xml"); res.Code != http.StatusBadRequest {
+		t.Fatalf("unknown format answered %d, want 400", res.Code)
+	}
+	res := exportRoom(t, &fakeChatService{exportErr: service.ErrNotRoomAdmin}, "csv")
+	if res.Code != http.StatusForbidden || res.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("non-admin export answered %d with Content-Disposition %q", res.Code, res.Header().Get("Content-Disposition"))
+	}
+}
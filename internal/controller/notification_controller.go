@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"errors"
+	Log "live-chatter/pkg/logger"
+	"net/http"
+	"strconv"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct {
+	NotificationService service.NotificationService
+	Pagination          config.PaginationConfig
+}
+
+func NewNotificationController(notificationService service.NotificationService, pagination config.PaginationConfig) *NotificationController {
+	return &NotificationController{NotificationService: notificationService, Pagination: pagination}
+}
+
+// GetNotifications lists the caller's notifications, newest first; ?unread=true limits it to unread ones
+func (nc *NotificationController) GetNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	unreadOnly, _ := strconv.ParseBool(c.Query("unread"))
+
+	limit := resolvePageLimit(c.Query("limit"), nc.Pagination)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	notifications, total, err := nc.NotificationService.GetNotifications(userID, unreadOnly, limit, offset)
+	if err != nil {
+		Log.Error("Error getting notifications for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
+
+// MarkRead marks one of the caller's notifications as read
+func (nc *NotificationController) MarkRead(c *gin.Context) {
+	notificationID, err := strconv.ParseUint(c.Param("notificationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := nc.NotificationService.MarkRead(userID, uint(notificationID)); err != nil {
+		if errors.Is(err, service.ErrNotificationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		Log.Error("Error marking notification %d read for user %d: %v", notificationID, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllRead marks all of the caller's notifications as read
+func (nc *NotificationController) MarkAllRead(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	count, err := nc.NotificationService.MarkAllRead(userID)
+	if err != nil {
+		Log.Error("Error marking notifications read for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "count": count})
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/service"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeNotificationService keeps each user's notifications in memory, newest last
+type fakeNotificationService struct {
+	mu            sync.Mutex
+	notifications []model.Notification
+}
+
+func (s *fakeNotificationService) GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]model.Notification, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matching []model.Notification
+	for i := len(s.notifications) - 1; i >= 0; i-- {
+		notification := s.notifications[i]
+		if notification.UserID == userID && !(unreadOnly && notification.Read) {
+			matching = append(matching, notification)
+		}
+	}
+	total := int64(len(matching))
+	if offset >= len(matching) {
+		return []model.Notification{}, total, nil
+	}
+	return matching[offset:min(offset+limit, len(matching))], total, nil
+}
+
+func (s *fakeNotificationService) MarkRead(userID, notificationID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.notifications {
+		if s.notifications[i].ID == notificationID && s.notifications[i].UserID == userID {
+			s.notifications[i].Read = true
+			return nil
+		}
+	}
+	return service.ErrNotificationNotFound
+}
+
+func (s *fakeNotificationService) MarkAllRead(userID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for i := range s.notifications {
+		if s.notifications[i].UserID == userID && !s.notifications[i].Read {
+			s.notifications[i].Read = true
+			count++
+		}
+	}
+	return count, nil
+}
+
+// notificationRouter serves the notification endpoints to user 2
+func notificationRouter(notifications service.NotificationService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	nc := NewNotificationController(notifications, config.PaginationConfig{})
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", uint(2)) })
+	router.GET("/notifications", nc.GetNotifications)
+	router.POST("/notifications/read-all", nc.MarkAllRead)
+	router.POST("/notifications/:notificationId/read", nc.MarkRead)
+	return router
+}
+
+// serveNotifications calls an endpoint and decodes its JSON body
+func serveNotifications(t *testing.T, router *gin.Engine, method, path string) (int, map[string]any) {
+	t.Helper()
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+	var body map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", res.Body, err)
+	}
+	return res.Code, body
+}
+
+func TestNotificationsAreListedAndMarkedRead(t *testing.T) {
+	notifications := &fakeNotificationService{notifications: []model.Notification{
+		{ID: 1, UserID: 2, Type: model.NotificationPrivateMessage},
+		{ID: 2, UserID: 3, Type: model.NotificationMention},
+		{ID: 3, UserID: 2, Type: model.NotificationMention},
+		{ID: 4, UserID: 2, Type: model.NotificationRoomKick},
+	}}
+	router := notificationRouter(notifications)
+	unreadIDs := func() []float64 {
+		t.Helper()
+		code, body := serveNotifications(t, router, http.MethodGet, "/notifications?unread=true")
+		if code != http.StatusOK {
+			t.Fatalf("list got %d %v", code, body)
+		}
+		var ids []float64
+		for _, entry := range body["notifications"].([]any) {
+			ids = append(ids, entry.(map[string]any)["id"].(float64))
+		}
+		return ids
+	}
+
+	code, body := serveNotifications(t, router, http.MethodGet, "/notifications?limit=2")
+	if code != http.StatusOK || body["total"] != float64(3) || len(body["notifications"].([]any)) != 2 {
+		t.Fatalf("first page got %d %v, want 2 of the caller's 3 notifications", code, body)
+	}
+	if ids := unreadIDs(); len(ids) != 3 || ids[0] != 4 {
+		t.Fatalf("unread %v, want the caller's three, newest first", ids)
+	}
+
+	if code, _ := serveNotifications(t, router, http.MethodPost, "/notifications/3/read"); code != http.StatusOK {
+		t.Fatalf("mark read got %d", code)
+	}
+	if code, _ := serveNotifications(t, router, http.MethodPost, "/notifications/2/read"); code != http.StatusNotFound {
+		t.Fatalf("marking another user's notification got %d, want 404", code)
+	}
+	if code, _ := serveNotifications(t, router, http.MethodPost, "/notifications/abc/read"); code != http.StatusBadRequest {
+		t.Fatalf("marking a malformed ID got %d, want 400", code)
+	}
+	if ids := unreadIDs(); len(ids) != 2 {
+		t.Fatalf("unread %v after marking one read, want two", ids)
+	}
+
+	code, body = serveNotifications(t, router, http.MethodPost, "/notifications/read-all")
+	if code != http.StatusOK || body["count"] != float64(2) {
+		t.Fatalf("mark all read got %d %v, want 2 marked", code, body)
+	}
+	if ids := unreadIDs(); len(ids) != 0 {
+		t.Fatalf("unread %v after marking all read", ids)
+	}
+	if notifications.notifications[1].Read {
+		t.Fatal("another user's notification was marked read")
+	}
+}
@@ -0,0 +1,23 @@
+package controller
+
+import (
+	Log "live-chatter/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLog returns a logger that tags each line with the request ID and, once the request
+// is authenticated, the acting user
+func requestLog(c *gin.Context) *Log.Entry {
+	fields := Log.Fields{}
+	if id := c.GetString("request_id"); id != "" {
+		fields["request_id"] = id
+	}
+	if userID := c.GetUint("user_id"); userID != 0 {
+		fields["user_id"] = userID
+	}
+	if username := c.GetString("username"); username != "" {
+		fields["username"] = username
+	}
+	return Log.With(fields)
+}
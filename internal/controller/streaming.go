@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+)
+
+// streamWriteTimeout is how long a streamed response may go without a successful write. The
+// server-wide WriteTimeout caps a whole response, which would cut off long exports and downloads.
+const streamWriteTimeout = 15 * time.Second
+
+// deadlineWriter pushes the connection's write deadline forward before every write, so a
+// streamed response is limited by stalls rather than by its total duration
+type deadlineWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+}
+
+// newDeadlineWriter wraps a response that is streamed for an unknown length of time
+func newDeadlineWriter(w http.ResponseWriter) *deadlineWriter {
+	return &deadlineWriter{ResponseWriter: w, controller: http.NewResponseController(w)}
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	// Writers that cannot set deadlines (such as test recorders) have no server timeout to extend
+	_ = w.controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
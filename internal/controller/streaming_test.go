@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlineWriterOutlivesServerWriteTimeout(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := newDeadlineWriter(w)
+		for i := 0; i < 5; i++ {
+			if _, err := io.WriteString(stream, "chunk\n"); err != nil {
+				return
+			}
+			http.NewResponseController(w).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	}
+	if got := strings.Count(string(body), "chunk"); got != 5 {
+		t.Fatalf("received %d chunks, want 5", got)
+	}
+}
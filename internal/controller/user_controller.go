@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	Log "live-chatter/pkg/logger"
+	"net/http"
+
+	"live-chatter/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserController struct {
+	UserService service.UserService
+}
+
+func NewUserController(userService service.UserService) *UserController {
+	return &UserController{UserService: userService}
+}
+
+// updateProfileRequest carries the editable profile fields. Omitted fields keep their value;
+// the password is deliberately absent so it cannot be changed here.
+type updateProfileRequest struct {
+	FirstName *string `json:"first_name" binding:"omitempty,max=100"`
+	LastName  *string `json:"last_name" binding:"omitempty,max=100"`
+	Email     *string `json:"email" binding:"omitempty,email,max=254"`
+	Locale    *string `json:"locale" binding:"omitempty,max=16"`
+}
+
+// UpdateProfile applies a partial update to the authenticated user's profile
+func (uc *UserController) UpdateProfile(c *gin.Context) {
+	var req updateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Log.Error("[UpdateProfile] Invalid input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	user, err := uc.UserService.UpdateProfile(userID, service.ProfileUpdate{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Locale:    req.Locale,
+	})
+	if err != nil {
+		Log.Error("[UpdateProfile] Failed for user %d: %v", userID, err)
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// DeactivateAccount deletes the authenticated user's account and signs them out everywhere
+func (uc *UserController) DeactivateAccount(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if err := uc.UserService.DeactivateAccount(userID); err != nil {
+		Log.Error("[DeactivateAccount] Failed for user %d: %v", userID, err)
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	Log.Info("[DeactivateAccount] Success: user %d deactivated", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// SetPresenceVisibility lets the user appear offline while staying connected
+func (uc *UserController) SetPresenceVisibility(c *gin.Context) {
+	var req struct {
+		AppearOffline *bool `json:"appear_offline" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Log.Error("[SetPresenceVisibility] Invalid input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := uc.UserService.SetAppearOffline(userID, *req.AppearOffline); err != nil {
+		Log.Error("[SetPresenceVisibility] Failed for user %d: %v", userID, err)
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"appear_offline": *req.AppearOffline})
+}
+
+// userErrorStatus maps account service errors to HTTP statuses
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidProfile):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrEmailTaken):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
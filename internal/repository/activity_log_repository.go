@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+)
+
+// ActivityLogFilter narrows an activity log query; zero values match everything
+type ActivityLogFilter struct {
+	UserID uint
+	Action string
+}
+
+type ActivityLogRepository interface {
+	CreateLog(entry *model.ActivityLog) error
+	GetLogs(filter ActivityLogFilter, limit, offset int) ([]model.ActivityLog, int64, error)
+}
+
+type activityLogRepository struct{}
+
+func NewActivityLogRepository() ActivityLogRepository {
+	return &activityLogRepository{}
+}
+
+func (r *activityLogRepository) CreateLog(entry *model.ActivityLog) error {
+	return db.GetDB().Omit("User").Create(entry).Error
+}
+
+// GetLogs returns matching entries newest first, along with the total number of matches
+func (r *activityLogRepository) GetLogs(filter ActivityLogFilter, limit, offset int) ([]model.ActivityLog, int64, error) {
+	query := db.GetDB().Model(&model.ActivityLog{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []model.ActivityLog
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
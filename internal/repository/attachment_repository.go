@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+type AttachmentRepository interface {
+	CreateAttachment(attachment *model.Attachment) error
+	GetAttachment(attachmentID string) (*model.Attachment, error)
+}
+
+type attachmentRepository struct{}
+
+func NewAttachmentRepository() AttachmentRepository {
+	return &attachmentRepository{}
+}
+
+func (r *attachmentRepository) CreateAttachment(attachment *model.Attachment) error {
+	return db.GetDB().Create(attachment).Error
+}
+
+func (r *attachmentRepository) GetAttachment(attachmentID string) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := db.GetDB().Where("id = ?", attachmentID).First(&attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &attachment, err
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"errors"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+type EmojiRepository interface {
+	CreateEmoji(emoji *model.CustomEmoji) error
+	GetEmojiByID(id uint) (*model.CustomEmoji, error)
+	FindEmoji(name string, roomID *string) (*model.CustomEmoji, error)
+	ListEmoji(roomID string) ([]model.CustomEmoji, error)
+	ListEmojiForRooms(roomIDs []string) ([]model.CustomEmoji, error)
+	DeleteEmoji(id uint) error
+}
+
+type emojiRepository struct{}
+
+func NewEmojiRepository() EmojiRepository {
+	return &emojiRepository{}
+}
+
+func (r *emojiRepository) CreateEmoji(emoji *model.CustomEmoji) error {
+	return db.GetDB().Create(emoji).Error
+}
+
+func (r *emojiRepository) GetEmojiByID(id uint) (*model.CustomEmoji, error) {
+	var emoji model.CustomEmoji
+	err := db.GetDB().First(&emoji, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &emoji, err
+}
+
+// FindEmoji looks up an emoji by name in exactly one scope: global when roomID is nil
+func (r *emojiRepository) FindEmoji(name string, roomID *string) (*model.CustomEmoji, error) {
+	query := db.GetDB().Where("name = ?", name)
+	if roomID == nil {
+		query = query.Where("room_id IS NULL")
+	} else {
+		query = query.Where("room_id = ?", *roomID)
+	}
+
+	var emoji model.CustomEmoji
+	err := query.First(&emoji).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &emoji, err
+}
+
+// ListEmoji returns the global emoji plus those scoped to the room, if one is given
+func (r *emojiRepository) ListEmoji(roomID string) ([]model.CustomEmoji, error) {
+	query := db.GetDB().Where("room_id IS NULL")
+	if roomID != "" {
+		query = query.Or("room_id = ?", roomID)
+	}
+
+	var emoji []model.CustomEmoji
+	err := query.Order("name").Find(&emoji).Error
+	return emoji, err
+}
+
+// ListEmojiForRooms returns the global emoji plus those scoped to any of the rooms
+func (r *emojiRepository) ListEmojiForRooms(roomIDs []string) ([]model.CustomEmoji, error) {
+	query := db.GetDB().Where("room_id IS NULL")
+	if len(roomIDs) > 0 {
+		query = query.Or("room_id IN ?", roomIDs)
+	}
+
+	var emoji []model.CustomEmoji
+	err := query.Order("name").Find(&emoji).Error
+	return emoji, err
+}
+
+func (r *emojiRepository) DeleteEmoji(id uint) error {
+	return db.GetDB().Delete(&model.CustomEmoji{}, id).Error
+}
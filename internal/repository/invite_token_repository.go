@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"errors"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InviteTokenRepository interface {
+	CreateToken(token *model.InviteToken) error
+	GetToken(token string) (*model.InviteToken, error)
+	RedeemToken(token string) (bool, error)
+}
+
+type inviteTokenRepository struct{}
+
+func NewInviteTokenRepository() InviteTokenRepository {
+	return &inviteTokenRepository{}
+}
+
+func (r *inviteTokenRepository) CreateToken(token *model.InviteToken) error {
+	return db.GetDB().Create(token).Error
+}
+
+func (r *inviteTokenRepository) GetToken(token string) (*model.InviteToken, error) {
+	var inviteToken model.InviteToken
+	err := db.GetDB().Where("token = ?", token).First(&inviteToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &inviteToken, err
+}
+
+// RedeemToken counts one use of the token in a single conditional update, so concurrent
+// redemptions can never exceed MaxUses. It reports false if the token is expired or used up.
+func (r *inviteTokenRepository) RedeemToken(token string) (bool, error) {
+	result := db.GetDB().Model(&model.InviteToken{}).
+		Where("token = ? AND expires_at > ?", token, time.Now()).
+		Where("max_uses = 0 OR uses < max_uses").
+		Update("uses", gorm.Expr("uses + 1"))
+	return result.RowsAffected > 0, result.Error
+}
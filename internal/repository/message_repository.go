@@ -1,44 +1,88 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"live-chatter/pkg/db"
 	"live-chatter/pkg/model"
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MessageRepository interface {
 	CreateMessage(message *model.Message) error
-	CreatePrivateMessage(message *model.PrivateMessage) error
 	GetMessagesByRoomID(roomID string, limit, offset int, before *time.Time) ([]model.Message, error)
-	SearchMessages(query, roomID string, limit int) ([]model.Message, error)
+	GetMessagesByRoomCursor(roomID string, limit int, cursor *MessageCursor) ([]model.Message, error)
+	GetMessagesByRoomAfter(roomID string, limit int, cursor *MessageCursor) ([]model.Message, error)
+	SearchMessages(query, roomID string, authorID, memberID uint, limit int) ([]model.Message, error)
 	GetMessageByID(messageID uint) (*model.Message, error)
-	UpdateMessage(message *model.Message) error
-	DeleteMessage(messageID uint) error
-	GetMessageCountByRoom(roomID string) (int64, error)
+	GetMessagesByIDs(ids []uint) ([]model.Message, error)
+	GetThreadParent(messageID uint) (*model.Message, error)
+	GetAncestorIDs(messageID uint, maxDepth int) ([]uint, error)
+	GetReplies(parentID uint, limit, offset int) ([]model.Message, error)
+	UpdateMessage(message *model.Message) (bool, error)
+	DeleteMessage(messageID, version uint) (bool, error)
+	DeleteMessagesOlderThan(roomID string, cutoff time.Time, hard bool) (int64, error)
+	GetMessageCountByRoom(roomID string, before *time.Time) (int64, error)
+	PinMessage(pin *model.PinnedMessage) (bool, error)
+	UnpinMessage(roomID string, messageID uint) (bool, error)
+	GetPinnedMessages(roomID string) ([]model.PinnedMessage, error)
 }
 
-type messageRepository struct {
-	db *gorm.DB
+// searchLanguagePattern accepts Postgres text search configuration names, which are spliced into SQL
+var searchLanguagePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// likeEscaper escapes LIKE wildcards so a search for "50%" matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// fullTextLanguage is the text search configuration used by SearchMessages; empty means the
+// full-text index is unavailable and searches fall back to ILIKE
+var fullTextLanguage string
+
+// EnableFullTextSearch creates the GIN index over message content for the given text search
+// configuration (such as "english" or "simple") and switches SearchMessages to ranked full-text
+// queries. On failure searches keep using ILIKE.
+func EnableFullTextSearch(language string) error {
+	if !searchLanguagePattern.MatchString(language) {
+		return fmt.Errorf("invalid text search language %q", language)
+	}
+
+	err := db.GetDB().Exec(fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS idx_messages_content_fts ON messages USING GIN (to_tsvector('%s', content))",
+		language)).Error
+	if err != nil {
+		return err
+	}
+
+	fullTextLanguage = language
+	return nil
 }
 
-func NewMessageRepository() MessageRepository {
-	return &messageRepository{db: db.GetDB()}
+// MessageCursor marks a position in a room's history by the last message a client has seen.
+// Ties on created_at are broken by ID so every message has exactly one position.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        uint
 }
 
-func (r *messageRepository) CreateMessage(message *model.Message) error {
-	return r.db.Create(message).Error
+type messageRepository struct{}
+
+func NewMessageRepository() MessageRepository {
+	return &messageRepository{}
 }
 
-func (r *messageRepository) CreatePrivateMessage(message *model.PrivateMessage) error {
-	return r.db.Create(message).Error
+func (r *messageRepository) CreateMessage(message *model.Message) error {
+	return db.GetDB().Create(message).Error
 }
 
 func (r *messageRepository) GetMessagesByRoomID(roomID string, limit, offset int, before *time.Time) ([]model.Message, error) {
 	var messages []model.Message
 
-	query := r.db.Preload("User").Where("room_id = ? AND deleted_at IS NULL", roomID)
+	query := db.GetDB().Preload("User").Where("room_id = ? AND deleted_at IS NULL", roomID)
 
 	if before != nil {
 		query = query.Where("created_at < ?", before)
@@ -52,14 +96,75 @@ func (r *messageRepository) GetMessagesByRoomID(roomID string, limit, offset int
 	return messages, err
 }
 
-func (r *messageRepository) SearchMessages(query, roomID string, limit int) ([]model.Message, error) {
+// GetMessagesByRoomCursor returns up to limit messages older than the cursor, newest first, or
+// the newest messages when cursor is nil. Unlike offsets, the keyset stays stable while new
+// messages arrive between page fetches.
+func (r *messageRepository) GetMessagesByRoomCursor(roomID string, limit int, cursor *MessageCursor) ([]model.Message, error) {
+	var messages []model.Message
+
+	query := db.GetDB().Preload("User").Where("room_id = ? AND deleted_at IS NULL", roomID)
+
+	if cursor != nil {
+		query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	err := query.Order("created_at DESC").
+		Order("id DESC").
+		Limit(limit).
+		Find(&messages).Error
+
+	return messages, err
+}
+
+// GetMessagesByRoomAfter returns up to limit messages newer than the cursor, oldest first, or the
+// oldest messages when cursor is nil. It walks a room's history forwards using the same keyset as
+// GetMessagesByRoomCursor.
+func (r *messageRepository) GetMessagesByRoomAfter(roomID string, limit int, cursor *MessageCursor) ([]model.Message, error) {
+	var messages []model.Message
+
+	query := db.GetDB().Where("room_id = ? AND deleted_at IS NULL", roomID)
+
+	if cursor != nil {
+		query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	err := query.Order("created_at ASC").
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+
+	return messages, err
+}
+
+// SearchMessages finds messages matching the query in the rooms memberID currently belongs to,
+// optionally within one room and from one author. With full-text search enabled, results are
+// ordered by relevance and then recency; otherwise they are substring matches, newest first.
+func (r *messageRepository) SearchMessages(query, roomID string, authorID, memberID uint, limit int) ([]model.Message, error) {
 	var messages []model.Message
 
-	dbQuery := r.db.Preload("User").Where("content LIKE ? AND deleted_at IS NULL", "%"+query+"%")
+	dbQuery := db.GetDB().Preload("User").
+		Where("deleted_at IS NULL").
+		Where("room_id IN (SELECT room_id FROM user_rooms WHERE user_id = ? AND left_at IS NULL)", memberID)
 
 	if roomID != "" {
 		dbQuery = dbQuery.Where("room_id = ?", roomID)
 	}
+	if authorID != 0 {
+		dbQuery = dbQuery.Where("user_id = ?", authorID)
+	}
+
+	if fullTextLanguage != "" {
+		// The document expression must match the index definition for the index to be used
+		document := fmt.Sprintf("to_tsvector('%s', content)", fullTextLanguage)
+		dbQuery = dbQuery.
+			Where(document+" @@ plainto_tsquery(?::regconfig, ?)", fullTextLanguage, query).
+			Order(clause.Expr{
+				SQL:  "ts_rank(" + document + ", plainto_tsquery(?::regconfig, ?)) DESC",
+				Vars: []interface{}{fullTextLanguage, query},
+			})
+	} else {
+		dbQuery = dbQuery.Where("content ILIKE ?", "%"+likeEscaper.Replace(query)+"%")
+	}
 
 	err := dbQuery.Order("created_at DESC").
 		Limit(limit).
@@ -68,31 +173,163 @@ func (r *messageRepository) SearchMessages(query, roomID string, limit int) ([]m
 	return messages, err
 }
 
+// GetMessageByID loads a message with its author, parent and replies; a missing or deleted
+// message yields nil without an error
 func (r *messageRepository) GetMessageByID(messageID uint) (*model.Message, error) {
 	var message model.Message
-	err := r.db.Preload("User").Preload("Parent").Preload("Replies").
+	err := db.GetDB().Preload("User").Preload("Parent").Preload("Replies").
 		First(&message, messageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetMessagesByIDs loads the given messages with their authors in one query, in no particular
+// order. Missing and deleted messages are left out.
+func (r *messageRepository) GetMessagesByIDs(ids []uint) ([]model.Message, error) {
+	var messages []model.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := db.GetDB().Preload("User").Where("id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+// GetThreadParent loads a prospective reply parent without its relations. Deleted messages are
+// included so callers can tell a deleted parent apart from a missing one.
+func (r *messageRepository) GetThreadParent(messageID uint) (*model.Message, error) {
+	var message model.Message
+	err := db.GetDB().Unscoped().First(&message, messageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	return &message, err
 }
 
-func (r *messageRepository) UpdateMessage(message *model.Message) error {
-	// Set edited flag and timestamp
+// GetAncestorIDs returns the message's ID followed by its ancestors' IDs up the thread,
+// at most maxDepth entries. Deleted messages stay in the chain so they cannot hide a cycle.
+func (r *messageRepository) GetAncestorIDs(messageID uint, maxDepth int) ([]uint, error) {
+	var ids []uint
+	err := db.GetDB().Raw(`
+		WITH RECURSIVE chain (id, parent_id, depth) AS (
+			SELECT id, parent_id, 1 FROM messages WHERE id = ?
+			UNION ALL
+			SELECT m.id, m.parent_id, chain.depth + 1
+			FROM messages m JOIN chain ON m.id = chain.parent_id
+			WHERE chain.depth < ?
+		)
+		SELECT id FROM chain ORDER BY depth`, messageID, maxDepth).Scan(&ids).Error
+	return ids, err
+}
+
+func (r *messageRepository) GetReplies(parentID uint, limit, offset int) ([]model.Message, error) {
+	var replies []model.Message
+	err := db.GetDB().Preload("User").
+		Where("parent_id = ? AND deleted_at IS NULL", parentID).
+		Order("created_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&replies).Error
+	return replies, err
+}
+
+// UpdateMessage saves a message's new content, provided it is still at message.Version. It returns
+// false, leaving message untouched, when another write changed the row first.
+func (r *messageRepository) UpdateMessage(message *model.Message) (bool, error) {
 	now := time.Now()
+	result := db.GetDB().Model(&model.Message{}).
+		Where("id = ? AND version = ?", message.ID, message.Version).
+		Updates(map[string]interface{}{
+			"content":   message.Content,
+			"edited":    true,
+			"edited_at": now,
+			"version":   message.Version + 1,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
 	message.Edited = true
 	message.EditedAt = &now
+	message.Version++
+	return true, nil
+}
 
-	return r.db.Save(message).Error
+// DeleteMessage soft-deletes a message, provided it is still at version. It returns false when the
+// message was changed or deleted in the meantime.
+func (r *messageRepository) DeleteMessage(messageID, version uint) (bool, error) {
+	result := db.GetDB().Where("version = ?", version).Delete(&model.Message{}, messageID)
+	return result.RowsAffected > 0, result.Error
 }
 
-func (r *messageRepository) DeleteMessage(messageID uint) error {
-	// Soft delete the message
-	return r.db.Delete(&model.Message{}, messageID).Error
+// DeleteMessagesOlderThan removes a room's messages created before cutoff and returns how many
+// were affected. Messages are soft-deleted unless hard is set, in which case their rows, pins and
+// reactions are removed and replies to them are detached.
+func (r *messageRepository) DeleteMessagesOlderThan(roomID string, cutoff time.Time, hard bool) (int64, error) {
+	if !hard {
+		result := db.GetDB().Where("room_id = ? AND created_at < ?", roomID, cutoff).Delete(&model.Message{})
+		return result.RowsAffected, result.Error
+	}
+
+	var deleted int64
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&model.Message{}).Select("id").
+			Where("room_id = ? AND created_at < ?", roomID, cutoff)
+
+		if err := tx.Where("message_id IN (?)", expired).Delete(&model.PinnedMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", expired).Delete(&model.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&model.Message{}).Where("parent_id IN (?)", expired).
+			Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("room_id = ? AND created_at < ?", roomID, cutoff).Delete(&model.Message{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
 }
 
-func (r *messageRepository) GetMessageCountByRoom(roomID string) (int64, error) {
+// GetMessageCountByRoom counts a room's messages, only those older than before when it is set
+func (r *messageRepository) GetMessageCountByRoom(roomID string, before *time.Time) (int64, error) {
+	query := db.GetDB().Model(&model.Message{}).Where("room_id = ? AND deleted_at IS NULL", roomID)
+	if before != nil {
+		query = query.Where("created_at < ?", before)
+	}
+
 	var count int64
-	err := r.db.Model(&model.Message{}).
-		Where("room_id = ? AND deleted_at IS NULL", roomID).
-		Count(&count).Error
+	err := query.Count(&count).Error
 	return count, err
 }
+
+// PinMessage pins a message, reporting false if it was already pinned
+func (r *messageRepository) PinMessage(pin *model.PinnedMessage) (bool, error) {
+	result := db.GetDB().Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(pin)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UnpinMessage removes a pin, reporting whether there was one
+func (r *messageRepository) UnpinMessage(roomID string, messageID uint) (bool, error) {
+	result := db.GetDB().Where("room_id = ? AND message_id = ?", roomID, messageID).Delete(&model.PinnedMessage{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetPinnedMessages lists a room's pins with their messages and authors, most recent pin
+// first. Pins of deleted messages are left out.
+func (r *messageRepository) GetPinnedMessages(roomID string) ([]model.PinnedMessage, error) {
+	var pins []model.PinnedMessage
+	err := db.GetDB().Preload("Message.User").
+		Joins("JOIN messages ON messages.id = pinned_messages.message_id AND messages.deleted_at IS NULL").
+		Where("pinned_messages.room_id = ?", roomID).
+		Order("pinned_messages.pinned_at DESC").
+		Find(&pins).Error
+	return pins, err
+}
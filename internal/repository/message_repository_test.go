@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+)
+
+func TestSearchMessagesOnlyCoversTheMembersRooms(t *testing.T) {
+	useTestDatabase(t)
+	rooms := NewRoomRepository()
+	messages := NewMessageRepository()
+	owner := createTestUser(t, "owner")
+	member := createTestUser(t, "member")
+	createTestRoom(t, "lobby", "public", owner)
+	createTestRoom(t, "staff", "private", owner)
+	createTestRoom(t, "attic", "public", owner)
+	for _, roomID := range []string{"lobby", "staff", "attic"} {
+		if _, err := rooms.AddUserToRoom(roomID, owner.ID, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if err := messages.CreateMessage(&model.Message{RoomID: roomID, UserID: owner.ID, Content: "release notes for " + roomID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rooms.AddUserToRoom("lobby", member.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rooms.AddUserToRoom("attic", member.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rooms.RemoveUserFromRoom("attic", member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := messages.SearchMessages("release", "", 0, member.ID, 20)
+	if err != nil || len(found) != 1 || found[0].RoomID != "lobby" {
+		t.Fatalf("search across rooms = %+v, %v, want only the lobby message", found, err)
+	}
+	found, err = messages.SearchMessages("release", "staff", 0, member.ID, 20)
+	if err != nil || len(found) != 0 {
+		t.Fatalf("search in a private room the user is not in = %+v, %v, want nothing", found, err)
+	}
+	found, err = messages.SearchMessages("release", "", 0, owner.ID, 20)
+	if err != nil || len(found) != 3 {
+		t.Fatalf("search by the member of every room = %+v, %v, want all three messages", found, err)
+	}
+}
+
+// searchWords make up the seeded messages; searchTerm is in roughly one message in a hundred
+var searchWords = strings.Fields("the a meeting lunch build deploy review coffee ticket sprint " +
+	"office update branch merge weekend budget client design report schedule")
+
+const searchTerm = "postmortem"
+
+// seedSearchMessages fills a room the returned member belongs to with count messages of random
+// words, for the search benchmarks
+func seedSearchMessages(b *testing.B, count int) uint {
+	b.Helper()
+	useTestDatabase(b)
+	member := createTestUser(b, "member")
+	createTestRoom(b, "lobby", "public", member)
+	if _, err := NewRoomRepository().AddUserToRoom("lobby", member.ID, "admin"); err != nil {
+		b.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	messages := make([]model.Message, count)
+	for i := range messages {
+		words := make([]string, 12)
+		for j := range words {
+			words[j] = searchWords[random.Intn(len(searchWords))]
+		}
+		if random.Intn(100) == 0 {
+			words[random.Intn(len(words))] = searchTerm
+		}
+		messages[i] = model.Message{RoomID: "lobby", UserID: member.ID, Content: strings.Join(words, " ")}
+	}
+	if err := db.GetDB().CreateInBatches(messages, 1000).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := db.GetDB().Exec("ANALYZE messages").Error; err != nil {
+		b.Fatal(err)
+	}
+	return member.ID
+}
+
+// BenchmarkSearchMessages compares the ILIKE fallback with full-text search over the same
+// seeded messages
+func BenchmarkSearchMessages(b *testing.B) {
+	for _, count := range []int{10000, 100000} {
+		b.Run(fmt.Sprintf("messages=%d", count), func(b *testing.B) {
+			memberID := seedSearchMessages(b, count)
+			repo := NewMessageRepository()
+			b.Cleanup(func() { fullTextLanguage = "" })
+
+			b.Run("ILIKE", func(b *testing.B) {
+				fullTextLanguage = ""
+				for i := 0; i < b.N; i++ {
+					if _, err := repo.SearchMessages(searchTerm, "", 0, memberID, 20); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run("tsvector", func(b *testing.B) {
+				if err := EnableFullTextSearch("english"); err != nil {
+					b.Fatalf("full-text search unavailable: %v", err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := repo.SearchMessages(searchTerm, "", 0, memberID, 20); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
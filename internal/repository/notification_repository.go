@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+)
+
+type NotificationRepository interface {
+	CreateNotifications(notifications []model.Notification) error
+	GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]model.Notification, int64, error)
+	MarkRead(userID, notificationID uint) (bool, error)
+	MarkAllRead(userID uint) (int64, error)
+}
+
+type notificationRepository struct{}
+
+func NewNotificationRepository() NotificationRepository {
+	return &notificationRepository{}
+}
+
+func (r *notificationRepository) CreateNotifications(notifications []model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.GetDB().Create(&notifications).Error
+}
+
+// GetNotifications returns a page of the user's notifications newest first, along with the
+// total number of matches
+func (r *notificationRepository) GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]model.Notification, int64, error) {
+	query := db.GetDB().Model(&model.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read = ?", false)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []model.Notification
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&notifications).Error
+	return notifications, total, err
+}
+
+// MarkRead marks one of the user's notifications as read. It reports false when the user has no
+// such notification; one already read is left as it was.
+func (r *notificationRepository) MarkRead(userID, notificationID uint) (bool, error) {
+	var notification model.Notification
+	err := db.GetDB().Where("id = ? AND user_id = ?", notificationID, userID).Limit(1).Find(&notification).Error
+	if err != nil || notification.ID == 0 {
+		return false, err
+	}
+	if notification.Read {
+		return true, nil
+	}
+	err = db.GetDB().Model(&notification).Updates(map[string]interface{}{"read": true, "read_at": time.Now()}).Error
+	return err == nil, err
+}
+
+// MarkAllRead marks every unread notification of the user as read and returns how many changed
+func (r *notificationRepository) MarkAllRead(userID uint) (int64, error) {
+	result := db.GetDB().Model(&model.Notification{}).
+		Where("user_id = ? AND read = ?", userID, false).
+		Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	CreateToken(token *model.PasswordResetToken) error
+	GetToken(tokenHash string) (*model.PasswordResetToken, error)
+	UseToken(tokenHash string) (bool, error)
+	DeleteUserTokens(userID uint) error
+}
+
+type passwordResetRepository struct{}
+
+func NewPasswordResetRepository() PasswordResetRepository {
+	return &passwordResetRepository{}
+}
+
+func (r *passwordResetRepository) CreateToken(token *model.PasswordResetToken) error {
+	return db.GetDB().Create(token).Error
+}
+
+func (r *passwordResetRepository) GetToken(tokenHash string) (*model.PasswordResetToken, error) {
+	var token model.PasswordResetToken
+	err := db.GetDB().Where("token_hash = ?", tokenHash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &token, err
+}
+
+// UseToken marks the token used in a single conditional update, so two concurrent resets
+// cannot both succeed. It reports false if the token is already used or has expired.
+func (r *passwordResetRepository) UseToken(tokenHash string) (bool, error) {
+	result := db.GetDB().Model(&model.PasswordResetToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteUserTokens discards every reset token issued to the user
+func (r *passwordResetRepository) DeleteUserTokens(userID uint) error {
+	return db.GetDB().Where("user_id = ?", userID).Delete(&model.PasswordResetToken{}).Error
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PrivateMessageRepository interface {
+	CreatePrivateMessage(message *model.PrivateMessage) error
+	GetUnreadMessages(recipientID uint) ([]model.PrivateMessage, error)
+	GetConversation(userID, otherUserID uint, limit, offset int) ([]model.PrivateMessage, error)
+	MarkConversationRead(recipientID, senderID uint) ([]model.PrivateMessage, time.Time, error)
+	GetPrivateMessageByID(messageID uint) (*model.PrivateMessage, error)
+	MarkMessageRead(messageID uint) (time.Time, error)
+	MarkDelivered(messageIDs []uint, deliveredAt time.Time) error
+}
+
+type privateMessageRepository struct{}
+
+func NewPrivateMessageRepository() PrivateMessageRepository {
+	return &privateMessageRepository{}
+}
+
+func (r *privateMessageRepository) CreatePrivateMessage(message *model.PrivateMessage) error {
+	return db.GetDB().Create(message).Error
+}
+
+// GetUnreadMessages returns every unread message addressed to the user, oldest first
+func (r *privateMessageRepository) GetUnreadMessages(recipientID uint) ([]model.PrivateMessage, error) {
+	var messages []model.PrivateMessage
+	err := db.GetDB().Preload("Sender").
+		Where("recipient_id = ? AND read = ?", recipientID, false).
+		Order("created_at ASC").
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetConversation returns the messages exchanged between two users, newest first
+func (r *privateMessageRepository) GetConversation(userID, otherUserID uint, limit, offset int) ([]model.PrivateMessage, error) {
+	var messages []model.PrivateMessage
+	err := db.GetDB().
+		Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
+			userID, otherUserID, otherUserID, userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&messages).Error
+	return messages, err
+}
+
+// MarkConversationRead flags every unread message from sender to recipient as read and returns
+// the IDs of the messages it changed, along with the recorded read time
+func (r *privateMessageRepository) MarkConversationRead(recipientID, senderID uint) ([]model.PrivateMessage, time.Time, error) {
+	readAt := time.Now()
+	var marked []model.PrivateMessage
+	err := db.GetDB().Model(&marked).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("recipient_id = ? AND sender_id = ? AND read = ?", recipientID, senderID, false).
+		Updates(map[string]interface{}{
+			"read":    true,
+			"read_at": readAt,
+		}).Error
+	return marked, readAt, err
+}
+
+func (r *privateMessageRepository) GetPrivateMessageByID(messageID uint) (*model.PrivateMessage, error) {
+	var message model.PrivateMessage
+	err := db.GetDB().Preload("Sender").First(&message, messageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &message, err
+}
+
+// MarkMessageRead flags a single message as read and returns the recorded read time
+func (r *privateMessageRepository) MarkMessageRead(messageID uint) (time.Time, error) {
+	readAt := time.Now()
+	err := db.GetDB().Model(&model.PrivateMessage{}).
+		Where("id = ?", messageID).
+		Updates(map[string]interface{}{
+			"read":    true,
+			"read_at": readAt,
+		}).Error
+	return readAt, err
+}
+
+// MarkDelivered records when the messages first reached the recipient, leaving messages that
+// were already delivered untouched
+func (r *privateMessageRepository) MarkDelivered(messageIDs []uint, deliveredAt time.Time) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return db.GetDB().Model(&model.PrivateMessage{}).
+		Where("id IN ? AND delivered_at IS NULL", messageIDs).
+		Update("delivered_at", deliveredAt).Error
+}
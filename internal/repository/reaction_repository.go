@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+
+	"gorm.io/gorm/clause"
+)
+
+// ReactionCount is how many users reacted to a message with one emoji
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+type ReactionRepository interface {
+	AddReaction(reaction *model.MessageReaction) (bool, error)
+	RemoveReaction(messageID, userID uint, emoji string) (bool, error)
+	CountReactions(messageID uint) ([]ReactionCount, error)
+}
+
+type reactionRepository struct{}
+
+func NewReactionRepository() ReactionRepository {
+	return &reactionRepository{}
+}
+
+// AddReaction stores a reaction, reporting false when the user had already reacted with that emoji
+func (r *reactionRepository) AddReaction(reaction *model.MessageReaction) (bool, error) {
+	result := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RemoveReaction deletes a reaction, reporting whether there was one to delete
+func (r *reactionRepository) RemoveReaction(messageID, userID uint, emoji string) (bool, error) {
+	result := db.GetDB().
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&model.MessageReaction{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountReactions aggregates a message's reactions per emoji, in the order each emoji was first used
+func (r *reactionRepository) CountReactions(messageID uint) ([]ReactionCount, error) {
+	var counts []ReactionCount
+	err := db.GetDB().Model(&model.MessageReaction{}).
+		Select("emoji, COUNT(*) AS count").
+		Where("message_id = ?", messageID).
+		Group("emoji").
+		Order("MIN(created_at)").
+		Scan(&counts).Error
+	return counts, err
+}
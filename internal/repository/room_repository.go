@@ -6,52 +6,87 @@ import (
 	"live-chatter/pkg/model"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RoomRepository interface {
 	CreateRoom(room *model.Room) error
+	CreateRoomWithCreator(room *model.Room, creatorID uint) error
 	GetAllRooms() ([]model.Room, error)
 	GetRoomByID(roomID string) (*model.Room, error)
 	GetRoomByName(name string) (*model.Room, error)
 	GetUserRooms(userID uint) ([]model.Room, error)
-	AddUserToRoom(roomID string, userID uint, role string) error
-	RemoveUserFromRoom(roomID string, userID uint) error
+	AddUserToRoom(roomID string, userID uint, role string) (bool, error)
+	RemoveUserFromRoom(roomID string, userID uint) (bool, error)
+	CountActiveMembers(roomID string) (int64, error)
+	CountUserRooms(userID uint) (int64, error)
+	CountRoomsCreatedBy(userID uint) (int64, error)
 	IsUserInRoom(roomID string, userID uint) (bool, error)
+	GetUserRole(roomID string, userID uint) (string, error)
+	GetRoomMembers(roomID string) ([]model.UserRoom, error)
+	UpdateMemberRole(roomID string, userID uint, role string) (bool, error)
+	BanUser(ban *model.RoomBan) error
+	UnbanUser(roomID string, userID uint) (bool, error)
+	IsUserBanned(roomID string, userID uint) (bool, error)
+	CreateInvite(invite *model.RoomInvite) error
+	HasInvite(roomID string, userID uint) (bool, error)
+	DeleteInvite(roomID string, userID uint) error
+	SetMuted(roomID string, userID uint, muted bool) error
+	SetFavorite(roomID string, userID uint, favorite bool) error
+	TouchMembership(roomID string, userID uint) error
+	GetInactiveMembers(cutoff time.Time) ([]model.UserRoom, error)
 	UpdateRoom(room *model.Room) error
 	DeleteRoom(roomID string) error
 }
 
-type roomRepository struct {
-	db *gorm.DB
-}
+type roomRepository struct{}
 
 func NewRoomRepository() RoomRepository {
-	return &roomRepository{db: db.GetDB()}
+	return &roomRepository{}
 }
 
 func (r *roomRepository) CreateRoom(room *model.Room) error {
-	return r.db.Create(room).Error
+	return db.GetDB().Create(room).Error
+}
+
+// CreateRoomWithCreator creates the room and makes its creator an admin in one transaction,
+// so a room can never exist without an admin
+func (r *roomRepository) CreateRoomWithCreator(room *model.Room, creatorID uint) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(room).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.UserRoom{
+			UserID:   creatorID,
+			RoomID:   room.ID,
+			Role:     "admin",
+			JoinedAt: time.Now(),
+		}).Error
+	})
 }
 
 func (r *roomRepository) GetAllRooms() ([]model.Room, error) {
 	var rooms []model.Room
-	err := r.db.Preload("Creator").Find(&rooms).Error
+	err := db.GetDB().Preload("Creator").Find(&rooms).Error
 	return rooms, err
 }
 
 func (r *roomRepository) GetRoomByID(roomID string) (*model.Room, error) {
 	var room model.Room
-	err := r.db.Preload("Creator").First(&room, "id = ?", roomID).Error
+	err := db.GetDB().Preload("Creator").First(&room, "id = ?", roomID).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &room, err
 }
 
+// GetRoomByName finds the live room with the given name. Deleted rooms are ignored, so a room's
+// name is free for reuse as soon as it is deleted.
 func (r *roomRepository) GetRoomByName(name string) (*model.Room, error) {
 	var room model.Room
-	err := r.db.First(&room, "name = ?", name).Error
+	err := db.GetDB().First(&room, "name = ? AND deleted_at IS NULL", name).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -60,7 +95,7 @@ func (r *roomRepository) GetRoomByName(name string) (*model.Room, error) {
 
 func (r *roomRepository) GetUserRooms(userID uint) ([]model.Room, error) {
 	var rooms []model.Room
-	err := r.db.Table("rooms").
+	err := db.GetDB().Table("rooms").
 		Joins("JOIN user_rooms ON user_rooms.room_id = rooms.id").
 		Where("user_rooms.user_id = ? AND user_rooms.left_at IS NULL", userID).
 		Preload("Creator").
@@ -68,69 +103,248 @@ func (r *roomRepository) GetUserRooms(userID uint) ([]model.Room, error) {
 	return rooms, err
 }
 
-func (r *roomRepository) AddUserToRoom(roomID string, userID uint, role string) error {
-	var existingUserRoom model.UserRoom
-	err := r.db.Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).First(&existingUserRoom).Error
-
-	if err == nil {
-		return nil
+// AddUserToRoom inserts a membership or revives the user's previous one in a single upsert.
+// A revived membership starts afresh, so earlier inactivity cannot auto-leave the user again.
+// An active membership is left untouched so rejoining never resets the member's role.
+// It reports whether the user became a member, which is false if they already were one.
+func (r *roomRepository) AddUserToRoom(roomID string, userID uint, role string) (bool, error) {
+	now := time.Now()
+	userRoom := model.UserRoom{
+		UserID:   userID,
+		RoomID:   roomID,
+		Role:     role,
+		JoinedAt: now,
 	}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
-	}
+	result := db.GetDB().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "room_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"role":           role,
+			"joined_at":      now,
+			"left_at":        nil,
+			"last_active_at": nil,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_rooms.left_at IS NOT NULL"}}},
+	}).Create(&userRoom)
+	return result.RowsAffected > 0, result.Error
+}
 
-	var previousUserRoom model.UserRoom
-	err = r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&previousUserRoom).Error
+// RemoveUserFromRoom ends an active membership, reporting whether there was one to end
+func (r *roomRepository) RemoveUserFromRoom(roomID string, userID uint) (bool, error) {
+	result := db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+		Update("left_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
 
-	if err == nil {
-		return r.db.Model(&previousUserRoom).Updates(map[string]interface{}{
-			"role":      role,
-			"joined_at": time.Now(),
-			"left_at":   nil,
-		}).Error
-	}
+// CountUserRooms returns how many rooms the user currently belongs to, ignoring deleted rooms
+func (r *roomRepository) CountUserRooms(userID uint) (int64, error) {
+	var count int64
+	err := db.GetDB().Model(&model.UserRoom{}).
+		Joins("JOIN rooms ON rooms.id = user_rooms.room_id AND rooms.deleted_at IS NULL").
+		Where("user_rooms.user_id = ? AND user_rooms.left_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
-	}
+// CountRoomsCreatedBy returns how many rooms the user created that have not been deleted
+func (r *roomRepository) CountRoomsCreatedBy(userID uint) (int64, error) {
+	var count int64
+	err := db.GetDB().Model(&model.Room{}).Where("created_by = ?", userID).Count(&count).Error
+	return count, err
+}
 
-	userRoom := model.UserRoom{
-		UserID:   userID,
-		RoomID:   roomID,
-		Role:     role,
-		JoinedAt: time.Now(),
+// CountActiveMembers returns how many users currently belong to the room
+func (r *roomRepository) CountActiveMembers(roomID string) (int64, error) {
+	var count int64
+	err := db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND left_at IS NULL", roomID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *roomRepository) IsUserInRoom(roomID string, userID uint) (bool, error) {
+	var count int64
+	err := db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetUserRole returns the user's role in the room, or "" if they are not an active member
+func (r *roomRepository) GetUserRole(roomID string, userID uint) (string, error) {
+	var userRoom model.UserRoom
+	err := db.GetDB().Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).First(&userRoom).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
 	}
+	return userRoom.Role, err
+}
+
+// GetRoomMembers returns the current memberships of a room with their users loaded, admins
+// first, then moderators, then members, each in joining order
+func (r *roomRepository) GetRoomMembers(roomID string) ([]model.UserRoom, error) {
+	var members []model.UserRoom
+	err := db.GetDB().Preload("User").
+		Where("room_id = ? AND left_at IS NULL", roomID).
+		Order("CASE role WHEN 'admin' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, joined_at").
+		Find(&members).Error
+	return members, err
+}
+
+// UpdateMemberRole changes an active member's role in the room. It returns false, changing
+// nothing, when the member is the room's last admin and the new role is not admin. The room's
+// admin rows stay locked until the change commits, so concurrent demotions cannot remove every admin.
+func (r *roomRepository) UpdateMemberRole(roomID string, userID uint, role string) (bool, error) {
+	updated := true
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var adminIDs []uint
+		if err := tx.Model(&model.UserRoom{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ? AND role = ? AND left_at IS NULL", roomID, "admin").
+			Pluck("user_id", &adminIDs).Error; err != nil {
+			return err
+		}
+		if role != "admin" && len(adminIDs) == 1 && adminIDs[0] == userID {
+			updated = false
+			return nil
+		}
+
+		return tx.Model(&model.UserRoom{}).
+			Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+			Update("role", role).Error
+	})
+	return updated && err == nil, err
+}
+
+// BanUser records a ban; banning an already banned user keeps the original ban
+func (r *roomRepository) BanUser(ban *model.RoomBan) error {
+	return db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(ban).Error
+}
 
-	return r.db.Create(&userRoom).Error
+// UnbanUser lifts a ban, reporting whether there was one
+func (r *roomRepository) UnbanUser(roomID string, userID uint) (bool, error) {
+	result := db.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&model.RoomBan{})
+	return result.RowsAffected > 0, result.Error
 }
 
-func (r *roomRepository) RemoveUserFromRoom(roomID string, userID uint) error {
-	return r.db.Model(&model.UserRoom{}).
+func (r *roomRepository) IsUserBanned(roomID string, userID uint) (bool, error) {
+	var count int64
+	err := db.GetDB().Model(&model.RoomBan{}).
 		Where("room_id = ? AND user_id = ?", roomID, userID).
-		Update("left_at", time.Now()).Error
+		Count(&count).Error
+	return count > 0, err
 }
 
-func (r *roomRepository) IsUserInRoom(roomID string, userID uint) (bool, error) {
+// CreateInvite records an invite; inviting an already invited user keeps the original invite
+func (r *roomRepository) CreateInvite(invite *model.RoomInvite) error {
+	return db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(invite).Error
+}
+
+func (r *roomRepository) HasInvite(roomID string, userID uint) (bool, error) {
 	var count int64
-	err := r.db.Model(&model.UserRoom{}).
-		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+	err := db.GetDB().Model(&model.RoomInvite{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
 		Count(&count).Error
 	return count > 0, err
 }
 
+// DeleteInvite uses up the user's invite to the room
+func (r *roomRepository) DeleteInvite(roomID string, userID uint) error {
+	return db.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&model.RoomInvite{}).Error
+}
+
+// SetMuted updates whether the user receives notifications from the room
+func (r *roomRepository) SetMuted(roomID string, userID uint, muted bool) error {
+	return db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+		Update("muted", muted).Error
+}
+
+// SetFavorite updates whether the membership is exempt from auto-leave
+func (r *roomRepository) SetFavorite(roomID string, userID uint, favorite bool) error {
+	return db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+		Update("favorite", favorite).Error
+}
+
+// TouchMembership records activity by the member, postponing auto-leave
+func (r *roomRepository) TouchMembership(roomID string, userID uint) error {
+	return db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+		Update("last_active_at", time.Now()).Error
+}
+
+// GetInactiveMembers returns the memberships in auto-leave rooms with no activity since the
+// cutoff. Favorites and room admins are never returned.
+func (r *roomRepository) GetInactiveMembers(cutoff time.Time) ([]model.UserRoom, error) {
+	var members []model.UserRoom
+	err := db.GetDB().Preload("User").Preload("Room").
+		Joins("JOIN rooms ON rooms.id = user_rooms.room_id AND rooms.deleted_at IS NULL").
+		Where("rooms.auto_leave = ? AND user_rooms.left_at IS NULL", true).
+		Where("user_rooms.favorite = ? AND user_rooms.role <> ?", false, "admin").
+		Where("COALESCE(user_rooms.last_active_at, user_rooms.joined_at) < ?", cutoff).
+		Find(&members).Error
+	return members, err
+}
+
 func (r *roomRepository) UpdateRoom(room *model.Room) error {
-	return r.db.Save(room).Error
+	// The preloaded creator must not be upserted alongside the room
+	return db.GetDB().Omit(clause.Associations).Save(room).Error
 }
 
+// DeleteRoom marks every member as left and soft-deletes the room in one transaction, so a
+// failed delete never leaves a live room without members
 func (r *roomRepository) DeleteRoom(roomID string) error {
-	// First mark all users as left
-	if err := r.db.Model(&model.UserRoom{}).
-		Where("room_id = ?", roomID).
-		Update("left_at", time.Now()).Error; err != nil {
-		return err
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// First mark all users as left
+		if err := tx.Model(&model.UserRoom{}).
+			Where("room_id = ? AND left_at IS NULL", roomID).
+			Update("left_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// Then soft delete the room
+		return tx.Delete(&model.Room{}, "id = ?", roomID).Error
+	})
+}
+
+// DeduplicateUserRooms collapses legacy duplicate user_rooms rows to one per (user, room), keeping
+// an active membership over a departed one and the most recent join otherwise, then adds the
+// unique index that prevents new duplicates. It is safe to run on every start.
+func DeduplicateUserRooms() (int64, error) {
+	conn := db.GetDB()
+	if !conn.Migrator().HasTable(&model.UserRoom{}) {
+		return 0, nil
+	}
+
+	result := conn.Exec(`
+		DELETE FROM user_rooms WHERE ctid IN (
+			SELECT ctid FROM (
+				SELECT ctid, ROW_NUMBER() OVER (
+					PARTITION BY user_id, room_id
+					ORDER BY (left_at IS NULL) DESC, joined_at DESC
+				) AS rn
+				FROM user_rooms
+			) ranked
+			WHERE rn > 1
+		)`)
+	if result.Error != nil {
+		return 0, result.Error
 	}
 
-	// Then soft delete the room
-	return r.db.Delete(&model.Room{}, "id = ?", roomID).Error
+	err := conn.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_rooms_user_room ON user_rooms (user_id, room_id)").Error
+	return result.RowsAffected, err
+}
+
+// EnsureRoomNameIndex adds the partial unique index that keeps live room names unique while
+// letting deleted rooms' names be reused. It fails if live rooms already share a name.
+func EnsureRoomNameIndex() error {
+	return db.GetDB().Exec(
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_rooms_name_active ON rooms (name) WHERE deleted_at IS NULL").Error
+}
+
+// IsUniqueViolation reports whether err came from a write rejected by a unique index
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
@@ -0,0 +1,391 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// testDSNVariable names the environment variable holding the connection string of a disposable
+// Postgres database for the repository tests; without it they are skipped
+const testDSNVariable = "LIVE_CHATTER_TEST_DSN"
+
+var (
+	testDatabaseOnce sync.Once
+	testDatabaseErr  error
+)
+
+// testDatabaseConfig turns the test DSN, in URL or keyword form, into the configuration pkg/db
+// connects with
+func testDatabaseConfig(dsn string) (*config.APIConfig, error) {
+	parsed, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config.APIConfig{}
+	cfg.Context.Mode = gin.ReleaseMode
+	cfg.Context.TimeZone = "UTC"
+	cfg.DB.Host = parsed.Host
+	cfg.DB.Port = int(parsed.Port)
+	cfg.DB.Username = parsed.User
+	cfg.DB.Password = config.DBPassword{Value: parsed.Password}
+	cfg.DB.Names.LIVECHAT = parsed.Database
+	cfg.DB.SSLMode = "disable"
+	if parsed.TLSConfig != nil {
+		cfg.DB.SSLMode = "require"
+	}
+	cfg.DB.Pool = config.DBPoolConfig{MaxOpenConns: 10, MaxIdleConns: 5, ConnMaxLifetime: 300}
+	return cfg, nil
+}
+
+// migrateTestDatabase creates the schema the server migrates to on start
+func migrateTestDatabase() error {
+	return db.GetDB().AutoMigrate(
+		&model.User{},
+		&model.Room{},
+		&model.Message{},
+		&model.Attachment{},
+		&model.UserRoom{},
+		&model.RoomBan{},
+		&model.RoomInvite{},
+		&model.PinnedMessage{},
+	)
+}
+
+// useTestDatabase points pkg/db at the test database, migrating it on first use, and empties its
+// tables so every test starts from a blank slate. The test is skipped when no DSN is set.
+func useTestDatabase(tb testing.TB) {
+	tb.Helper()
+	dsn := os.Getenv(testDSNVariable)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSNVariable)
+	}
+
+	testDatabaseOnce.Do(func() {
+		cfg, err := testDatabaseConfig(dsn)
+		if err != nil {
+			testDatabaseErr = err
+			return
+		}
+		if testDatabaseErr = db.InitDBFromConfig(cfg); testDatabaseErr != nil {
+			return
+		}
+		testDatabaseErr = migrateTestDatabase()
+	})
+	if testDatabaseErr != nil {
+		tb.Fatalf("test database unavailable: %v", testDatabaseErr)
+	}
+
+	if err := db.GetDB().Exec("TRUNCATE users, rooms, messages, user_rooms RESTART IDENTITY CASCADE").Error; err != nil {
+		tb.Fatalf("failed to empty the test database: %v", err)
+	}
+}
+
+func createTestUser(tb testing.TB, username string) model.User {
+	tb.Helper()
+	user := model.User{Username: username, Password: "hash"}
+	if err := db.GetDB().Create(&user).Error; err != nil {
+		tb.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+func createTestRoom(tb testing.TB, id string, roomType string, creator model.User) model.Room {
+	tb.Helper()
+	room := model.Room{ID: id, Name: id, Type: roomType, CreatedBy: creator.ID}
+	if err := db.GetDB().Create(&room).Error; err != nil {
+		tb.Fatalf("failed to create room %s: %v", id, err)
+	}
+	return room
+}
+
+// errInjected is the failure failWritesTo makes writes return
+var errInjected = errors.New("injected failure")
+
+// failWritesTo makes every create and delete on the table fail with errInjected until the test
+// ends, to check that what was written alongside them is rolled back
+func failWritesTo(tb testing.TB, table string) {
+	tb.Helper()
+	name := "test:fail_writes_to_" + table
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			_ = tx.AddError(errInjected)
+		}
+	}
+
+	callbacks := db.GetDB().Callback()
+	if err := callbacks.Create().Before("gorm:create").Register(name, fail); err != nil {
+		tb.Fatal(err)
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register(name, fail); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = callbacks.Create().Remove(name)
+		_ = callbacks.Delete().Remove(name)
+	})
+}
+
+// membershipRows counts every user_rooms row for the pair, departed ones included
+func membershipRows(tb testing.TB, roomID string, userID uint) int64 {
+	tb.Helper()
+	var count int64
+	if err := db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Count(&count).Error; err != nil {
+		tb.Fatal(err)
+	}
+	return count
+}
+
+func TestDeduplicateUserRoomsCollapsesLegacyDuplicates(t *testing.T) {
+	useTestDatabase(t)
+	conn := db.GetDB()
+
+	// Recreate user_rooms as legacy databases had it, without a key on (user, room)
+	t.Cleanup(func() {
+		_ = db.GetDB().Migrator().DropTable(&model.UserRoom{})
+		if err := db.GetDB().AutoMigrate(&model.UserRoom{}); err != nil {
+			t.Errorf("failed to restore user_rooms: %v", err)
+		}
+	})
+	if err := conn.Migrator().DropTable(&model.UserRoom{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Exec(`CREATE TABLE user_rooms (
+		user_id bigint, room_id text, role text DEFAULT 'member', muted boolean DEFAULT false,
+		favorite boolean DEFAULT false, joined_at timestamptz, left_at timestamptz, last_active_at timestamptz)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Exec(`INSERT INTO user_rooms (user_id, room_id, role, joined_at, left_at) VALUES
+		(1, 'lobby', 'member', now() - interval '3 days', now() - interval '2 days'),
+		(1, 'lobby', 'moderator', now() - interval '1 day', NULL),
+		(1, 'lobby', 'member', now(), now()),
+		(2, 'lobby', 'member', now() - interval '2 days', now() - interval '1 day'),
+		(2, 'lobby', 'member', now() - interval '1 hour', now()),
+		(3, 'lobby', 'member', now(), NULL)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := DeduplicateUserRooms()
+	if err != nil || removed != 3 {
+		t.Fatalf("DeduplicateUserRooms() = %d, %v, want 3 rows removed", removed, err)
+	}
+	for userID := uint(1); userID <= 3; userID++ {
+		if rows := membershipRows(t, "lobby", userID); rows != 1 {
+			t.Fatalf("user %d has %d membership rows, want 1", userID, rows)
+		}
+	}
+
+	var kept model.UserRoom
+	if err := conn.Where("room_id = ? AND user_id = ?", "lobby", 1).First(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept.LeftAt != nil || kept.Role != "moderator" {
+		t.Fatalf("kept %+v, want the active moderator membership", kept)
+	}
+	if err := conn.Where("room_id = ? AND user_id = ?", "lobby", 2).First(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept.LeftAt == nil || time.Since(kept.JoinedAt) > 2*time.Hour {
+		t.Fatalf("kept %+v, want the most recent departed membership", kept)
+	}
+
+	err = conn.Exec("INSERT INTO user_rooms (user_id, room_id, joined_at) VALUES (3, 'lobby', now())").Error
+	if !IsUniqueViolation(err) {
+		t.Fatalf("inserting a duplicate membership = %v, want a unique violation", err)
+	}
+
+	if removed, err := DeduplicateUserRooms(); err != nil || removed != 0 {
+		t.Fatalf("second DeduplicateUserRooms() = %d, %v, want nothing to remove", removed, err)
+	}
+}
+
+func TestAddUserToRoomUpsertsTheMembership(t *testing.T) {
+	useTestDatabase(t)
+	if _, err := DeduplicateUserRooms(); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRoomRepository()
+	owner := createTestUser(t, "owner")
+	member := createTestUser(t, "member")
+	createTestRoom(t, "lobby", "public", owner)
+
+	if joined, err := repo.AddUserToRoom("lobby", member.ID, "member"); err != nil || !joined {
+		t.Fatalf("first join = %v, %v, want joined", joined, err)
+	}
+	if joined, err := repo.AddUserToRoom("lobby", member.ID, "member"); err != nil || joined {
+		t.Fatalf("joining again = %v, %v, want no change", joined, err)
+	}
+	if left, err := repo.RemoveUserFromRoom("lobby", member.ID); err != nil || !left {
+		t.Fatalf("leaving = %v, %v, want left", left, err)
+	}
+	if joined, err := repo.AddUserToRoom("lobby", member.ID, "member"); err != nil || !joined {
+		t.Fatalf("rejoining = %v, %v, want joined", joined, err)
+	}
+
+	if rows := membershipRows(t, "lobby", member.ID); rows != 1 {
+		t.Fatalf("the member has %d membership rows, want 1", rows)
+	}
+	if in, err := repo.IsUserInRoom("lobby", member.ID); err != nil || !in {
+		t.Fatalf("IsUserInRoom after rejoining = %v, %v, want true", in, err)
+	}
+}
+
+func TestRejoinedMemberSurvivesTheNextInactivitySweep(t *testing.T) {
+	useTestDatabase(t)
+	repo := NewRoomRepository()
+	owner := createTestUser(t, "owner")
+	member := createTestUser(t, "member")
+	room := createTestRoom(t, "lobby", "public", owner)
+	if err := db.GetDB().Model(&room).Update("auto_leave", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.AddUserToRoom("lobby", member.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+	if err := db.GetDB().Model(&model.UserRoom{}).
+		Where("room_id = ? AND user_id = ?", "lobby", member.ID).
+		Updates(map[string]interface{}{"joined_at": longAgo, "last_active_at": longAgo}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	inactive, err := repo.GetInactiveMembers(cutoff)
+	if err != nil || len(inactive) != 1 || inactive[0].UserID != member.ID {
+		t.Fatalf("GetInactiveMembers() = %+v, %v, want the idle member", inactive, err)
+	}
+	if _, err := repo.RemoveUserFromRoom("lobby", member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if joined, err := repo.AddUserToRoom("lobby", member.ID, "member"); err != nil || !joined {
+		t.Fatalf("rejoining = %v, %v, want joined", joined, err)
+	}
+	inactive, err = repo.GetInactiveMembers(cutoff)
+	if err != nil || len(inactive) != 0 {
+		t.Fatalf("GetInactiveMembers() after rejoining = %+v, %v, want no one", inactive, err)
+	}
+}
+
+func TestDeleteRoomIsAllOrNothing(t *testing.T) {
+	useTestDatabase(t)
+	repo := NewRoomRepository()
+	owner := createTestUser(t, "owner")
+	member := createTestUser(t, "member")
+	for _, roomID := range []string{"lobby", "attic"} {
+		createTestRoom(t, roomID, "public", owner)
+		if _, err := repo.AddUserToRoom(roomID, member.ID, "member"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.DeleteRoom("lobby"); err != nil {
+		t.Fatalf("DeleteRoom failed: %v", err)
+	}
+	if room, err := repo.GetRoomByID("lobby"); err != nil || room != nil {
+		t.Fatalf("GetRoomByID after deleting = %+v, %v, want nothing", room, err)
+	}
+	if in, err := repo.IsUserInRoom("lobby", member.ID); err != nil || in {
+		t.Fatalf("IsUserInRoom after deleting = %v, %v, want false", in, err)
+	}
+
+	failWritesTo(t, "rooms")
+	if err := repo.DeleteRoom("attic"); !errors.Is(err, errInjected) {
+		t.Fatalf("DeleteRoom with the room delete failing = %v, want the injected failure", err)
+	}
+	if room, err := repo.GetRoomByID("attic"); err != nil || room == nil {
+		t.Fatalf("GetRoomByID after the failed delete = %+v, %v, want the room", room, err)
+	}
+	if in, err := repo.IsUserInRoom("attic", member.ID); err != nil || !in {
+		t.Fatalf("IsUserInRoom after the failed delete = %v, %v, want the member kept", in, err)
+	}
+}
+
+func TestRepositoriesDoNotKeepAConnection(t *testing.T) {
+	connType := reflect.TypeOf(&gorm.DB{})
+	for _, repo := range []interface{}{
+		NewActivityLogRepository(),
+		NewAttachmentRepository(),
+		NewEmojiRepository(),
+		NewInviteTokenRepository(),
+		NewMessageRepository(),
+		NewNotificationRepository(),
+		NewPasswordResetRepository(),
+		NewPrivateMessageRepository(),
+		NewReactionRepository(),
+		NewRoomRepository(),
+		NewSessionRepository(),
+		NewUserRepository(),
+	} {
+		value := reflect.ValueOf(repo).Elem()
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).Type == connType {
+				t.Errorf("%s holds a connection in %s, which a reconnect would leave stale",
+					value.Type(), value.Type().Field(i).Name)
+			}
+		}
+	}
+}
+
+func TestRoomRepositoryUsesTheConnectionAfterAReconnect(t *testing.T) {
+	useTestDatabase(t)
+	repo := NewRoomRepository()
+	owner := createTestUser(t, "owner")
+	createTestRoom(t, "lobby", "public", owner)
+
+	before := db.GetDB()
+	db.ReconnectDB("TestRoomRepositoryUsesTheConnectionAfterAReconnect")
+	after := db.GetDB()
+	if after == before {
+		t.Fatal("ReconnectDB kept the old connection")
+	}
+	if old, err := before.DB(); err != nil || old.Ping() == nil {
+		t.Fatal("the old connection is still open")
+	}
+
+	room, err := repo.GetRoomByID("lobby")
+	if err != nil || room == nil {
+		t.Fatalf("GetRoomByID after reconnecting = %+v, %v, want the room", room, err)
+	}
+}
+
+func TestCreateRoomWithCreatorRollsBackWithoutItsAdmin(t *testing.T) {
+	useTestDatabase(t)
+	repo := NewRoomRepository()
+	owner := createTestUser(t, "owner")
+
+	if err := repo.CreateRoomWithCreator(&model.Room{ID: "lobby", Name: "lobby", CreatedBy: owner.ID}, owner.ID); err != nil {
+		t.Fatalf("CreateRoomWithCreator failed: %v", err)
+	}
+	if role, err := repo.GetUserRole("lobby", owner.ID); err != nil || role != "admin" {
+		t.Fatalf("creator's role = %q, %v, want admin", role, err)
+	}
+
+	failWritesTo(t, "user_rooms")
+	err := repo.CreateRoomWithCreator(&model.Room{ID: "attic", Name: "attic", CreatedBy: owner.ID}, owner.ID)
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("CreateRoomWithCreator with the membership insert failing = %v, want the injected failure", err)
+	}
+	var rooms int64
+	if err := db.GetDB().Unscoped().Model(&model.Room{}).Where("id = ?", "attic").Count(&rooms).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rooms != 0 {
+		t.Fatal("the room was kept without its admin")
+	}
+}
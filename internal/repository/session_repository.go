@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+	"time"
+)
+
+type SessionRepository interface {
+	CreateSession(session *model.UserSession) error
+	GetUserSessions(userID uint) ([]model.UserSession, error)
+	IsSessionActive(sessionID string) (bool, error)
+	DeleteSession(sessionID string) error
+	DeleteUserSessions(userID uint) error
+}
+
+type sessionRepository struct{}
+
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{}
+}
+
+func (r *sessionRepository) CreateSession(session *model.UserSession) error {
+	return db.GetDB().Create(session).Error
+}
+
+// GetUserSessions returns the user's unexpired sessions, newest first
+func (r *sessionRepository) GetUserSessions(userID uint) ([]model.UserSession, error) {
+	var sessions []model.UserSession
+	err := db.GetDB().Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// IsSessionActive reports whether the session exists and has not expired
+func (r *sessionRepository) IsSessionActive(sessionID string) (bool, error) {
+	var count int64
+	err := db.GetDB().Model(&model.UserSession{}).
+		Where("token = ? AND expires_at > ?", sessionID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *sessionRepository) DeleteSession(sessionID string) error {
+	return db.GetDB().Where("token = ?", sessionID).Delete(&model.UserSession{}).Error
+}
+
+// DeleteUserSessions revokes every session belonging to the user
+func (r *sessionRepository) DeleteUserSessions(userID uint) error {
+	return db.GetDB().Where("user_id = ?", userID).Delete(&model.UserSession{}).Error
+}
@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"errors"
 	"live-chatter/pkg/db"
 	"live-chatter/pkg/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type UserRepository interface {
@@ -10,9 +15,15 @@ type UserRepository interface {
 	GetUserByEmail(email string) (*model.User, error)
 	GetAllUsers() ([]model.User, error)
 	GetOnlineUsers() ([]model.User, error)
+	GetUsersByUsernames(usernames []string) ([]model.User, error)
 	UpdateUserStatus(userID uint, status string) error
 	GetUserByUsername(username string) (*model.User, error)
 	GetUserByID(id uint) (*model.User, error)
+	IsUsernameTaken(username string) (bool, error)
+	IsEmailTaken(email string, excludeUserID uint) (bool, error)
+	UpdateUser(userID uint, fields map[string]interface{}) error
+	UpdatePassword(userID uint, passwordHash string) error
+	DeactivateUser(userID uint) ([]string, error)
 }
 
 type userRepository struct{}
@@ -20,6 +31,9 @@ type userRepository struct{}
 func (r *userRepository) GetUserByID(id uint) (*model.User, error) {
 	var user model.User
 	err := db.GetDB().Where("id = ?", id).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	return &user, err
 }
 
@@ -31,9 +45,18 @@ func (r *userRepository) CreateUser(user *model.User) error {
 	return db.GetDB().Create(user).Error
 }
 
+// GetUserByEmail finds the user with the given email. Accounts without an email are never
+// matched, so an empty email finds nobody.
 func (r *userRepository) GetUserByEmail(email string) (*model.User, error) {
+	if email == "" {
+		return nil, nil
+	}
+
 	var user model.User
 	err := db.GetDB().Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	return &user, err
 }
 
@@ -45,16 +68,116 @@ func (r *userRepository) GetAllUsers() ([]model.User, error) {
 
 func (r *userRepository) GetOnlineUsers() ([]model.User, error) {
 	var users []model.User
-	err := db.GetDB().Where("status = ?", "online").Find(&users).Error
+	err := db.GetDB().Where("status = ? AND appear_offline = ?", "online", false).Find(&users).Error
+	return users, err
+}
+
+// GetUsersByUsernames loads the named users in one query, ignoring case; unknown names are
+// left out. Usernames are stored lowercase, so the lookup can use the username index.
+func (r *userRepository) GetUsersByUsernames(usernames []string) ([]model.User, error) {
+	var users []model.User
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+	err := db.GetDB().Where("username IN ?", lowered).Order("username").Find(&users).Error
 	return users, err
 }
 
+// UpdateUserStatus sets the user's status and records now as the time they were last seen
 func (r *userRepository) UpdateUserStatus(userID uint, status string) error {
-	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Update("status", status).Error
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"status": status, "last_seen": time.Now()}).Error
 }
 
+// GetUserByUsername looks up a user by name, ignoring case
 func (r *userRepository) GetUserByUsername(username string) (*model.User, error) {
 	var user model.User
-	err := db.GetDB().Where("username = ?", username).First(&user).Error
+	err := db.GetDB().Where("username = ?", strings.ToLower(username)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	return &user, err
 }
+
+// IsUsernameTaken checks for an existing username ignoring case, so "Alice" cannot shadow "alice".
+// Deactivated accounts keep their name reserved so nobody can take over their identity.
+func (r *userRepository) IsUsernameTaken(username string) (bool, error) {
+	var count int64
+	err := db.GetDB().Unscoped().Model(&model.User{}).Where("username = ?", strings.ToLower(username)).Count(&count).Error
+	return count > 0, err
+}
+
+// NormalizeUsernames lowercases usernames stored before registration did so. It fails if two
+// accounts' names differ only in case.
+func NormalizeUsernames() error {
+	return db.GetDB().Exec("UPDATE users SET username = LOWER(username) WHERE username <> LOWER(username)").Error
+}
+
+// IsEmailTaken checks whether another account, including a deactivated one, uses the email.
+// Any number of accounts may go without one, so an empty email is never taken.
+func (r *userRepository) IsEmailTaken(email string, excludeUserID uint) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.GetDB().Unscoped().Model(&model.User{}).
+		Where("email = ? AND id <> ?", email, excludeUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateUser writes the given columns of a user. The password is never written through this
+// path, even if a caller passes it in, so credential changes stay in the auth flow.
+func (r *userRepository) UpdateUser(userID uint, fields map[string]interface{}) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Omit("password").Updates(fields).Error
+}
+
+// UpdatePassword replaces the stored password hash
+func (r *userRepository) UpdatePassword(userID uint, passwordHash string) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Update("password", passwordHash).Error
+}
+
+// DeactivateUser ends every active room membership of the user, revokes their sessions and
+// soft-deletes the account in one transaction, returning the rooms they left. Lookups skip the
+// account from then on.
+func (r *userRepository) DeactivateUser(userID uint) ([]string, error) {
+	var roomIDs []string
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserRoom{}).
+			Where("user_id = ? AND left_at IS NULL", userID).
+			Pluck("room_id", &roomIDs).Error; err != nil {
+			return err
+		}
+		if len(roomIDs) > 0 {
+			if err := tx.Model(&model.UserRoom{}).
+				Where("user_id = ? AND room_id IN ? AND left_at IS NULL", userID, roomIDs).
+				Update("left_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserSession{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.User{}, userID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roomIDs, nil
+}
+
+// DropLegacyEmailIndex removes the unique index that covered every email, empty ones included,
+// so accounts registered without an email no longer collide. The partial index that replaces it
+// is created by AutoMigrate. It is safe to run on every start.
+func DropLegacyEmailIndex() error {
+	conn := db.GetDB()
+	if !conn.Migrator().HasTable(&model.User{}) {
+		return nil
+	}
+	return conn.Exec("DROP INDEX IF EXISTS idx_users_email").Error
+}
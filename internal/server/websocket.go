@@ -2,6 +2,7 @@ package server
 
 import (
 	"live-chatter/pkg"
+	"live-chatter/pkg/middleware"
 	"live-chatter/pkg/model"
 	"net/http"
 
@@ -11,17 +12,25 @@ import (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: implement proper origin checking
-		return true
-	},
+	CheckOrigin:     checkOrigin,
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 }
 
+// checkOrigin accepts requests without an Origin header (non-browser clients) and
+// browser requests whose origin is on the configured allow-list
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || middleware.IsOriginAllowed(origin) {
+		return true
+	}
+	Log.Warn("Rejected WebSocket connection from origin %q (%s)", origin, r.RemoteAddr)
+	return false
+}
+
 // WebSocket upgrades an HTTP request to a WebSocket connection
 // and manages the client lifecycle with the given ClientManager.
-func WebSocket(res http.ResponseWriter, req *http.Request, clientsManager *pkg.ClientManager) {
+func WebSocket(res http.ResponseWriter, req *http.Request, clientsManager *pkg.ClientManager, clientCfg pkg.ClientConfig) {
 	userID, ok := req.Context().Value("user_id").(uint)
 	if !ok {
 		Log.Error("User ID not found in WebSocket request context")
@@ -58,18 +67,27 @@ func WebSocket(res http.ResponseWriter, req *http.Request, clientsManager *pkg.C
 		Email:    email,
 	}
 
-	// Create a new client with user information
-	client := &pkg.Client{
-		User:   user,
-		Socket: conn,
-		Send:   make(chan []byte, 256),
-		Rooms:  make(map[string]bool),
+	// The token does not carry the locale or visibility, so take them from the stored profile
+	if clientsManager.UserRepo != nil {
+		if profile, err := clientsManager.UserRepo.GetUserByID(userID); err == nil && profile != nil {
+			user.Locale = profile.Locale
+			user.AppearOffline = profile.AppearOffline
+		}
 	}
 
-	Log.Info("WebSocket connection established for user: %s (ID: %d)", username, userID)
+	// Create a new client with user information
+	client := pkg.NewClient(user, conn, clientCfg)
+	client.IPAddress, _ = req.Context().Value("client_ip").(string)
+	client.RequestID = Log.RequestID(req.Context())
+
+	Log.InfoCtx(req.Context(), "WebSocket connection established for user: %s (ID: %d)", username, userID)
 
 	// Register the client with the client manager to start tracking it
-	clientsManager.Register <- client
+	if !clientsManager.RegisterClient(client) {
+		Log.Warn("Rejecting WebSocket connection for user %s: server is shutting down", username)
+		_ = conn.Close()
+		return
+	}
 
 	// Start goroutines to handle incoming and outgoing messages
 	go client.Read(clientsManager)
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg/middleware"
+)
+
+// originConfig builds a config allowing the given origins in the given mode
+func originConfig(mode string, origins ...string) *config.APIConfig {
+	cfg := &config.APIConfig{}
+	cfg.Context.Mode = mode
+	cfg.Context.AllowedOrigins.Origins = origins
+	return cfg
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.APIConfig
+		origin  string
+		allowed bool
+	}{
+		{"allow-listed origin", originConfig("release", "https://chat.example.com"), "https://chat.example.com", true},
+		{"allow-listed origin in another case", originConfig("release", "https://chat.example.com/"), "HTTPS://Chat.Example.com", true},
+		{"unknown origin", originConfig("release", "https://chat.example.com"), "https://evil.example.net", false},
+		{"lookalike subdomain", originConfig("release", "https://chat.example.com"), "https://chat.example.com.evil.net", false},
+		{"no origin header", originConfig("release", "https://chat.example.com"), "", true},
+		{"wildcard in debug mode", originConfig("debug", "*"), "https://anything.example", true},
+		{"wildcard ignored in release mode", originConfig("release", "*"), "https://anything.example", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware.InitOriginConfig(tt.cfg)
+			req := httptest.NewRequest("GET", "/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(req); got != tt.allowed {
+				t.Fatalf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"live-chatter/internal/repository"
+	"live-chatter/pkg"
+	"live-chatter/pkg/db"
+	"live-chatter/pkg/model"
+)
+
+// AdminService exposes operational data to administrators
+type AdminService interface {
+	GetActivityLogs(filter repository.ActivityLogFilter, limit, offset int) ([]model.ActivityLog, int64, error)
+	GetServerStats() pkg.ServerStats
+	GetDatabaseStats() (db.PoolStats, error)
+}
+
+// PoolStatsSource reports database connection pool statistics
+type PoolStatsSource interface {
+	PoolStats() (db.PoolStats, error)
+}
+
+type adminService struct {
+	activityRepo  repository.ActivityLogRepository
+	clientManager *pkg.ClientManager
+	database      PoolStatsSource
+}
+
+func NewAdminService(activityRepo repository.ActivityLogRepository, clientManager *pkg.ClientManager,
+	database PoolStatsSource) AdminService {
+	return &adminService{activityRepo: activityRepo, clientManager: clientManager, database: database}
+}
+
+// GetActivityLogs returns a page of matching activity entries, newest first, and the total match count
+func (s *adminService) GetActivityLogs(filter repository.ActivityLogFilter, limit, offset int) ([]model.ActivityLog, int64, error) {
+	return s.activityRepo.GetLogs(filter, limit, offset)
+}
+
+// GetServerStats returns the live connection counts of the WebSocket server
+func (s *adminService) GetServerStats() pkg.ServerStats {
+	if s.clientManager == nil {
+		return pkg.ServerStats{RoomOccupancy: map[string]int{}}
+	}
+	return s.clientManager.Stats()
+}
+
+// GetDatabaseStats returns the database connection pool statistics
+func (s *adminService) GetDatabaseStats() (db.PoolStats, error) {
+	return s.database.PoolStats()
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+	"live-chatter/pkg/storage"
+	"live-chatter/pkg/thumbnail"
+
+	Log "live-chatter/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxAttachmentSize bounds uploads when no maximum is configured
+const DefaultMaxAttachmentSize = 10 << 20
+
+// defaultAttachmentTypes are accepted when no types are configured
+var defaultAttachmentTypes = []string{"image/*", "application/pdf", "text/plain"}
+
+// maxAttachmentNameLength caps the stored original file name
+const maxAttachmentNameLength = 255
+
+// AttachmentService stores files uploaded to rooms for use in image and file messages
+type AttachmentService interface {
+	Upload(roomID string, uploaderID uint, fileName string, content io.Reader) (*model.Attachment, error)
+	Open(attachmentID string, userID uint, thumb bool) (*model.Attachment, io.ReadSeekCloser, error)
+	MaxSize() int64
+}
+
+type attachmentService struct {
+	attachmentRepo repository.AttachmentRepository
+	roomRepo       repository.RoomRepository
+	storage        storage.Storage
+	processor      thumbnail.Processor
+	maxSize        int64
+	allowedTypes   []string
+}
+
+func NewAttachmentService(attachmentRepo repository.AttachmentRepository, roomRepo repository.RoomRepository,
+	store storage.Storage, processor thumbnail.Processor, uploads config.UploadsConfig) AttachmentService {
+	maxSize := uploads.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	allowedTypes := uploads.AllowedTypes
+	if len(allowedTypes) == 0 {
+		allowedTypes = defaultAttachmentTypes
+	}
+	return &attachmentService{
+		attachmentRepo: attachmentRepo,
+		roomRepo:       roomRepo,
+		storage:        store,
+		processor:      processor,
+		maxSize:        maxSize,
+		allowedTypes:   allowedTypes,
+	}
+}
+
+// MaxSize returns the largest file Upload accepts, in bytes
+func (s *attachmentService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Upload stores a file for a member of the room. The type is sniffed from the content rather than
+// trusted from the client, and the size is enforced while the file is written.
+func (s *attachmentService) Upload(roomID string, uploaderID uint, fileName string, content io.Reader) (*model.Attachment, error) {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(roomID, uploaderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	head = head[:n]
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !s.typeAllowed(contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrAttachmentType, contentType)
+	}
+
+	attachment := &model.Attachment{
+		ID:          uuid.New().String(),
+		RoomID:      roomID,
+		UploaderID:  uploaderID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		CreatedAt:   time.Now(),
+	}
+
+	// Reading one byte past the limit tells an oversized file apart from one exactly at it
+	limited := &io.LimitedReader{R: io.MultiReader(bytes.NewReader(head), content), N: s.maxSize + 1}
+	if err := s.storage.Save(attachment.ID, limited); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %v", err)
+	}
+	if limited.N == 0 {
+		s.discard(attachment.ID)
+		return nil, fmt.Errorf("%w of %d bytes", ErrAttachmentTooLarge, s.maxSize)
+	}
+	attachment.Size = s.maxSize + 1 - limited.N
+	s.storeThumbnail(attachment)
+
+	if err := s.attachmentRepo.CreateAttachment(attachment); err != nil {
+		s.discard(attachment.ID)
+		if attachment.ThumbnailType != "" {
+			s.discard(attachment.ThumbnailKey())
+		}
+		return nil, fmt.Errorf("failed to save attachment: %v", err)
+	}
+	return attachment, nil
+}
+
+// storeThumbnail saves a thumbnail next to an uploaded image. Thumbnails are best effort: the
+// upload succeeds without one when the processor skips or fails on the file.
+func (s *attachmentService) storeThumbnail(attachment *model.Attachment) {
+	if s.processor == nil || !strings.HasPrefix(attachment.ContentType, "image/") {
+		return
+	}
+
+	source, err := s.storage.Open(attachment.ID)
+	if err != nil {
+		Log.Warn("Failed to reopen attachment %s for its thumbnail: %v", attachment.ID, err)
+		return
+	}
+	defer source.Close()
+
+	thumb, err := s.processor.Thumbnail(source, attachment.ContentType)
+	if errors.Is(err, thumbnail.ErrUnsupported) {
+		return
+	}
+	if err != nil {
+		Log.Warn("No thumbnail for attachment %s: %v", attachment.ID, err)
+		return
+	}
+
+	if err := s.storage.Save(attachment.ThumbnailKey(), bytes.NewReader(thumb.Data)); err != nil {
+		Log.Warn("Failed to store thumbnail of attachment %s: %v", attachment.ID, err)
+		return
+	}
+	attachment.ThumbnailType = thumb.ContentType
+}
+
+// Open returns an attachment and its content, or its thumbnail, for a member of the room it was
+// posted in. The caller must close the content.
+func (s *attachmentService) Open(attachmentID string, userID uint, thumb bool) (*model.Attachment, io.ReadSeekCloser, error) {
+	attachment, err := s.attachmentRepo.GetAttachment(attachmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load attachment: %v", err)
+	}
+	if attachment == nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(attachment.RoomID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, nil, ErrNotRoomMember
+	}
+
+	key := attachment.ID
+	if thumb {
+		if attachment.ThumbnailType == "" {
+			return nil, nil, fmt.Errorf("%w: no thumbnail", ErrAttachmentNotFound)
+		}
+		key = attachment.ThumbnailKey()
+	}
+
+	content, err := s.storage.Open(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		Log.Warn("Attachment %s has no stored file", attachment.ID)
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open attachment: %v", err)
+	}
+	return attachment, content, nil
+}
+
+// typeAllowed reports whether a content type matches the allowed list
+func (s *attachmentService) typeAllowed(contentType string) bool {
+	for _, allowed := range s.allowedTypes {
+		if allowed == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// discard removes a stored file that will not be recorded
+func (s *attachmentService) discard(key string) {
+	if err := s.storage.Delete(key); err != nil {
+		Log.Warn("Failed to remove discarded attachment %s: %v", key, err)
+	}
+}
+
+// cleanFileName keeps only the base name of a client-supplied file name
+func cleanFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > maxAttachmentNameLength {
+		name = name[:maxAttachmentNameLength]
+	}
+	return name
+}
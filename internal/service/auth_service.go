@@ -6,27 +6,70 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"live-chatter/internal/config"
 	"live-chatter/internal/repository"
+	"live-chatter/pkg"
+	"live-chatter/pkg/i18n"
+	"live-chatter/pkg/mail"
 	jwtutil "live-chatter/pkg/middleware"
 	"live-chatter/pkg/model"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthService interface
 type AuthService interface {
 	Register(user *model.User) error
-	Login(username, authhash string) (*LoginResponse, error)
+	Login(credentials LoginCredentials, client SessionClient) (*LoginResponse, error)
+	Logout(userID uint, sessionID string, client SessionClient) error
+	ChangePassword(userID uint, oldAuthHash, newPassword string) error
 	RefreshTokens(refreshToken string) (*TokenResponse, error)
+	ForgotPassword(email string) error
+	ResetPassword(token, newPassword, ipAddress string) error
+}
+
+// LoginCredentials identify an account by email or username. When both are given the email
+// takes precedence. The authhash must be computed with the identifier that was sent.
+type LoginCredentials struct {
+	Email    string
+	Username string
+	AuthHash string
+}
+
+// SessionClient describes where a login came from, recorded on the session row
+type SessionClient struct {
+	IPAddress string
+	UserAgent string
 }
 
 type authService struct {
-	userRepo repository.UserRepository
+	userRepo       repository.UserRepository
+	sessionRepo    repository.SessionRepository
+	activityRepo   repository.ActivityLogRepository
+	resetRepo      repository.PasswordResetRepository
+	mailer         mail.Mailer
+	authentication config.AuthenticationConfig
+	registration   config.RegistrationConfig
+	passwordReset  config.PasswordResetConfig
 }
 
 // NewAuthService initializes authentication service
-func NewAuthService(userRepo repository.UserRepository) AuthService {
-	return &authService{userRepo: userRepo}
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository,
+	activityRepo repository.ActivityLogRepository, resetRepo repository.PasswordResetRepository, mailer mail.Mailer,
+	authentication config.AuthenticationConfig, registration config.RegistrationConfig, passwordReset config.PasswordResetConfig) AuthService {
+	return &authService{
+		userRepo:       userRepo,
+		sessionRepo:    sessionRepo,
+		activityRepo:   activityRepo,
+		resetRepo:      resetRepo,
+		mailer:         mailer,
+		authentication: authentication,
+		registration:   registration,
+		passwordReset:  passwordReset,
+	}
 }
 
 // hash256encode hashes a password using SHA-256
@@ -37,15 +80,37 @@ func hash256encode(password string) string {
 }
 
 func (s *authService) Register(user *model.User) error {
-	existingUser, err := s.userRepo.GetUserByEmail(user.Email)
-	if err == nil && existingUser != nil {
-		return errors.New("email already in use")
+	if err := validateUsername(user.Username, s.registration.Username); err != nil {
+		return err
+	}
+
+	// Usernames are stored lowercase so lookups and mentions can match them by index
+	user.Username = strings.ToLower(user.Username)
+
+	taken, err := s.userRepo.IsUsernameTaken(user.Username)
+	if err != nil {
+		return fmt.Errorf("failed to check username: %v", err)
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+
+	emailTaken, err := s.userRepo.IsEmailTaken(user.Email, 0)
+	if err != nil {
+		return fmt.Errorf("failed to check email: %v", err)
+	}
+	if emailTaken {
+		return ErrEmailTaken
 	}
 
-	if user.Password == "" {
-		return errors.New("password cannot be empty")
+	// The password arrives in plaintext here, unlike the authhash used to log in
+	if err := validatePassword(user.Password, s.registration.Password); err != nil {
+		return err
 	}
 
+	// Unknown locales fall back to the closest supported catalog
+	user.Locale = i18n.Supported(user.Locale)
+
 	// First, apply SHA-256 hashing
 	hashedPassword := hash256encode(user.Password)
 
@@ -68,44 +133,71 @@ type LoginResponse struct {
 	Refresh string      `json:"refresh"`
 }
 
-// Login function to authenticate user
-func (s *authService) Login(username, authhash string) (*LoginResponse, error) {
+// Login authenticates a user by email or username. For older clients that send a username in
+// the email field, an email that matches no account is retried as a username.
+func (s *authService) Login(credentials LoginCredentials, client SessionClient) (*LoginResponse, error) {
 	// Step 1: Retrieve user from database
-	user, err := s.userRepo.GetUserByEmail(username)
-	if err != nil || user == nil {
-		user, err = s.userRepo.GetUserByUsername(username)
-		if err != nil || user == nil {
-			return nil, errors.New("user not found")
-		}
+	identifier := credentials.Email
+	if identifier == "" {
+		identifier = credentials.Username
+	}
+	if identifier == "" {
+		return nil, ErrMissingIdentifier
 	}
 
-	// Step 2: Concatenate with stored SHA-256 hashed password
-	concatenatedString := username + "::" + user.Password
-
-	// Step 3: Decode Base64 `authhash` received from frontend
-	bcryptEncryptedBytes, err := base64.StdEncoding.DecodeString(authhash)
-	if err != nil {
-		return nil, errors.New("invalid authhash format")
+	var user *model.User
+	var err error
+	if credentials.Email != "" {
+		user, err = s.userRepo.GetUserByEmail(credentials.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up user: %v", err)
+		}
+	}
+	if user == nil {
+		user, err = s.userRepo.GetUserByUsername(identifier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up user: %v", err)
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
 	}
-	bcryptEncrypted := string(bcryptEncryptedBytes)
 
-	// Step 4: Compare bcrypt hash with concatenated string
-	err = bcrypt.CompareHashAndPassword([]byte(bcryptEncrypted), []byte(concatenatedString))
-	if err != nil {
-		fmt.Println("Bcrypt Comparison Failed:", err)
-		return nil, errors.New("invalid credentials")
+	// Steps 2-4: Check the authhash against the stored SHA-256 hash
+	if err := verifyAuthHash(identifier, user.Password, credentials.AuthHash); err != nil {
+		return nil, err
 	}
 
 	// Step 5: Remove password before returning user data
 	user.Password = ""
 
-	// Step 6: Generate access and refresh tokens
-	accessToken, refreshToken, err := jwtutil.GenerateTokens(user)
+	// Step 6: Open a session so the tokens can be revoked on logout. In single-session
+	// mode the user's earlier sessions are revoked first, logging out other devices.
+	if !s.authentication.MultipleSameUserSessions {
+		if err := s.sessionRepo.DeleteUserSessions(user.ID); err != nil {
+			return nil, errors.New("failed to revoke existing sessions")
+		}
+	}
+	session := &model.UserSession{
+		UserID:    user.ID,
+		Token:     uuid.New().String(),
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(jwtutil.SessionLifetime()),
+	}
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		return nil, errors.New("failed to create session")
+	}
+
+	// Step 7: Generate access and refresh tokens
+	accessToken, refreshToken, err := jwtutil.GenerateTokens(user, session.Token)
 	if err != nil {
 		return nil, errors.New("failed to generate tokens")
 	}
 
-	// Step 7: Return response in expected format
+	pkg.RecordActivity(s.activityRepo, user.ID, model.ActivityLogin, "user agent "+client.UserAgent, client.IPAddress)
+
+	// Step 8: Return response in expected format
 	return &LoginResponse{
 		User:    user,
 		Access:  accessToken,
@@ -113,6 +205,67 @@ func (s *authService) Login(username, authhash string) (*LoginResponse, error) {
 	}, nil
 }
 
+// verifyAuthHash checks a client authhash: the Base64 encoding of a bcrypt hash of
+// "<identifier>::<sha256(password)>", where identifier is the name the client signed in with
+func verifyAuthHash(identifier, storedHash, authhash string) error {
+	// Concatenate with stored SHA-256 hashed password
+	concatenatedString := identifier + "::" + storedHash
+
+	// Decode Base64 `authhash` received from frontend
+	bcryptEncryptedBytes, err := base64.StdEncoding.DecodeString(authhash)
+	if err != nil {
+		return fmt.Errorf("%w: malformed authhash", ErrInvalidCredentials)
+	}
+	bcryptEncrypted := string(bcryptEncryptedBytes)
+
+	// Compare bcrypt hash with concatenated string
+	if err := bcrypt.CompareHashAndPassword([]byte(bcryptEncrypted), []byte(concatenatedString)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// ChangePassword verifies the current password through the login authhash flow, stores the
+// new one and revokes every session, so all devices must sign in again with the new password.
+// The authhash may be computed with either the username or the email as identifier.
+func (s *authService) ChangePassword(userID uint, oldAuthHash, newPassword string) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return ErrUserNotFound
+	}
+
+	if err := verifyAuthHash(user.Username, user.Password, oldAuthHash); err != nil {
+		if user.Email == "" || verifyAuthHash(user.Email, user.Password, oldAuthHash) != nil {
+			return err
+		}
+	}
+
+	if err := validatePassword(newPassword, s.registration.Password); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(userID, hash256encode(newPassword)); err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+	if err := s.sessionRepo.DeleteUserSessions(userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return nil
+}
+
+// Logout ends the session so its access and refresh tokens stop validating
+func (s *authService) Logout(userID uint, sessionID string, client SessionClient) error {
+	if sessionID == "" {
+		return errors.New("token is not bound to a session")
+	}
+	if err := s.sessionRepo.DeleteSession(sessionID); err != nil {
+		return fmt.Errorf("failed to end session: %v", err)
+	}
+
+	pkg.RecordActivity(s.activityRepo, userID, model.ActivityLogout, "user agent "+client.UserAgent, client.IPAddress)
+	return nil
+}
+
 // TokenResponse struct for refresh tokens
 type TokenResponse struct {
 	Access  string `json:"access"`
@@ -121,11 +274,26 @@ type TokenResponse struct {
 
 // RefreshTokens function to refresh both access and refresh tokens
 func (s *authService) RefreshTokens(refreshToken string) (*TokenResponse, error) {
-	newAccessToken, newRefreshToken, err := jwtutil.RefreshTokens(refreshToken)
+	claims, err := jwtutil.ValidateToken(refreshToken, true)
 	if err != nil {
 		return nil, errors.New("invalid or expired refresh token")
 	}
 
+	// Issue the new tokens from the stored account rather than the old claims, so a role or
+	// username changed since login takes effect on the next refresh
+	user, err := s.userRepo.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if user == nil {
+		return nil, errors.New("invalid or expired refresh token")
+	}
+
+	newAccessToken, newRefreshToken, err := jwtutil.GenerateTokens(user, claims.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate new tokens")
+	}
+
 	return &TokenResponse{
 		Access:  newAccessToken,
 		Refresh: newRefreshToken,
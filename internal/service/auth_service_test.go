@@ -0,0 +1,402 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	jwtutil "live-chatter/pkg/middleware"
+	"live-chatter/pkg/model"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// fakeSessionRepository keeps login sessions in memory, keyed by session token
+type fakeSessionRepository struct {
+	repository.SessionRepository
+	mu       sync.Mutex
+	sessions map[string]uint
+}
+
+func (r *fakeSessionRepository) CreateSession(session *model.UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[string]uint)
+	}
+	r.sessions[session.Token] = session.UserID
+	return nil
+}
+
+func (r *fakeSessionRepository) IsSessionActive(sessionID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.sessions[sessionID]
+	return ok, nil
+}
+
+func (r *fakeSessionRepository) DeleteSession(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+func (r *fakeSessionRepository) DeleteUserSessions(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for token, owner := range r.sessions {
+		if owner == userID {
+			delete(r.sessions, token)
+		}
+	}
+	return nil
+}
+
+// count reports how many sessions the user holds
+func (r *fakeSessionRepository) count(userID uint) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, owner := range r.sessions {
+		if owner == userID {
+			n++
+		}
+	}
+	return n
+}
+
+// authHash builds the authhash a client sends for identifier and password
+func authHash(t *testing.T, identifier, password string) string {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(identifier+"::"+hash256encode(password)), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(hashed)
+}
+
+// newTestAuthService signs tokens with test secrets and checks them against the fake session store
+func newTestAuthService(t *testing.T, users *fakeUserRepository, authentication config.AuthenticationConfig) (AuthService, *fakeSessionRepository) {
+	t.Helper()
+	jwtutil.InitAuthConfig(&config.APIConfig{Authentication: config.AuthenticationConfig{
+		SecretKeys:      map[string]string{"ACCESS": "access-secret", "REFRESH": "refresh-secret"},
+		SessionTimeouts: map[string]int{"ACCESS": 15, "REFRESH": 60},
+		TimeUnits:       map[string]string{"ACCESS": "MINUTES", "REFRESH": "MINUTES"},
+	}})
+	sessions := &fakeSessionRepository{}
+	jwtutil.SetSessionStore(sessions)
+	t.Cleanup(func() { jwtutil.SetSessionStore(nil) })
+	return NewAuthService(users, sessions, nil, nil, nil, authentication, config.RegistrationConfig{}, config.PasswordResetConfig{}), sessions
+}
+
+func aliceAccount() *fakeUserRepository {
+	return &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice", Password: hash256encode("Correct-Horse-9")}}}
+}
+
+func TestLogoutRevokesTheSession(t *testing.T) {
+	auth, sessions := newTestAuthService(t, aliceAccount(), config.AuthenticationConfig{})
+
+	login, err := auth.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}, SessionClient{})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	claims, err := jwtutil.ValidateToken(login.Access, false)
+	if err != nil {
+		t.Fatalf("fresh token rejected: %v", err)
+	}
+
+	if err := auth.Logout(1, claims.ID, SessionClient{}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if sessions.count(1) != 0 {
+		t.Fatal("logout left the session in place")
+	}
+	for _, token := range []struct {
+		value     string
+		isRefresh bool
+	}{{login.Access, false}, {login.Refresh, true}} {
+		if _, err := jwtutil.ValidateToken(token.value, token.isRefresh); !errors.Is(err, jwtutil.ErrSessionRevoked) {
+			t.Fatalf("token after logout = %v, want ErrSessionRevoked", err)
+		}
+	}
+
+	if err := auth.Logout(1, "", SessionClient{}); err == nil {
+		t.Fatal("logout without a session should fail")
+	}
+}
+
+func TestSingleSessionModeLogsOutOtherDevices(t *testing.T) {
+	auth, sessions := newTestAuthService(t, aliceAccount(), config.AuthenticationConfig{})
+	credentials := LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}
+
+	first, err := auth.Login(credentials, SessionClient{UserAgent: "laptop"})
+	if err != nil {
+		t.Fatalf("first login failed: %v", err)
+	}
+	second, err := auth.Login(credentials, SessionClient{UserAgent: "phone"})
+	if err != nil {
+		t.Fatalf("second login failed: %v", err)
+	}
+
+	if sessions.count(1) != 1 {
+		t.Fatalf("%d sessions open, want 1", sessions.count(1))
+	}
+	if _, err := jwtutil.ValidateToken(first.Access, false); !errors.Is(err, jwtutil.ErrSessionRevoked) {
+		t.Fatalf("first device's token = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := jwtutil.ValidateToken(second.Access, false); err != nil {
+		t.Fatalf("newest token rejected: %v", err)
+	}
+}
+
+func TestMultipleSessionsAreKeptWhenAllowed(t *testing.T) {
+	auth, sessions := newTestAuthService(t, aliceAccount(), config.AuthenticationConfig{MultipleSameUserSessions: true})
+	credentials := LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}
+
+	var logins []*LoginResponse
+	for _, device := range []string{"laptop", "phone"} {
+		login, err := auth.Login(credentials, SessionClient{UserAgent: device})
+		if err != nil {
+			t.Fatalf("login from %s failed: %v", device, err)
+		}
+		logins = append(logins, login)
+	}
+
+	if sessions.count(1) != 2 {
+		t.Fatalf("%d sessions open, want 2", sessions.count(1))
+	}
+	for _, login := range logins {
+		if _, err := jwtutil.ValidateToken(login.Access, false); err != nil {
+			t.Fatalf("token rejected: %v", err)
+		}
+	}
+}
+
+// UpdatePassword stores a new password hash on the fake account
+func (r *fakeUserRepository) UpdatePassword(userID uint, passwordHash string) error {
+	for i := range r.users {
+		if r.users[i].ID == userID {
+			r.users[i].Password = passwordHash
+		}
+	}
+	return nil
+}
+
+func TestChangePasswordVerifiesTheCurrentPassword(t *testing.T) {
+	users := aliceAccount()
+	auth, sessions := newTestAuthService(t, users, config.AuthenticationConfig{MultipleSameUserSessions: true})
+
+	if err := auth.ChangePassword(1, authHash(t, "alice", "wrong-password"), "New-Password-42"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong current password = %v, want ErrInvalidCredentials", err)
+	}
+	if err := auth.ChangePassword(1, authHash(t, "alice", "Correct-Horse-9"), "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("weak new password = %v, want ErrInvalidPassword", err)
+	}
+	if err := auth.ChangePassword(2, authHash(t, "bob", "Correct-Horse-9"), "New-Password-42"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown user = %v, want ErrUserNotFound", err)
+	}
+	if users.users[0].Password != hash256encode("Correct-Horse-9") {
+		t.Fatal("a rejected change replaced the password")
+	}
+
+	credentials := LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}
+	for i := 0; i < 2; i++ {
+		if _, err := auth.Login(credentials, SessionClient{}); err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}
+
+	if err := auth.ChangePassword(1, credentials.AuthHash, "New-Password-42"); err != nil {
+		t.Fatalf("change failed: %v", err)
+	}
+	if sessions.count(1) != 0 {
+		t.Fatalf("%d sessions survived the change, want 0", sessions.count(1))
+	}
+	if _, err := auth.Login(credentials, SessionClient{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with the old password = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := auth.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "New-Password-42")}, SessionClient{}); err != nil {
+		t.Fatalf("login with the new password failed: %v", err)
+	}
+}
+
+// fakeActivityLogRepository keeps the activity rows written through it
+type fakeActivityLogRepository struct {
+	repository.ActivityLogRepository
+	mu      sync.Mutex
+	entries []model.ActivityLog
+}
+
+func (r *fakeActivityLogRepository) CreateLog(entry *model.ActivityLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func TestLoginAndLogoutAreRecordedInTheActivityLog(t *testing.T) {
+	users := aliceAccount()
+	_, sessions := newTestAuthService(t, users, config.AuthenticationConfig{})
+	activity := &fakeActivityLogRepository{}
+	auth := NewAuthService(users, sessions, activity, nil, nil, config.AuthenticationConfig{}, config.RegistrationConfig{}, config.PasswordResetConfig{})
+
+	client := SessionClient{IPAddress: "203.0.113.7", UserAgent: "test-agent"}
+	login, err := auth.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}, client)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	claims, err := jwtutil.ValidateToken(login.Access, false)
+	if err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	if err := auth.Logout(1, claims.ID, client); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+
+	if len(activity.entries) != 2 {
+		t.Fatalf("recorded %+v, want a login and a logout", activity.entries)
+	}
+	for i, action := range []string{model.ActivityLogin, model.ActivityLogout} {
+		entry := activity.entries[i]
+		if entry.Action != action || entry.UserID != 1 || entry.IPAddress != "203.0.113.7" {
+			t.Fatalf("entry %d = %+v, want %s by user 1 from the client IP", i, entry, action)
+		}
+	}
+}
+
+// IsUsernameTaken counts deactivated accounts too, as the repository does
+func (r *fakeUserRepository) IsUsernameTaken(username string) (bool, error) {
+	for _, user := range r.users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeUserRepository) CreateUser(user *model.User) error {
+	user.ID = uint(len(r.users) + 1)
+	r.users = append(r.users, *user)
+	return nil
+}
+
+func TestDeactivatedAccountsCannotBeReRegistered(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{{
+		ID: 1, Username: "alice", Email: "alice@example.com", Password: hash256encode("Correct-Horse-9"),
+		DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true},
+	}}}
+	auth, _ := newTestAuthService(t, users, config.AuthenticationConfig{})
+
+	err := auth.Register(&model.User{Username: "Alice", Email: "new@example.com", Password: "Correct-Horse-9"})
+	if err != ErrUsernameTaken {
+		t.Fatalf("re-registering the username = %v, want ErrUsernameTaken", err)
+	}
+	err = auth.Register(&model.User{Username: "alice2", Email: "alice@example.com", Password: "Correct-Horse-9"})
+	if err != ErrEmailTaken {
+		t.Fatalf("re-registering the email = %v, want ErrEmailTaken", err)
+	}
+	if _, err := auth.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}, SessionClient{}); err != ErrUserNotFound {
+		t.Fatalf("login to a deactivated account = %v, want ErrUserNotFound", err)
+	}
+
+	if err := auth.Register(&model.User{Username: "carol", Email: "carol@example.com", Password: "Correct-Horse-9"}); err != nil {
+		t.Fatalf("registering a new account failed: %v", err)
+	}
+}
+
+// failingUserRepository fails every lookup, as a dropped database connection would
+type failingUserRepository struct {
+	repository.UserRepository
+}
+
+func (failingUserRepository) GetUserByUsername(username string) (*model.User, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestLoginAsUnknownUserFailsCleanly(t *testing.T) {
+	auth, sessions := newTestAuthService(t, aliceAccount(), config.AuthenticationConfig{})
+
+	_, err := auth.Login(LoginCredentials{Username: "eve", AuthHash: authHash(t, "eve", "whatever")}, SessionClient{})
+	if err != ErrUserNotFound {
+		t.Fatalf("login as an unknown user = %v, want ErrUserNotFound", err)
+	}
+	if sessions.count(0) != 0 {
+		t.Fatal("a failed login opened a session")
+	}
+
+	// A lookup failure is reported as such, not as a missing user
+	broken := NewAuthService(failingUserRepository{}, sessions, nil, nil, nil, config.AuthenticationConfig{}, config.RegistrationConfig{}, config.PasswordResetConfig{})
+	_, err = broken.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}, SessionClient{})
+	if err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("login during a database failure = %v, want a lookup error", err)
+	}
+}
+
+func TestAccountsWithoutEmailDoNotCollide(t *testing.T) {
+	users := &fakeUserRepository{}
+	auth, _ := newTestAuthService(t, users, config.AuthenticationConfig{})
+
+	for _, username := range []string{"alice", "bob"} {
+		if err := auth.Register(&model.User{Username: username, Password: "Correct-Horse-9"}); err != nil {
+			t.Fatalf("registering %s without an email failed: %v", username, err)
+		}
+	}
+	if len(users.users) != 2 {
+		t.Fatalf("%d accounts created, want 2", len(users.users))
+	}
+
+	if err := auth.Register(&model.User{Username: "carol", Email: "carol@example.com", Password: "Correct-Horse-9"}); err != nil {
+		t.Fatalf("registering with an email failed: %v", err)
+	}
+	err := auth.Register(&model.User{Username: "dave", Email: "carol@example.com", Password: "Correct-Horse-9"})
+	if err != ErrEmailTaken {
+		t.Fatalf("reusing an email = %v, want ErrEmailTaken", err)
+	}
+}
+
+// GetUserByEmail matches live accounts only and never matches an empty email, as the repository does
+func (r *fakeUserRepository) GetUserByEmail(email string) (*model.User, error) {
+	for _, user := range r.users {
+		if email != "" && user.Email == email && !user.DeletedAt.Valid {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestLoginByEmailOrUsername(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice", Email: "a@x.io", Password: hash256encode("Correct-Horse-9")},
+	}}
+	auth, _ := newTestAuthService(t, users, config.AuthenticationConfig{MultipleSameUserSessions: true})
+
+	for _, credentials := range []LoginCredentials{
+		{Email: "a@x.io", AuthHash: authHash(t, "a@x.io", "Correct-Horse-9")},
+		{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")},
+		// Older clients send the username in the email field
+		{Email: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")},
+	} {
+		login, err := auth.Login(credentials, SessionClient{})
+		if err != nil {
+			t.Fatalf("login with %+v failed: %v", credentials, err)
+		}
+		if login.User.ID != 1 || login.User.Password != "" {
+			t.Fatalf("login with %+v returned %+v", credentials, login.User)
+		}
+	}
+
+	// The email wins when both are sent, so the authhash must be built from it
+	both := LoginCredentials{Email: "a@x.io", Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}
+	if _, err := auth.Login(both, SessionClient{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("authhash built from the username with an email sent = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := auth.Login(LoginCredentials{AuthHash: authHash(t, "alice", "Correct-Horse-9")}, SessionClient{}); err != ErrMissingIdentifier {
+		t.Fatalf("login without an identifier = %v, want ErrMissingIdentifier", err)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"live-chatter/internal/config"
+)
+
+// ChallengeVerifier checks a token produced by a client-side challenge such as a CAPTCHA.
+// Verify returns an error wrapping ErrChallengeFailed when the token is rejected; any other
+// error means the verifier could not be reached.
+type ChallengeVerifier interface {
+	Verify(token string) error
+}
+
+// NoopChallengeVerifier accepts every token; it is used when challenges are disabled
+type NoopChallengeVerifier struct{}
+
+func (NoopChallengeVerifier) Verify(string) error {
+	return nil
+}
+
+// defaultChallengeTimeout bounds a verification request when no timeout is configured
+const defaultChallengeTimeout = 5 * time.Second
+
+// HTTPChallengeVerifier verifies tokens against a siteverify endpoint as used by hCaptcha and
+// reCAPTCHA: the secret and token are posted as a form and the JSON reply reports success.
+type HTTPChallengeVerifier struct {
+	VerifyURL string
+	Secret    string
+	Client    *http.Client
+}
+
+// NewChallengeVerifier builds the verifier selected by the registration config
+func NewChallengeVerifier(cfg config.ChallengeConfig) ChallengeVerifier {
+	if !cfg.Enabled {
+		return NoopChallengeVerifier{}
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultChallengeTimeout
+	}
+	return &HTTPChallengeVerifier{
+		VerifyURL: cfg.VerifyURL,
+		Secret:    cfg.Secret,
+		Client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Verify posts the token to the siteverify endpoint
+func (v *HTTPChallengeVerifier) Verify(token string) error {
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("%w: missing challenge token", ErrChallengeFailed)
+	}
+
+	form := url.Values{}
+	form.Set("secret", v.Secret)
+	form.Set("response", token)
+
+	resp, err := v.Client.PostForm(v.VerifyURL, form)
+	if err != nil {
+		return fmt.Errorf("challenge verification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("challenge verification returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode challenge verification: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrChallengeFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
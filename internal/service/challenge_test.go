@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"live-chatter/internal/config"
+)
+
+// siteverify answers like hCaptcha: only the token "good" passes, and only with the right secret
+func siteverify(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") == "s3cret" && r.PostFormValue("response") == "good" {
+			_, _ = w.Write([]byte(`{"success":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPChallengeVerifier(t *testing.T) {
+	server := siteverify(t)
+	verifier := NewChallengeVerifier(config.ChallengeConfig{Enabled: true, VerifyURL: server.URL, Secret: "s3cret"})
+
+	if err := verifier.Verify("good"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	for _, token := range []string{"bad", " "} {
+		if err := verifier.Verify(token); !errors.Is(err, ErrChallengeFailed) {
+			t.Fatalf("token %q = %v, want ErrChallengeFailed", token, err)
+		}
+	}
+
+	server.Close()
+	if err := verifier.Verify("good"); err == nil || errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("unreachable verifier = %v, want an unavailability error", err)
+	}
+}
+
+func TestDisabledChallengeAcceptsEverything(t *testing.T) {
+	if err := NewChallengeVerifier(config.ChallengeConfig{}).Verify(""); err != nil {
+		t.Fatalf("disabled challenge rejected a sign-up: %v", err)
+	}
+}
@@ -1,82 +1,227 @@
 package service
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"live-chatter/pkg"
+	"strconv"
+	"strings"
 	"time"
 
+	"live-chatter/internal/config"
 	"live-chatter/internal/repository"
 	"live-chatter/pkg/model"
 
+	Log "live-chatter/pkg/logger"
+
 	"github.com/google/uuid"
 )
 
 type ChatService interface {
 	CreateRoom(room *model.Room) (*model.Room, error)
 	GetAllRooms() ([]model.Room, error)
+	ListRooms() ([]pkg.RoomInfo, error)
 	GetRoomByID(roomID string) (*model.Room, error)
 	GetUserRooms(userID uint) ([]model.Room, error)
-	JoinRoom(roomID string, userID uint) error
-	LeaveRoom(roomID string, userID uint) error
+	JoinRoom(roomID string, userID uint, ipAddress string) error
+	LeaveRoom(roomID string, userID uint, ipAddress string) error
+	CheckRoomJoinLimit(roomID string, userID uint) error
+	UpdateRoom(roomID string, actorID uint, update RoomUpdate) (*RoomUpdateResult, error)
+	DeleteRoom(roomID string, actorID uint) error
+	GetRoomMembers(roomID string, userID uint) ([]RoomMember, error)
+	ChangeMemberRole(roomID string, actorID, targetID uint, role string) error
+	KickUser(roomID string, actorID, targetID uint, ban bool) error
+	UnbanUser(roomID string, actorID, targetID uint) error
+	InviteUser(roomID string, actorID uint, username string) error
+	CreateInviteToken(roomID string, actorID uint, expiresIn time.Duration, maxUses int) (*model.InviteToken, error)
+	AcceptInviteToken(token string, userID uint, ipAddress string) (*model.Room, error)
+	SetRoomMuted(roomID string, userID uint, muted bool) error
+	SetRoomFavorite(roomID string, userID uint, favorite bool) error
+	AutoLeaveInactiveMembers(inactiveFor time.Duration) (int, error)
+	PurgeExpiredMessages(retention map[string]time.Duration, hard bool) (int64, error)
+
+	SaveMessage(message *model.Message, ipAddress string) (*model.Message, error)
+	GetRoomMessages(roomID string, userID uint, limit, offset int, before *time.Time) (*MessagePage, error)
+	GetRoomMessagesByCursor(roomID string, userID uint, limit int, cursor string) (*MessagePage, error)
+	ExportRoomMessages(roomID string, userID uint, emit func([]model.Message) error) error
+	SearchMessages(query, roomID string, authorID, userID uint, limit int) ([]model.Message, error)
+	GetMessage(messageID, userID uint) (*model.Message, error)
+	GetMessagesByIDs(ids []uint, userID uint) ([]model.Message, error)
+	GetMessageReplies(messageID, userID uint, limit, offset int) ([]model.Message, error)
+	EditMessage(messageID uint, userID uint, newContent string, version uint) (*model.Message, error)
+	DeleteMessage(messageID, userID uint) error
+	ReactToMessage(messageID, userID uint, emoji string, add bool) ([]repository.ReactionCount, error)
+	PinMessage(roomID string, messageID, actorID uint, pin bool) error
+	GetPinnedMessages(roomID string, userID uint) ([]model.PinnedMessage, error)
 
-	SaveMessage(message *model.Message) (*model.Message, error)
-	GetRoomMessages(roomID string, limit, offset int, before *time.Time) ([]model.Message, error)
-	SearchMessages(query, roomID string, limit int) ([]model.Message, error)
+	GetPrivateConversation(userID uint, otherUsername string, limit, offset int) ([]model.PrivateMessage, error)
+	MarkConversationRead(userID uint, otherUsername string) (int64, error)
+	MarkPrivateMessageRead(messageID, userID uint) error
 
-	GetOnlineUsers() ([]model.User, error)
+	GetOnlineUsers(source string) ([]model.User, error)
 	UpdateUserStatus(userID uint, status string) error
 	GetUserByUsername(username string) (*model.User, error)
 }
 
+// MessagePage is one page of a room's history, newest first, with the metadata clients need
+// to keep scrolling
+type MessagePage struct {
+	Messages []model.Message `json:"messages"`
+	Total    int64           `json:"total"`
+	HasMore  bool            `json:"has_more"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+	// NextCursor fetches the page after this one; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// encodeMessageCursor turns the last message of a page into an opaque cursor for the next one
+func encodeMessageCursor(message model.Message) string {
+	raw := strconv.FormatInt(message.CreatedAt.UnixNano(), 10) + "." + strconv.FormatUint(uint64(message.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeMessageCursor parses a cursor produced by encodeMessageCursor
+func decodeMessageCursor(cursor string) (*repository.MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	messageID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.MessageCursor{CreatedAt: time.Unix(0, createdAt), ID: uint(messageID)}, nil
+}
+
+// Invite token lifetime bounds; tokens are minted with the default unless the admin asks otherwise
+const (
+	defaultInviteTokenLifetime = 7 * 24 * time.Hour
+	maxInviteTokenLifetime     = 30 * 24 * time.Hour
+)
+
+// RoomUpdate lists the room settings an admin may change; nil fields are left untouched
+type RoomUpdate struct {
+	Name           *string
+	Description    *string
+	Type           *string
+	NotifyOnChange *bool
+	AutoLeave      *bool
+}
+
+// RoomUpdateResult is an updated room with any warnings about the change's effects
+type RoomUpdateResult struct {
+	Room     *model.Room `json:"room"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// roomRoles are the roles a room membership can hold
+var roomRoles = map[string]bool{"admin": true, "moderator": true, "member": true}
+
+// RoomMember is one entry of a room's member list
+type RoomMember struct {
+	UserID   uint            `json:"user_id"`
+	Username string          `json:"username"`
+	Role     string          `json:"role"`
+	JoinedAt model.Timestamp `json:"joined_at"`
+}
+
 type chatService struct {
-	messageRepo   repository.MessageRepository
-	roomRepo      repository.RoomRepository
-	userRepo      repository.UserRepository
-	clientManager *pkg.ClientManager
+	messageRepo        repository.MessageRepository
+	roomRepo           repository.RoomRepository
+	userRepo           repository.UserRepository
+	privateMessageRepo repository.PrivateMessageRepository
+	notificationRepo   repository.NotificationRepository
+	activityRepo       repository.ActivityLogRepository
+	inviteTokenRepo    repository.InviteTokenRepository
+	clientManager      *pkg.ClientManager
+	roomPolicy         config.RoomPolicyConfig
 }
 
 func NewChatService(messageRepo repository.MessageRepository,
 	roomRepo repository.RoomRepository,
 	userRepo repository.UserRepository,
-	clientManager *pkg.ClientManager) ChatService {
+	privateMessageRepo repository.PrivateMessageRepository,
+	notificationRepo repository.NotificationRepository,
+	activityRepo repository.ActivityLogRepository,
+	inviteTokenRepo repository.InviteTokenRepository,
+	clientManager *pkg.ClientManager,
+	roomPolicy config.RoomPolicyConfig) ChatService {
 
 	return &chatService{
-		messageRepo:   messageRepo,
-		roomRepo:      roomRepo,
-		userRepo:      userRepo,
-		clientManager: clientManager,
+		messageRepo:        messageRepo,
+		roomRepo:           roomRepo,
+		userRepo:           userRepo,
+		privateMessageRepo: privateMessageRepo,
+		notificationRepo:   notificationRepo,
+		activityRepo:       activityRepo,
+		inviteTokenRepo:    inviteTokenRepo,
+		clientManager:      clientManager,
+		roomPolicy:         roomPolicy,
 	}
 }
 
 // CreateRoom creates a new chat room
 func (s *chatService) CreateRoom(room *model.Room) (*model.Room, error) {
+	if err := s.validateRoom(room); err != nil {
+		return nil, err
+	}
+
 	room.ID = uuid.New().String()
 
-	if room.Name == "" {
-		return nil, errors.New("room name cannot be empty")
+	existingRoom, err := s.roomRepo.GetRoomByName(room.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room name: %v", err)
 	}
-
-	existingRoom, _ := s.roomRepo.GetRoomByName(room.Name)
 	if existingRoom != nil {
-		return nil, errors.New("room name already exists")
+		return nil, ErrRoomNameTaken
 	}
 
 	if room.Type == "" {
 		room.Type = "public"
 	}
 
-	err := s.roomRepo.CreateRoom(room)
-	if err != nil {
+	if err := s.checkRoomCreationLimit(room.CreatedBy); err != nil {
+		return nil, err
+	}
+	if err := s.checkRoomJoinLimit(room.CreatedBy); err != nil {
+		return nil, err
+	}
+
+	if err := s.roomRepo.CreateRoomWithCreator(room, room.CreatedBy); err != nil {
+		if repository.IsUniqueViolation(err) {
+			return nil, ErrRoomNameTaken
+		}
 		return nil, fmt.Errorf("failed to create room: %v", err)
 	}
 
-	err = s.roomRepo.AddUserToRoom(room.ID, room.CreatedBy, "admin")
+	return room, nil
+}
+
+// validateRoom normalizes a room's name and description in place, rejecting values that break
+// the room policy. Every path that creates or updates a room goes through it.
+func (s *chatService) validateRoom(room *model.Room) error {
+	name, err := normalizeRoomName(room.Name, s.roomPolicy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add creator to room: %v", err)
+		return err
+	}
+	description, err := sanitizeRoomDescription(room.Description, s.roomPolicy)
+	if err != nil {
+		return err
 	}
 
-	return room, nil
+	room.Name = name
+	room.Description = description
+	return nil
 }
 
 // GetAllRooms returns all available rooms
@@ -84,6 +229,30 @@ func (s *chatService) GetAllRooms() ([]model.Room, error) {
 	return s.roomRepo.GetAllRooms()
 }
 
+// ListRooms returns every room along with how many of its members are connected right now
+func (s *chatService) ListRooms() ([]pkg.RoomInfo, error) {
+	rooms, err := s.roomRepo.GetAllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]pkg.RoomInfo, 0, len(rooms))
+	for _, room := range rooms {
+		info := pkg.RoomInfo{
+			ID:          room.ID,
+			Name:        room.Name,
+			Description: room.Description,
+			Type:        room.Type,
+			CreatedAt:   room.CreatedAt,
+		}
+		if s.clientManager != nil {
+			info.UserCount = len(s.clientManager.GetRoomUsers(room.ID))
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 // GetRoomByID returns a room by its ID
 func (s *chatService) GetRoomByID(roomID string) (*model.Room, error) {
 	return s.roomRepo.GetRoomByID(roomID)
@@ -95,24 +264,120 @@ func (s *chatService) GetUserRooms(userID uint) ([]model.Room, error) {
 }
 
 // JoinRoom adds a user to a room
-func (s *chatService) JoinRoom(roomID string, userID uint) error {
+func (s *chatService) JoinRoom(roomID string, userID uint, ipAddress string) error {
 	room, err := s.roomRepo.GetRoomByID(roomID)
 	if err != nil {
 		return err
 	}
 	if room == nil {
-		return errors.New("room not found")
+		return ErrRoomNotFound
+	}
+
+	banned, err := s.roomRepo.IsUserBanned(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room bans: %v", err)
+	}
+	if banned {
+		return ErrBannedFromRoom
+	}
+
+	// Private rooms admit their current members and invited users only
+	invited := false
+	if room.Type == "private" {
+		isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check room membership: %v", err)
+		}
+		if !isMember {
+			invited, err = s.roomRepo.HasInvite(roomID, userID)
+			if err != nil {
+				return fmt.Errorf("failed to check room invites: %v", err)
+			}
+			if !invited {
+				return ErrInviteRequired
+			}
+		}
+	}
+
+	if err := s.CheckRoomJoinLimit(roomID, userID); err != nil {
+		return err
+	}
+
+	if err := s.addMember(roomID, userID, ipAddress); err != nil {
+		return err
 	}
+	if invited {
+		if err := s.roomRepo.DeleteInvite(roomID, userID); err != nil {
+			Log.Error("Failed to use up invite of user %d to room %s: %v", userID, roomID, err)
+		}
+	}
+	return nil
+}
+
+// CheckRoomJoinLimit applies the join limit unless the user already belongs to the room,
+// since joining again does not add a membership. WebSocket joins are checked through it too.
+func (s *chatService) CheckRoomJoinLimit(roomID string, userID uint) error {
+	if s.roomPolicy.MaxRoomsJoined <= 0 {
+		return nil
+	}
+	isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if isMember {
+		return nil
+	}
+	return s.checkRoomJoinLimit(userID)
+}
+
+// checkRoomJoinLimit refuses another membership to a user at the configured maximum
+func (s *chatService) checkRoomJoinLimit(userID uint) error {
+	if s.roomPolicy.MaxRoomsJoined <= 0 {
+		return nil
+	}
+	count, err := s.roomRepo.CountUserRooms(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count joined rooms: %v", err)
+	}
+	if count >= int64(s.roomPolicy.MaxRoomsJoined) {
+		return fmt.Errorf("%w (maximum %d)", ErrTooManyRoomsJoined, s.roomPolicy.MaxRoomsJoined)
+	}
+	return nil
+}
+
+// checkRoomCreationLimit refuses another room to a user who has created the configured maximum
+func (s *chatService) checkRoomCreationLimit(userID uint) error {
+	if s.roomPolicy.MaxRoomsCreated <= 0 {
+		return nil
+	}
+	count, err := s.roomRepo.CountRoomsCreatedBy(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count created rooms: %v", err)
+	}
+	if count >= int64(s.roomPolicy.MaxRoomsCreated) {
+		return fmt.Errorf("%w (maximum %d)", ErrTooManyRoomsCreated, s.roomPolicy.MaxRoomsCreated)
+	}
+	return nil
+}
 
-	err = s.roomRepo.AddUserToRoom(roomID, userID, "member")
+// addMember persists a membership the caller has already authorized and syncs it to the user's
+// live connection
+func (s *chatService) addMember(roomID string, userID uint, ipAddress string) error {
+	joined, err := s.roomRepo.AddUserToRoom(roomID, userID, "member")
 	if err != nil {
 		return err
 	}
+	if joined && s.clientManager != nil {
+		s.clientManager.AdjustMemberCount(roomID, 1)
+	}
 
 	user, err := s.userRepo.GetUserByID(userID)
 	if err != nil {
 		return err
 	}
+	if user == nil {
+		return ErrUserNotFound
+	}
 
 	// Sync with WebSocket client manager
 	if s.clientManager != nil {
@@ -121,18 +386,19 @@ func (s *chatService) JoinRoom(roomID string, userID uint) error {
 		}
 	}
 
+	pkg.RecordActivity(s.activityRepo, userID, model.ActivityJoinRoom, "room "+roomID, ipAddress)
 	return nil
 }
 
 // LeaveRoom removes a user from a room
-func (s *chatService) LeaveRoom(roomID string, userID uint) error {
+func (s *chatService) LeaveRoom(roomID string, userID uint, ipAddress string) error {
 	room, err := s.roomRepo.GetRoomByID(roomID)
 	if err != nil {
-		return errors.New("room not found")
+		return ErrRoomNotFound
 	}
 
 	if room == nil {
-		return errors.New("room not found")
+		return ErrRoomNotFound
 	}
 
 	isInRoom, err := s.roomRepo.IsUserInRoom(roomID, userID)
@@ -141,13 +407,16 @@ func (s *chatService) LeaveRoom(roomID string, userID uint) error {
 	}
 
 	if !isInRoom {
-		return errors.New("user is not in this room")
+		return ErrNotRoomMember
 	}
 
 	user, err := s.userRepo.GetUserByID(userID)
 	if err != nil {
 		return err
 	}
+	if user == nil {
+		return ErrUserNotFound
+	}
 
 	// Sync with WebSocket client manager first
 	if s.clientManager != nil {
@@ -157,26 +426,177 @@ func (s *chatService) LeaveRoom(roomID string, userID uint) error {
 	}
 
 	// Remove user from room
-	err = s.roomRepo.RemoveUserFromRoom(roomID, userID)
+	left, err := s.roomRepo.RemoveUserFromRoom(roomID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to leave room: %v", err)
 	}
+	if left && s.clientManager != nil {
+		s.clientManager.AdjustMemberCount(roomID, -1)
+	}
+
+	pkg.RecordActivity(s.activityRepo, userID, model.ActivityLeaveRoom, "room "+roomID, ipAddress)
+	return nil
+}
+
+// SetRoomMuted toggles whether the user receives notifications from a room they belong to
+func (s *chatService) SetRoomMuted(roomID string, userID uint, muted bool) error {
+	isInRoom, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isInRoom {
+		return ErrNotRoomMember
+	}
+
+	if err := s.roomRepo.SetMuted(roomID, userID, muted); err != nil {
+		return fmt.Errorf("failed to update mute setting: %v", err)
+	}
+	return nil
+}
+
+// SetRoomFavorite marks a room as a favorite of the user, which exempts them from auto-leave there
+func (s *chatService) SetRoomFavorite(roomID string, userID uint, favorite bool) error {
+	isInRoom, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isInRoom {
+		return ErrNotRoomMember
+	}
 
+	if err := s.roomRepo.SetFavorite(roomID, userID, favorite); err != nil {
+		return fmt.Errorf("failed to update favorite setting: %v", err)
+	}
 	return nil
 }
 
-func (s *chatService) GetOnlineUsers() ([]model.User, error) {
-	return s.userRepo.GetOnlineUsers()
+// AutoLeaveInactiveMembers ends memberships in opted-in rooms that have seen no activity from
+// the member for inactiveFor. Removed users are told why, live or through a stored notification,
+// and keep access to the room's history. It returns how many memberships were ended.
+func (s *chatService) AutoLeaveInactiveMembers(inactiveFor time.Duration) (int, error) {
+	members, err := s.roomRepo.GetInactiveMembers(time.Now().Add(-inactiveFor))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load inactive members: %v", err)
+	}
+
+	removed := 0
+	var notifications []model.Notification
+	for _, member := range members {
+		left, err := s.roomRepo.RemoveUserFromRoom(member.RoomID, member.UserID)
+		if err != nil {
+			Log.Error("Failed to auto-leave user %d from room %s: %v", member.UserID, member.RoomID, err)
+			continue
+		}
+		if !left {
+			continue
+		}
+		removed++
+
+		if s.clientManager != nil {
+			s.clientManager.AdjustMemberCount(member.RoomID, -1)
+			if s.clientManager.IsUserOnline(member.User.Username) {
+				s.clientManager.EvictFromRoom(member.User.Username, member.RoomID, "auto_left_room",
+					map[string]string{"room": member.Room.Name})
+				continue
+			}
+		}
+		notifications = append(notifications, model.Notification{
+			UserID:  member.UserID,
+			Type:    model.NotificationRoomAutoLeft,
+			RoomID:  member.RoomID,
+			Content: member.Room.Name,
+		})
+	}
+
+	if s.notificationRepo != nil {
+		if err := s.notificationRepo.CreateNotifications(notifications); err != nil {
+			Log.Error("Failed to store auto-leave notifications: %v", err)
+		}
+	}
+	return removed, nil
+}
+
+// PurgeExpiredMessages deletes messages older than the retention period for their room's type.
+// Room types missing from retention, or given a period of zero, keep their messages. Messages are
+// soft-deleted unless hard is set. It returns how many messages were purged.
+func (s *chatService) PurgeExpiredMessages(retention map[string]time.Duration, hard bool) (int64, error) {
+	rooms, err := s.roomRepo.GetAllRooms()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load rooms: %v", err)
+	}
+
+	now := time.Now()
+	var purged int64
+	for _, room := range rooms {
+		keep := retention[room.Type]
+		if keep <= 0 {
+			continue
+		}
+		deleted, err := s.messageRepo.DeleteMessagesOlderThan(room.ID, now.Add(-keep), hard)
+		if err != nil {
+			Log.Error("Failed to purge expired messages in room %s: %v", room.ID, err)
+			continue
+		}
+		purged += deleted
+	}
+	return purged, nil
+}
+
+// Sources GetOnlineUsers can read presence from
+const (
+	PresenceSourceDB     = "db"     // The users.status column
+	PresenceSourceLive   = "live"   // Users with an open WebSocket, as the manager sees them
+	PresenceSourceMerged = "merged" // Either of the above
+)
+
+// GetOnlineUsers lists the users who are online according to the given source, defaulting to
+// the database. The live list is authoritative; the stored status can lag behind it, for
+// instance after a crash left users marked online.
+func (s *chatService) GetOnlineUsers(source string) ([]model.User, error) {
+	switch source {
+	case "", PresenceSourceDB:
+		return s.userRepo.GetOnlineUsers()
+	case PresenceSourceLive, PresenceSourceMerged:
+	default:
+		return nil, ErrInvalidPresenceSource
+	}
+
+	var live []string
+	if s.clientManager != nil {
+		live = s.clientManager.GetOnlineUsers()
+	}
+	users, err := s.userRepo.GetUsersByUsernames(live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live users: %w", err)
+	}
+	if source == PresenceSourceLive {
+		return users, nil
+	}
+
+	stored, err := s.userRepo.GetOnlineUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get online users: %w", err)
+	}
+	seen := make(map[uint]bool, len(users))
+	for _, user := range users {
+		seen[user.ID] = true
+	}
+	for _, user := range stored {
+		if !seen[user.ID] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
 }
 
-func (s *chatService) SaveMessage(message *model.Message) (*model.Message, error) {
-	if message.Content == "" {
+func (s *chatService) SaveMessage(message *model.Message, ipAddress string) (*model.Message, error) {
+	if message.Content == "" && message.AttachmentID == nil {
 		return nil, errors.New("message content cannot be empty")
 	}
 
 	room, err := s.roomRepo.GetRoomByID(message.RoomID)
 	if err != nil || room == nil {
-		return nil, errors.New("room not found")
+		return nil, ErrRoomNotFound
 	}
 
 	isInRoom, err := s.roomRepo.IsUserInRoom(message.RoomID, message.UserID)
@@ -184,7 +604,42 @@ func (s *chatService) SaveMessage(message *model.Message) (*model.Message, error
 		return nil, fmt.Errorf("failed to check room membership: %v", err)
 	}
 	if !isInRoom {
-		return nil, errors.New("user is not in this room")
+		return nil, ErrNotRoomMember
+	}
+
+	if message.ParentID != nil {
+		var policy pkg.ThreadPolicy
+		if s.clientManager != nil {
+			policy = s.clientManager.ThreadPolicy
+		}
+		if err := pkg.ValidateReplyParent(s.messageRepo, policy, *message.ParentID, message.RoomID, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.clientManager != nil {
+		if err := s.clientManager.AttachToMessage(message); err != nil {
+			return nil, err
+		}
+	}
+
+	var annotations map[string]interface{}
+	if s.clientManager != nil {
+		preSend := &pkg.PreSendMessage{
+			Kind:    "chat_message",
+			Sender:  &model.User{ID: message.UserID, Username: message.Username},
+			RoomID:  message.RoomID,
+			Content: message.Content,
+
+			HasAttachment: message.AttachmentID != nil,
+		}
+		if err := s.clientManager.RunPreSendHooks(preSend); err != nil {
+			return nil, err
+		}
+		message.Content = preSend.Content
+		if len(preSend.Annotations) > 0 {
+			annotations = preSend.Annotations
+		}
 	}
 
 	message.CreatedAt = time.Now()
@@ -193,14 +648,51 @@ func (s *chatService) SaveMessage(message *model.Message) (*model.Message, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to save message: %v", err)
 	}
+	s.touchMembership(message.RoomID, message.UserID)
+
+	s.broadcastToRoom(message.RoomID, &pkg.Message{
+		ID:        fmt.Sprintf("%d", message.ID),
+		Type:      "chat_message",
+		Content:   message.Content,
+		UserID:    message.UserID,
+		Username:  message.Username,
+		RoomID:    message.RoomID,
+		ParentID:  message.ParentID,
+		Timestamp: message.CreatedAt,
+		Data:      annotations,
+
+		AttachmentURL: message.AttachmentURL,
+	})
+	if s.clientManager != nil {
+		s.clientManager.NotifyMentions(message)
+	}
+	pkg.RecordActivity(s.activityRepo, message.UserID, model.ActivitySendMessage,
+		fmt.Sprintf("message %d in room %s", message.ID, message.RoomID), ipAddress)
 
 	return message, nil
 }
 
-func (s *chatService) GetRoomMessages(roomID string, limit, offset int, before *time.Time) ([]model.Message, error) {
+// touchMembership records that a member sent or read messages in the room, postponing auto-leave
+func (s *chatService) touchMembership(roomID string, userID uint) {
+	if err := s.roomRepo.TouchMembership(roomID, userID); err != nil {
+		Log.Warn("Failed to record activity of user %d in room %s: %v", userID, roomID, err)
+	}
+}
+
+// GetRoomMessages returns a page of a room's history, newest first, to a member of the room.
+// Reading it counts as activity in the room for auto-leave.
+func (s *chatService) GetRoomMessages(roomID string, userID uint, limit, offset int, before *time.Time) (*MessagePage, error) {
 	room, err := s.roomRepo.GetRoomByID(roomID)
 	if err != nil || room == nil {
-		return nil, errors.New("room not found")
+		return nil, ErrRoomNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
 	}
 
 	messages, err := s.messageRepo.GetMessagesByRoomID(roomID, limit, offset, before)
@@ -208,40 +700,1022 @@ func (s *chatService) GetRoomMessages(roomID string, limit, offset int, before *
 		return nil, fmt.Errorf("failed to get messages: %v", err)
 	}
 
-	return messages, nil
+	total, err := s.messageRepo.GetMessageCountByRoom(roomID, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %v", err)
+	}
+
+	s.touchMembership(roomID, userID)
+
+	page := &MessagePage{
+		Messages: messages,
+		Total:    total,
+		HasMore:  int64(offset+len(messages)) < total,
+		Limit:    limit,
+		Offset:   offset,
+	}
+	if page.HasMore && len(messages) > 0 {
+		page.NextCursor = encodeMessageCursor(messages[len(messages)-1])
+	}
+	return page, nil
 }
 
-func (s *chatService) SearchMessages(query, roomID string, limit int) ([]model.Message, error) {
-	if query == "" {
-		return nil, errors.New("search query cannot be empty")
+// GetRoomMessagesByCursor returns the page of a room's history after the given cursor, newest
+// first, starting from the newest message when the cursor is empty. Pages stay stable while new
+// messages are posted, which offset pagination cannot guarantee. Like GetRoomMessages, reading
+// counts as activity in the room, and only members may read it.
+func (s *chatService) GetRoomMessagesByCursor(roomID string, userID uint, limit int, cursor string) (*MessagePage, error) {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
 	}
 
-	// If roomID is provided, validate room exists
-	if roomID != "" {
-		room, err := s.roomRepo.GetRoomByID(roomID)
-		if err != nil || room == nil {
-			return nil, errors.New("room not found")
+	isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	var position *repository.MessageCursor
+	if cursor != "" {
+		if position, err = decodeMessageCursor(cursor); err != nil {
+			return nil, err
 		}
 	}
 
-	// Search messages
-	messages, err := s.messageRepo.SearchMessages(query, roomID, limit)
+	// One extra row tells whether another page follows without a separate count
+	messages, err := s.messageRepo.GetMessagesByRoomCursor(roomID, limit+1, position)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search messages: %v", err)
+		return nil, fmt.Errorf("failed to get messages: %v", err)
 	}
 
-	return messages, nil
+	total, err := s.messageRepo.GetMessageCountByRoom(roomID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %v", err)
+	}
+
+	s.touchMembership(roomID, userID)
+
+	page := &MessagePage{Total: total, Limit: limit}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.HasMore = true
+		page.NextCursor = encodeMessageCursor(messages[len(messages)-1])
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// exportBatchSize is how many messages an export reads per query
+const exportBatchSize = 500
+
+// ExportRoomMessages hands a room's entire history to emit, oldest first, one batch at a time so
+// the export never holds it all in memory. Only room admins may export. An error from emit stops
+// the export and is returned.
+func (s *chatService) ExportRoomMessages(roomID string, userID uint, emit func([]model.Message) error) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	role, err := s.roomRepo.GetUserRole(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if role != "admin" {
+		return ErrNotRoomAdmin
+	}
+
+	var position *repository.MessageCursor
+	for {
+		messages, err := s.messageRepo.GetMessagesByRoomAfter(roomID, exportBatchSize, position)
+		if err != nil {
+			return fmt.Errorf("failed to get messages: %v", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		if err := emit(messages); err != nil {
+			return err
+		}
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+		last := messages[len(messages)-1]
+		position = &repository.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// UpdateRoom changes a room's settings on behalf of one of its admins. Names and descriptions
+// pass the same policy as at creation. A room may switch between public and private freely;
+// making a room private keeps its current members, which the result warns about.
+func (s *chatService) UpdateRoom(roomID string, actorID uint, update RoomUpdate) (*RoomUpdateResult, error) {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" {
+		return nil, ErrNotRoomAdmin
+	}
+
+	result := &RoomUpdateResult{Room: room}
+	oldName := room.Name
+
+	if update.Name != nil {
+		room.Name = *update.Name
+	}
+	if update.Description != nil {
+		room.Description = *update.Description
+	}
+	if err := s.validateRoom(room); err != nil {
+		return nil, err
+	}
+	if room.Name != oldName {
+		existingRoom, err := s.roomRepo.GetRoomByName(room.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check room name: %v", err)
+		}
+		if existingRoom != nil && existingRoom.ID != room.ID {
+			return nil, ErrRoomNameTaken
+		}
+	}
+
+	if update.Type != nil && *update.Type != room.Type {
+		if *update.Type != "public" && *update.Type != "private" {
+			return nil, ErrInvalidRoomType
+		}
+		if *update.Type == "private" {
+			members, err := s.roomRepo.CountActiveMembers(roomID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count room members: %v", err)
+			}
+			if members > 1 {
+				result.Warnings = append(result.Warnings, fmt.Sprintf(
+					"%d existing members keep access; kick anyone who should not", members))
+			}
+		}
+		room.Type = *update.Type
+	}
+	if update.NotifyOnChange != nil {
+		room.NotifyOnChange = *update.NotifyOnChange
+	}
+	if update.AutoLeave != nil {
+		room.AutoLeave = *update.AutoLeave
+	}
+
+	if err := s.roomRepo.UpdateRoom(room); err != nil {
+		if repository.IsUniqueViolation(err) {
+			return nil, ErrRoomNameTaken
+		}
+		return nil, fmt.Errorf("failed to update room: %v", err)
+	}
+
+	s.broadcastToRoom(roomID, &pkg.Message{
+		ID:        uuid.New().String(),
+		Type:      "room_updated",
+		UserID:    actorID,
+		RoomID:    roomID,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"name":             room.Name,
+			"description":      room.Description,
+			"type":             room.Type,
+			"notify_on_change": room.NotifyOnChange,
+			"auto_leave":       room.AutoLeave,
+		},
+	})
+	return result, nil
+}
+
+// DeleteRoom soft-deletes a room and ends every membership in it. Only the room's creator or
+// one of its admins may delete it. Connected members are removed from the room at once.
+func (s *chatService) DeleteRoom(roomID string, actorID uint) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	if room.CreatedBy != actorID {
+		actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+		if err != nil {
+			return fmt.Errorf("failed to check room role: %v", err)
+		}
+		if actorRole != "admin" {
+			return ErrNotRoomAdmin
+		}
+	}
+
+	if err := s.roomRepo.DeleteRoom(roomID); err != nil {
+		return fmt.Errorf("failed to delete room: %v", err)
+	}
+
+	if s.clientManager != nil {
+		s.clientManager.CloseRoom(roomID, room.Name, actorID)
+	}
+	return nil
+}
+
+// GetRoomMembers lists the room's current members and their roles. Members of private rooms
+// are only visible to other members.
+func (s *chatService) GetRoomMembers(roomID string, userID uint) ([]RoomMember, error) {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	if room.Type == "private" {
+		isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check room membership: %v", err)
+		}
+		if !isMember {
+			return nil, ErrNotRoomMember
+		}
+	}
+
+	memberships, err := s.roomRepo.GetRoomMembers(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room members: %v", err)
+	}
+
+	members := make([]RoomMember, 0, len(memberships))
+	for _, membership := range memberships {
+		members = append(members, RoomMember{
+			UserID:   membership.UserID,
+			Username: membership.User.Username,
+			Role:     membership.Role,
+			JoinedAt: model.Timestamp(membership.JoinedAt),
+		})
+	}
+	return members, nil
+}
+
+// ChangeMemberRole promotes or demotes a member of the room. Only room admins may change roles,
+// and the room's last admin cannot be demoted, including by themselves.
+func (s *chatService) ChangeMemberRole(roomID string, actorID, targetID uint, role string) error {
+	if !roomRoles[role] {
+		return ErrInvalidRole
+	}
+
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" {
+		return ErrNotRoomAdmin
+	}
+
+	currentRole, err := s.roomRepo.GetUserRole(roomID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if currentRole == "" {
+		return ErrNotRoomMember
+	}
+	if currentRole == role {
+		return nil
+	}
+
+	// The repository checks for the last admin in the same transaction as the change
+	updated, err := s.roomRepo.UpdateMemberRole(roomID, targetID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %v", err)
+	}
+	if !updated {
+		return ErrLastRoomAdmin
+	}
+
+	s.broadcastToRoom(roomID, &pkg.Message{
+		ID:        uuid.New().String(),
+		Type:      "member_role_changed",
+		UserID:    actorID,
+		RoomID:    roomID,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"user_id": targetID,
+			"role":    role,
+		},
+	})
+	return nil
+}
+
+// KickUser ends another member's membership on behalf of a room admin or moderator and, when ban
+// is set, keeps them from rejoining. Moderators may only remove plain members; admins must be
+// demoted before they can be removed. A live target is evicted from the room at once and the
+// room is told with a user_kicked event. Banning a user who is not a member is allowed.
+func (s *chatService) KickUser(roomID string, actorID, targetID uint, ban bool) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" && actorRole != "moderator" {
+		return ErrNotRoomModerator
+	}
+
+	target, err := s.userRepo.GetUserByID(targetID)
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %v", err)
+	}
+	if target == nil {
+		return ErrUserNotFound
+	}
+
+	targetRole, err := s.roomRepo.GetUserRole(roomID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if targetID == actorID || targetRole == "admin" || (targetRole == "moderator" && actorRole != "admin") {
+		return ErrCannotKick
+	}
+	if targetRole == "" && !ban {
+		return ErrNotRoomMember
+	}
+
+	if ban {
+		if err := s.roomRepo.BanUser(&model.RoomBan{RoomID: roomID, UserID: targetID, BannedBy: actorID}); err != nil {
+			return fmt.Errorf("failed to ban user: %v", err)
+		}
+	}
+
+	left, err := s.roomRepo.RemoveUserFromRoom(roomID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to remove user from room: %v", err)
+	}
+
+	if s.clientManager != nil {
+		if left {
+			s.clientManager.AdjustMemberCount(roomID, -1)
+		}
+		reasonKey := "kicked_from_room"
+		if ban {
+			reasonKey = "banned_from_room"
+		}
+		s.clientManager.EvictFromRoom(target.Username, roomID, reasonKey, map[string]string{"room": room.Name})
+	}
+
+	if left || ban {
+		s.broadcastToRoom(roomID, &pkg.Message{
+			ID:        uuid.New().String(),
+			Type:      "user_kicked",
+			UserID:    actorID,
+			RoomID:    roomID,
+			Timestamp: time.Now(),
+			Data: map[string]interface{}{
+				"user_id":  targetID,
+				"username": target.Username,
+				"banned":   ban,
+			},
+		})
+		if s.clientManager != nil {
+			s.clientManager.Notify(target.Username, model.Notification{
+				UserID:  targetID,
+				Type:    model.NotificationRoomKick,
+				RoomID:  roomID,
+				ActorID: actorID,
+				Content: room.Name,
+			}, map[string]interface{}{
+				"room_name": room.Name,
+				"banned":    ban,
+			})
+		}
+	}
+	return nil
+}
+
+// UnbanUser lets a banned user join the room again; any room admin or moderator may lift a ban
+func (s *chatService) UnbanUser(roomID string, actorID, targetID uint) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" && actorRole != "moderator" {
+		return ErrNotRoomModerator
+	}
+
+	if _, err := s.roomRepo.UnbanUser(roomID, targetID); err != nil {
+		return fmt.Errorf("failed to lift ban: %v", err)
+	}
+	return nil
+}
+
+// InviteUser lets a user join a private room on behalf of one of its admins. The invitee is sent
+// a notification. Public rooms need no invite.
+func (s *chatService) InviteUser(roomID string, actorID uint, username string) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" {
+		return ErrNotRoomAdmin
+	}
+
+	invitee, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %v", err)
+	}
+	if invitee == nil {
+		return ErrUserNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(roomID, invitee.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if isMember {
+		return ErrAlreadyRoomMember
+	}
+
+	if err := s.roomRepo.CreateInvite(&model.RoomInvite{RoomID: roomID, UserID: invitee.ID, InvitedBy: actorID}); err != nil {
+		return fmt.Errorf("failed to create invite: %v", err)
+	}
+
+	if s.clientManager != nil {
+		s.clientManager.Notify(invitee.Username, model.Notification{
+			UserID:  invitee.ID,
+			Type:    model.NotificationRoomInvite,
+			RoomID:  roomID,
+			ActorID: actorID,
+			Content: room.Name,
+		}, map[string]interface{}{
+			"room_name": room.Name,
+		})
+	}
+	return nil
+}
+
+// CreateInviteToken mints a shareable invite link to the room on behalf of one of its admins.
+// A zero expiresIn uses the default lifetime; a zero maxUses allows unlimited joins.
+func (s *chatService) CreateInviteToken(roomID string, actorID uint, expiresIn time.Duration, maxUses int) (*model.InviteToken, error) {
+	if expiresIn == 0 {
+		expiresIn = defaultInviteTokenLifetime
+	}
+	if expiresIn < 0 || expiresIn > maxInviteTokenLifetime {
+		return nil, fmt.Errorf("%w: expiry must be at most %d days", ErrInvalidInvite, int(maxInviteTokenLifetime.Hours()/24))
+	}
+	if maxUses < 0 {
+		return nil, fmt.Errorf("%w: max uses cannot be negative", ErrInvalidInvite)
+	}
+
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" {
+		return nil, ErrNotRoomAdmin
+	}
+
+	token := &model.InviteToken{
+		Token:     uuid.New().String(),
+		RoomID:    roomID,
+		CreatedBy: actorID,
+		ExpiresAt: time.Now().Add(expiresIn),
+		MaxUses:   maxUses,
+	}
+	if err := s.inviteTokenRepo.CreateToken(token); err != nil {
+		return nil, fmt.Errorf("failed to create invite: %v", err)
+	}
+	return token, nil
+}
+
+// AcceptInviteToken joins the user to the token's room. A use is only counted when the user
+// actually joins; current members get the room back without spending one. Bans still apply.
+func (s *chatService) AcceptInviteToken(token string, userID uint, ipAddress string) (*model.Room, error) {
+	inviteToken, err := s.inviteTokenRepo.GetToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up invite: %v", err)
+	}
+	if inviteToken == nil {
+		return nil, ErrInviteNotFound
+	}
+
+	room, err := s.roomRepo.GetRoomByID(inviteToken.RoomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(room.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if isMember {
+		return room, nil
+	}
+
+	banned, err := s.roomRepo.IsUserBanned(room.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room bans: %v", err)
+	}
+	if banned {
+		return nil, ErrBannedFromRoom
+	}
+	if err := s.checkRoomJoinLimit(userID); err != nil {
+		return nil, err
+	}
+
+	redeemed, err := s.inviteTokenRepo.RedeemToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem invite: %v", err)
+	}
+	if !redeemed {
+		if !inviteToken.ExpiresAt.After(time.Now()) {
+			return nil, ErrInviteExpired
+		}
+		return nil, ErrInviteExhausted
+	}
+
+	if err := s.addMember(room.ID, userID, ipAddress); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// GetMessage returns a single message with its author, parent and replies, provided the caller
+// is a member of the message's room
+func (s *chatService) GetMessage(messageID, userID uint) (*model.Message, error) {
+	message, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(message.RoomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	return message, nil
+}
+
+// MaxBatchMessages caps how many messages a single GetMessagesByIDs call may request
+const MaxBatchMessages = 200
+
+// GetMessagesByIDs returns the requested messages in the order their IDs were given, so
+// reconnecting clients can fill gaps. Missing messages and those in rooms the caller is not a
+// member of are left out; repeated IDs are returned once.
+func (s *chatService) GetMessagesByIDs(ids []uint, userID uint) ([]model.Message, error) {
+	if len(ids) > MaxBatchMessages {
+		return nil, ErrTooManyMessages
+	}
+
+	found, err := s.messageRepo.GetMessagesByIDs(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	byID := make(map[uint]model.Message, len(found))
+	memberOf := make(map[string]bool)
+	for _, message := range found {
+		isMember, checked := memberOf[message.RoomID]
+		if !checked {
+			isMember, err = s.roomRepo.IsUserInRoom(message.RoomID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check room membership: %v", err)
+			}
+			memberOf[message.RoomID] = isMember
+		}
+		if isMember {
+			byID[message.ID] = message
+		}
+	}
+
+	messages := make([]model.Message, 0, len(byID))
+	for _, id := range ids {
+		if message, ok := byID[id]; ok {
+			messages = append(messages, message)
+			delete(byID, id)
+		}
+	}
+	return messages, nil
+}
+
+// GetMessageReplies returns the replies posted under a message, oldest first, to a member of
+// the message's room
+func (s *chatService) GetMessageReplies(messageID, userID uint, limit, offset int) ([]model.Message, error) {
+	parent, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil || parent == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(parent.RoomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	replies, err := s.messageRepo.GetReplies(messageID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %v", err)
+	}
+
+	return replies, nil
+}
+
+// SearchMessages finds messages matching the query, optionally from one author, in the rooms the
+// caller belongs to. A room to search in must be one of them.
+func (s *chatService) SearchMessages(query, roomID string, authorID, userID uint, limit int) ([]model.Message, error) {
+	if query == "" {
+		return nil, errors.New("search query cannot be empty")
+	}
+
+	// If roomID is provided, validate room exists and the caller may read it
+	if roomID != "" {
+		room, err := s.roomRepo.GetRoomByID(roomID)
+		if err != nil || room == nil {
+			return nil, ErrRoomNotFound
+		}
+
+		isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check room membership: %v", err)
+		}
+		if !isMember {
+			return nil, ErrNotRoomMember
+		}
+	}
+
+	// Search messages
+	messages, err := s.messageRepo.SearchMessages(query, roomID, authorID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+
+	return messages, nil
+}
+
+// EditMessage replaces the content of a message, provided the caller authored it. The new content
+// goes through the pre-send hooks like a fresh message. A non-zero
+// version must match the message's current version; either way ErrMessageConflict is returned
+// when the message changes between being read and written.
+func (s *chatService) EditMessage(messageID uint, userID uint, newContent string, version uint) (*model.Message, error) {
+	if strings.TrimSpace(newContent) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	message, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil || message == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if message.UserID != userID {
+		return nil, ErrNotMessageAuthor
+	}
+
+	if version != 0 && version != message.Version {
+		return nil, ErrMessageConflict
+	}
+
+	var annotations map[string]interface{}
+	if s.clientManager != nil {
+		preSend := &pkg.PreSendMessage{
+			Kind:    "message_edit",
+			Sender:  &model.User{ID: message.UserID, Username: message.Username},
+			RoomID:  message.RoomID,
+			Content: newContent,
+
+			HasAttachment: message.AttachmentID != nil,
+		}
+		if err := s.clientManager.RunPreSendHooks(preSend); err != nil {
+			return nil, err
+		}
+		newContent = preSend.Content
+		annotations = preSend.Annotations
+	}
+
+	previousContent := message.Content
+	message.Content = newContent
+	updated, err := s.messageRepo.UpdateMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %v", err)
+	}
+	if !updated {
+		return nil, ErrMessageConflict
+	}
+
+	data := map[string]interface{}{
+		"message_id": message.ID,
+		"edited_at":  message.EditedAt,
+		"version":    message.Version,
+	}
+	for key, value := range annotations {
+		data[key] = value
+	}
+	s.broadcastToRoom(message.RoomID, &pkg.Message{
+		ID:        fmt.Sprintf("%d", message.ID),
+		Type:      "message_edited",
+		Content:   message.Content,
+		UserID:    message.UserID,
+		Username:  message.Username,
+		RoomID:    message.RoomID,
+		Timestamp: *message.EditedAt,
+		Data:      data,
+	})
+
+	s.notifyOfflineMembers(message, model.NotificationMessageEdited, userID, previousContent)
+
+	return message, nil
+}
+
+// DeleteMessage soft-deletes a message if the caller authored it or moderates its room. It fails
+// with ErrMessageConflict if the message is edited or deleted while the check is made.
+func (s *chatService) DeleteMessage(messageID, userID uint) error {
+	message, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil || message == nil {
+		return ErrMessageNotFound
+	}
+
+	if message.UserID != userID {
+		role, err := s.roomRepo.GetUserRole(message.RoomID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check room role: %v", err)
+		}
+		if role != "admin" && role != "moderator" {
+			return ErrCannotDelete
+		}
+	}
+
+	deleted, err := s.messageRepo.DeleteMessage(messageID, message.Version)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %v", err)
+	}
+	if !deleted {
+		return ErrMessageConflict
+	}
+
+	s.broadcastToRoom(message.RoomID, &pkg.Message{
+		ID:        fmt.Sprintf("%d", message.ID),
+		Type:      "message_deleted",
+		UserID:    userID,
+		RoomID:    message.RoomID,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"message_id": message.ID,
+		},
+	})
+
+	s.notifyOfflineMembers(message, model.NotificationMessageDeleted, userID, message.Content)
+
+	return nil
+}
+
+// PinMessage pins a message to the top of its room, or unpins it, on behalf of a room admin or
+// moderator. The room is told with a message_pinned or message_unpinned event; repeating a pin
+// or unpin changes nothing and broadcasts nothing.
+func (s *chatService) PinMessage(roomID string, messageID, actorID uint, pin bool) error {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return ErrRoomNotFound
+	}
+
+	actorRole, err := s.roomRepo.GetUserRole(roomID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to check room role: %v", err)
+	}
+	if actorRole != "admin" && actorRole != "moderator" {
+		return ErrNotRoomModerator
+	}
+
+	var changed bool
+	eventType := "message_unpinned"
+	if pin {
+		message, err := s.messageRepo.GetMessageByID(messageID)
+		if err != nil {
+			return fmt.Errorf("failed to get message: %w", err)
+		}
+		if message == nil || message.RoomID != roomID {
+			return ErrMessageNotFound
+		}
+
+		changed, err = s.messageRepo.PinMessage(&model.PinnedMessage{
+			MessageID: messageID,
+			RoomID:    roomID,
+			PinnedBy:  actorID,
+			PinnedAt:  time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to pin message: %v", err)
+		}
+		eventType = "message_pinned"
+	} else {
+		changed, err = s.messageRepo.UnpinMessage(roomID, messageID)
+		if err != nil {
+			return fmt.Errorf("failed to unpin message: %v", err)
+		}
+	}
+
+	if changed {
+		s.broadcastToRoom(roomID, &pkg.Message{
+			ID:        uuid.New().String(),
+			Type:      eventType,
+			UserID:    actorID,
+			RoomID:    roomID,
+			Timestamp: time.Now(),
+			Data: map[string]interface{}{
+				"message_id": messageID,
+			},
+		})
+	}
+	return nil
+}
+
+// GetPinnedMessages lists a room's pinned messages. Pins of private rooms are only visible to
+// their members.
+func (s *chatService) GetPinnedMessages(roomID string, userID uint) ([]model.PinnedMessage, error) {
+	room, err := s.roomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	if room.Type == "private" {
+		isMember, err := s.roomRepo.IsUserInRoom(roomID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check room membership: %v", err)
+		}
+		if !isMember {
+			return nil, ErrNotRoomMember
+		}
+	}
+
+	pins, err := s.messageRepo.GetPinnedMessages(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned messages: %v", err)
+	}
+	return pins, nil
+}
+
+// ReactToMessage adds or removes the user's reaction to a message and returns its updated counts.
+// Reactions are applied through the WebSocket manager so the room sees them live.
+func (s *chatService) ReactToMessage(messageID, userID uint, emoji string, add bool) ([]repository.ReactionCount, error) {
+	if s.clientManager == nil || s.clientManager.ReactionRepo == nil {
+		return nil, errors.New("reactions are not available")
+	}
+	return s.clientManager.React(userID, messageID, emoji, add)
+}
+
+// GetPrivateConversation returns the direct messages exchanged with another user, newest first
+func (s *chatService) GetPrivateConversation(userID uint, otherUsername string, limit, offset int) ([]model.PrivateMessage, error) {
+	other, err := s.userRepo.GetUserByUsername(otherUsername)
+	if err != nil || other == nil {
+		return nil, ErrUserNotFound
+	}
+
+	messages, err := s.privateMessageRepo.GetConversation(userID, other.ID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private messages: %v", err)
+	}
+
+	return messages, nil
+}
+
+// MarkConversationRead marks every unread message received from another user as read and sends
+// the other user a read receipt for each
+func (s *chatService) MarkConversationRead(userID uint, otherUsername string) (int64, error) {
+	other, err := s.userRepo.GetUserByUsername(otherUsername)
+	if err != nil || other == nil {
+		return 0, ErrUserNotFound
+	}
+
+	marked, readAt, err := s.privateMessageRepo.MarkConversationRead(userID, other.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark messages as read: %v", err)
+	}
+
+	if s.clientManager != nil && len(marked) > 0 {
+		reader, err := s.userRepo.GetUserByID(userID)
+		if err == nil && reader != nil {
+			for i := range marked {
+				marked[i].Sender = *other
+				s.clientManager.NotifyReadReceipt(&marked[i], reader.Username, readAt)
+			}
+		}
+	}
+
+	return int64(len(marked)), nil
+}
+
+// MarkPrivateMessageRead marks a single message addressed to the user as read and notifies the sender
+func (s *chatService) MarkPrivateMessageRead(messageID, userID uint) error {
+	pm, err := s.privateMessageRepo.GetPrivateMessageByID(messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get private message: %v", err)
+	}
+	if pm == nil {
+		return ErrMessageNotFound
+	}
+	if pm.RecipientID != userID {
+		return ErrNotRecipient
+	}
+
+	readAt, err := s.privateMessageRepo.MarkMessageRead(pm.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark message as read: %v", err)
+	}
+
+	if s.clientManager != nil {
+		reader, err := s.userRepo.GetUserByID(userID)
+		if err == nil && reader != nil {
+			s.clientManager.NotifyReadReceipt(pm, reader.Username, readAt)
+		}
+	}
+
+	return nil
+}
+
+// notifyOfflineMembers records a notification for offline members who could have seen a changed
+// message, when its room has opted in. Members who joined after the message, muted the room, or
+// made the change themselves are skipped; online members already received the live broadcast.
+func (s *chatService) notifyOfflineMembers(message *model.Message, notificationType string, actorID uint, previousContent string) {
+	if s.notificationRepo == nil {
+		return
+	}
+
+	room, err := s.roomRepo.GetRoomByID(message.RoomID)
+	if err != nil || room == nil || !room.NotifyOnChange {
+		return
+	}
+
+	members, err := s.roomRepo.GetRoomMembers(message.RoomID)
+	if err != nil {
+		Log.Error("Failed to load members of room %s for notifications: %v", message.RoomID, err)
+		return
+	}
+
+	var notifications []model.Notification
+	for _, member := range members {
+		if member.UserID == actorID || member.Muted || member.JoinedAt.After(message.CreatedAt) {
+			continue
+		}
+		if s.clientManager != nil && s.clientManager.IsUserOnline(member.User.Username) {
+			continue
+		}
+		notifications = append(notifications, model.Notification{
+			UserID:    member.UserID,
+			Type:      notificationType,
+			RoomID:    message.RoomID,
+			MessageID: &message.ID,
+			ActorID:   actorID,
+			Content:   previousContent,
+		})
+	}
+
+	if err := s.notificationRepo.CreateNotifications(notifications); err != nil {
+		Log.Error("Failed to store %s notifications for message %d: %v", notificationType, message.ID, err)
+	}
+}
+
+// broadcastToRoom pushes a frame to the live members of a room, if the WebSocket manager is wired in
+func (s *chatService) broadcastToRoom(roomID string, message *pkg.Message) {
+	if s.clientManager == nil {
+		return
+	}
+
+	s.clientManager.Publish(pkg.BroadcastMessage{
+		Message:     message,
+		RoomID:      roomID,
+		MessageType: "broadcast_room",
+	})
 }
 
 func (s *chatService) UpdateUserStatus(userID uint, status string) error {
-	// Validate status
-	validStatuses := map[string]bool{
-		"online":  true,
-		"offline": true,
-		"away":    true,
-		"busy":    true,
-	}
-	if !validStatuses[status] {
+	if !model.IsValidStatus(status) {
 		return errors.New("invalid status")
 	}
 
@@ -267,7 +1741,7 @@ func (s *chatService) GetUserByUsername(username string) (*model.User, error) {
 	}
 
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	return user, nil
@@ -0,0 +1,1662 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/pkg"
+	"live-chatter/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+// The fakes below embed the repository interfaces so each test only implements what it uses;
+// anything else panics on the nil interface.
+
+// fakeUserRepository hands out copies, like a database would, so callers clearing fields such as
+// the password do not change the stored account. Deactivated users are hidden from lookups.
+type fakeUserRepository struct {
+	repository.UserRepository
+	users []model.User
+}
+
+func (r *fakeUserRepository) GetUserByID(id uint) (*model.User, error) {
+	for i := range r.users {
+		if r.users[i].ID == id && !r.users[i].DeletedAt.Valid {
+			user := r.users[i]
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUserRepository) GetUserByUsername(username string) (*model.User, error) {
+	for i := range r.users {
+		if r.users[i].Username == username && !r.users[i].DeletedAt.Valid {
+			user := r.users[i]
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+type fakePrivateMessageRepository struct {
+	repository.PrivateMessageRepository
+	messages []model.PrivateMessage
+}
+
+func (r *fakePrivateMessageRepository) MarkConversationRead(recipientID, senderID uint) ([]model.PrivateMessage, time.Time, error) {
+	readAt := time.Now()
+	var marked []model.PrivateMessage
+	for i := range r.messages {
+		pm := &r.messages[i]
+		if pm.RecipientID == recipientID && pm.SenderID == senderID && !pm.Read {
+			pm.Read, pm.ReadAt = true, &readAt
+			marked = append(marked, model.PrivateMessage{ID: pm.ID})
+		}
+	}
+	return marked, readAt, nil
+}
+
+func (r *fakePrivateMessageRepository) GetPrivateMessageByID(messageID uint) (*model.PrivateMessage, error) {
+	for i := range r.messages {
+		if r.messages[i].ID == messageID {
+			pm := r.messages[i]
+			return &pm, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakePrivateMessageRepository) MarkMessageRead(messageID uint) (time.Time, error) {
+	readAt := time.Now()
+	for i := range r.messages {
+		if r.messages[i].ID == messageID {
+			r.messages[i].Read, r.messages[i].ReadAt = true, &readAt
+		}
+	}
+	return readAt, nil
+}
+
+// startClientManager runs a manager loop with the given users connected
+func startClientManager(t *testing.T, usernames ...string) (*pkg.ClientManager, map[string]*pkg.Client) {
+	t.Helper()
+	manager := &pkg.ClientManager{
+		Broadcast:   make(chan pkg.BroadcastMessage, 16),
+		Clients:     make(map[*pkg.Client]bool),
+		Rooms:       make(map[string]map[*pkg.Client]bool),
+		UserClients: make(map[string]*pkg.Client),
+	}
+	clients := make(map[string]*pkg.Client)
+	for _, username := range usernames {
+		client := pkg.NewClient(&model.User{Username: username}, nil, pkg.DefaultClientConfig())
+		manager.Clients[client] = true
+		manager.UserClients[username] = client
+		clients[username] = client
+	}
+	go manager.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		manager.Shutdown(ctx)
+	})
+	return manager, clients
+}
+
+// receiveFrames collects the frames queued for a client until none arrive for a short while
+func receiveFrames(client *pkg.Client) []pkg.Message {
+	var frames []pkg.Message
+	for {
+		select {
+		case data := <-client.Send:
+			var message pkg.Message
+			if json.Unmarshal(data, &message) == nil {
+				frames = append(frames, message)
+			}
+		case <-time.After(200 * time.Millisecond):
+			return frames
+		}
+	}
+}
+
+func TestMarkConversationReadSendsReceiptPerMessage(t *testing.T) {
+	manager, clients := startClientManager(t, "alice")
+	users := &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}}}
+	privateMessages := &fakePrivateMessageRepository{messages: []model.PrivateMessage{
+		{ID: 10, SenderID: 1, RecipientID: 2},
+		{ID: 11, SenderID: 1, RecipientID: 2},
+		{ID: 12, SenderID: 1, RecipientID: 2, Read: true},
+	}}
+	chat := NewChatService(nil, nil, users, privateMessages, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	updated, err := chat.MarkConversationRead(2, "alice")
+	if err != nil || updated != 2 {
+		t.Fatalf("MarkConversationRead = %d, %v; want 2, nil", updated, err)
+	}
+
+	receipts := make(map[float64]bool)
+	for _, frame := range receiveFrames(clients["alice"]) {
+		if frame.Type == "read_receipt" && frame.Username == "bob" {
+			receipts[frame.Data["message_id"].(float64)] = true
+		}
+	}
+	if len(receipts) != 2 || !receipts[10] || !receipts[11] {
+		t.Fatalf("read receipts for messages %v, want 10 and 11", receipts)
+	}
+}
+
+func TestMarkPrivateMessageReadRequiresTheRecipient(t *testing.T) {
+	manager, clients := startClientManager(t, "alice")
+	users := &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}}}
+	privateMessages := &fakePrivateMessageRepository{messages: []model.PrivateMessage{
+		{ID: 10, SenderID: 1, RecipientID: 2, Sender: model.User{Username: "alice"}},
+	}}
+	chat := NewChatService(nil, nil, users, privateMessages, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	if err := chat.MarkPrivateMessageRead(10, 3); err != ErrNotRecipient {
+		t.Fatalf("marking another user's message = %v, want ErrNotRecipient", err)
+	}
+	if err := chat.MarkPrivateMessageRead(11, 2); err != ErrMessageNotFound {
+		t.Fatalf("marking an unknown message = %v, want ErrMessageNotFound", err)
+	}
+	if privateMessages.messages[0].Read {
+		t.Fatal("a refused request marked the message read")
+	}
+
+	if err := chat.MarkPrivateMessageRead(10, 2); err != nil {
+		t.Fatalf("MarkPrivateMessageRead failed: %v", err)
+	}
+	if !privateMessages.messages[0].Read {
+		t.Fatal("the message was not marked read")
+	}
+	frames := receiveFrames(clients["alice"])
+	if len(frames) != 1 || frames[0].Type != "read_receipt" || frames[0].Username != "bob" || frames[0].Data["message_id"] != float64(10) {
+		t.Fatalf("sender got %+v, want one read receipt from bob", frames)
+	}
+}
+
+type fakeRoomRepository struct {
+	repository.RoomRepository
+	rooms   map[string]*model.Room
+	members map[string][]uint
+
+	mu    sync.Mutex // stands in for the transaction UpdateMemberRole runs in
+	roles map[string]map[uint]string
+
+	memberships map[string][]model.UserRoom
+	bans        []model.RoomBan
+	invites     []model.RoomInvite
+}
+
+func (r *fakeRoomRepository) GetRoomMembers(roomID string) ([]model.UserRoom, error) {
+	return r.memberships[roomID], nil
+}
+
+func (r *fakeRoomRepository) GetUserRole(roomID string, userID uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roles[roomID][userID], nil
+}
+
+func (r *fakeRoomRepository) UpdateMemberRole(roomID string, userID uint, role string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	admins := 0
+	for _, memberRole := range r.roles[roomID] {
+		if memberRole == "admin" {
+			admins++
+		}
+	}
+	if role != "admin" && r.roles[roomID][userID] == "admin" && admins == 1 {
+		return false, nil
+	}
+	r.roles[roomID][userID] = role
+	return true, nil
+}
+
+func (r *fakeRoomRepository) GetRoomByID(roomID string) (*model.Room, error) {
+	room, ok := r.rooms[roomID]
+	if !ok || room.DeletedAt.Valid {
+		return nil, nil
+	}
+	copied := *room
+	return &copied, nil
+}
+
+func (r *fakeRoomRepository) IsUserInRoom(roomID string, userID uint) (bool, error) {
+	for _, id := range r.members[roomID] {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRoomHistoryRequiresMembership(t *testing.T) {
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"private": {ID: "private", Type: "private"}},
+		members: map[string][]uint{"private": {1}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	if _, err := chat.GetRoomMessages("private", 2, 50, 0, nil); err != ErrNotRoomMember {
+		t.Fatalf("GetRoomMessages by non-member = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := chat.GetRoomMessagesByCursor("private", 2, 50, ""); err != ErrNotRoomMember {
+		t.Fatalf("GetRoomMessagesByCursor by non-member = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := chat.GetRoomMessagesByCursor("missing", 1, 50, ""); err != ErrRoomNotFound {
+		t.Fatalf("GetRoomMessagesByCursor for unknown room = %v, want ErrRoomNotFound", err)
+	}
+}
+
+func TestConcurrentDemotionsKeepAnAdmin(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		rooms := &fakeRoomRepository{
+			rooms: map[string]*model.Room{"lobby": {ID: "lobby"}},
+			roles: map[string]map[uint]string{"lobby": {1: "admin", 2: "admin"}},
+		}
+		chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+		// Each admin demotes the other at the same time
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for j, pair := range [][2]uint{{1, 2}, {2, 1}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = chat.ChangeMemberRole("lobby", pair[0], pair[1], "member")
+			}()
+		}
+		wg.Wait()
+
+		if (errs[0] == nil) == (errs[1] == nil) {
+			t.Fatalf("want exactly one demotion to succeed, got %v and %v", errs[0], errs[1])
+		}
+		if rooms.roles["lobby"][1] != "admin" && rooms.roles["lobby"][2] != "admin" {
+			t.Fatal("both admins were demoted")
+		}
+	}
+}
+
+func TestLastAdminCannotBeDemoted(t *testing.T) {
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{"lobby": {ID: "lobby"}},
+		roles: map[string]map[uint]string{"lobby": {1: "admin", 2: "member"}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	if err := chat.ChangeMemberRole("lobby", 1, 1, "member"); err != ErrLastRoomAdmin {
+		t.Fatalf("demoting the last admin = %v, want ErrLastRoomAdmin", err)
+	}
+}
+
+func TestOnlyAdminsChangeRoles(t *testing.T) {
+	manager, clients := startClientManager(t, "carol")
+	manager.AddClientToRoom(clients["carol"], "lobby")
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{"lobby": {ID: "lobby"}},
+		roles: map[string]map[uint]string{"lobby": {1: "admin", 2: "moderator", 3: "member"}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	if err := chat.ChangeMemberRole("lobby", 2, 3, "moderator"); err != ErrNotRoomAdmin {
+		t.Fatalf("promotion by a moderator = %v, want ErrNotRoomAdmin", err)
+	}
+	if err := chat.ChangeMemberRole("lobby", 1, 3, "owner"); err != ErrInvalidRole {
+		t.Fatalf("promotion to an unknown role = %v, want ErrInvalidRole", err)
+	}
+	if err := chat.ChangeMemberRole("lobby", 1, 4, "moderator"); err != ErrNotRoomMember {
+		t.Fatalf("promoting a non-member = %v, want ErrNotRoomMember", err)
+	}
+
+	if err := chat.ChangeMemberRole("lobby", 1, 3, "moderator"); err != nil {
+		t.Fatalf("promotion by the admin failed: %v", err)
+	}
+	if rooms.roles["lobby"][3] != "moderator" {
+		t.Fatalf("carol is %q, want moderator", rooms.roles["lobby"][3])
+	}
+	frames := receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "member_role_changed" || frames[0].Data["role"] != "moderator" {
+		t.Fatalf("room got %+v, want a member_role_changed event", frames)
+	}
+}
+
+// fakeMessageRepository stores messages with the version guard UpdateMessage applies in SQL. When
+// readers is set, GetMessageByID waits until that many callers have read, so concurrent edits all
+// start from the same version.
+type fakeMessageRepository struct {
+	repository.MessageRepository
+	mu       sync.Mutex
+	messages map[uint]model.Message
+	readers  *sync.WaitGroup
+	pins     map[uint]model.PinnedMessage
+}
+
+func (r *fakeMessageRepository) GetMessageByID(id uint) (*model.Message, error) {
+	r.mu.Lock()
+	message, ok := r.messages[id]
+	r.mu.Unlock()
+	if r.readers != nil {
+		r.readers.Done()
+		r.readers.Wait()
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &message, nil
+}
+
+func (r *fakeMessageRepository) UpdateMessage(message *model.Message) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.messages[message.ID].Version != message.Version {
+		return false, nil
+	}
+	now := time.Now()
+	message.Edited, message.EditedAt = true, &now
+	message.Version++
+	r.messages[message.ID] = *message
+	return true, nil
+}
+
+func (r *fakeMessageRepository) DeleteMessage(messageID, version uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if message, ok := r.messages[messageID]; !ok || message.Version != version {
+		return false, nil
+	}
+	delete(r.messages, messageID)
+	return true, nil
+}
+
+func TestConcurrentEditsConflict(t *testing.T) {
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	messages := &fakeMessageRepository{
+		messages: map[uint]model.Message{9: {ID: 9, RoomID: "lobby", UserID: 1, Content: "first", Version: 1}},
+		readers:  readers,
+	}
+	chat := NewChatService(messages, nil, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, content := range []string{"edit one", "edit two"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = chat.EditMessage(9, 1, content, 1)
+		}()
+	}
+	wg.Wait()
+
+	succeeded, conflicted := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrMessageConflict):
+			conflicted++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || conflicted != 1 {
+		t.Fatalf("%d edits succeeded and %d conflicted, want one of each", succeeded, conflicted)
+	}
+	if stored := messages.messages[9]; stored.Version != 2 {
+		t.Fatalf("stored version %d, want 2", stored.Version)
+	}
+}
+
+func TestEditWithStaleVersionConflicts(t *testing.T) {
+	messages := &fakeMessageRepository{
+		messages: map[uint]model.Message{9: {ID: 9, RoomID: "lobby", UserID: 1, Content: "first", Version: 3}},
+	}
+	chat := NewChatService(messages, nil, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	if _, err := chat.EditMessage(9, 1, "late edit", 2); !errors.Is(err, ErrMessageConflict) {
+		t.Fatalf("EditMessage with a stale version = %v, want ErrMessageConflict", err)
+	}
+}
+
+func TestDeleteMessageRequiresAuthorOrModerator(t *testing.T) {
+	newChat := func() (ChatService, *fakeMessageRepository) {
+		messages := &fakeMessageRepository{
+			messages: map[uint]model.Message{9: {ID: 9, RoomID: "lobby", UserID: 1, Content: "hello", Version: 1}},
+		}
+		rooms := &fakeRoomRepository{
+			rooms: map[string]*model.Room{"lobby": {ID: "lobby"}},
+			roles: map[string]map[uint]string{"lobby": {1: "member", 2: "member", 3: "moderator", 4: "admin"}},
+		}
+		return NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{}), messages
+	}
+
+	chat, messages := newChat()
+	if err := chat.DeleteMessage(9, 2); err != ErrCannotDelete {
+		t.Fatalf("deleting another member's message = %v, want ErrCannotDelete", err)
+	}
+	if _, ok := messages.messages[9]; !ok {
+		t.Fatal("a refused delete removed the message")
+	}
+	if err := chat.DeleteMessage(10, 1); err != ErrMessageNotFound {
+		t.Fatalf("deleting an unknown message = %v, want ErrMessageNotFound", err)
+	}
+
+	for _, userID := range []uint{1, 3, 4} {
+		chat, messages := newChat()
+		if err := chat.DeleteMessage(9, userID); err != nil {
+			t.Fatalf("delete by user %d failed: %v", userID, err)
+		}
+		if _, ok := messages.messages[9]; ok {
+			t.Fatalf("delete by user %d left the message in place", userID)
+		}
+	}
+}
+
+// GetMessagesByRoomID pages through the room's messages newest first; IDs stand in for creation order
+func (r *fakeMessageRepository) GetMessagesByRoomID(roomID string, limit, offset int, before *time.Time) ([]model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []model.Message
+	for _, message := range r.messages {
+		if message.RoomID == roomID {
+			messages = append(messages, message)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID > messages[j].ID })
+	if offset >= len(messages) {
+		return nil, nil
+	}
+	return messages[offset:min(offset+limit, len(messages))], nil
+}
+
+func (r *fakeMessageRepository) GetMessageCountByRoom(roomID string, before *time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for _, message := range r.messages {
+		if message.RoomID == roomID {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *fakeRoomRepository) TouchMembership(roomID string, userID uint) error { return nil }
+
+func TestRoomMessagesReportPaginationMetadata(t *testing.T) {
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{}}
+	for id := uint(1); id <= 5; id++ {
+		messages.messages[id] = model.Message{ID: id, RoomID: "lobby", CreatedAt: time.Unix(int64(id), 0)}
+	}
+	messages.messages[6] = model.Message{ID: 6, RoomID: "other"}
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"lobby": {ID: "lobby"}},
+		members: map[string][]uint{"lobby": {1}},
+	}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	first, err := chat.GetRoomMessages("lobby", 1, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("first page failed: %v", err)
+	}
+	if len(first.Messages) != 2 || first.Total != 5 || !first.HasMore || first.Limit != 2 || first.Offset != 0 {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+	if first.Messages[0].ID != 5 || first.NextCursor == "" {
+		t.Fatalf("first page should start at the newest message and carry a cursor: %+v", first)
+	}
+
+	last, err := chat.GetRoomMessages("lobby", 1, 2, 4, nil)
+	if err != nil {
+		t.Fatalf("last page failed: %v", err)
+	}
+	if len(last.Messages) != 1 || last.Total != 5 || last.HasMore || last.NextCursor != "" {
+		t.Fatalf("unexpected last page %+v", last)
+	}
+}
+
+// fakeNotificationRepository keeps the notifications the service stores
+type fakeNotificationRepository struct {
+	repository.NotificationRepository
+	mu            sync.Mutex
+	notifications []model.Notification
+}
+
+func (r *fakeNotificationRepository) CreateNotifications(notifications []model.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, notifications...)
+	return nil
+}
+
+func TestChangedMessagesNotifyOfflineMembers(t *testing.T) {
+	posted := time.Now().Add(-time.Hour)
+	for _, notifyOnChange := range []bool{true, false} {
+		manager, _ := startClientManager(t, "carol")
+		messages := &fakeMessageRepository{messages: map[uint]model.Message{
+			9: {ID: 9, RoomID: "lobby", UserID: 1, Username: "alice", Content: "first", Version: 1, CreatedAt: posted},
+		}}
+		member := func(id uint, username string, joined time.Time, muted bool) model.UserRoom {
+			return model.UserRoom{UserID: id, RoomID: "lobby", JoinedAt: joined, Muted: muted, User: model.User{ID: id, Username: username}}
+		}
+		rooms := &fakeRoomRepository{
+			rooms: map[string]*model.Room{"lobby": {ID: "lobby", NotifyOnChange: notifyOnChange}},
+			roles: map[string]map[uint]string{"lobby": {1: "member"}},
+			memberships: map[string][]model.UserRoom{"lobby": {
+				member(1, "alice", posted.Add(-time.Hour), false), // made the change
+				member(2, "bob", posted.Add(-time.Hour), false),   // offline and saw it
+				member(3, "carol", posted.Add(-time.Hour), false), // online, gets the live event
+				member(4, "dave", posted.Add(-time.Hour), true),   // muted the room
+				member(5, "erin", posted.Add(time.Minute), false), // joined after it was posted
+			}},
+		}
+		notifications := &fakeNotificationRepository{}
+		chat := NewChatService(messages, rooms, nil, nil, notifications, nil, nil, manager, config.RoomPolicyConfig{})
+
+		if _, err := chat.EditMessage(9, 1, "second", 1); err != nil {
+			t.Fatalf("edit failed: %v", err)
+		}
+		if err := chat.DeleteMessage(9, 1); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+
+		if !notifyOnChange {
+			if len(notifications.notifications) != 0 {
+				t.Fatalf("room without the opt-in stored %+v", notifications.notifications)
+			}
+			continue
+		}
+		if len(notifications.notifications) != 2 {
+			t.Fatalf("stored %+v, want an edit and a delete notification for bob", notifications.notifications)
+		}
+		edited, deleted := notifications.notifications[0], notifications.notifications[1]
+		if edited.UserID != 2 || edited.Type != model.NotificationMessageEdited || edited.Content != "first" || edited.ActorID != 1 {
+			t.Fatalf("unexpected edit notification %+v", edited)
+		}
+		if deleted.UserID != 2 || deleted.Type != model.NotificationMessageDeleted || *deleted.MessageID != 9 {
+			t.Fatalf("unexpected delete notification %+v", deleted)
+		}
+	}
+}
+
+// GetInactiveMembers applies the repository's selection to the fake's memberships
+func (r *fakeRoomRepository) GetInactiveMembers(cutoff time.Time) ([]model.UserRoom, error) {
+	var inactive []model.UserRoom
+	for roomID, members := range r.memberships {
+		room := r.rooms[roomID]
+		if room == nil || !room.AutoLeave {
+			continue
+		}
+		for _, member := range members {
+			lastActive := member.JoinedAt
+			if member.LastActiveAt != nil {
+				lastActive = *member.LastActiveAt
+			}
+			if member.LeftAt == nil && !member.Favorite && member.Role != "admin" && lastActive.Before(cutoff) {
+				member.Room = *room
+				inactive = append(inactive, member)
+			}
+		}
+	}
+	return inactive, nil
+}
+
+func (r *fakeRoomRepository) RemoveUserFromRoom(roomID string, userID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, member := range r.memberships[roomID] {
+		if member.UserID == userID && member.LeftAt == nil {
+			now := time.Now()
+			r.memberships[roomID][i].LeftAt = &now
+			delete(r.roles[roomID], userID)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// activeMembers lists the users still in a fake room
+func (r *fakeRoomRepository) activeMembers(roomID string) []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []uint
+	for _, member := range r.memberships[roomID] {
+		if member.LeftAt == nil {
+			ids = append(ids, member.UserID)
+		}
+	}
+	return ids
+}
+
+func TestInactiveMembersAutoLeave(t *testing.T) {
+	manager, clients := startClientManager(t, "carol")
+	manager.AddClientToRoom(clients["carol"], "lobby")
+
+	recently, longAgo := time.Now().Add(-10*time.Minute), time.Now().Add(-2*time.Hour)
+	member := func(id uint, username string, lastActive time.Time) model.UserRoom {
+		return model.UserRoom{UserID: id, RoomID: "lobby", Role: "member", JoinedAt: longAgo, LastActiveAt: &lastActive,
+			User: model.User{ID: id, Username: username}}
+	}
+	favorite := member(5, "erin", longAgo)
+	favorite.Favorite = true
+	admin := member(6, "frank", longAgo)
+	admin.Role = "admin"
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{"lobby": {ID: "lobby", Name: "Lobby", AutoLeave: true}},
+		memberships: map[string][]model.UserRoom{"lobby": {
+			member(2, "bob", longAgo),   // idle and offline
+			member(3, "carol", longAgo), // idle but connected
+			member(4, "dave", recently), // active
+			favorite,
+			admin,
+		}},
+	}
+	notifications := &fakeNotificationRepository{}
+	chat := NewChatService(nil, rooms, nil, nil, notifications, nil, nil, manager, config.RoomPolicyConfig{})
+
+	removed, err := chat.AutoLeaveInactiveMembers(time.Hour)
+	if err != nil || removed != 2 {
+		t.Fatalf("AutoLeaveInactiveMembers = %d, %v; want 2, nil", removed, err)
+	}
+	if remaining := rooms.activeMembers("lobby"); !slices.Equal(remaining, []uint{4, 5, 6}) {
+		t.Fatalf("members left in the room: %v, want dave, erin and frank", remaining)
+	}
+
+	// The offline member finds a notification; the connected one is told right away
+	if len(notifications.notifications) != 1 || notifications.notifications[0].UserID != 2 ||
+		notifications.notifications[0].Type != model.NotificationRoomAutoLeft {
+		t.Fatalf("stored %+v, want one auto-leave notification for bob", notifications.notifications)
+	}
+	frames := receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "room_removed" || frames[0].RoomID != "lobby" {
+		t.Fatalf("carol got %+v, want a room_removed frame", frames)
+	}
+	if users := manager.GetRoomUsers("lobby"); len(users) != 0 {
+		t.Fatalf("carol is still live in the room: %v", users)
+	}
+}
+
+func TestRoomMembersAreListedWithRoles(t *testing.T) {
+	joined := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	membership := func(id uint, username, role string) model.UserRoom {
+		return model.UserRoom{UserID: id, Role: role, JoinedAt: joined, User: model.User{ID: id, Username: username}}
+	}
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"team": {ID: "team", Type: "private"}},
+		members: map[string][]uint{"team": {1, 2, 3}},
+		memberships: map[string][]model.UserRoom{"team": {
+			membership(1, "alice", "admin"),
+			membership(2, "bob", "moderator"),
+			membership(3, "carol", "member"),
+		}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	members, err := chat.GetRoomMembers("team", 3)
+	if err != nil {
+		t.Fatalf("GetRoomMembers failed: %v", err)
+	}
+	want := []RoomMember{
+		{UserID: 1, Username: "alice", Role: "admin", JoinedAt: model.Timestamp(joined)},
+		{UserID: 2, Username: "bob", Role: "moderator", JoinedAt: model.Timestamp(joined)},
+		{UserID: 3, Username: "carol", Role: "member", JoinedAt: model.Timestamp(joined)},
+	}
+	if !slices.Equal(members, want) {
+		t.Fatalf("members = %+v, want %+v", members, want)
+	}
+
+	if _, err := chat.GetRoomMembers("team", 4); err != ErrNotRoomMember {
+		t.Fatalf("listing a private room as an outsider = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := chat.GetRoomMembers("missing", 1); err != ErrRoomNotFound {
+		t.Fatalf("listing an unknown room = %v, want ErrRoomNotFound", err)
+	}
+}
+
+func (r *fakeRoomRepository) BanUser(ban *model.RoomBan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bans = append(r.bans, *ban)
+	return nil
+}
+
+func TestKickRequiresAModeratorAndEvictsLiveTargets(t *testing.T) {
+	manager, clients := startClientManager(t, "bob", "carol")
+	manager.AddClientToRoom(clients["bob"], "lobby")
+	manager.AddClientToRoom(clients["carol"], "lobby")
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}, {ID: 3, Username: "carol"}, {ID: 4, Username: "dave"}, {ID: 5, Username: "erin"},
+	}}
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{"lobby": {ID: "lobby", Name: "Lobby"}},
+		roles: map[string]map[uint]string{"lobby": {1: "moderator", 2: "member", 3: "member", 4: "moderator", 5: "admin"}},
+		memberships: map[string][]model.UserRoom{"lobby": {
+			{UserID: 1, RoomID: "lobby"}, {UserID: 2, RoomID: "lobby"}, {UserID: 3, RoomID: "lobby"},
+			{UserID: 4, RoomID: "lobby"}, {UserID: 5, RoomID: "lobby"},
+		}},
+	}
+	chat := NewChatService(nil, rooms, users, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	refusals := []struct {
+		name            string
+		actorID, target uint
+		want            error
+	}{
+		{"member kicks member", 3, 2, ErrNotRoomModerator},
+		{"moderator kicks moderator", 1, 4, ErrCannotKick},
+		{"moderator kicks admin", 1, 5, ErrCannotKick},
+		{"moderator kicks self", 1, 1, ErrCannotKick},
+	}
+	for _, tt := range refusals {
+		if err := chat.KickUser("lobby", tt.actorID, tt.target, false); err != tt.want {
+			t.Fatalf("%s = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(rooms.activeMembers("lobby")) != 5 {
+		t.Fatal("a refused kick removed someone")
+	}
+
+	if err := chat.KickUser("lobby", 1, 2, false); err != nil {
+		t.Fatalf("kick failed: %v", err)
+	}
+	if slices.Contains(rooms.activeMembers("lobby"), 2) {
+		t.Fatal("bob is still a member")
+	}
+	if users := manager.GetRoomUsers("lobby"); !slices.Equal(users, []string{"carol"}) {
+		t.Fatalf("live room users %v, want only carol", users)
+	}
+	bobFrames := map[string]bool{}
+	for _, frame := range receiveFrames(clients["bob"]) {
+		bobFrames[frame.Type] = true
+	}
+	if !bobFrames["room_removed"] || !bobFrames["notification"] {
+		t.Fatalf("bob got %v, want room_removed and a notification", bobFrames)
+	}
+	carolFrames := receiveFrames(clients["carol"])
+	if len(carolFrames) != 1 || carolFrames[0].Type != "user_kicked" || carolFrames[0].Data["banned"] != false {
+		t.Fatalf("room got %+v, want a user_kicked event", carolFrames)
+	}
+
+	// Banning works on users who are no longer members
+	if err := chat.KickUser("lobby", 1, 2, true); err != nil {
+		t.Fatalf("ban failed: %v", err)
+	}
+	if len(rooms.bans) != 1 || rooms.bans[0].UserID != 2 || rooms.bans[0].BannedBy != 1 {
+		t.Fatalf("bans %+v, want bob banned by alice", rooms.bans)
+	}
+}
+
+func (r *fakeRoomRepository) IsUserBanned(roomID string, userID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ban := range r.bans {
+		if ban.RoomID == roomID && ban.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeRoomRepository) CreateInvite(invite *model.RoomInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invites = append(r.invites, *invite)
+	return nil
+}
+
+func (r *fakeRoomRepository) HasInvite(roomID string, userID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, invite := range r.invites {
+		if invite.RoomID == roomID && invite.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeRoomRepository) DeleteInvite(roomID string, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invites = slices.DeleteFunc(r.invites, func(invite model.RoomInvite) bool {
+		return invite.RoomID == roomID && invite.UserID == userID
+	})
+	return nil
+}
+
+// AddUserToRoom records the membership; it reports false when the user was already a member
+func (r *fakeRoomRepository) AddUserToRoom(roomID string, userID uint, role string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.members[roomID], userID) {
+		return false, nil
+	}
+	if r.members == nil {
+		r.members = make(map[string][]uint)
+	}
+	r.members[roomID] = append(r.members[roomID], userID)
+	return true, nil
+}
+
+func TestPrivateRoomsRequireAnInvite(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}}}
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{
+			"lobby": {ID: "lobby", Type: "public"},
+			"team":  {ID: "team", Type: "private"},
+		},
+		members: map[string][]uint{"team": {1}},
+		roles:   map[string]map[uint]string{"team": {1: "admin"}},
+	}
+	chat := NewChatService(nil, rooms, users, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	if err := chat.JoinRoom("lobby", 2, ""); err != nil {
+		t.Fatalf("joining a public room failed: %v", err)
+	}
+	if err := chat.JoinRoom("team", 2, ""); err != ErrInviteRequired {
+		t.Fatalf("joining a private room uninvited = %v, want ErrInviteRequired", err)
+	}
+	if slices.Contains(rooms.members["team"], 2) {
+		t.Fatal("an uninvited user was added to the private room")
+	}
+
+	if err := chat.InviteUser("team", 1, "bob"); err != nil {
+		t.Fatalf("invite failed: %v", err)
+	}
+	if err := chat.JoinRoom("team", 2, ""); err != nil {
+		t.Fatalf("joining with an invite failed: %v", err)
+	}
+	if !slices.Contains(rooms.members["team"], 2) || len(rooms.invites) != 0 {
+		t.Fatalf("members %v, invites %+v; want bob joined and the invite used up", rooms.members["team"], rooms.invites)
+	}
+}
+
+// fakeInviteTokenRepository applies the repository's expiry and use-count guard in memory
+type fakeInviteTokenRepository struct {
+	repository.InviteTokenRepository
+	mu     sync.Mutex
+	tokens map[string]*model.InviteToken
+}
+
+func (r *fakeInviteTokenRepository) CreateToken(token *model.InviteToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = make(map[string]*model.InviteToken)
+	}
+	stored := *token
+	r.tokens[token.Token] = &stored
+	return nil
+}
+
+func (r *fakeInviteTokenRepository) GetToken(token string) (*model.InviteToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.tokens[token]; ok {
+		found := *stored
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeInviteTokenRepository) RedeemToken(token string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.tokens[token]
+	if !ok || !stored.ExpiresAt.After(time.Now()) || (stored.MaxUses > 0 && stored.Uses >= stored.MaxUses) {
+		return false, nil
+	}
+	stored.Uses++
+	return true, nil
+}
+
+func TestInviteTokens(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}, {ID: 3, Username: "carol"}}}
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"team": {ID: "team", Type: "private"}},
+		members: map[string][]uint{"team": {1}},
+		roles:   map[string]map[uint]string{"team": {1: "admin"}},
+	}
+	tokens := &fakeInviteTokenRepository{}
+	chat := NewChatService(nil, rooms, users, nil, nil, nil, tokens, nil, config.RoomPolicyConfig{})
+
+	if _, err := chat.CreateInviteToken("team", 2, 0, 0); err != ErrNotRoomAdmin {
+		t.Fatalf("invite by a non-admin = %v, want ErrNotRoomAdmin", err)
+	}
+
+	single, err := chat.CreateInviteToken("team", 1, time.Hour, 1)
+	if err != nil {
+		t.Fatalf("creating an invite failed: %v", err)
+	}
+	if room, err := chat.AcceptInviteToken(single.Token, 2, ""); err != nil || room.ID != "team" {
+		t.Fatalf("redeeming the invite = %v, %v", room, err)
+	}
+	if !slices.Contains(rooms.members["team"], 2) {
+		t.Fatal("bob did not join the room")
+	}
+	// Members get the room back without spending a use
+	if _, err := chat.AcceptInviteToken(single.Token, 2, ""); err != nil {
+		t.Fatalf("member reusing the invite = %v", err)
+	}
+	if _, err := chat.AcceptInviteToken(single.Token, 3, ""); err != ErrInviteExhausted {
+		t.Fatalf("redeeming a used-up invite = %v, want ErrInviteExhausted", err)
+	}
+
+	expired := &model.InviteToken{Token: "expired", RoomID: "team", CreatedBy: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+	_ = tokens.CreateToken(expired)
+	if _, err := chat.AcceptInviteToken("expired", 3, ""); err != ErrInviteExpired {
+		t.Fatalf("redeeming an expired invite = %v, want ErrInviteExpired", err)
+	}
+	if _, err := chat.AcceptInviteToken("unknown", 3, ""); err != ErrInviteNotFound {
+		t.Fatalf("redeeming an unknown invite = %v, want ErrInviteNotFound", err)
+	}
+	if slices.Contains(rooms.members["team"], 3) {
+		t.Fatal("carol joined without a valid invite")
+	}
+}
+
+// DeleteRoom soft-deletes the room and ends its memberships, as the repository does
+func (r *fakeRoomRepository) DeleteRoom(roomID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if room, ok := r.rooms[roomID]; ok {
+		room.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	}
+	delete(r.members, roomID)
+	return nil
+}
+
+func TestRoomDeletionRequiresCreatorOrAdmin(t *testing.T) {
+	manager, clients := startClientManager(t, "carol")
+	manager.AddClientToRoom(clients["carol"], "lobby")
+	newRooms := func() *fakeRoomRepository {
+		return &fakeRoomRepository{
+			rooms:   map[string]*model.Room{"lobby": {ID: "lobby", Name: "Lobby", CreatedBy: 1}},
+			members: map[string][]uint{"lobby": {1, 2, 3}},
+			roles:   map[string]map[uint]string{"lobby": {1: "member", 2: "admin", 3: "moderator"}},
+		}
+	}
+
+	rooms := newRooms()
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+	if err := chat.DeleteRoom("lobby", 3); err != ErrNotRoomAdmin {
+		t.Fatalf("deletion by a moderator = %v, want ErrNotRoomAdmin", err)
+	}
+	if rooms.rooms["lobby"].DeletedAt.Valid {
+		t.Fatal("a refused deletion removed the room")
+	}
+
+	// The creator may delete the room even after giving up the admin role
+	if err := chat.DeleteRoom("lobby", 1); err != nil {
+		t.Fatalf("deletion by the creator failed: %v", err)
+	}
+	if !rooms.rooms["lobby"].DeletedAt.Valid {
+		t.Fatal("the room was not deleted")
+	}
+	frames := receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "room_deleted" || frames[0].Data["room_name"] != "Lobby" {
+		t.Fatalf("live member got %+v, want a room_deleted frame", frames)
+	}
+	if users := manager.GetRoomUsers("lobby"); len(users) != 0 {
+		t.Fatalf("live members left in the deleted room: %v", users)
+	}
+
+	chat = NewChatService(nil, newRooms(), nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+	if err := chat.DeleteRoom("lobby", 2); err != nil {
+		t.Fatalf("deletion by an admin failed: %v", err)
+	}
+}
+
+// GetRoomByName ignores deleted rooms, as the repository does
+func (r *fakeRoomRepository) GetRoomByName(name string) (*model.Room, error) {
+	for _, room := range r.rooms {
+		if room.Name == name && !room.DeletedAt.Valid {
+			copied := *room
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRoomRepository) CountActiveMembers(roomID string) (int64, error) {
+	return int64(len(r.members[roomID])), nil
+}
+
+func (r *fakeRoomRepository) UpdateRoom(room *model.Room) error {
+	saved := *room
+	r.rooms[room.ID] = &saved
+	return nil
+}
+
+func TestRoomUpdatesAreCheckedAndBroadcast(t *testing.T) {
+	manager, clients := startClientManager(t, "carol")
+	manager.AddClientToRoom(clients["carol"], "lobby")
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{
+			"lobby":  {ID: "lobby", Name: "Lobby", Type: "public"},
+			"random": {ID: "random", Name: "Random", Type: "public"},
+		},
+		members: map[string][]uint{"lobby": {1, 2, 3}},
+		roles:   map[string]map[uint]string{"lobby": {1: "admin", 2: "moderator", 3: "member"}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+	name := func(value string) *string { return &value }
+
+	if _, err := chat.UpdateRoom("lobby", 2, RoomUpdate{Name: name("Hall")}); err != ErrNotRoomAdmin {
+		t.Fatalf("update by a moderator = %v, want ErrNotRoomAdmin", err)
+	}
+	if _, err := chat.UpdateRoom("lobby", 1, RoomUpdate{Name: name("  Random ")}); err != ErrRoomNameTaken {
+		t.Fatalf("renaming onto another room = %v, want ErrRoomNameTaken", err)
+	}
+	if _, err := chat.UpdateRoom("lobby", 1, RoomUpdate{Name: name("no<tags>")}); !errors.Is(err, ErrInvalidRoomName) {
+		t.Fatalf("renaming to an invalid name = %v, want ErrInvalidRoomName", err)
+	}
+	if rooms.rooms["lobby"].Name != "Lobby" {
+		t.Fatalf("a refused update renamed the room to %q", rooms.rooms["lobby"].Name)
+	}
+	if frames := receiveFrames(clients["carol"]); len(frames) != 0 {
+		t.Fatalf("refused updates were broadcast: %+v", frames)
+	}
+
+	result, err := chat.UpdateRoom("lobby", 1, RoomUpdate{Name: name("Hall"), Type: name("private")})
+	if err != nil {
+		t.Fatalf("UpdateRoom failed: %v", err)
+	}
+	if saved := rooms.rooms["lobby"]; saved.Name != "Hall" || saved.Type != "private" {
+		t.Fatalf("saved room = %+v, want a private room named Hall", saved)
+	}
+	if len(result.Warnings) != 1 {
+		t.Fatalf("warnings = %v, want one about the existing members", result.Warnings)
+	}
+	frames := receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "room_updated" || frames[0].Data["name"] != "Hall" || frames[0].Data["type"] != "private" {
+		t.Fatalf("member got %+v, want one room_updated frame", frames)
+	}
+
+	// Keeping the room's own name is not a collision
+	if _, err := chat.UpdateRoom("lobby", 1, RoomUpdate{Name: name("Hall")}); err != nil {
+		t.Fatalf("re-saving the same name failed: %v", err)
+	}
+}
+
+func TestGetMessageRequiresRoomMembership(t *testing.T) {
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{
+		9: {ID: 9, RoomID: "lobby", UserID: 1, Content: "hello"},
+	}}
+	rooms := &fakeRoomRepository{members: map[string][]uint{"lobby": {1, 2}}}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	message, err := chat.GetMessage(9, 2)
+	if err != nil || message == nil || message.Content != "hello" {
+		t.Fatalf("GetMessage by a member = %+v, %v, want the message", message, err)
+	}
+	if _, err := chat.GetMessage(10, 2); err != ErrMessageNotFound {
+		t.Fatalf("GetMessage of an unknown message = %v, want ErrMessageNotFound", err)
+	}
+	if _, err := chat.GetMessage(9, 3); err != ErrNotRoomMember {
+		t.Fatalf("GetMessage by an outsider = %v, want ErrNotRoomMember", err)
+	}
+}
+
+// GetReplies returns the stored replies to parentID, oldest first
+func (r *fakeMessageRepository) GetReplies(parentID uint, limit, offset int) ([]model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var replies []model.Message
+	for _, message := range r.messages {
+		if message.ParentID != nil && *message.ParentID == parentID {
+			replies = append(replies, message)
+		}
+	}
+	sort.Slice(replies, func(i, j int) bool { return replies[i].ID < replies[j].ID })
+	if offset >= len(replies) {
+		return nil, nil
+	}
+	return replies[offset:min(offset+limit, len(replies))], nil
+}
+
+func TestRepliesRequireRoomMembership(t *testing.T) {
+	parentID := uint(9)
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{
+		9:  {ID: 9, RoomID: "staff", UserID: 1, Content: "thread"},
+		10: {ID: 10, RoomID: "staff", UserID: 1, Content: "reply", ParentID: &parentID},
+	}}
+	rooms := &fakeRoomRepository{members: map[string][]uint{"staff": {1, 2}}}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	replies, err := chat.GetMessageReplies(9, 2, 50, 0)
+	if err != nil || len(replies) != 1 || replies[0].ID != 10 {
+		t.Fatalf("GetMessageReplies by a member = %+v, %v, want the reply", replies, err)
+	}
+	if _, err := chat.GetMessageReplies(9, 3, 50, 0); err != ErrNotRoomMember {
+		t.Fatalf("GetMessageReplies by an outsider = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := chat.GetMessageReplies(11, 2, 50, 0); err != ErrMessageNotFound {
+		t.Fatalf("GetMessageReplies of an unknown message = %v, want ErrMessageNotFound", err)
+	}
+}
+
+// GetMessagesByIDs returns the stored messages among ids in no particular order, as SQL IN does
+func (r *fakeMessageRepository) GetMessagesByIDs(ids []uint) ([]model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []model.Message
+	for id, message := range r.messages {
+		if slices.Contains(ids, id) {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func TestMessageBatchKeepsRequestOrder(t *testing.T) {
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{}}
+	for id := uint(1); id <= 6; id++ {
+		messages.messages[id] = model.Message{ID: id, RoomID: "lobby"}
+	}
+	messages.messages[7] = model.Message{ID: 7, RoomID: "staff"}
+	rooms := &fakeRoomRepository{members: map[string][]uint{"lobby": {1}, "staff": {2}}}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	batch, err := chat.GetMessagesByIDs([]uint{5, 2, 99, 7, 6, 2, 1}, 1)
+	if err != nil {
+		t.Fatalf("GetMessagesByIDs failed: %v", err)
+	}
+	var got []uint
+	for _, message := range batch {
+		got = append(got, message.ID)
+	}
+	if want := []uint{5, 2, 6, 1}; !slices.Equal(got, want) {
+		t.Fatalf("batch = %v, want %v without unknown, foreign or repeated IDs", got, want)
+	}
+
+	ids := make([]uint, MaxBatchMessages+1)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	if _, err := chat.GetMessagesByIDs(ids, 1); err != ErrTooManyMessages {
+		t.Fatalf("oversized batch = %v, want ErrTooManyMessages", err)
+	}
+	if batch, err := chat.GetMessagesByIDs(ids[:MaxBatchMessages], 1); err != nil || len(batch) != 6 {
+		t.Fatalf("batch at the cap = %d messages, %v, want all 6", len(batch), err)
+	}
+}
+
+// GetMessagesByRoomCursor mirrors the (created_at, id) keyset comparison done in SQL
+func (r *fakeMessageRepository) GetMessagesByRoomCursor(roomID string, limit int, cursor *repository.MessageCursor) ([]model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []model.Message
+	for _, message := range r.messages {
+		if message.RoomID != roomID {
+			continue
+		}
+		if cursor != nil && !message.CreatedAt.Before(cursor.CreatedAt) &&
+			!(message.CreatedAt.Equal(cursor.CreatedAt) && message.ID < cursor.ID) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].CreatedAt.After(messages[j].CreatedAt)
+		}
+		return messages[i].ID > messages[j].ID
+	})
+	return messages[:min(limit, len(messages))], nil
+}
+
+func TestCursorPagesStayStableWhileMessagesArrive(t *testing.T) {
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{}}
+	post := func(id uint, at int64) {
+		messages.mu.Lock()
+		messages.messages[id] = model.Message{ID: id, RoomID: "lobby", CreatedAt: time.Unix(at, 0)}
+		messages.mu.Unlock()
+	}
+	// Messages 3 and 4 share a timestamp, so the ID has to break the tie
+	for id, at := range map[uint]int64{1: 10, 2: 20, 3: 30, 4: 30, 5: 40, 6: 50, 7: 60} {
+		post(id, at)
+	}
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"lobby": {ID: "lobby"}},
+		members: map[string][]uint{"lobby": {1}},
+	}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	var seen []uint
+	cursor := ""
+	for page := 0; ; page++ {
+		result, err := chat.GetRoomMessagesByCursor("lobby", 1, 2, cursor)
+		if err != nil {
+			t.Fatalf("page %d failed: %v", page, err)
+		}
+		for _, message := range result.Messages {
+			seen = append(seen, message.ID)
+		}
+		if !result.HasMore {
+			if result.NextCursor != "" {
+				t.Fatalf("the last page carries a cursor: %+v", result)
+			}
+			break
+		}
+		cursor = result.NextCursor
+		// New messages between fetches would shift every offset-based page
+		post(uint(100+page), int64(100+page))
+	}
+
+	if want := []uint{7, 6, 5, 4, 3, 2, 1}; !slices.Equal(seen, want) {
+		t.Fatalf("paged through %v, want %v with nothing skipped or repeated", seen, want)
+	}
+
+	if _, err := chat.GetRoomMessagesByCursor("lobby", 1, 2, "not-a-cursor"); err != ErrInvalidCursor {
+		t.Fatalf("garbage cursor = %v, want ErrInvalidCursor", err)
+	}
+	if _, err := chat.GetRoomMessagesByCursor("lobby", 2, 2, ""); err != ErrNotRoomMember {
+		t.Fatalf("outsider paging = %v, want ErrNotRoomMember", err)
+	}
+}
+
+func (r *fakeUserRepository) GetOnlineUsers() ([]model.User, error) {
+	var users []model.User
+	for _, user := range r.users {
+		if user.Status == "online" && !user.DeletedAt.Valid {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepository) GetUsersByUsernames(usernames []string) ([]model.User, error) {
+	var users []model.User
+	for _, user := range r.users {
+		if slices.Contains(usernames, user.Username) && !user.DeletedAt.Valid {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func TestOnlineUsersBySource(t *testing.T) {
+	// bob's socket dropped without the stored status catching up; carol just connected
+	manager, _ := startClientManager(t, "alice", "carol")
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice", Status: "online"},
+		{ID: 2, Username: "bob", Status: "online"},
+		{ID: 3, Username: "carol", Status: "offline"},
+		{ID: 4, Username: "dave", Status: "offline"},
+	}}
+	chat := NewChatService(nil, nil, users, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	for source, want := range map[string][]string{
+		"":                   {"alice", "bob"},
+		PresenceSourceDB:     {"alice", "bob"},
+		PresenceSourceLive:   {"alice", "carol"},
+		PresenceSourceMerged: {"alice", "bob", "carol"},
+	} {
+		online, err := chat.GetOnlineUsers(source)
+		if err != nil {
+			t.Fatalf("source %q failed: %v", source, err)
+		}
+		var got []string
+		for _, user := range online {
+			got = append(got, user.Username)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("source %q listed %v, want %v", source, got, want)
+		}
+	}
+
+	if _, err := chat.GetOnlineUsers("rumour"); err != ErrInvalidPresenceSource {
+		t.Fatalf("unknown source = %v, want ErrInvalidPresenceSource", err)
+	}
+}
+
+func (r *fakeRoomRepository) GetAllRooms() ([]model.Room, error) {
+	var rooms []model.Room
+	for _, room := range r.rooms {
+		if !room.DeletedAt.Valid {
+			rooms = append(rooms, *room)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms, nil
+}
+
+func TestRoomListingCountsConnectedMembers(t *testing.T) {
+	manager, clients := startClientManager(t, "alice", "bob", "carol")
+	manager.AddClientToRoom(clients["alice"], "lobby")
+	manager.AddClientToRoom(clients["bob"], "lobby")
+	manager.AddClientToRoom(clients["carol"], "random")
+	rooms := &fakeRoomRepository{rooms: map[string]*model.Room{
+		"empty":  {ID: "empty", Name: "Empty"},
+		"lobby":  {ID: "lobby", Name: "Lobby"},
+		"random": {ID: "random", Name: "Random"},
+	}}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	infos, err := chat.ListRooms()
+	if err != nil {
+		t.Fatalf("ListRooms failed: %v", err)
+	}
+	counts := map[string]int{}
+	for _, info := range infos {
+		counts[info.Name] = info.UserCount
+	}
+	if want := map[string]int{"Empty": 0, "Lobby": 2, "Random": 1}; !maps.Equal(counts, want) {
+		t.Fatalf("user counts %v, want %v", counts, want)
+	}
+}
+
+// PinMessage reports false for a message that is already pinned, as the upsert in SQL does
+func (r *fakeMessageRepository) PinMessage(pin *model.PinnedMessage) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pins[pin.MessageID]; ok {
+		return false, nil
+	}
+	if r.pins == nil {
+		r.pins = make(map[uint]model.PinnedMessage)
+	}
+	r.pins[pin.MessageID] = *pin
+	return true, nil
+}
+
+func (r *fakeMessageRepository) UnpinMessage(roomID string, messageID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pin, ok := r.pins[messageID]; !ok || pin.RoomID != roomID {
+		return false, nil
+	}
+	delete(r.pins, messageID)
+	return true, nil
+}
+
+func (r *fakeMessageRepository) GetPinnedMessages(roomID string) ([]model.PinnedMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pins []model.PinnedMessage
+	for _, pin := range r.pins {
+		if pin.RoomID == roomID {
+			pins = append(pins, pin)
+		}
+	}
+	return pins, nil
+}
+
+func TestOnlyModeratorsPinMessages(t *testing.T) {
+	manager, clients := startClientManager(t, "carol")
+	manager.AddClientToRoom(clients["carol"], "staff")
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{
+		9:  {ID: 9, RoomID: "staff", Content: "read the rules"},
+		10: {ID: 10, RoomID: "lobby", Content: "elsewhere"},
+	}}
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{"staff": {ID: "staff", Type: "private"}},
+		members: map[string][]uint{"staff": {1, 2, 3}},
+		roles:   map[string]map[uint]string{"staff": {1: "admin", 2: "moderator", 3: "member"}},
+	}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, manager, config.RoomPolicyConfig{})
+
+	if err := chat.PinMessage("staff", 9, 3, true); err != ErrNotRoomModerator {
+		t.Fatalf("pin by a member = %v, want ErrNotRoomModerator", err)
+	}
+	if err := chat.PinMessage("staff", 10, 2, true); err != ErrMessageNotFound {
+		t.Fatalf("pinning another room's message = %v, want ErrMessageNotFound", err)
+	}
+	if len(messages.pins) != 0 {
+		t.Fatalf("refused pins were stored: %v", messages.pins)
+	}
+
+	if err := chat.PinMessage("staff", 9, 2, true); err != nil {
+		t.Fatalf("pin by a moderator failed: %v", err)
+	}
+	// Pinning again changes nothing and is not announced twice
+	if err := chat.PinMessage("staff", 9, 1, true); err != nil {
+		t.Fatalf("repeated pin failed: %v", err)
+	}
+	frames := receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "message_pinned" || frames[0].Data["message_id"] != float64(9) {
+		t.Fatalf("member got %+v, want one message_pinned frame", frames)
+	}
+
+	if pins, err := chat.GetPinnedMessages("staff", 3); err != nil || len(pins) != 1 || pins[0].PinnedBy != 2 {
+		t.Fatalf("pins listed to a member = %+v, %v", pins, err)
+	}
+	if _, err := chat.GetPinnedMessages("staff", 4); err != ErrNotRoomMember {
+		t.Fatalf("pins of a private room listed to an outsider = %v, want ErrNotRoomMember", err)
+	}
+
+	if err := chat.PinMessage("staff", 9, 3, false); err != ErrNotRoomModerator {
+		t.Fatalf("unpin by a member = %v, want ErrNotRoomModerator", err)
+	}
+	if err := chat.PinMessage("staff", 9, 1, false); err != nil {
+		t.Fatalf("unpin by an admin failed: %v", err)
+	}
+	frames = receiveFrames(clients["carol"])
+	if len(frames) != 1 || frames[0].Type != "message_unpinned" {
+		t.Fatalf("member got %+v, want one message_unpinned frame", frames)
+	}
+}
+
+// CreateRoomWithCreator stores the room and makes its creator an admin member
+func (r *fakeRoomRepository) CreateRoomWithCreator(room *model.Room, creatorID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := *room
+	r.rooms[room.ID] = &saved
+	r.members[room.ID] = append(r.members[room.ID], creatorID)
+	return nil
+}
+
+func (r *fakeRoomRepository) CountUserRooms(userID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, members := range r.members {
+		if slices.Contains(members, userID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeRoomRepository) CountRoomsCreatedBy(userID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, room := range r.rooms {
+		if room.CreatedBy == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestRoomCapsApplyToJoiningAndCreating(t *testing.T) {
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{
+			"r1": {ID: "r1", Name: "One", Type: "public"},
+			"r2": {ID: "r2", Name: "Two", Type: "public"},
+		},
+		members: map[string][]uint{"r1": {2}, "r2": {2}},
+	}
+	users := &fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}}}
+	chat := NewChatService(nil, rooms, users, nil, nil, nil, nil, nil,
+		config.RoomPolicyConfig{MaxRoomsJoined: 2, MaxRoomsCreated: 1})
+
+	if _, err := chat.CreateRoom(&model.Room{Name: "Alpha", CreatedBy: 1}); err != nil {
+		t.Fatalf("first room failed: %v", err)
+	}
+	if _, err := chat.CreateRoom(&model.Room{Name: "Beta", CreatedBy: 1}); !errors.Is(err, ErrTooManyRoomsCreated) {
+		t.Fatalf("room over the creation cap = %v, want ErrTooManyRoomsCreated", err)
+	}
+
+	if err := chat.JoinRoom("r1", 1, ""); err != nil {
+		t.Fatalf("join within the cap failed: %v", err)
+	}
+	if err := chat.JoinRoom("r2", 1, ""); !errors.Is(err, ErrTooManyRoomsJoined) {
+		t.Fatalf("join over the cap = %v, want ErrTooManyRoomsJoined", err)
+	}
+	// Joining a room again adds no membership, so the cap does not apply
+	if err := chat.JoinRoom("r1", 1, ""); err != nil {
+		t.Fatalf("re-joining at the cap failed: %v", err)
+	}
+
+	// Creating a room also joins it, so a user at the join cap cannot create one either
+	if _, err := chat.CreateRoom(&model.Room{Name: "Gamma", CreatedBy: 2}); !errors.Is(err, ErrTooManyRoomsJoined) {
+		t.Fatalf("room by a user at the join cap = %v, want ErrTooManyRoomsJoined", err)
+	}
+	if len(rooms.rooms) != 3 {
+		t.Fatalf("%d rooms stored, want only Alpha added", len(rooms.rooms))
+	}
+}
+
+// DeleteMessagesOlderThan removes the room's messages created before the cutoff, hard or not
+func (r *fakeMessageRepository) DeleteMessagesOlderThan(roomID string, cutoff time.Time, hard bool) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, message := range r.messages {
+		if message.RoomID == roomID && message.CreatedAt.Before(cutoff) {
+			delete(r.messages, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestRetentionPurgesOnlyExpiredMessages(t *testing.T) {
+	now := time.Now()
+	messages := &fakeMessageRepository{messages: map[uint]model.Message{
+		1: {ID: 1, RoomID: "lobby", CreatedAt: now.Add(-2 * time.Hour)},
+		2: {ID: 2, RoomID: "lobby", CreatedAt: now.Add(-90 * time.Minute)},
+		3: {ID: 3, RoomID: "lobby", CreatedAt: now.Add(-time.Minute)},
+		4: {ID: 4, RoomID: "staff", CreatedAt: now.Add(-48 * time.Hour)},
+	}}
+	rooms := &fakeRoomRepository{rooms: map[string]*model.Room{
+		"lobby": {ID: "lobby", Type: "public"},
+		"staff": {ID: "staff", Type: "private"},
+	}}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	// Private rooms are given no period, so they keep everything
+	purged, err := chat.PurgeExpiredMessages(map[string]time.Duration{"public": time.Hour, "private": 0}, false)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if purged != 2 {
+		t.Fatalf("purged %d messages, want 2", purged)
+	}
+	var remaining []uint
+	for id := range messages.messages {
+		remaining = append(remaining, id)
+	}
+	slices.Sort(remaining)
+	if !slices.Equal(remaining, []uint{3, 4}) {
+		t.Fatalf("messages %v remain, want the recent public one and the private one", remaining)
+	}
+
+	if purged, err := chat.PurgeExpiredMessages(map[string]time.Duration{"public": time.Hour}, false); err != nil || purged != 0 {
+		t.Fatalf("second purge removed %d, %v; want nothing left to purge", purged, err)
+	}
+}
+
+func TestDeletedRoomNamesCanBeReused(t *testing.T) {
+	rooms := &fakeRoomRepository{
+		rooms:   map[string]*model.Room{},
+		members: map[string][]uint{},
+		roles:   map[string]map[uint]string{},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	first, err := chat.CreateRoom(&model.Room{Name: "Lobby", CreatedBy: 1})
+	if err != nil {
+		t.Fatalf("CreateRoom failed: %v", err)
+	}
+	if _, err := chat.CreateRoom(&model.Room{Name: "Lobby", CreatedBy: 2}); err != ErrRoomNameTaken {
+		t.Fatalf("duplicate of a live room = %v, want ErrRoomNameTaken", err)
+	}
+
+	if err := chat.DeleteRoom(first.ID, 1); err != nil {
+		t.Fatalf("DeleteRoom failed: %v", err)
+	}
+	second, err := chat.CreateRoom(&model.Room{Name: "Lobby", CreatedBy: 2})
+	if err != nil {
+		t.Fatalf("recreating a deleted room's name failed: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Fatal("the recreated room reused the deleted room's ID")
+	}
+	if found, _ := rooms.GetRoomByName("Lobby"); found == nil || found.ID != second.ID {
+		t.Fatalf("the name resolves to %+v, want the new room", found)
+	}
+}
+
+// scopedSearchRepository searches the stored messages in the rooms memberID belongs to, as the
+// membership subquery in the real search does
+type scopedSearchRepository struct {
+	*fakeMessageRepository
+	rooms *fakeRoomRepository
+}
+
+func (r *scopedSearchRepository) SearchMessages(query, roomID string, authorID, memberID uint, limit int) ([]model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []model.Message
+	for _, message := range r.messages {
+		isMember, _ := r.rooms.IsUserInRoom(message.RoomID, memberID)
+		if isMember && strings.Contains(message.Content, query) &&
+			(roomID == "" || message.RoomID == roomID) && (authorID == 0 || message.UserID == authorID) {
+			found = append(found, message)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found, nil
+}
+
+func TestSearchIsScopedToTheCallersRooms(t *testing.T) {
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{
+			"lobby": {ID: "lobby", Type: "public"},
+			"staff": {ID: "staff", Type: "private"},
+		},
+		members: map[string][]uint{"lobby": {1, 2}, "staff": {1}},
+	}
+	messages := &scopedSearchRepository{
+		fakeMessageRepository: &fakeMessageRepository{messages: map[uint]model.Message{
+			1: {ID: 1, RoomID: "lobby", UserID: 1, Content: "release on friday"},
+			2: {ID: 2, RoomID: "staff", UserID: 1, Content: "release salaries"},
+		}},
+		rooms: rooms,
+	}
+	chat := NewChatService(messages, rooms, nil, nil, nil, nil, nil, nil, config.RoomPolicyConfig{})
+
+	found, err := chat.SearchMessages("release", "", 0, 2, 20)
+	if err != nil || len(found) != 1 || found[0].ID != 1 {
+		t.Fatalf("search across rooms by a lobby member = %+v, %v, want only the lobby message", found, err)
+	}
+	if _, err := chat.SearchMessages("release", "staff", 0, 2, 20); err != ErrNotRoomMember {
+		t.Fatalf("search in a private room by an outsider = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := chat.SearchMessages("release", "attic", 0, 2, 20); err != ErrRoomNotFound {
+		t.Fatalf("search in an unknown room = %v, want ErrRoomNotFound", err)
+	}
+
+	found, err = chat.SearchMessages("release", "", 0, 1, 20)
+	if err != nil || len(found) != 2 {
+		t.Fatalf("search by a member of both rooms = %+v, %v, want both messages", found, err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// emojiNamePattern restricts custom emoji names to shortcode-safe characters
+var emojiNamePattern = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+// EmojiService manages custom emoji and resolves them for the rooms they are scoped to
+type EmojiService interface {
+	CreateEmoji(emoji *model.CustomEmoji) (*model.CustomEmoji, error)
+	DeleteEmoji(emojiID uint) error
+	ListEmoji(roomID string, userID uint) ([]model.CustomEmoji, error)
+}
+
+type emojiService struct {
+	emojiRepo repository.EmojiRepository
+	roomRepo  repository.RoomRepository
+}
+
+func NewEmojiService(emojiRepo repository.EmojiRepository, roomRepo repository.RoomRepository) EmojiService {
+	return &emojiService{emojiRepo: emojiRepo, roomRepo: roomRepo}
+}
+
+// CreateEmoji registers a custom emoji, globally or for a single room. Names are unique per scope.
+func (s *emojiService) CreateEmoji(emoji *model.CustomEmoji) (*model.CustomEmoji, error) {
+	if !emojiNamePattern.MatchString(emoji.Name) {
+		return nil, fmt.Errorf("%w: name must be 2-32 lowercase letters, digits or underscores", ErrInvalidEmoji)
+	}
+	if parsed, err := url.Parse(emoji.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidEmoji)
+	}
+
+	if emoji.RoomID != nil {
+		room, err := s.roomRepo.GetRoomByID(*emoji.RoomID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up room: %v", err)
+		}
+		if room == nil {
+			return nil, ErrRoomNotFound
+		}
+	}
+
+	existing, err := s.emojiRepo.FindEmoji(emoji.Name, emoji.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check emoji name: %v", err)
+	}
+	if existing != nil {
+		return nil, ErrEmojiNameTaken
+	}
+
+	if err := s.emojiRepo.CreateEmoji(emoji); err != nil {
+		return nil, fmt.Errorf("failed to create emoji: %v", err)
+	}
+	return emoji, nil
+}
+
+func (s *emojiService) DeleteEmoji(emojiID uint) error {
+	emoji, err := s.emojiRepo.GetEmojiByID(emojiID)
+	if err != nil {
+		return fmt.Errorf("failed to look up emoji: %v", err)
+	}
+	if emoji == nil {
+		return ErrEmojiNotFound
+	}
+	if err := s.emojiRepo.DeleteEmoji(emojiID); err != nil {
+		return fmt.Errorf("failed to delete emoji: %v", err)
+	}
+	return nil
+}
+
+// ListEmoji returns the emoji available in a room: the global set plus the room's own.
+// Without a room only the global set is returned.
+func (s *emojiService) ListEmoji(roomID string, userID uint) ([]model.CustomEmoji, error) {
+	if roomID != "" {
+		if err := s.checkMember(roomID, userID); err != nil {
+			return nil, err
+		}
+	}
+	return s.emojiRepo.ListEmoji(roomID)
+}
+
+func (s *emojiService) checkMember(roomID string, userID uint) error {
+	isInRoom, err := s.roomRepo.IsUserInRoom(roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isInRoom {
+		return ErrNotRoomMember
+	}
+	return nil
+}
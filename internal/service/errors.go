@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+
+	"live-chatter/pkg"
+)
+
+// Sentinel errors returned by the services so controllers can map them to HTTP statuses.
+var (
+	ErrInvalidUsername        = errors.New("invalid username")
+	ErrUsernameTaken          = errors.New("username already in use")
+	ErrChallengeFailed        = errors.New("challenge verification failed")
+	ErrEmailTaken             = errors.New("email already in use")
+	ErrInvalidProfile         = errors.New("invalid profile")
+	ErrMissingIdentifier      = errors.New("email or username is required")
+	ErrInvalidCredentials     = errors.New("invalid credentials")
+	ErrInvalidPassword        = errors.New("invalid password")
+	ErrInvalidPresenceSource  = errors.New("source must be db, live or merged")
+	ErrResetTokenInvalid      = errors.New("password reset token is invalid")
+	ErrResetTokenExpired      = errors.New("password reset token has expired")
+	ErrResetTokenUsed         = errors.New("password reset token has already been used")
+	ErrUserNotFound           = errors.New("user not found")
+	ErrRoomNotFound           = errors.New("room not found")
+	ErrInvalidRoomName        = errors.New("invalid room name")
+	ErrInvalidRoomDescription = errors.New("invalid room description")
+	ErrRoomNameTaken          = errors.New("room name already exists")
+	ErrInvalidRoomType        = errors.New("room type must be public or private")
+	ErrNotRoomMember          = errors.New("user is not in this room")
+	ErrNotRoomAdmin           = errors.New("only a room admin can do this")
+	ErrInvalidRole            = errors.New("role must be admin, moderator or member")
+	ErrLastRoomAdmin          = errors.New("a room must keep at least one admin")
+	ErrNotRoomModerator       = errors.New("only a room admin or moderator can do this")
+	ErrCannotKick             = errors.New("this member cannot be removed by you")
+	ErrBannedFromRoom         = errors.New("you are banned from this room")
+	ErrInviteRequired         = errors.New("this room is private; an invite is required to join")
+	ErrAlreadyRoomMember      = errors.New("user is already in this room")
+	ErrTooManyRoomsJoined     = pkg.ErrRoomLimitReached
+	ErrTooManyRoomsCreated    = errors.New("room creation limit reached; delete a room before creating another")
+	ErrInvalidInvite          = errors.New("invalid invite settings")
+	ErrInviteNotFound         = errors.New("invite not found")
+	ErrInviteExpired          = errors.New("invite has expired")
+	ErrInviteExhausted        = errors.New("invite has reached its maximum uses")
+	ErrMessageNotFound        = errors.New("message not found")
+	ErrInvalidCursor          = errors.New("invalid pagination cursor")
+	ErrTooManyMessages        = errors.New("too many message IDs requested")
+	ErrEmptyContent           = errors.New("message content cannot be empty")
+	ErrNotMessageAuthor       = errors.New("only the author can edit this message")
+	ErrCannotDelete           = errors.New("only the author or a room moderator can delete this message")
+	ErrMessageConflict        = errors.New("message was changed by someone else; reload it and try again")
+	ErrNotRecipient           = errors.New("message is not addressed to you")
+	ErrInvalidEmoji           = errors.New("invalid custom emoji")
+	ErrEmojiNameTaken         = errors.New("custom emoji name already in use")
+	ErrEmojiNotFound          = errors.New("custom emoji not found")
+	ErrNotificationNotFound   = errors.New("notification not found")
+	ErrAttachmentNotFound     = errors.New("attachment not found")
+	ErrAttachmentTooLarge     = errors.New("attachment exceeds the maximum size")
+	ErrAttachmentType         = errors.New("attachment type is not allowed")
+)
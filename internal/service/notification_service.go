@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// NotificationService serves the notifications stored for users while they were offline
+type NotificationService interface {
+	GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]model.Notification, int64, error)
+	MarkRead(userID, notificationID uint) error
+	MarkAllRead(userID uint) (int64, error)
+}
+
+type notificationService struct {
+	notificationRepo repository.NotificationRepository
+}
+
+func NewNotificationService(notificationRepo repository.NotificationRepository) NotificationService {
+	return &notificationService{notificationRepo: notificationRepo}
+}
+
+// GetNotifications returns a page of the user's notifications, newest first, and the total count
+func (s *notificationService) GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]model.Notification, int64, error) {
+	return s.notificationRepo.GetNotifications(userID, unreadOnly, limit, offset)
+}
+
+// MarkRead marks one of the user's notifications as read
+func (s *notificationService) MarkRead(userID, notificationID uint) error {
+	found, err := s.notificationRepo.MarkRead(userID, notificationID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %v", err)
+	}
+	if !found {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications as read and returns how many were unread
+func (s *notificationService) MarkAllRead(userID uint) (int64, error) {
+	count, err := s.notificationRepo.MarkAllRead(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	return count, nil
+}
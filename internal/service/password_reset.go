@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"live-chatter/pkg"
+	"live-chatter/pkg/model"
+
+	Log "live-chatter/pkg/logger"
+)
+
+// defaultResetTokenTTL applies when PASSWORD_RESET leaves TOKEN_TTL unset
+const defaultResetTokenTTL = 30 * time.Minute
+
+// ForgotPassword emails a single-use reset link to the account with the given email. To avoid
+// revealing which emails are registered it succeeds whether or not an account matches, and the
+// token is issued and mailed in the background so the response takes as long either way.
+func (s *authService) ForgotPassword(email string) error {
+	email = strings.TrimSpace(email)
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %v", err)
+	}
+	if user == nil {
+		Log.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	go func() {
+		if err := s.sendResetEmail(user); err != nil {
+			Log.Error("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// sendResetEmail issues a reset token for the user and emails them the link that uses it
+func (s *authService) sendResetEmail(user *model.User) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate reset token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	ttl := time.Duration(s.passwordReset.TokenTTL) * time.Minute
+	if ttl <= 0 {
+		ttl = defaultResetTokenTTL
+	}
+	if err := s.resetRepo.CreateToken(&model.PasswordResetToken{
+		TokenHash: hash256encode(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return fmt.Errorf("failed to store reset token: %v", err)
+	}
+
+	link := token
+	if s.passwordReset.ResetURL != "" {
+		separator := "?"
+		if strings.Contains(s.passwordReset.ResetURL, "?") {
+			separator = "&"
+		}
+		link = s.passwordReset.ResetURL + separator + "token=" + url.QueryEscape(token)
+	}
+	body := fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %d minutes and works once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+		user.Username, int(ttl.Minutes()), link)
+	if err := s.mailer.Send(user.Email, "Reset your password", body); err != nil {
+		return fmt.Errorf("failed to send reset email: %v", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed reset token. A token works once, even
+// under concurrent attempts. Afterwards every session of the user is revoked, along with any
+// other reset tokens they were sent.
+func (s *authService) ResetPassword(token, newPassword, ipAddress string) error {
+	tokenHash := hash256encode(token)
+	resetToken, err := s.resetRepo.GetToken(tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to look up reset token: %v", err)
+	}
+	if resetToken == nil {
+		return ErrResetTokenInvalid
+	}
+	if resetToken.UsedAt != nil {
+		return ErrResetTokenUsed
+	}
+	if !resetToken.ExpiresAt.After(time.Now()) {
+		return ErrResetTokenExpired
+	}
+
+	if err := validatePassword(newPassword, s.registration.Password); err != nil {
+		return err
+	}
+
+	used, err := s.resetRepo.UseToken(tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to use reset token: %v", err)
+	}
+	if !used {
+		return ErrResetTokenUsed
+	}
+
+	if err := s.userRepo.UpdatePassword(resetToken.UserID, hash256encode(newPassword)); err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+	if err := s.sessionRepo.DeleteUserSessions(resetToken.UserID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	if err := s.resetRepo.DeleteUserTokens(resetToken.UserID); err != nil {
+		Log.Warn("Failed to discard reset tokens of user %d: %v", resetToken.UserID, err)
+	}
+
+	pkg.RecordActivity(s.activityRepo, resetToken.UserID, model.ActivityPasswordReset, "", ipAddress)
+	return nil
+}
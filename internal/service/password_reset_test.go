@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// fakePasswordResetRepository keeps reset tokens in memory, with the conditional use of the SQL one
+type fakePasswordResetRepository struct {
+	repository.PasswordResetRepository
+	mu     sync.Mutex
+	tokens map[string]model.PasswordResetToken
+}
+
+func (r *fakePasswordResetRepository) CreateToken(token *model.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = make(map[string]model.PasswordResetToken)
+	}
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *fakePasswordResetRepository) GetToken(tokenHash string) (*model.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (r *fakePasswordResetRepository) UseToken(tokenHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	r.tokens[tokenHash] = token
+	return true, nil
+}
+
+func (r *fakePasswordResetRepository) DeleteUserTokens(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, token := range r.tokens {
+		if token.UserID == userID {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// capturingMailer hands every email body it is asked to send to the test
+type capturingMailer struct {
+	bodies chan string
+}
+
+func (m *capturingMailer) Send(to, subject, body string) error {
+	m.bodies <- body
+	return nil
+}
+
+var resetLink = regexp.MustCompile(`https://chat\.example/reset\?token=([0-9a-f]+)`)
+
+// newResetService returns an auth service for alice, whose email is a@x.io, and its fakes
+func newResetService(t *testing.T) (AuthService, *fakeUserRepository, *fakeSessionRepository, *fakePasswordResetRepository, *capturingMailer) {
+	t.Helper()
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice", Email: "a@x.io", Password: hash256encode("Correct-Horse-9")},
+	}}
+	_, sessions := newTestAuthService(t, users, config.AuthenticationConfig{})
+	resets := &fakePasswordResetRepository{}
+	mailer := &capturingMailer{bodies: make(chan string, 1)}
+	auth := NewAuthService(users, sessions, nil, resets, mailer, config.AuthenticationConfig{},
+		config.RegistrationConfig{}, config.PasswordResetConfig{TokenTTL: 10, ResetURL: "https://chat.example/reset"})
+	return auth, users, sessions, resets, mailer
+}
+
+// mailedToken waits for the reset email and pulls the token out of its link
+func mailedToken(t *testing.T, mailer *capturingMailer) string {
+	t.Helper()
+	select {
+	case body := <-mailer.bodies:
+		match := resetLink.FindStringSubmatch(body)
+		if match == nil {
+			t.Fatalf("no reset link in %q", body)
+		}
+		return match[1]
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reset email was sent")
+		return ""
+	}
+}
+
+func TestPasswordResetSetsTheNewPasswordOnce(t *testing.T) {
+	auth, users, sessions, _, mailer := newResetService(t)
+	if _, err := auth.Login(LoginCredentials{Username: "alice", AuthHash: authHash(t, "alice", "Correct-Horse-9")}, SessionClient{}); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	if err := auth.ForgotPassword(" a@x.io "); err != nil {
+		t.Fatalf("ForgotPassword failed: %v", err)
+	}
+	token := mailedToken(t, mailer)
+
+	if err := auth.ResetPassword(token, "short", ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("weak password = %v, want ErrInvalidPassword", err)
+	}
+	if err := auth.ResetPassword(token, "New-Password-42", "203.0.113.7"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if users.users[0].Password != hash256encode("New-Password-42") {
+		t.Fatal("the password was not changed")
+	}
+	if sessions.count(1) != 0 {
+		t.Fatalf("%d sessions survived the reset, want 0", sessions.count(1))
+	}
+
+	if err := auth.ResetPassword(token, "Another-Password-7", ""); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Fatalf("reusing the token = %v, want ErrResetTokenInvalid", err)
+	}
+	if users.users[0].Password != hash256encode("New-Password-42") {
+		t.Fatal("a reused token changed the password")
+	}
+}
+
+func TestPasswordResetRefusesExpiredAndUsedTokens(t *testing.T) {
+	auth, users, _, resets, _ := newResetService(t)
+	used := time.Now().Add(-time.Minute)
+	resets.CreateToken(&model.PasswordResetToken{TokenHash: hash256encode("expired"), UserID: 1, ExpiresAt: time.Now().Add(-time.Second)})
+	resets.CreateToken(&model.PasswordResetToken{TokenHash: hash256encode("used"), UserID: 1, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &used})
+
+	for token, want := range map[string]error{
+		"expired": ErrResetTokenExpired,
+		"used":    ErrResetTokenUsed,
+		"unknown": ErrResetTokenInvalid,
+	} {
+		if err := auth.ResetPassword(token, "New-Password-42", ""); !errors.Is(err, want) {
+			t.Errorf("token %q = %v, want %v", token, err, want)
+		}
+	}
+	if users.users[0].Password != hash256encode("Correct-Horse-9") {
+		t.Fatal("a refused token changed the password")
+	}
+}
+
+func TestForgotPasswordForUnknownEmailSendsNothing(t *testing.T) {
+	auth, _, _, resets, mailer := newResetService(t)
+	if err := auth.ForgotPassword("nobody@x.io"); err != nil {
+		t.Fatalf("ForgotPassword for an unknown email = %v, want success", err)
+	}
+	select {
+	case body := <-mailer.bodies:
+		t.Fatalf("an email was sent: %q", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(resets.tokens) != 0 {
+		t.Fatalf("tokens issued for an unknown email: %v", resets.tokens)
+	}
+}
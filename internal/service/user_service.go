@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg"
+	"live-chatter/pkg/i18n"
+	"live-chatter/pkg/model"
+)
+
+// Profile field limits, matching the register request binding
+const (
+	maxNameLength   = 100
+	maxEmailLength  = 254
+	maxLocaleLength = 16
+)
+
+// UserService manages a user's own account details
+type UserService interface {
+	UpdateProfile(userID uint, update ProfileUpdate) (*model.User, error)
+	DeactivateAccount(userID uint) error
+	SetAppearOffline(userID uint, appearOffline bool) error
+}
+
+// ProfileUpdate lists the profile fields a user may change; nil fields are left untouched
+type ProfileUpdate struct {
+	FirstName *string
+	LastName  *string
+	Email     *string
+	Locale    *string
+}
+
+type userService struct {
+	userRepo      repository.UserRepository
+	sessionRepo   repository.SessionRepository
+	roomRepo      repository.RoomRepository
+	clientManager *pkg.ClientManager
+}
+
+func NewUserService(userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	roomRepo repository.RoomRepository,
+	clientManager *pkg.ClientManager) UserService {
+
+	return &userService{
+		userRepo:      userRepo,
+		sessionRepo:   sessionRepo,
+		roomRepo:      roomRepo,
+		clientManager: clientManager,
+	}
+}
+
+// UpdateProfile validates and applies a partial profile update, returning the stored result
+func (s *userService) UpdateProfile(userID uint, update ProfileUpdate) (*model.User, error) {
+	fields := make(map[string]interface{})
+
+	if update.FirstName != nil {
+		firstName := strings.TrimSpace(*update.FirstName)
+		if utf8.RuneCountInString(firstName) > maxNameLength {
+			return nil, fmt.Errorf("%w: first name must be at most %d characters", ErrInvalidProfile, maxNameLength)
+		}
+		fields["first_name"] = firstName
+	}
+
+	if update.LastName != nil {
+		lastName := strings.TrimSpace(*update.LastName)
+		if utf8.RuneCountInString(lastName) > maxNameLength {
+			return nil, fmt.Errorf("%w: last name must be at most %d characters", ErrInvalidProfile, maxNameLength)
+		}
+		fields["last_name"] = lastName
+	}
+
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		if email == "" || len(email) > maxEmailLength {
+			return nil, fmt.Errorf("%w: email must be between 1 and %d characters", ErrInvalidProfile, maxEmailLength)
+		}
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			return nil, fmt.Errorf("%w: email address is malformed", ErrInvalidProfile)
+		}
+
+		taken, err := s.userRepo.IsEmailTaken(email, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check email: %v", err)
+		}
+		if taken {
+			return nil, ErrEmailTaken
+		}
+		fields["email"] = email
+	}
+
+	if update.Locale != nil {
+		if len(*update.Locale) > maxLocaleLength {
+			return nil, fmt.Errorf("%w: locale must be at most %d characters", ErrInvalidProfile, maxLocaleLength)
+		}
+		// Unknown locales fall back to the closest supported catalog
+		fields["locale"] = i18n.Supported(*update.Locale)
+	}
+
+	if len(fields) > 0 {
+		if err := s.userRepo.UpdateUser(userID, fields); err != nil {
+			return nil, fmt.Errorf("failed to update profile: %v", err)
+		}
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Password = ""
+
+	return user, nil
+}
+
+// DeactivateAccount soft-deletes the user, ends their room memberships and sessions, and drops
+// their live connection. The username and email stay reserved and cannot be registered again.
+func (s *userService) DeactivateAccount(userID uint) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return ErrUserNotFound
+	}
+
+	// Memberships, sessions and the account change together, so a failure leaves nothing half done
+	roomIDs, err := s.userRepo.DeactivateUser(userID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate account: %v", err)
+	}
+
+	if s.clientManager != nil {
+		for _, roomID := range roomIDs {
+			s.clientManager.AdjustMemberCount(roomID, -1)
+		}
+		s.clientManager.DisconnectUser(user.Username)
+	}
+
+	return nil
+}
+
+// SetAppearOffline stores the user's visibility and applies it to their live connection
+func (s *userService) SetAppearOffline(userID uint, appearOffline bool) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return ErrUserNotFound
+	}
+
+	// The stored status of a connected user follows their visibility, as it does when they connect
+	updates := map[string]interface{}{"appear_offline": appearOffline}
+	if s.clientManager != nil && s.clientManager.IsUserOnline(user.Username) {
+		updates["status"] = "online"
+		if appearOffline {
+			updates["status"] = "offline"
+		}
+	}
+	if err := s.userRepo.UpdateUser(userID, updates); err != nil {
+		return fmt.Errorf("failed to update presence visibility: %v", err)
+	}
+
+	if s.clientManager != nil {
+		s.clientManager.SetAppearOffline(user.Username, appearOffline)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"live-chatter/pkg/model"
+)
+
+// IsEmailTaken never reports an empty email as taken, as the repository does
+func (r *fakeUserRepository) IsEmailTaken(email string, excludeUserID uint) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+	for _, user := range r.users {
+		if user.ID != excludeUserID && strings.EqualFold(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateUser applies the profile columns UpdateProfile writes
+func (r *fakeUserRepository) UpdateUser(userID uint, fields map[string]interface{}) error {
+	for i := range r.users {
+		if r.users[i].ID != userID {
+			continue
+		}
+		for column, value := range fields {
+			switch column {
+			case "first_name":
+				r.users[i].FirstName = value.(string)
+			case "last_name":
+				r.users[i].LastName = value.(string)
+			case "email":
+				r.users[i].Email = value.(string)
+			case "locale":
+				r.users[i].Locale = value.(string)
+			}
+		}
+	}
+	return nil
+}
+
+// deactivatingUserRepository fails or succeeds at the single deactivation write
+type deactivatingUserRepository struct {
+	fakeUserRepository
+	err   error
+	calls int
+}
+
+func (r *deactivatingUserRepository) DeactivateUser(userID uint) ([]string, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []string{"lobby"}, nil
+}
+
+func TestDeactivateAccountIsOneWrite(t *testing.T) {
+	for _, failure := range []error{nil, errors.New("connection reset")} {
+		users := &deactivatingUserRepository{
+			fakeUserRepository: fakeUserRepository{users: []model.User{{ID: 1, Username: "alice"}}},
+			err:                failure,
+		}
+		// No session or room repository: every write must go through DeactivateUser
+		accounts := NewUserService(users, nil, nil, nil)
+
+		err := accounts.DeactivateAccount(1)
+		if (err != nil) != (failure != nil) {
+			t.Fatalf("DeactivateAccount = %v, want failure %v", err, failure)
+		}
+		if users.calls != 1 {
+			t.Fatalf("DeactivateUser called %d times, want once", users.calls)
+		}
+	}
+}
+
+func TestUpdateProfileAppliesTheGivenFields(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com", FirstName: "Alice", LastName: "Old", Password: "hash"},
+	}}
+	accounts := NewUserService(users, nil, nil, nil)
+
+	lastName, email := "  Liddell ", "alice@example.org"
+	user, err := accounts.UpdateProfile(1, ProfileUpdate{LastName: &lastName, Email: &email})
+	if err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	if user.FirstName != "Alice" || user.LastName != "Liddell" || user.Email != "alice@example.org" {
+		t.Fatalf("unexpected profile %+v", user)
+	}
+	if user.Password != "" {
+		t.Fatal("the password hash was returned")
+	}
+}
+
+func TestUpdateProfileRejectsATakenEmail(t *testing.T) {
+	users := &fakeUserRepository{users: []model.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com"},
+		{ID: 2, Username: "bob", Email: "bob@example.com"},
+	}}
+	accounts := NewUserService(users, nil, nil, nil)
+
+	taken := "bob@example.com"
+	if _, err := accounts.UpdateProfile(1, ProfileUpdate{Email: &taken}); err != ErrEmailTaken {
+		t.Fatalf("taking bob's email = %v, want ErrEmailTaken", err)
+	}
+	malformed := "not an email"
+	if _, err := accounts.UpdateProfile(1, ProfileUpdate{Email: &malformed}); !errors.Is(err, ErrInvalidProfile) {
+		t.Fatalf("malformed email = %v, want ErrInvalidProfile", err)
+	}
+	if users.users[0].Email != "alice@example.com" {
+		t.Fatalf("a rejected update changed the email to %q", users.users[0].Email)
+	}
+
+	// Keeping one's own address is not a collision
+	own := "alice@example.com"
+	if _, err := accounts.UpdateProfile(1, ProfileUpdate{Email: &own}); err != nil {
+		t.Fatalf("re-saving the same email failed: %v", err)
+	}
+}
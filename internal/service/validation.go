@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"live-chatter/internal/config"
+)
+
+// Fallbacks used when the REGISTRATION section leaves username rules unset
+const (
+	defaultUsernameMinLength  = 3
+	defaultUsernameMaxLength  = 50
+	defaultUsernameSeparators = "._-"
+)
+
+// Bounds on password length; the configured minimum is raised to at least minPasswordLength
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 128
+)
+
+// Fallbacks used when the ROOMS section leaves length limits unset
+const (
+	defaultRoomNameMaxLength        = 50
+	defaultRoomDescriptionMaxLength = 255
+)
+
+// roomNamePunctuation lists the non-alphanumeric characters allowed in room names besides spaces
+const roomNamePunctuation = "-_.,'&()#!?+:"
+
+// htmlTagPattern matches markup so it can be stripped from room descriptions
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// systemReservedNames can never be registered because the server uses them as message authors
+var systemReservedNames = []string{"system"}
+
+// validateUsername enforces the configured username policy. Only ASCII letters, digits and
+// separators are accepted, which rules out look-alike unicode characters used for impersonation.
+func validateUsername(username string, policy config.UsernamePolicyConfig) error {
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = defaultUsernameMinLength
+	}
+	maxLength := policy.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultUsernameMaxLength
+	}
+	separators := policy.Separators
+	if separators == "" {
+		separators = defaultUsernameSeparators
+	}
+
+	if len(username) < minLength || len(username) > maxLength {
+		return fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidUsername, minLength, maxLength)
+	}
+
+	previousWasSeparator := false
+	for i, r := range username {
+		isSeparator := strings.ContainsRune(separators, r)
+		isAlphanumeric := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+
+		if !isSeparator && !isAlphanumeric {
+			return fmt.Errorf("%w: may only contain letters, digits and %q", ErrInvalidUsername, separators)
+		}
+		if isSeparator && (i == 0 || i == len(username)-1) {
+			return fmt.Errorf("%w: cannot start or end with a separator", ErrInvalidUsername)
+		}
+		if isSeparator && previousWasSeparator {
+			return fmt.Errorf("%w: cannot contain consecutive separators", ErrInvalidUsername)
+		}
+		previousWasSeparator = isSeparator
+	}
+
+	reserved := append(append([]string{}, systemReservedNames...), policy.ReservedNames...)
+	for _, name := range reserved {
+		if strings.EqualFold(username, strings.TrimSpace(name)) {
+			return fmt.Errorf("%w: %q is reserved", ErrInvalidUsername, username)
+		}
+	}
+
+	return nil
+}
+
+// validatePassword checks a plaintext password against the configured strength policy. The
+// error names every rule the password breaks, not just the first.
+func validatePassword(password string, policy config.PasswordPolicyConfig) error {
+	minLength := policy.MinLength
+	if minLength < minPasswordLength {
+		minLength = minPasswordLength
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length > maxPasswordLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrInvalidPassword, maxPasswordLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var failed []string
+	if length < minLength {
+		failed = append(failed, fmt.Sprintf("be at least %d characters", minLength))
+	}
+	if policy.RequireUpper && !hasUpper {
+		failed = append(failed, "contain an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		failed = append(failed, "contain a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		failed = append(failed, "contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		failed = append(failed, "contain a symbol")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: must %s", ErrInvalidPassword, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// normalizeRoomName trims a room name and checks it against the configured policy.
+// Names may contain letters and digits in any script, single spaces and a small set of punctuation.
+func normalizeRoomName(name string, policy config.RoomPolicyConfig) (string, error) {
+	maxLength := policy.NameMaxLength
+	if maxLength <= 0 {
+		maxLength = defaultRoomNameMaxLength
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: cannot be empty", ErrInvalidRoomName)
+	}
+	if utf8.RuneCountInString(name) > maxLength {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidRoomName, maxLength)
+	}
+
+	previousWasSpace := false
+	for _, r := range name {
+		isSpace := r == ' '
+		if !isSpace && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(roomNamePunctuation, r) {
+			return "", fmt.Errorf("%w: may only contain letters, digits, spaces and %q", ErrInvalidRoomName, roomNamePunctuation)
+		}
+		if isSpace && previousWasSpace {
+			return "", fmt.Errorf("%w: cannot contain consecutive spaces", ErrInvalidRoomName)
+		}
+		previousWasSpace = isSpace
+	}
+
+	return name, nil
+}
+
+// sanitizeRoomDescription strips markup and control characters from a description and
+// enforces the configured length limit on what remains
+func sanitizeRoomDescription(description string, policy config.RoomPolicyConfig) (string, error) {
+	maxLength := policy.DescriptionMaxLength
+	if maxLength <= 0 {
+		maxLength = defaultRoomDescriptionMaxLength
+	}
+
+	description = htmlTagPattern.ReplaceAllString(description, "")
+	description = strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || (unicode.IsControl(r) && r != '\n') {
+			return -1
+		}
+		return r
+	}, description)
+	description = strings.TrimSpace(description)
+
+	if utf8.RuneCountInString(description) > maxLength {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidRoomDescription, maxLength)
+	}
+
+	return description, nil
+}
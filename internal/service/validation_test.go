@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg/model"
+)
+
+func TestValidateUsername(t *testing.T) {
+	policy := config.UsernamePolicyConfig{ReservedNames: []string{"admin", " moderator "}}
+
+	tests := []struct {
+		name     string
+		username string
+		valid    bool
+	}{
+		{"plain", "alice", true},
+		{"separators inside", "alice.smith_2-b", true},
+		{"too short", "al", false},
+		{"too long", "a123456789012345678901234567890123456789012345678901", false},
+		{"space", "alice smith", false},
+		{"at sign", "alice@home", false},
+		{"leading separator", "_alice", false},
+		{"trailing separator", "alice.", false},
+		{"consecutive separators", "alice..smith", false},
+		{"cyrillic homoglyph", "\u0430lice", false}, // A Cyrillic a
+		{"fullwidth letters", "\uff41\uff4c\uff49\uff43\uff45", false},
+		{"zero-width space", "ali\u200bce", false},
+		{"system", "system", false},
+		{"system in capitals", "SYSTEM", false},
+		{"configured reserved name", "Admin", false},
+		{"reserved name with padding in config", "moderator", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUsername(tt.username, policy)
+			if tt.valid && err != nil {
+				t.Fatalf("validateUsername(%q) = %v, want it accepted", tt.username, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidUsername) {
+				t.Fatalf("validateUsername(%q) = %v, want ErrInvalidUsername", tt.username, err)
+			}
+		})
+	}
+}
+
+func TestValidateUsernameUsesConfiguredRules(t *testing.T) {
+	policy := config.UsernamePolicyConfig{MinLength: 5, MaxLength: 8, Separators: "-"}
+
+	if err := validateUsername("bob", policy); err == nil {
+		t.Fatal("a name under the configured minimum was accepted")
+	}
+	if err := validateUsername("bob-smith", policy); err == nil {
+		t.Fatal("a name over the configured maximum was accepted")
+	}
+	if err := validateUsername("bob_s", policy); err == nil {
+		t.Fatal("a separator outside the configured set was accepted")
+	}
+	if err := validateUsername("bob-s", policy); err != nil {
+		t.Fatalf("a name within the configured rules was rejected: %v", err)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	strict := config.PasswordPolicyConfig{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		policy   config.PasswordPolicyConfig
+		failures []string // Rules the error must name; none means the password is accepted
+	}{
+		{"meets every rule", "Corr3ct-horse", strict, nil},
+		{"too short", "Sh0rt-pw", strict, []string{"at least 10 characters"}},
+		{"no uppercase", "corr3ct-horse", strict, []string{"uppercase"}},
+		{"no lowercase", "CORR3CT-HORSE", strict, []string{"lowercase"}},
+		{"no digit", "Correct-horse", strict, []string{"digit"}},
+		{"no symbol", "Corr3cthorse", strict, []string{"symbol"}},
+		{"breaks several rules", "horse", strict, []string{"at least 10 characters", "uppercase", "digit", "symbol"}},
+		{"minimum is never below eight", "abcdefg", config.PasswordPolicyConfig{MinLength: 4}, []string{"at least 8 characters"}},
+		{"no rules beyond length by default", "abcdefgh", config.PasswordPolicyConfig{}, nil},
+		{"too long", strings.Repeat("a", maxPasswordLength+1), config.PasswordPolicyConfig{}, []string{"at most"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePassword(tt.password, tt.policy)
+			if len(tt.failures) == 0 {
+				if err != nil {
+					t.Fatalf("validatePassword = %v, want it accepted", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidPassword) {
+				t.Fatalf("validatePassword = %v, want ErrInvalidPassword", err)
+			}
+			for _, rule := range tt.failures {
+				if !strings.Contains(err.Error(), rule) {
+					t.Errorf("error %q does not mention %q", err, rule)
+				}
+			}
+		})
+	}
+}
+
+func TestRoomsWithInvalidNamesOrDescriptionsAreRejected(t *testing.T) {
+	policy := config.RoomPolicyConfig{NameMaxLength: 20, DescriptionMaxLength: 30}
+	rooms := &fakeRoomRepository{
+		rooms: map[string]*model.Room{"lobby": {ID: "lobby", Name: "Lobby"}},
+		roles: map[string]map[uint]string{"lobby": {1: "admin"}},
+	}
+	chat := NewChatService(nil, rooms, nil, nil, nil, nil, nil, nil, policy)
+
+	tests := []struct {
+		name        string
+		roomName    string
+		description string
+		want        error
+	}{
+		{"blank name", "   ", "", ErrInvalidRoomName},
+		{"name over the limit", strings.Repeat("x", 21), "", ErrInvalidRoomName},
+		{"markup in the name", "<b>Lobby</b>", "", ErrInvalidRoomName},
+		{"consecutive spaces", "Big  Lobby", "", ErrInvalidRoomName},
+		{"description over the limit", "Lobby", strings.Repeat("y", 31), ErrInvalidRoomDescription},
+		{"description over the limit once tags are stripped", "Lobby", "<i>" + strings.Repeat("y", 31) + "</i>", ErrInvalidRoomDescription},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Neither path may reach the repository's name check or write
+			_, err := chat.CreateRoom(&model.Room{Name: tt.roomName, Description: tt.description, CreatedBy: 1})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateRoom = %v, want %v", err, tt.want)
+			}
+			_, err = chat.UpdateRoom("lobby", 1, RoomUpdate{Name: &tt.roomName, Description: &tt.description})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateRoom = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeRoomDescription(t *testing.T) {
+	got, err := sanitizeRoomDescription("  <script>alert(1)</script>Chat about <b>Go</b>\x07\nand more <  ", config.RoomPolicyConfig{})
+	if err != nil {
+		t.Fatalf("sanitizeRoomDescription: %v", err)
+	}
+	if want := "alert(1)Chat about Go\nand more"; got != want {
+		t.Fatalf("sanitizeRoomDescription = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"live-chatter/pkg/model"
+)
+
+// ErrInvalidAttachment is returned when a message references an attachment the sender did not
+// upload to the message's room
+var ErrInvalidAttachment = errors.New("attachment not found in this room")
+
+// AttachToMessage resolves the message's AttachmentID, filling in its URL and marking it an image
+// or file message. Messages without an attachment are left untouched.
+func (manager *ClientManager) AttachToMessage(message *model.Message) error {
+	if message.AttachmentID == nil {
+		return nil
+	}
+	if manager.AttachmentRepo == nil {
+		return ErrInvalidAttachment
+	}
+
+	attachment, err := manager.AttachmentRepo.GetAttachment(*message.AttachmentID)
+	if err != nil {
+		return fmt.Errorf("failed to load attachment: %v", err)
+	}
+	if attachment == nil || attachment.RoomID != message.RoomID || attachment.UploaderID != message.UserID {
+		return ErrInvalidAttachment
+	}
+
+	message.AttachmentURL = attachment.URL()
+	message.Type = "file"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		message.Type = "image"
+	}
+	return nil
+}
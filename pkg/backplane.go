@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	Log "live-chatter/pkg/logger"
+)
+
+// Backplane carries events between server instances that share a database. Delivery and read
+// receipts for a sender who is not connected to this instance are published on it, and the
+// backplane hands receipts published by other instances to ReceiveRelayed.
+type Backplane interface {
+	// Publish sends the broadcast to the other instances. It is called from the manager loop,
+	// so it must not block.
+	Publish(broadcastMsg BroadcastMessage) error
+}
+
+// relayedMessageTypes are the direct events published on the backplane when their target is not
+// connected to this instance
+var relayedMessageTypes = map[string]bool{
+	"delivery_receipt": true,
+	"read_receipt":     true,
+}
+
+// ReceiveRelayed queues a direct event published by another instance. It reaches the target if
+// they are connected here and is never published back.
+func (manager *ClientManager) ReceiveRelayed(broadcastMsg BroadcastMessage) {
+	if broadcastMsg.MessageType != "direct_message" || broadcastMsg.Message == nil {
+		Log.Warn("Ignoring relayed broadcast of type %s", broadcastMsg.MessageType)
+		return
+	}
+	broadcastMsg.Relayed = true
+	manager.Publish(broadcastMsg)
+}
+
+// deliverDirect sends a direct event to its target, or publishes it on the backplane when the
+// target is not connected here and the event is one other instances need.
+// Must be called from the manager loop, like sendToUser.
+func (manager *ClientManager) deliverDirect(broadcastMsg BroadcastMessage) {
+	if manager.sendToUser(broadcastMsg.Message, broadcastMsg.TargetUsername) {
+		return
+	}
+	if broadcastMsg.Relayed || manager.Backplane == nil || !relayedMessageTypes[broadcastMsg.Message.Type] {
+		return
+	}
+	if err := manager.Backplane.Publish(broadcastMsg); err != nil {
+		Log.Warn("Failed to relay %s for %s: %v", broadcastMsg.Message.Type, broadcastMsg.TargetUsername, err)
+	}
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"live-chatter/pkg/model"
+)
+
+// linkedBackplane hands everything published on one instance to another, as a shared channel would
+type linkedBackplane struct {
+	peer *ClientManager
+}
+
+func (b *linkedBackplane) Publish(broadcastMsg BroadcastMessage) error {
+	b.peer.ReceiveRelayed(broadcastMsg)
+	return nil
+}
+
+// startTestManager runs a manager loop with the given users connected and no repositories
+func startTestManager(t *testing.T, usernames ...string) (*ClientManager, map[string]*Client) {
+	t.Helper()
+	manager := &ClientManager{
+		Broadcast:   make(chan BroadcastMessage, 16),
+		Clients:     make(map[*Client]bool),
+		Rooms:       make(map[string]map[*Client]bool),
+		UserClients: make(map[string]*Client),
+	}
+	clients := make(map[string]*Client)
+	for _, username := range usernames {
+		client := NewClient(&model.User{Username: username}, nil, DefaultClientConfig())
+		manager.Clients[client] = true
+		manager.UserClients[username] = client
+		clients[username] = client
+	}
+	go manager.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		manager.Shutdown(ctx)
+	})
+	return manager, clients
+}
+
+// nextFrame waits for the next frame queued for the client
+func nextFrame(t *testing.T, client *Client) *Message {
+	t.Helper()
+	select {
+	case data := <-client.Send:
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("undecodable frame %s: %v", data, err)
+		}
+		return &message
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no frame reached %s", client.User.Username)
+		return nil
+	}
+}
+
+func TestReadReceiptReachesSenderOnAnotherInstance(t *testing.T) {
+	senderSide, senderClients := startTestManager(t, "alice")
+	recipientSide, _ := startTestManager(t, "bob")
+	recipientSide.Backplane = &linkedBackplane{peer: senderSide}
+
+	pm := &model.PrivateMessage{ID: 7, Sender: model.User{Username: "alice"}}
+	recipientSide.NotifyReadReceipt(pm, "bob", time.Now())
+
+	receipt := nextFrame(t, senderClients["alice"])
+	if receipt.Type != "read_receipt" || receipt.Username != "bob" || receipt.Data["message_id"] != float64(7) {
+		t.Fatalf("unexpected frame %+v", receipt)
+	}
+}
+
+func TestUnreadMessagesSendDeliveryReceiptsOnce(t *testing.T) {
+	senderSide, senderClients := startTestManager(t, "alice")
+	recipientSide, recipientClients := startTestManager(t, "bob")
+	recipientSide.Backplane = &linkedBackplane{peer: senderSide}
+
+	delivered := time.Now().Add(-time.Hour)
+	unread := []model.PrivateMessage{
+		{ID: 1, Sender: model.User{Username: "alice"}, DeliveredAt: &delivered},
+		{ID: 2, Sender: model.User{Username: "alice"}},
+	}
+	recipientSide.mu.Lock()
+	recipientSide.deliverUnreadPrivateMessages(recipientClients["bob"], unread)
+	recipientSide.mu.Unlock()
+
+	receipt := nextFrame(t, senderClients["alice"])
+	if receipt.Type != "delivery_receipt" || receipt.Data["message_id"] != float64(2) {
+		t.Fatalf("unexpected frame %+v", receipt)
+	}
+	select {
+	case data := <-senderClients["alice"].Send:
+		t.Fatalf("receipt re-sent for a message delivered earlier: %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
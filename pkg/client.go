@@ -2,7 +2,10 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"live-chatter/pkg/model"
@@ -10,28 +13,180 @@ import (
 	Log "live-chatter/pkg/logger"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
 )
 
 const (
-	// Time allowed to write a message to the peer
-	writeWait = 10 * time.Second
+	// DefaultWriteWait is the time allowed to write a message to the peer
+	DefaultWriteWait = 10 * time.Second
 
-	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
+	// DefaultPongWait is the time allowed to read the next pong message from the peer
+	DefaultPongWait = 60 * time.Second
 
-	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = (pongWait * 9) / 10
+	// DefaultSendBufferSize is the number of outgoing frames buffered per client
+	DefaultSendBufferSize = 256
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 512
+	// DefaultMaxMessageSize is the content size limit used when none is configured
+	DefaultMaxMessageSize = 4096
+
+	// DefaultHeartbeatInterval is used when heartbeats are enabled without an interval
+	DefaultHeartbeatInterval = 25 * time.Second
+
+	// Incoming frame limits used when none are configured: a sustained 10 frames a second with
+	// bursts of 20, and a disconnect after 50 limited frames in a row
+	DefaultMessageRate       = 10
+	DefaultMessageBurst      = 20
+	DefaultMaxRateViolations = 50
+
+	// readLimitFactor sizes the socket read limit relative to the content limit, leaving room for
+	// the JSON envelope and escaping so oversized content gets an error frame instead of a disconnect
+	readLimitFactor = 4
 )
 
+// ClientConfig holds the per-connection timing and buffer settings
+type ClientConfig struct {
+	WriteWait      time.Duration // Time allowed to write a message to the peer
+	PongWait       time.Duration // Time allowed to read the next pong message from the peer
+	PingPeriod     time.Duration // Send pings to peer with this period (must be less than PongWait)
+	SendBufferSize int           // Buffered outgoing frames per client
+	MaxMessageSize int           // Maximum message content size in bytes
+
+	// HeartbeatInterval is how often an application-level "heartbeat" frame is sent so proxies
+	// that ignore protocol pings still see traffic on idle connections (0 disables)
+	HeartbeatInterval time.Duration
+
+	// Incoming frames are limited per connection by a token bucket refilled at MessageRate frames
+	// per second up to MessageBurst (a zero rate disables the limit). After MaxRateViolations
+	// consecutive limited frames the connection is closed (0 never closes it).
+	MessageRate       float64
+	MessageBurst      int
+	MaxRateViolations int
+}
+
+// DefaultClientConfig returns the settings used when nothing is configured
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		WriteWait:      DefaultWriteWait,
+		PongWait:       DefaultPongWait,
+		PingPeriod:     (DefaultPongWait * 9) / 10,
+		SendBufferSize: DefaultSendBufferSize,
+		MaxMessageSize: DefaultMaxMessageSize,
+
+		MessageRate:       DefaultMessageRate,
+		MessageBurst:      DefaultMessageBurst,
+		MaxRateViolations: DefaultMaxRateViolations,
+	}
+}
+
+// Validate checks that the settings are usable; a ping period at or above the pong wait
+// would let healthy connections time out between pings
+func (cfg ClientConfig) Validate() error {
+	if cfg.WriteWait <= 0 || cfg.PongWait <= 0 || cfg.PingPeriod <= 0 {
+		return fmt.Errorf("websocket write wait, pong wait and ping period must be positive")
+	}
+	if cfg.PingPeriod >= cfg.PongWait {
+		return fmt.Errorf("websocket ping period (%s) must be less than pong wait (%s)", cfg.PingPeriod, cfg.PongWait)
+	}
+	if cfg.SendBufferSize <= 0 {
+		return fmt.Errorf("websocket send buffer size must be positive")
+	}
+	if cfg.MaxMessageSize <= 0 {
+		return fmt.Errorf("websocket max message size must be positive")
+	}
+	if cfg.HeartbeatInterval < 0 {
+		return fmt.Errorf("websocket heartbeat interval cannot be negative")
+	}
+	if cfg.MessageRate < 0 || cfg.MaxRateViolations < 0 {
+		return fmt.Errorf("websocket message rate and max rate violations cannot be negative")
+	}
+	if cfg.MessageRate > 0 && cfg.MessageBurst <= 0 {
+		return fmt.Errorf("websocket message burst must be positive when a message rate is set")
+	}
+	return nil
+}
+
 // Client represents a single WebSocket connection with user information
 type Client struct {
 	User   *model.User     // User information
 	Socket *websocket.Conn // WebSocket connection
 	Send   chan []byte     // Buffered channel for outgoing messages
-	Rooms  map[string]bool // Set of rooms this client has joined
+	Config ClientConfig    // Timing and size limits for this connection
+
+	rooms   map[string]bool // Set of rooms this client has joined
+	roomsMu sync.RWMutex    // guards rooms, which the manager changes while the client reads it
+
+	sendMu     sync.Mutex // guards sendClosed and closing Send
+	sendClosed bool       // Set once Send is closed; later frames are dropped
+
+	IPAddress string // Address the connection was opened from, recorded in activity logs
+	RequestID string // Correlation ID of the upgrade request, included in connection log lines
+
+	appearOffline atomic.Bool // Hides the user from online lists and presence events
+
+	presenceSubs map[string]bool // Set of usernames whose presence this client watches
+
+	limiter        *rate.Limiter // Throttles incoming frames; nil when unlimited
+	rateViolations int           // Consecutive frames dropped by the limiter; only touched by Read
+
+	done chan struct{} // Closed once Write has flushed the send queue and closed the socket
+}
+
+// InRoom reports whether this client has joined the room
+func (c *Client) InRoom(roomID string) bool {
+	c.roomsMu.RLock()
+	defer c.roomsMu.RUnlock()
+	return c.rooms[roomID]
+}
+
+// roomIDs returns the rooms this client has joined
+func (c *Client) roomIDs() []string {
+	c.roomsMu.RLock()
+	defer c.roomsMu.RUnlock()
+
+	ids := make([]string, 0, len(c.rooms))
+	for roomID := range c.rooms {
+		ids = append(ids, roomID)
+	}
+	return ids
+}
+
+// joinRoom and leaveRoom update the client's own view of its rooms; the manager's room index is
+// kept separately under manager.mu
+func (c *Client) joinRoom(roomID string) {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	if c.rooms == nil {
+		c.rooms = make(map[string]bool)
+	}
+	c.rooms[roomID] = true
+}
+
+func (c *Client) leaveRoom(roomID string) {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	delete(c.rooms, roomID)
+}
+
+// AppearsOnline reports whether other users may see this client as online
+func (c *Client) AppearsOnline() bool {
+	return !c.appearOffline.Load()
+}
+
+// NewClient creates a client for an upgraded connection using the given settings
+func NewClient(user *model.User, conn *websocket.Conn, cfg ClientConfig) *Client {
+	client := &Client{
+		User:   user,
+		Socket: conn,
+		Send:   make(chan []byte, cfg.SendBufferSize),
+		rooms:  make(map[string]bool),
+		Config: cfg,
+		done:   make(chan struct{}),
+	}
+	if cfg.MessageRate > 0 {
+		client.limiter = rate.NewLimiter(rate.Limit(cfg.MessageRate), cfg.MessageBurst)
+	}
+	client.appearOffline.Store(user.AppearOffline)
+	return client
 }
 
 // Read continuously listens for incoming messages from the client
@@ -41,13 +196,13 @@ func (c *Client) Read(clientsManager *ClientManager) {
 	}()
 
 	// Set read deadline and message size limit
-	c.Socket.SetReadLimit(maxMessageSize)
-	err := c.Socket.SetReadDeadline(time.Now().Add(pongWait))
+	c.Socket.SetReadLimit(int64(c.Config.MaxMessageSize * readLimitFactor))
+	err := c.Socket.SetReadDeadline(time.Now().Add(c.Config.PongWait))
 	if err != nil {
 		return
 	}
 	c.Socket.SetPongHandler(func(string) error {
-		err := c.Socket.SetReadDeadline(time.Now().Add(pongWait))
+		err := c.Socket.SetReadDeadline(time.Now().Add(c.Config.PongWait))
 		if err != nil {
 			return err
 		}
@@ -71,12 +226,18 @@ func (c *Client) Read(clientsManager *ClientManager) {
 
 // HandleMessage processes an incoming message based on its type
 func (c *Client) HandleMessage(messageData []byte, clientsManager *ClientManager) {
+	receivedAt := time.Now()
+	if !c.allowFrame(receivedAt) {
+		return
+	}
+
 	var incomingMsg IncomingMessage
 	if err := json.Unmarshal(messageData, &incomingMsg); err != nil {
 		Log.Error("Error unmarshaling message from user %s: %v", c.User.Username, err)
 		c.SendError("Invalid message format")
 		return
 	}
+	incomingMsg.receivedAt = receivedAt
 
 	Log.Info("Received message from %s: type=%s", c.User.Username, incomingMsg.Type)
 
@@ -89,30 +250,112 @@ func (c *Client) HandleMessage(messageData []byte, clientsManager *ClientManager
 		c.handleLeaveRoom(incomingMsg, clientsManager)
 	case "private_message":
 		c.handlePrivateMessage(incomingMsg, clientsManager)
+	case "mark_read":
+		c.handleMarkRead(incomingMsg, clientsManager)
 	case "typing":
 		c.handleTyping(incomingMsg, clientsManager)
+	case "add_reaction":
+		c.handleReaction(incomingMsg, clientsManager, true)
+	case "remove_reaction":
+		c.handleReaction(incomingMsg, clientsManager, false)
+	case "fetch_history":
+		c.handleFetchHistory(incomingMsg, clientsManager)
+	case "set_status":
+		c.handleSetStatus(incomingMsg, clientsManager)
+	case "subscribe_presence":
+		c.handleSubscribePresence(incomingMsg, clientsManager)
+	case "unsubscribe_presence":
+		c.handleUnsubscribePresence(incomingMsg, clientsManager)
 	case "ping":
 		c.handlePing()
+	case "heartbeat":
+		// Replies to our heartbeat only exist to generate traffic; nothing to do
 	default:
 		Log.Warn("Unknown message type '%s' from user %s", incomingMsg.Type, c.User.Username)
 		c.SendError("Unknown message type")
 	}
 }
 
+// allowFrame takes a token from the client's rate limiter. A limited frame is answered with a
+// rate_limited frame telling the client when to retry; sustained flooding closes the connection.
+func (c *Client) allowFrame(now time.Time) bool {
+	if c.limiter == nil {
+		return true
+	}
+	if c.limiter.AllowN(now, 1) {
+		c.rateViolations = 0
+		return true
+	}
+
+	c.rateViolations++
+	if c.Config.MaxRateViolations > 0 && c.rateViolations >= c.Config.MaxRateViolations {
+		Log.Warn("Closing connection of %s after %d rate-limited frames", c.User.Username, c.rateViolations)
+		closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+		_ = c.Socket.WriteControl(websocket.CloseMessage, closeMsg, now.Add(c.Config.WriteWait))
+		_ = c.Socket.Close()
+		return false
+	}
+
+	reservation := c.limiter.ReserveN(now, 1)
+	retryAfter := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+
+	c.SendMessage(&Message{
+		ID:        generateMessageID(),
+		Type:      "rate_limited",
+		Username:  "System",
+		Timestamp: now,
+		Data: map[string]interface{}{
+			"retry_after_ms": retryAfter.Milliseconds(),
+		},
+	})
+	return false
+}
+
 // handleChatMessage processes chat messages
 func (c *Client) handleChatMessage(msg IncomingMessage, clientsManager *ClientManager) {
-	if msg.Content == "" {
+	if msg.Content == "" && msg.AttachmentID == nil {
 		c.SendError("Message content cannot be empty")
 		return
 	}
 
+	if !c.checkContentSize(msg.Content) {
+		return
+	}
+
+	if msg.RoomID != "" && !c.checkRoomAccess(msg.RoomID, clientsManager) {
+		return
+	}
+
+	if msg.ParentID != nil && !c.checkReplyParent(*msg.ParentID, msg.RoomID, clientsManager) {
+		return
+	}
+
+	preSend := &PreSendMessage{Kind: "chat_message", Sender: c.User, RoomID: msg.RoomID, Content: msg.Content,
+		HasAttachment: msg.AttachmentID != nil}
+	if !c.runPreSendHooks(preSend, clientsManager) {
+		return
+	}
+
 	// Create chat message
 	chatMsg := &model.Message{
-		Content:   msg.Content,
+		Content:   preSend.Content,
 		UserID:    c.User.ID,
 		Username:  c.User.Username,
 		RoomID:    msg.RoomID,
+		ParentID:  msg.ParentID,
 		CreatedAt: time.Now(),
+
+		AttachmentID: msg.AttachmentID,
+	}
+	if err := clientsManager.AttachToMessage(chatMsg); err != nil {
+		if errors.Is(err, ErrInvalidAttachment) {
+			c.SendErrorCode("invalid_attachment", "Attachment not found in this room")
+			return
+		}
+		Log.Error("Failed to attach %s to message from %s: %v", *msg.AttachmentID, c.User.Username, err)
+		c.SendError("Failed to send message")
+		return
 	}
 
 	// Persist to DB
@@ -121,6 +364,9 @@ func (c *Client) handleChatMessage(msg IncomingMessage, clientsManager *ClientMa
 		c.SendError("Failed to send message")
 		return
 	}
+	if err := clientsManager.RoomRepo.TouchMembership(chatMsg.RoomID, c.User.ID); err != nil {
+		Log.Warn("Failed to record activity of %s in room %s: %v", c.User.Username, chatMsg.RoomID, err)
+	}
 
 	// Broadcast to room or general chat
 	broadcastMsg := BroadcastMessage{
@@ -131,14 +377,71 @@ func (c *Client) handleChatMessage(msg IncomingMessage, clientsManager *ClientMa
 			UserID:    chatMsg.UserID,
 			Username:  chatMsg.Username,
 			RoomID:    chatMsg.RoomID,
+			ParentID:  chatMsg.ParentID,
 			Timestamp: chatMsg.CreatedAt,
+			Data:      preSend.data(),
+
+			AttachmentURL: chatMsg.AttachmentURL,
 		},
 		RoomID:      msg.RoomID,
 		ExcludeUser: "",
 		MessageType: "broadcast_room",
 	}
 
-	clientsManager.Broadcast <- broadcastMsg
+	clientsManager.Publish(broadcastMsg)
+	clientsManager.NotifyMentions(chatMsg)
+	RecordActivity(clientsManager.ActivityRepo, c.User.ID, model.ActivitySendMessage,
+		fmt.Sprintf("message %d in room %s", chatMsg.ID, chatMsg.RoomID), c.IPAddress)
+
+	// Acknowledge to the sender with both timestamps so clients can tell
+	// network delay (received_at) apart from server processing (created_at -> timestamp)
+	ackMsg := &Message{
+		ID:        generateMessageID(),
+		Type:      "message_ack",
+		Username:  "System",
+		RoomID:    chatMsg.RoomID,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"message_id":  chatMsg.ID,
+			"received_at": msg.receivedAt,
+			"created_at":  chatMsg.CreatedAt,
+		},
+	}
+	c.SendMessage(ackMsg)
+}
+
+// checkReplyParent enforces the thread policy on a reply's parent, reporting violations to the sender
+func (c *Client) checkReplyParent(parentID uint, roomID string, clientsManager *ClientManager) bool {
+	err := ValidateReplyParent(clientsManager.MessageRepo, clientsManager.ThreadPolicy, parentID, roomID, 0)
+	if err == nil {
+		return true
+	}
+
+	if violation, ok := err.(*ThreadViolation); ok {
+		c.SendErrorCode(violation.Code, violation.Reason)
+		return false
+	}
+	Log.Error("Failed to validate reply parent %d for %s: %v", parentID, c.User.Username, err)
+	c.SendError("Failed to send message")
+	return false
+}
+
+// handleReaction adds or removes the client's reaction to a message; the room sees the new
+// counts through the reaction_updated broadcast
+func (c *Client) handleReaction(msg IncomingMessage, clientsManager *ClientManager, add bool) {
+	if msg.MessageID == 0 || msg.Emoji == "" {
+		c.SendError("Message ID and emoji are required")
+		return
+	}
+
+	if _, err := clientsManager.React(c.User.ID, msg.MessageID, msg.Emoji, add); err != nil {
+		if reactionErr, ok := err.(*ReactionError); ok {
+			c.SendErrorCode(reactionErr.Code, reactionErr.Reason)
+			return
+		}
+		Log.Error("Failed to update reaction of %s on message %d: %v", c.User.Username, msg.MessageID, err)
+		c.SendError("Failed to update reaction")
+	}
 }
 
 // handleJoinRoom processes room join requests
@@ -148,35 +451,92 @@ func (c *Client) handleJoinRoom(msg IncomingMessage, clientsManager *ClientManag
 		return
 	}
 
-	// Add client to room
-	if clientsManager.Rooms[msg.RoomID] == nil {
-		clientsManager.Rooms[msg.RoomID] = make(map[*Client]bool)
+	exists, err := clientsManager.RoomExists(msg.RoomID)
+	if err != nil {
+		Log.Error("Failed to look up room %s for user %s: %v", msg.RoomID, c.User.Username, err)
+		c.SendError("Failed to join room")
+		return
+	}
+	if !exists {
+		c.SendErrorCode("room_not_found", "Room "+msg.RoomID+" does not exist")
+		return
 	}
-	clientsManager.Rooms[msg.RoomID][c] = true
-	c.Rooms[msg.RoomID] = true
 
-	// Send confirmation to user
-	confirmMsg := &Message{
+	banned, err := clientsManager.RoomRepo.IsUserBanned(msg.RoomID, c.User.ID)
+	if err != nil {
+		Log.Error("Failed to check bans of room %s for user %s: %v", msg.RoomID, c.User.Username, err)
+		c.SendError("Failed to join room")
+		return
+	}
+	if banned {
+		c.SendErrorCode("banned_from_room", "You are banned from room "+msg.RoomID)
+		return
+	}
+
+	allowed, invited, err := clientsManager.checkPrivateRoomAccess(msg.RoomID, c.User.ID)
+	if err != nil {
+		Log.Error("Failed to check access of user %s to room %s: %v", c.User.Username, msg.RoomID, err)
+		c.SendError("Failed to join room")
+		return
+	}
+	if !allowed {
+		c.SendErrorCode("invite_required", "Room "+msg.RoomID+" is private; an invite is required to join")
+		return
+	}
+
+	if clientsManager.JoinLimit != nil {
+		if err := clientsManager.JoinLimit(msg.RoomID, c.User.ID); errors.Is(err, ErrRoomLimitReached) {
+			c.SendErrorCode("room_limit_reached", err.Error())
+			return
+		} else if err != nil {
+			Log.Error("Failed to check room limit of user %s: %v", c.User.Username, err)
+			c.SendError("Failed to join room")
+			return
+		}
+	}
+
+	// Persist membership so it survives reconnects and backs the membership checks
+	joined, err := clientsManager.RoomRepo.AddUserToRoom(msg.RoomID, c.User.ID, "member")
+	if err != nil {
+		Log.Error("Failed to persist membership of %s in room %s: %v", c.User.Username, msg.RoomID, err)
+		c.SendError("Failed to join room")
+		return
+	}
+	if joined {
+		clientsManager.AdjustMemberCount(msg.RoomID, 1)
+	}
+	if invited {
+		if err := clientsManager.RoomRepo.DeleteInvite(msg.RoomID, c.User.ID); err != nil {
+			Log.Error("Failed to use up invite of %s to room %s: %v", c.User.Username, msg.RoomID, err)
+		}
+	}
+
+	// Add client to room
+	clientsManager.AddClientToRoom(c, msg.RoomID)
+
+	// Send confirmation to user, with the custom emoji usable in the room
+	confirmMsg := (&Message{
 		ID:        generateMessageID(),
 		Type:      "room_joined",
-		Content:   "Successfully joined room",
 		RoomID:    msg.RoomID,
 		Username:  "System",
 		Timestamp: time.Now(),
+	}).localizable("room_joined", nil)
+	if emoji := clientsManager.roomEmoji(msg.RoomID); emoji != nil {
+		confirmMsg.Data = map[string]interface{}{"custom_emoji": emoji}
 	}
 
 	c.SendMessage(confirmMsg)
 
 	// Notify other room members
-	notifyMsg := &Message{
+	notifyMsg := (&Message{
 		ID:        generateMessageID(),
 		Type:      "user_joined",
-		Content:   c.User.Username + " joined the room",
 		UserID:    c.User.ID,
 		Username:  c.User.Username,
 		RoomID:    msg.RoomID,
 		Timestamp: time.Now(),
-	}
+	}).localizable("user_joined_room", map[string]string{"username": c.User.Username})
 
 	broadcastMsg := BroadcastMessage{
 		Message:     notifyMsg,
@@ -185,7 +545,8 @@ func (c *Client) handleJoinRoom(msg IncomingMessage, clientsManager *ClientManag
 		MessageType: "broadcast_room",
 	}
 
-	clientsManager.Broadcast <- broadcastMsg
+	clientsManager.Publish(broadcastMsg)
+	RecordActivity(clientsManager.ActivityRepo, c.User.ID, model.ActivityJoinRoom, "room "+msg.RoomID, c.IPAddress)
 
 	Log.Info("User %s joined room %s", c.User.Username, msg.RoomID)
 }
@@ -197,38 +558,40 @@ func (c *Client) handleLeaveRoom(msg IncomingMessage, clientsManager *ClientMana
 		return
 	}
 
-	// Remove client from room
-	if clientsManager.Rooms[msg.RoomID] != nil {
-		delete(clientsManager.Rooms[msg.RoomID], c)
-		if len(clientsManager.Rooms[msg.RoomID]) == 0 {
-			delete(clientsManager.Rooms, msg.RoomID)
-		}
+	left, err := clientsManager.RoomRepo.RemoveUserFromRoom(msg.RoomID, c.User.ID)
+	if err != nil {
+		Log.Error("Failed to persist departure of %s from room %s: %v", c.User.Username, msg.RoomID, err)
+		c.SendError("Failed to leave room")
+		return
 	}
-	delete(c.Rooms, msg.RoomID)
+	if left {
+		clientsManager.AdjustMemberCount(msg.RoomID, -1)
+	}
+
+	// Remove client from room
+	clientsManager.RemoveClientFromRoom(c, msg.RoomID)
 
 	// Send confirmation to user
-	confirmMsg := &Message{
+	confirmMsg := (&Message{
 		ID:        generateMessageID(),
 		Type:      "room_left",
-		Content:   "Successfully left room",
 		RoomID:    msg.RoomID,
 		Username:  "System",
 		Timestamp: time.Now(),
-	}
+	}).localizable("room_left", nil)
 
 	c.SendMessage(confirmMsg)
 
 	// Notify other room members
 	if clientsManager.Rooms[msg.RoomID] != nil && len(clientsManager.Rooms[msg.RoomID]) > 0 {
-		notifyMsg := &Message{
+		notifyMsg := (&Message{
 			ID:        generateMessageID(),
 			Type:      "user_left",
-			Content:   c.User.Username + " left the room",
 			UserID:    c.User.ID,
 			Username:  c.User.Username,
 			RoomID:    msg.RoomID,
 			Timestamp: time.Now(),
-		}
+		}).localizable("user_left_room", map[string]string{"username": c.User.Username})
 
 		broadcastMsg := BroadcastMessage{
 			Message:     notifyMsg,
@@ -237,8 +600,9 @@ func (c *Client) handleLeaveRoom(msg IncomingMessage, clientsManager *ClientMana
 			MessageType: "broadcast_room",
 		}
 
-		clientsManager.Broadcast <- broadcastMsg
+		clientsManager.Publish(broadcastMsg)
 	}
+	RecordActivity(clientsManager.ActivityRepo, c.User.ID, model.ActivityLeaveRoom, "room "+msg.RoomID, c.IPAddress)
 
 	Log.Info("User %s left room %s", c.User.Username, msg.RoomID)
 }
@@ -257,6 +621,10 @@ func (c *Client) handlePrivateMessage(msg IncomingMessage, clientsManager *Clien
 		return
 	}
 
+	if !c.checkContentSize(msg.Content) {
+		return
+	}
+
 	recipient, err := clientsManager.UserRepo.GetUserByUsername(msg.RecipientUsername)
 	if err != nil || recipient == nil {
 		Log.Error("Failed to get user %s", msg.RecipientUsername)
@@ -264,60 +632,245 @@ func (c *Client) handlePrivateMessage(msg IncomingMessage, clientsManager *Clien
 		return
 	}
 
+	preSend := &PreSendMessage{Kind: "private_message", Sender: c.User, RecipientUsername: recipient.Username, Content: msg.Content}
+	if !c.runPreSendHooks(preSend, clientsManager) {
+		return
+	}
+
 	privateMsg := &model.PrivateMessage{
-		Content:     msg.Content,
+		Content:     preSend.Content,
 		Type:        "text",
 		SenderID:    c.User.ID,
 		RecipientID: recipient.ID,
 		CreatedAt:   time.Now(),
 	}
 
-	if err := clientsManager.MessageRepo.CreatePrivateMessage(privateMsg); err != nil {
+	if err := clientsManager.PrivateMessageRepo.CreatePrivateMessage(privateMsg); err != nil {
 		Log.Error("Failed to save private message from %s: %v", c.User.Username, err)
 		c.SendError("Failed to send message")
 		return
 	}
 
 	wsMsg := &Message{
-		ID:        fmt.Sprintf("%d", privateMsg.ID),
-		Type:      "private_message",
-		Content:   privateMsg.Content,
-		UserID:    privateMsg.SenderID,
-		Username:  c.User.Username,
-		Timestamp: privateMsg.CreatedAt,
+		ID:                fmt.Sprintf("%d", privateMsg.ID),
+		Type:              "private_message",
+		Content:           privateMsg.Content,
+		UserID:            privateMsg.SenderID,
+		Username:          c.User.Username,
+		RecipientUsername: recipient.Username,
+		Timestamp:         privateMsg.CreatedAt,
+		Data:              preSend.data(),
 	}
 
 	// Send to recipient
-	clientsManager.Broadcast <- BroadcastMessage{
+	clientsManager.Publish(BroadcastMessage{
 		Message:        wsMsg,
 		TargetUsername: msg.RecipientUsername,
 		MessageType:    "private_message",
-	}
+	})
 
 	// Send copy to sender
 	c.SendMessage(wsMsg)
+
+	// The message waits for an offline recipient; the notification tells them who wrote
+	if !clientsManager.IsUserOnline(recipient.Username) {
+		clientsManager.Notify(recipient.Username, model.Notification{
+			UserID:  recipient.ID,
+			Type:    model.NotificationPrivateMessage,
+			ActorID: c.User.ID,
+			Content: privateMsg.Content,
+		}, map[string]interface{}{
+			"private_message_id": privateMsg.ID,
+			"username":           c.User.Username,
+		})
+	}
 }
 
-// handleTyping processes typing indicators
-func (c *Client) handleTyping(msg IncomingMessage, clientsManager *ClientManager) {
-	typingMsg := &Message{
+// handleMarkRead marks a private message addressed to this user as read and notifies the sender
+func (c *Client) handleMarkRead(msg IncomingMessage, clientsManager *ClientManager) {
+	if msg.MessageID == 0 {
+		c.SendError("Message ID cannot be empty")
+		return
+	}
+
+	pm, err := clientsManager.PrivateMessageRepo.GetPrivateMessageByID(msg.MessageID)
+	if err != nil {
+		Log.Error("Failed to load private message %d for %s: %v", msg.MessageID, c.User.Username, err)
+		c.SendError("Failed to mark message as read")
+		return
+	}
+	if pm == nil {
+		c.SendErrorCode("message_not_found", "Message not found")
+		return
+	}
+	if pm.RecipientID != c.User.ID {
+		c.SendErrorCode("not_recipient", "You can only mark messages addressed to you as read")
+		return
+	}
+
+	readAt, err := clientsManager.PrivateMessageRepo.MarkMessageRead(pm.ID)
+	if err != nil {
+		Log.Error("Failed to mark private message %d as read: %v", pm.ID, err)
+		c.SendError("Failed to mark message as read")
+		return
+	}
+
+	clientsManager.NotifyReadReceipt(pm, c.User.Username, readAt)
+}
+
+// historyFrameType is the frame type a stored message is replayed as in a history frame. Text goes
+// out as chat_message, as it does live; image, file and system messages keep their stored type.
+func historyFrameType(storedType string) string {
+	if storedType == "" || storedType == "text" {
+		return "chat_message"
+	}
+	return storedType
+}
+
+// handleFetchHistory sends a page of a room's history, newest first, in a history frame
+// carrying the ChatHistoryResponse fields. Only members of the room may read it.
+func (c *Client) handleFetchHistory(msg IncomingMessage, clientsManager *ClientManager) {
+	if msg.RoomID == "" {
+		c.SendError("Room ID cannot be empty")
+		return
+	}
+
+	limit := clientsManager.Pagination.PageLimit(msg.Limit)
+
+	var before *time.Time
+	if msg.Before != "" {
+		parsed, err := model.ParseTimestamp(msg.Before)
+		if err != nil {
+			c.SendErrorCode("invalid_before", "Invalid before timestamp")
+			return
+		}
+		before = &parsed
+	}
+
+	isMember, err := clientsManager.RoomRepo.IsUserInRoom(msg.RoomID, c.User.ID)
+	if err != nil {
+		Log.Error("Failed to check membership of %s in room %s: %v", c.User.Username, msg.RoomID, err)
+		c.SendError("Failed to fetch history")
+		return
+	}
+	if !isMember {
+		c.SendErrorCode("not_a_member", "You are not a member of room "+msg.RoomID)
+		return
+	}
+	// Reading counts as activity, so members who only read are not auto-removed
+	if err := clientsManager.RoomRepo.TouchMembership(msg.RoomID, c.User.ID); err != nil {
+		Log.Warn("Failed to record activity of %s in room %s: %v", c.User.Username, msg.RoomID, err)
+	}
+
+	// One extra row tells whether older messages remain
+	stored, err := clientsManager.MessageRepo.GetMessagesByRoomID(msg.RoomID, limit+1, 0, before)
+	if err != nil {
+		Log.Error("Failed to load history of room %s for %s: %v", msg.RoomID, c.User.Username, err)
+		c.SendError("Failed to fetch history")
+		return
+	}
+
+	history := ChatHistoryResponse{Messages: make([]Message, 0, limit)}
+	if len(stored) > limit {
+		stored = stored[:limit]
+		history.HasMore = true
+	}
+	for _, message := range stored {
+		history.Messages = append(history.Messages, Message{
+			ID:        fmt.Sprintf("%d", message.ID),
+			Type:      historyFrameType(message.Type),
+			Content:   message.Content,
+			UserID:    message.UserID,
+			Username:  message.Username,
+			RoomID:    message.RoomID,
+			ParentID:  message.ParentID,
+			Timestamp: message.CreatedAt,
+
+			AttachmentURL: message.AttachmentURL,
+		})
+	}
+
+	c.SendMessage(&Message{
 		ID:        generateMessageID(),
-		Type:      "typing",
-		UserID:    c.User.ID,
-		Username:  c.User.Username,
+		Type:      MessageTypeHistory,
+		Username:  "System",
 		RoomID:    msg.RoomID,
-		Content:   msg.Content, // "start" or "stop"
 		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"messages": history.Messages,
+			"has_more": history.HasMore,
+		},
+	})
+}
+
+// handleTyping processes typing indicators; the manager throttles and expires them
+func (c *Client) handleTyping(msg IncomingMessage, clientsManager *ClientManager) {
+	// Typing frames are too frequent to answer with errors; silently drop them for rooms the client has not joined
+	if msg.RoomID != "" && !c.InRoom(msg.RoomID) {
+		return
 	}
 
-	broadcastMsg := BroadcastMessage{
-		Message:     typingMsg,
-		RoomID:      msg.RoomID,
-		ExcludeUser: c.User.Username,
-		MessageType: "broadcast_room",
+	switch msg.Content {
+	case "start":
+		clientsManager.Typing(c.User.ID, c.User.Username, msg.RoomID, true)
+	case "stop":
+		clientsManager.Typing(c.User.ID, c.User.Username, msg.RoomID, false)
+	}
+}
+
+// handleSetStatus changes the user's presence status (online, away, busy or offline)
+func (c *Client) handleSetStatus(msg IncomingMessage, clientsManager *ClientManager) {
+	if !model.IsValidStatus(msg.Content) {
+		c.SendError("Status must be online, away, busy or offline")
+		return
+	}
+
+	if err := clientsManager.SetStatus(c, msg.Content); err != nil {
+		Log.Error("Failed to set status of %s: %v", c.User.Username, err)
+		c.SendError("Failed to update status")
+	}
+}
+
+// handleSubscribePresence registers interest in the presence of specific users
+func (c *Client) handleSubscribePresence(msg IncomingMessage, clientsManager *ClientManager) {
+	if len(msg.Usernames) == 0 {
+		c.SendError("Usernames cannot be empty")
+		return
+	}
+
+	statuses, err := clientsManager.SubscribePresence(c, msg.Usernames)
+	if err != nil {
+		Log.Warn("Presence subscription rejected for user %s: %v", c.User.Username, err)
+		c.SendError(err.Error())
+		return
 	}
 
-	clientsManager.Broadcast <- broadcastMsg
+	confirmMsg := &Message{
+		ID:        generateMessageID(),
+		Type:      "presence_subscribed",
+		Username:  "System",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"presence": statuses,
+		},
+	}
+	c.SendMessage(confirmMsg)
+}
+
+// handleUnsubscribePresence stops presence updates for specific users, or all if none are given
+func (c *Client) handleUnsubscribePresence(msg IncomingMessage, clientsManager *ClientManager) {
+	clientsManager.UnsubscribePresence(c, msg.Usernames)
+
+	confirmMsg := &Message{
+		ID:        generateMessageID(),
+		Type:      "presence_unsubscribed",
+		Username:  "System",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"usernames": msg.Usernames,
+		},
+	}
+	c.SendMessage(confirmMsg)
 }
 
 // handlePing responds to ping messages
@@ -333,16 +886,43 @@ func (c *Client) handlePing() {
 
 // SendMessage sends a message to this client
 func (c *Client) SendMessage(msg *Message) {
-	data, err := json.Marshal(msg)
+	data, err := json.Marshal(msg.localize(c.User.Locale))
 	if err != nil {
 		Log.Error("Error marshaling message for user %s: %v", c.User.Username, err)
 		return
 	}
 
+	if !c.enqueue(data) {
+		Log.Warn("Send channel full for user %s, closing connection", c.User.Username)
+		c.closeSend()
+	}
+}
+
+// enqueue queues an encoded frame without blocking. It reports false when the queue is full;
+// frames for a closed queue are dropped and reported as queued.
+func (c *Client) enqueue(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.sendClosed {
+		return true
+	}
 	select {
 	case c.Send <- data:
+		return true
 	default:
-		Log.Warn("Send channel full for user %s, closing connection", c.User.Username)
+		return false
+	}
+}
+
+// closeSend closes the send queue once, which makes Write flush it and send a close frame.
+// Goroutines still producing frames for the client are then safely ignored.
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.sendClosed {
+		c.sendClosed = true
 		close(c.Send)
 	}
 }
@@ -359,27 +939,116 @@ func (c *Client) SendError(errorMsg string) {
 	c.SendMessage(msg)
 }
 
-// Close unregisters the client and closes its WebSocket connection
+// SendErrorCode sends an error message carrying a machine-readable code
+func (c *Client) SendErrorCode(code, errorMsg string) {
+	msg := &Message{
+		ID:        generateMessageID(),
+		Type:      "error",
+		Content:   errorMsg,
+		Username:  "System",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"code": code,
+		},
+	}
+	c.SendMessage(msg)
+}
+
+// checkContentSize rejects oversized content with an error frame while keeping the connection open
+func (c *Client) checkContentSize(content string) bool {
+	if len(content) > c.Config.MaxMessageSize {
+		c.SendErrorCode("message_too_large",
+			fmt.Sprintf("Message exceeds the maximum size of %d bytes", c.Config.MaxMessageSize))
+		return false
+	}
+	return true
+}
+
+// runPreSendHooks applies the manager's pre-send hooks, reporting a rejection to the sender
+func (c *Client) runPreSendHooks(msg *PreSendMessage, clientsManager *ClientManager) bool {
+	if err := clientsManager.RunPreSendHooks(msg); err != nil {
+		var rejection *HookRejection
+		if !errors.As(err, &rejection) {
+			Log.Error("Pre-send hooks failed for message from %s: %v", c.User.Username, err)
+			c.SendError("Failed to send message")
+			return false
+		}
+		Log.Info("Message from %s rejected by %s: %s", c.User.Username, rejection.Hook, rejection.Reason)
+		c.SendErrorCode(rejection.Code, rejection.Reason)
+		return false
+	}
+	return true
+}
+
+// checkRoomAccess verifies that this client has joined the room, and that the room exists when
+// unknown rooms are rejected, replying with a coded error frame when a check fails
+func (c *Client) checkRoomAccess(roomID string, clientsManager *ClientManager) bool {
+	if clientsManager.RejectUnknownRooms {
+		exists, err := clientsManager.RoomExists(roomID)
+		if err != nil {
+			Log.Error("Failed to look up room %s for user %s: %v", roomID, c.User.Username, err)
+			c.SendError("Failed to send message")
+			return false
+		}
+		if !exists {
+			c.SendErrorCode("room_not_found", "Room "+roomID+" does not exist")
+			return false
+		}
+	}
+
+	if !c.InRoom(roomID) {
+		// The live view may lag behind the database (e.g. a join made over REST); trust the persisted membership
+		isMember, err := clientsManager.RoomRepo.IsUserInRoom(roomID, c.User.ID)
+		if err != nil {
+			Log.Error("Failed to check membership of %s in room %s: %v", c.User.Username, roomID, err)
+			c.SendError("Failed to send message")
+			return false
+		}
+		if !isMember {
+			Log.Warn("User %s tried to send to room %s without being a member", c.User.Username, roomID)
+			c.SendErrorCode("not_a_member", "You are not a member of room "+roomID)
+			return false
+		}
+		clientsManager.AddClientToRoom(c, roomID)
+	}
+
+	return true
+}
+
+// Close unregisters the client and closes its WebSocket connection. After the manager has shut
+// down there is nothing left to unregister from.
 func (c *Client) Close(clientsManager *ClientManager) {
-	Log.Info("Closing connection for user: %s", c.User.Username)
-	clientsManager.Unregister <- c
+	Log.Info("Closing connection for user: %s (request %s)", c.User.Username, c.RequestID)
+	select {
+	case clientsManager.Unregister <- c:
+	case <-clientsManager.stoppedChan():
+	}
 }
 
 // Write listens for outgoing messages and sends them to the WebSocket
 func (c *Client) Write() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.Config.PingPeriod)
+
+	// A nil channel never fires, which leaves heartbeats off when no interval is set
+	var heartbeat <-chan time.Time
+	if c.Config.HeartbeatInterval > 0 {
+		heartbeatTicker := time.NewTicker(c.Config.HeartbeatInterval)
+		defer heartbeatTicker.Stop()
+		heartbeat = heartbeatTicker.C
+	}
+
 	defer func() {
 		ticker.Stop()
-		err := c.Socket.Close()
-		if err != nil {
-			return
+		_ = c.Socket.Close()
+		if c.done != nil {
+			close(c.done)
 		}
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			err := c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.Socket.SetWriteDeadline(time.Now().Add(c.Config.WriteWait))
 			if err != nil {
 				return
 			}
@@ -397,7 +1066,7 @@ func (c *Client) Write() {
 			}
 
 		case <-ticker.C:
-			err := c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.Socket.SetWriteDeadline(time.Now().Add(c.Config.WriteWait))
 			if err != nil {
 				return
 			}
@@ -405,6 +1074,24 @@ func (c *Client) Write() {
 				Log.Error("Ping error for user %s: %v", c.User.Username, err)
 				return
 			}
+
+		case <-heartbeat:
+			data, err := json.Marshal(&Message{
+				ID:        generateMessageID(),
+				Type:      "heartbeat",
+				Username:  "System",
+				Timestamp: time.Now(),
+			})
+			if err != nil {
+				continue
+			}
+			if err := c.Socket.SetWriteDeadline(time.Now().Add(c.Config.WriteWait)); err != nil {
+				return
+			}
+			if err := c.Socket.WriteMessage(websocket.TextMessage, data); err != nil {
+				Log.Error("Heartbeat error for user %s: %v", c.User.Username, err)
+				return
+			}
 		}
 	}
 }
@@ -1,9 +1,18 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"live-chatter/internal/config"
 	"live-chatter/internal/repository"
+	"live-chatter/pkg/i18n"
+	"live-chatter/pkg/metrics"
+	"live-chatter/pkg/model"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	Log "live-chatter/pkg/logger"
@@ -20,9 +29,67 @@ type ClientManager struct {
 	UserClients map[string]*Client          // Map of usernames to clients (for private messages)
 	mu          sync.RWMutex                // for thread safety
 
-	RoomRepo    repository.RoomRepository
-	MessageRepo repository.MessageRepository
-	UserRepo    repository.UserRepository
+	lifecycleOnce sync.Once
+	quit          chan struct{} // Closed by Shutdown to stop the Start loop
+	stopped       chan struct{} // Closed by the Start loop once every client has been closed
+	quitOnce      sync.Once
+
+	presenceSubscribers map[string]map[*Client]bool // Map of watched usernames to subscribed clients
+	presenceMu          sync.Mutex                  // guards presenceSubscribers and Client.presenceSubs
+
+	ShedHighWaterMark int          // Queue length above which low-priority broadcasts are dropped (0 disables)
+	droppedBroadcasts atomic.Int64 // Number of broadcasts shed under load
+	routedBroadcasts  atomic.Int64 // Number of broadcasts delivered to all clients or a room
+
+	messagesTotal *metrics.CounterVec // Set by RegisterMetrics
+	fanoutSeconds *metrics.Histogram
+
+	preSendHooks []PreSendHook // Run in order on every chat message and DM before it is stored
+	ThreadPolicy ThreadPolicy  // Rules a reply's parent must satisfy
+
+	Pagination config.PaginationConfig // Page sizes for fetch_history, the same as the REST history endpoints'
+
+	MemberCountEvents   bool          // Broadcast member_count_changed when a room's membership changes
+	MemberCountCoalesce time.Duration // Window over which rapid membership changes are merged into one event
+	memberCounts        map[string]int
+	memberCountPending  map[string]bool
+	memberCountMu       sync.Mutex // guards memberCounts and memberCountPending
+
+	TypingThrottle time.Duration // Minimum gap between typing start broadcasts per user and room
+	TypingTimeout  time.Duration // Silence after which a typist is reported as stopped
+	typists        map[typingKey]*typingState
+	typingMu       sync.Mutex // guards typists
+
+	JoinLimit          func(roomID string, userID uint) error // Refuses a membership over the room limit; set from the chat service
+	RejectUnknownRooms bool                                   // Tell senders when a room does not exist rather than that they are not a member
+
+	Backplane Backplane // Relays receipts to other instances; nil when running alone
+
+	RoomRepo           repository.RoomRepository
+	MessageRepo        repository.MessageRepository
+	UserRepo           repository.UserRepository
+	PrivateMessageRepo repository.PrivateMessageRepository
+	ActivityRepo       repository.ActivityLogRepository
+	ReactionRepo       repository.ReactionRepository
+	EmojiRepo          repository.EmojiRepository
+	NotificationRepo   repository.NotificationRepository
+	AttachmentRepo     repository.AttachmentRepository
+}
+
+// maxPresenceSubscriptions caps how many users a single client may watch
+const maxPresenceSubscriptions = 200
+
+// DefaultBroadcastQueueSize is the Broadcast channel capacity used when none is configured
+const DefaultBroadcastQueueSize = 1024
+
+// ErrRoomLimitReached is returned by JoinLimit when a user already belongs to the maximum number of rooms
+var ErrRoomLimitReached = errors.New("room limit reached; leave a room before joining another")
+
+// sheddableMessageTypes are low-priority events that may be dropped when the broadcast queue backs up
+var sheddableMessageTypes = map[string]bool{
+	"typing":          true,
+	"presence_update": true,
+	"online_users":    true,
 }
 
 // BroadcastMessage represents different types of broadcast operations
@@ -31,100 +98,256 @@ type BroadcastMessage struct {
 	RoomID         string   `json:"room_id,omitempty"`
 	TargetUsername string   `json:"target_username,omitempty"`
 	ExcludeUser    string   `json:"exclude_user,omitempty"`
-	MessageType    string   `json:"message_type"` // "broadcast_all", "broadcast_room", "private_message"
+	MessageType    string   `json:"message_type"` // "broadcast_all", "broadcast_room", "private_message", "direct_message"
+	Relayed        bool     `json:"-"`            // Received from another instance over the backplane
 }
 
 // Start runs the client manager in a separate goroutine.
 // It continuously listens on the Register, Unregister, and Broadcast channels.
 func (manager *ClientManager) Start() {
 	Log.Info("Client manager started")
+	manager.initLifecycle()
 
 	for {
 		select {
+		case <-manager.quit:
+			manager.closeAllClients()
+			close(manager.stopped)
+			Log.Info("Client manager stopped")
+			return
+
 		case client := <-manager.Register:
 			manager.registerClient(client)
 
+		// Both may remove clients that stopped reading, so they hold the lock that readers
+		// of the client maps such as IsUserOnline take
 		case client := <-manager.Unregister:
+			manager.mu.Lock()
 			manager.unregisterClient(client)
+			manager.mu.Unlock()
 
 		case broadcastMsg := <-manager.Broadcast:
+			manager.mu.Lock()
 			manager.handleBroadcast(broadcastMsg)
+			manager.mu.Unlock()
 		}
 	}
 }
 
-// registerClient adds a new client to the manager
-func (manager *ClientManager) registerClient(client *Client) {
+func (manager *ClientManager) initLifecycle() {
+	manager.lifecycleOnce.Do(func() {
+		manager.quit = make(chan struct{})
+		manager.stopped = make(chan struct{})
+	})
+}
+
+// stoppedChan returns a channel that is closed once the manager has shut down
+func (manager *ClientManager) stoppedChan() <-chan struct{} {
+	manager.initLifecycle()
+	return manager.stopped
+}
+
+// RegisterClient hands a new connection to the manager loop. It reports false if the manager
+// has shut down, in which case the caller must close the connection itself.
+func (manager *ClientManager) RegisterClient(client *Client) bool {
+	select {
+	case manager.Register <- client:
+		return true
+	case <-manager.stoppedChan():
+		return false
+	}
+}
+
+// Shutdown stops the manager loop and closes every live connection. Each client's queued frames
+// are flushed before it receives a close frame. Shutdown waits for that to finish or for ctx to
+// expire, whichever comes first; it must only be called once Start is running.
+func (manager *ClientManager) Shutdown(ctx context.Context) error {
+	manager.initLifecycle()
+
+	manager.mu.RLock()
+	clients := make([]*Client, 0, len(manager.Clients))
+	for client := range manager.Clients {
+		clients = append(clients, client)
+	}
+	manager.mu.RUnlock()
+
+	manager.quitOnce.Do(func() { close(manager.quit) })
+
+	select {
+	case <-manager.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, client := range clients {
+		if client.done == nil {
+			continue
+		}
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	Log.Info("Closed %d WebSocket connections", len(clients))
+	return nil
+}
+
+// closeAllClients closes every client's send queue, which makes its writer flush the queue and
+// send a close frame. Read goroutines still handling a frame may keep producing replies; those
+// are dropped by the closed queue. Nobody is told about the departures since everyone is leaving.
+func (manager *ClientManager) closeAllClients() {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	if existingClient, exists := manager.UserClients[client.User.Username]; exists {
-		Log.Info("User %s reconnecting, closing old connection", client.User.Username)
-		manager.forceDisconnectClient(existingClient)
+	for client := range manager.Clients {
+		client.closeSend()
+		manager.removePresenceSubscriptions(client)
 	}
+	manager.Clients = make(map[*Client]bool)
+	manager.UserClients = make(map[string]*Client)
+	manager.Rooms = make(map[string]map[*Client]bool)
+}
 
-	manager.Clients[client] = true
-	manager.UserClients[client.User.Username] = client
+// registerClient adds a new client to the manager. The database is read and written before the
+// lock is taken so that readers of the client maps are not held up by it.
+func (manager *ClientManager) registerClient(client *Client) {
+	// Users appearing offline stay offline in the stored status too, which is what lists built
+	// from the database show
+	status := "online"
+	if !client.AppearsOnline() {
+		status = "offline"
+	}
+	if err := manager.UserRepo.UpdateUserStatus(client.User.ID, status); err != nil {
+		Log.Error("Failed to mark user %s %s: %v", client.User.Username, status, err)
+	}
 
 	dbRooms, err := manager.RoomRepo.GetUserRooms(client.User.ID)
 	if err != nil {
 		Log.Error("Failed to load rooms for user %s: %v", client.User.Username, err)
-	} else {
-		for _, room := range dbRooms {
-			if manager.Rooms[room.ID] == nil {
-				manager.Rooms[room.ID] = make(map[*Client]bool)
-			}
-			manager.Rooms[room.ID][client] = true
-			if client.Rooms == nil {
-				client.Rooms = make(map[string]bool)
-			}
-			client.Rooms[room.ID] = true
-			Log.Debug("Restored user %s to room %s from DB", client.User.Username, room.ID)
+	}
+	unread := manager.loadUnreadPrivateMessages(client)
+	emoji := manager.loadCustomEmoji(dbRooms)
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	// The new connection takes over the user's entry first, so closing the old one below is not
+	// mistaken for the user going offline
+	existingClient, exists := manager.UserClients[client.User.Username]
+	manager.Clients[client] = true
+	manager.UserClients[client.User.Username] = client
+	if exists {
+		Log.Info("User %s reconnecting, closing old connection", client.User.Username)
+		manager.forceDisconnectClient(existingClient)
+	}
+
+	for _, room := range dbRooms {
+		if manager.Rooms[room.ID] == nil {
+			manager.Rooms[room.ID] = make(map[*Client]bool)
 		}
+		manager.Rooms[room.ID][client] = true
+		client.joinRoom(room.ID)
+		Log.Debug("Restored user %s to room %s from DB", client.User.Username, room.ID)
 	}
 
 	Log.Info("User %s connected (Total connections: %d)",
 		client.User.Username, len(manager.Clients))
 
 	// Send welcome message to the new client
-	welcomeMsg := &Message{
+	welcomeMsg := (&Message{
 		ID:        generateMessageID(),
 		Type:      "system",
-		Content:   "Welcome to Chatter! You are now connected.",
 		Username:  "System",
 		Timestamp: time.Now(),
-	}
+	}).localizable("welcome", nil)
 	client.SendMessage(welcomeMsg)
+	manager.sendCapabilities(client, emoji)
 
 	// Notify other users about the new connection
-	notificationMsg := &Message{
+	notificationMsg := (&Message{
 		ID:        generateMessageID(),
 		Type:      "system",
-		Content:   client.User.Username + " joined the chat",
 		UserID:    client.User.ID,
 		Username:  client.User.Username,
 		Timestamp: time.Now(),
-	}
+	}).localizable("user_joined_chat", map[string]string{"username": client.User.Username})
 
-	// Broadcast to all other clients
-	manager.broadcastToAll(notificationMsg, client.User.Username)
+	// Users appearing offline connect silently
+	if client.AppearsOnline() {
+		// Broadcast to all other clients
+		manager.broadcastToAll(notificationMsg, client.User.Username)
+
+		// Notify clients watching this user's presence
+		manager.notifyPresenceSubscribers(client.User.Username, "online")
+	}
 
 	// Send current online users list to the new client
 	manager.sendOnlineUsersList(client)
+
+	// Deliver private messages that arrived while the user was offline
+	manager.deliverUnreadPrivateMessages(client, unread)
+}
+
+// loadUnreadPrivateMessages fetches the private messages waiting for a connecting client
+func (manager *ClientManager) loadUnreadPrivateMessages(client *Client) []model.PrivateMessage {
+	if manager.PrivateMessageRepo == nil {
+		return nil
+	}
+
+	unread, err := manager.PrivateMessageRepo.GetUnreadMessages(client.User.ID)
+	if err != nil {
+		Log.Error("Failed to load unread private messages for %s: %v", client.User.Username, err)
+		return nil
+	}
+	return unread
+}
+
+// deliverUnreadPrivateMessages pushes the unread private messages to a freshly connected client.
+// Senders get a delivery receipt only the first time a message is delivered, not on every
+// reconnect until it is read.
+func (manager *ClientManager) deliverUnreadPrivateMessages(client *Client, unread []model.PrivateMessage) {
+	deliveredAt := time.Now()
+	var firstDelivered []uint
+	for _, pm := range unread {
+		client.SendMessage(&Message{
+			ID:                fmt.Sprintf("%d", pm.ID),
+			Type:              "private_message",
+			Content:           pm.Content,
+			UserID:            pm.SenderID,
+			Username:          pm.Sender.Username,
+			RecipientUsername: client.User.Username,
+			Timestamp:         pm.CreatedAt,
+		})
+		if pm.DeliveredAt == nil {
+			firstDelivered = append(firstDelivered, pm.ID)
+			manager.sendDeliveryReceipt(pm.ID, pm.Sender.Username, client, deliveredAt)
+		}
+	}
+	manager.markDelivered(firstDelivered, deliveredAt)
+
+	if len(unread) > 0 {
+		Log.Debug("Delivered %d unread private messages to %s", len(unread), client.User.Username)
+	}
 }
 
 // unregisterClient removes a client from the manager
 func (manager *ClientManager) unregisterClient(client *Client) {
 	if _, ok := manager.Clients[client]; ok {
 		// Close the client's send channel
-		close(client.Send)
+		client.closeSend()
 
-		// Remove from all data structures
+		// Remove from all data structures. A reconnect replaces the user's entry before the old
+		// connection is unregistered, and that newer connection must keep it.
 		delete(manager.Clients, client)
-		delete(manager.UserClients, client.User.Username)
+		current := manager.UserClients[client.User.Username] == client
+		if current {
+			delete(manager.UserClients, client.User.Username)
+		}
 
 		// Remove from all rooms
-		for roomID := range client.Rooms {
+		for _, roomID := range client.roomIDs() {
 			if manager.Rooms[roomID] != nil {
 				delete(manager.Rooms[roomID], client)
 				if len(manager.Rooms[roomID]) == 0 {
@@ -136,18 +359,36 @@ func (manager *ClientManager) unregisterClient(client *Client) {
 		Log.Debug("User %s disconnected (Total connections: %d)",
 			client.User.Username, len(manager.Clients))
 
+		// The user is still connected elsewhere, so they have not gone offline
+		if !current {
+			manager.removePresenceSubscriptions(client)
+			return
+		}
+
+		if err := manager.UserRepo.UpdateUserStatus(client.User.ID, "offline"); err != nil {
+			Log.Error("Failed to mark user %s offline: %v", client.User.Username, err)
+		}
+
 		// Notify other users about the disconnection
-		notificationMsg := &Message{
+		notificationMsg := (&Message{
 			ID:        generateMessageID(),
 			Type:      "system",
-			Content:   client.User.Username + " left the chat",
 			UserID:    client.User.ID,
 			Username:  client.User.Username,
 			Timestamp: time.Now(),
+		}).localizable("user_left_chat", map[string]string{"username": client.User.Username})
+
+		// Clients that drop mid-sentence never send their stop
+		for _, roomID := range manager.clearTyping(client.User.ID) {
+			manager.broadcastToRoom(typingMessage(client.User.ID, client.User.Username, roomID, "stop"), roomID, client.User.Username)
 		}
 
-		// Broadcast to all other clients
-		manager.broadcastToAll(notificationMsg, client.User.Username)
+		manager.removePresenceSubscriptions(client)
+		if client.AppearsOnline() {
+			// Broadcast to all other clients
+			manager.broadcastToAll(notificationMsg, client.User.Username)
+			manager.notifyPresenceSubscribers(client.User.Username, "offline")
+		}
 	}
 }
 
@@ -163,8 +404,53 @@ func (manager *ClientManager) forceDisconnectClient(client *Client) {
 	manager.unregisterClient(client)
 }
 
+// DisconnectUser closes the user's live connection, if any. The client's read loop then
+// unregisters it through the manager as for any other disconnect.
+func (manager *ClientManager) DisconnectUser(username string) {
+	manager.mu.RLock()
+	client, exists := manager.UserClients[username]
+	manager.mu.RUnlock()
+
+	if exists && client.Socket != nil {
+		if err := client.Socket.Close(); err != nil {
+			Log.Error("Error closing socket of %s: %v", username, err)
+		}
+	}
+}
+
+// Publish queues a broadcast for the manager loop. Once the queue is above the high-water mark,
+// low-priority events such as typing indicators are shed so chat and private messages keep flowing.
+func (manager *ClientManager) Publish(broadcastMsg BroadcastMessage) {
+	if manager.ShedHighWaterMark > 0 &&
+		len(manager.Broadcast) >= manager.ShedHighWaterMark &&
+		broadcastMsg.Message != nil &&
+		sheddableMessageTypes[broadcastMsg.Message.Type] {
+
+		dropped := manager.droppedBroadcasts.Add(1)
+		if dropped%100 == 1 {
+			Log.Warn("Broadcast queue above high-water mark (%d/%d), shedding %s events (total shed: %d)",
+				len(manager.Broadcast), cap(manager.Broadcast), broadcastMsg.Message.Type, dropped)
+		}
+		return
+	}
+
+	select {
+	case manager.Broadcast <- broadcastMsg:
+	case <-manager.stoppedChan():
+	}
+}
+
+// GetDroppedBroadcastCount returns how many low-priority broadcasts have been shed under load
+func (manager *ClientManager) GetDroppedBroadcastCount() int64 {
+	return manager.droppedBroadcasts.Load()
+}
+
 // handleBroadcast processes different types of broadcast messages
 func (manager *ClientManager) handleBroadcast(broadcastMsg BroadcastMessage) {
+	if broadcastMsg.Message != nil {
+		manager.messagesTotal.Inc(broadcastMsg.Message.Type)
+	}
+
 	switch broadcastMsg.MessageType {
 	case "broadcast_all":
 		manager.broadcastToAll(broadcastMsg.Message, broadcastMsg.ExcludeUser)
@@ -175,6 +461,9 @@ func (manager *ClientManager) handleBroadcast(broadcastMsg BroadcastMessage) {
 	case "private_message":
 		manager.sendPrivateMessage(broadcastMsg.Message, broadcastMsg.TargetUsername)
 
+	case "direct_message":
+		manager.deliverDirect(broadcastMsg)
+
 	default:
 		Log.Warn("Unknown broadcast message type: %s", broadcastMsg.MessageType)
 	}
@@ -182,19 +471,21 @@ func (manager *ClientManager) handleBroadcast(broadcastMsg BroadcastMessage) {
 
 // broadcastToAll sends a message to all connected clients
 func (manager *ClientManager) broadcastToAll(message *Message, excludeUser string) {
-	data, err := json.Marshal(message)
-	if err != nil {
-		Log.Error("Error marshaling broadcast message: %v", err)
-		return
-	}
+	manager.routedBroadcasts.Add(1)
+	defer manager.observeFanout(time.Now())
+	encodings := make(map[string][]byte)
 
 	count := 0
 	for client := range manager.Clients {
 		if client.User.Username != excludeUser {
-			select {
-			case client.Send <- data:
+			data, err := encodeFor(message, client, encodings)
+			if err != nil {
+				Log.Error("Error marshaling broadcast message: %v", err)
+				return
+			}
+			if client.enqueue(data) {
 				count++
-			default:
+			} else {
 				Log.Warn("Client %s not receiving, cleaning up", client.User.Username)
 				manager.cleanupClient(client)
 			}
@@ -217,19 +508,21 @@ func (manager *ClientManager) broadcastToRoom(message *Message, roomID string, e
 		return
 	}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		Log.Error("Error marshaling room message: %v", err)
-		return
-	}
+	manager.routedBroadcasts.Add(1)
+	defer manager.observeFanout(time.Now())
+	encodings := make(map[string][]byte)
 
 	count := 0
 	for client := range roomClients {
 		if client.User.Username != excludeUser {
-			select {
-			case client.Send <- data:
+			data, err := encodeFor(message, client, encodings)
+			if err != nil {
+				Log.Error("Error marshaling room message: %v", err)
+				return
+			}
+			if client.enqueue(data) {
 				count++
-			default:
+			} else {
 				Log.Warn("Client %s in room %s not receiving, cleaning up", client.User.Username, roomID)
 				manager.cleanupClient(client)
 			}
@@ -239,24 +532,44 @@ func (manager *ClientManager) broadcastToRoom(message *Message, roomID string, e
 	Log.Info("Broadcasted message to %d clients in room %s (type: %s)", count, roomID, message.Type)
 }
 
+// encodeFor marshals a broadcast for one client, rendering catalog text in the client's locale.
+// Encodings are cached per locale so each broadcast is marshalled once per language.
+func encodeFor(message *Message, client *Client, encodings map[string][]byte) ([]byte, error) {
+	locale := ""
+	if message.Key != "" {
+		locale = i18n.Supported(client.User.Locale)
+	}
+	if data, ok := encodings[locale]; ok {
+		return data, nil
+	}
+
+	data, err := json.Marshal(message.localize(locale))
+	if err != nil {
+		return nil, err
+	}
+	encodings[locale] = data
+	return data, nil
+}
+
 // sendPrivateMessage sends a message to a specific user
 func (manager *ClientManager) sendPrivateMessage(message *Message, targetUsername string) {
 	targetClient, exists := manager.UserClients[targetUsername]
-	if !exists {
-		Log.Warn("Attempted to send private message to offline user: %s", targetUsername)
-
-		// Send error message back to sender
+	if !exists || !targetClient.AppearsOnline() {
+		// The message is already persisted; let the sender know it is waiting. A recipient
+		// appearing offline gets the message live, but the sender is told the same thing.
 		if senderClient, senderExists := manager.UserClients[message.Username]; senderExists {
-			errorMsg := &Message{
+			queuedMsg := (&Message{
 				ID:        generateMessageID(),
-				Type:      "error",
-				Content:   "User " + targetUsername + " is not online",
+				Type:      "system",
 				Username:  "System",
 				Timestamp: time.Now(),
-			}
-			senderClient.SendMessage(errorMsg)
+			}).localizable("recipient_offline", map[string]string{"username": targetUsername})
+			senderClient.SendMessage(queuedMsg)
+		}
+		if !exists {
+			Log.Debug("Private message to offline user %s queued for delivery on reconnect", targetUsername)
+			return
 		}
-		return
 	}
 
 	data, err := json.Marshal(message)
@@ -265,23 +578,109 @@ func (manager *ClientManager) sendPrivateMessage(message *Message, targetUsernam
 		return
 	}
 
-	select {
-	case targetClient.Send <- data:
+	if targetClient.enqueue(data) {
 		Log.Debug("Private message sent from %s to %s", message.Username, targetUsername)
-	default:
+		if id, err := strconv.ParseUint(message.ID, 10, 64); err == nil {
+			deliveredAt := time.Now()
+			manager.markDelivered([]uint{uint(id)}, deliveredAt)
+			manager.sendDeliveryReceipt(uint(id), message.Username, targetClient, deliveredAt)
+		}
+	} else {
 		Log.Warn("Target client %s not receiving private message, cleaning up", targetUsername)
 		manager.cleanupClient(targetClient)
 	}
 }
 
-// cleanupClient removes a non-responsive client
+// sendToUser delivers a server-generated event to a user if they are online; offline users are
+// skipped. It reports whether the user is connected to this instance.
+func (manager *ClientManager) sendToUser(message *Message, targetUsername string) bool {
+	targetClient, exists := manager.UserClients[targetUsername]
+	if !exists {
+		Log.Debug("Skipping %s event for offline user %s", message.Type, targetUsername)
+		return false
+	}
+
+	data, err := encodeFor(message, targetClient, make(map[string][]byte))
+	if err != nil {
+		Log.Error("Error marshaling direct message: %v", err)
+		return true
+	}
+
+	if !targetClient.enqueue(data) {
+		Log.Warn("Target client %s not receiving direct message, cleaning up", targetUsername)
+		manager.cleanupClient(targetClient)
+	}
+	return true
+}
+
+// sendDeliveryReceipt tells the sender of a private message that it reached the recipient's
+// connection, on this instance or through the backplane. Recipients appearing offline send no
+// receipt, as it would give them away. Must be called from the manager loop, like sendToUser.
+func (manager *ClientManager) sendDeliveryReceipt(messageID uint, senderUsername string, recipient *Client, deliveredAt time.Time) {
+	if !recipient.AppearsOnline() {
+		return
+	}
+
+	manager.deliverDirect(BroadcastMessage{
+		Message: &Message{
+			ID:        generateMessageID(),
+			Type:      "delivery_receipt",
+			Username:  recipient.User.Username,
+			Timestamp: deliveredAt,
+			Data: map[string]interface{}{
+				"message_id":   messageID,
+				"delivered_at": deliveredAt,
+			},
+		},
+		TargetUsername: senderUsername,
+		MessageType:    "direct_message",
+	})
+}
+
+// markDelivered records the delivery of private messages in the background, since it is called
+// with the manager lock held. Messages already marked keep their first delivery time.
+func (manager *ClientManager) markDelivered(messageIDs []uint, deliveredAt time.Time) {
+	if manager.PrivateMessageRepo == nil || len(messageIDs) == 0 {
+		return
+	}
+	go func() {
+		if err := manager.PrivateMessageRepo.MarkDelivered(messageIDs, deliveredAt); err != nil {
+			Log.Error("Failed to mark %d private messages delivered: %v", len(messageIDs), err)
+		}
+	}()
+}
+
+// NotifyReadReceipt tells the sender of a private message that the recipient has read it. A sender
+// connected to another instance gets it through the backplane.
+func (manager *ClientManager) NotifyReadReceipt(pm *model.PrivateMessage, readerUsername string, readAt time.Time) {
+	manager.Publish(BroadcastMessage{
+		Message: &Message{
+			ID:        generateMessageID(),
+			Type:      "read_receipt",
+			Username:  readerUsername,
+			Timestamp: readAt,
+			Data: map[string]interface{}{
+				"message_id": pm.ID,
+				"read_at":    readAt,
+			},
+		},
+		TargetUsername: pm.Sender.Username,
+		MessageType:    "direct_message",
+	})
+}
+
+// cleanupClient removes a non-responsive client. As in unregisterClient, the user's entry and
+// their offline notice are left alone when a newer connection of theirs is still registered.
 func (manager *ClientManager) cleanupClient(client *Client) {
-	close(client.Send)
+	client.closeSend()
 	delete(manager.Clients, client)
-	delete(manager.UserClients, client.User.Username)
+	current := manager.UserClients[client.User.Username] == client
+	if current {
+		delete(manager.UserClients, client.User.Username)
+	}
 
 	// Remove from all rooms
-	for roomID := range client.Rooms {
+	for _, roomID := range client.roomIDs() {
 		if manager.Rooms[roomID] != nil {
 			delete(manager.Rooms[roomID], client)
 			if len(manager.Rooms[roomID]) == 0 {
@@ -289,13 +688,131 @@ func (manager *ClientManager) cleanupClient(client *Client) {
 			}
 		}
 	}
+
+	manager.removePresenceSubscriptions(client)
+	if current && client.AppearsOnline() {
+		manager.notifyPresenceSubscribers(client.User.Username, "offline")
+	}
+}
+
+// SubscribePresence registers the client for presence updates about the given users.
+// It returns the current status of every requested user so the client can render
+// an initial state without waiting for the next connect/disconnect.
+func (manager *ClientManager) SubscribePresence(client *Client, usernames []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(usernames))
+	manager.mu.RLock()
+	for _, username := range usernames {
+		if username == "" {
+			continue
+		}
+		if manager.appearsOnline(username) {
+			statuses[username] = "online"
+		} else {
+			statuses[username] = "offline"
+		}
+	}
+	manager.mu.RUnlock()
+
+	manager.presenceMu.Lock()
+	defer manager.presenceMu.Unlock()
+
+	total := len(client.presenceSubs)
+	for username := range statuses {
+		if !client.presenceSubs[username] {
+			total++
+		}
+	}
+	if total > maxPresenceSubscriptions {
+		return nil, fmt.Errorf("presence subscriptions are limited to %d users", maxPresenceSubscriptions)
+	}
+
+	if manager.presenceSubscribers == nil {
+		manager.presenceSubscribers = make(map[string]map[*Client]bool)
+	}
+	if client.presenceSubs == nil {
+		client.presenceSubs = make(map[string]bool)
+	}
+
+	for username := range statuses {
+		if manager.presenceSubscribers[username] == nil {
+			manager.presenceSubscribers[username] = make(map[*Client]bool)
+		}
+		manager.presenceSubscribers[username][client] = true
+		client.presenceSubs[username] = true
+	}
+
+	Log.Debug("User %s now watching presence of %d users", client.User.Username, len(client.presenceSubs))
+	return statuses, nil
+}
+
+// UnsubscribePresence stops presence updates about the given users.
+// An empty list removes every subscription held by the client.
+func (manager *ClientManager) UnsubscribePresence(client *Client, usernames []string) {
+	if len(usernames) == 0 {
+		manager.removePresenceSubscriptions(client)
+		return
+	}
+
+	manager.presenceMu.Lock()
+	defer manager.presenceMu.Unlock()
+
+	for _, username := range usernames {
+		manager.unwatchPresence(client, username)
+	}
+}
+
+// removePresenceSubscriptions drops every presence subscription held by a client
+func (manager *ClientManager) removePresenceSubscriptions(client *Client) {
+	manager.presenceMu.Lock()
+	defer manager.presenceMu.Unlock()
+
+	for username := range client.presenceSubs {
+		manager.unwatchPresence(client, username)
+	}
+}
+
+// unwatchPresence removes a single subscription; callers must hold presenceMu
+func (manager *ClientManager) unwatchPresence(client *Client, username string) {
+	if subscribers := manager.presenceSubscribers[username]; subscribers != nil {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(manager.presenceSubscribers, username)
+		}
+	}
+	delete(client.presenceSubs, username)
+}
+
+// notifyPresenceSubscribers sends a presence_update to every client watching the given user
+func (manager *ClientManager) notifyPresenceSubscribers(username, status string) {
+	manager.presenceMu.Lock()
+	defer manager.presenceMu.Unlock()
+
+	subscribers := manager.presenceSubscribers[username]
+	if len(subscribers) == 0 {
+		return
+	}
+
+	presenceMsg := &Message{
+		ID:        generateMessageID(),
+		Type:      "presence_update",
+		Username:  "System",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"username": username,
+			"status":   status,
+		},
+	}
+
+	for subscriber := range subscribers {
+		subscriber.SendMessage(presenceMsg)
+	}
 }
 
 // sendOnlineUsersList sends the current list of online users to a client
 func (manager *ClientManager) sendOnlineUsersList(client *Client) {
 	var onlineUsers []string
-	for username := range manager.UserClients {
-		if username != client.User.Username {
+	for username, other := range manager.UserClients {
+		if username != client.User.Username && other.AppearsOnline() {
 			onlineUsers = append(onlineUsers, username)
 		}
 	}
@@ -315,21 +832,31 @@ func (manager *ClientManager) sendOnlineUsersList(client *Client) {
 	client.SendMessage(usersListMsg)
 }
 
-// GetOnlineUsers returns a list of currently online users
+// GetOnlineUsers returns a list of currently online users, leaving out those appearing offline
 func (manager *ClientManager) GetOnlineUsers() []string {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
 	var users []string
-	for username := range manager.UserClients {
-		users = append(users, username)
+	for username, client := range manager.UserClients {
+		if client.AppearsOnline() {
+			users = append(users, username)
+		}
 	}
 	return users
 }
 
 // GetRoomUsers returns a list of users in a specific room
 func (manager *ClientManager) GetRoomUsers(roomID string) []string {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
 	var users []string
 	if roomClients, exists := manager.Rooms[roomID]; exists {
 		for client := range roomClients {
-			users = append(users, client.User.Username)
+			if client.AppearsOnline() {
+				users = append(users, client.User.Username)
+			}
 		}
 	}
 	return users
@@ -345,8 +872,205 @@ func (manager *ClientManager) GetRoomCount() int {
 	return len(manager.Rooms)
 }
 
-// IsUserOnline checks if a user is currently online
+// ServerStats is a snapshot of the live connection state
+type ServerStats struct {
+	Connections      int            `json:"connections"`
+	ActiveRooms      int            `json:"active_rooms"`
+	BroadcastsRouted int64          `json:"broadcasts_routed"`
+	BroadcastsShed   int64          `json:"broadcasts_shed"`
+	RoomOccupancy    map[string]int `json:"room_occupancy"` // Live clients per room
+}
+
+// Stats returns the current connection counts and broadcast counters
+func (manager *ClientManager) Stats() ServerStats {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	occupancy := make(map[string]int, len(manager.Rooms))
+	for roomID, clients := range manager.Rooms {
+		occupancy[roomID] = len(clients)
+	}
+
+	return ServerStats{
+		Connections:      len(manager.Clients),
+		ActiveRooms:      len(manager.Rooms),
+		BroadcastsRouted: manager.routedBroadcasts.Load(),
+		BroadcastsShed:   manager.droppedBroadcasts.Load(),
+		RoomOccupancy:    occupancy,
+	}
+}
+
+// RoomExists reports whether a room is known, checking live rooms before the database
+func (manager *ClientManager) RoomExists(roomID string) (bool, error) {
+	manager.mu.RLock()
+	_, live := manager.Rooms[roomID]
+	manager.mu.RUnlock()
+	if live {
+		return true, nil
+	}
+
+	room, err := manager.RoomRepo.GetRoomByID(roomID)
+	if err != nil {
+		return false, err
+	}
+	return room != nil, nil
+}
+
+// appearsOnline reports whether the user is connected and visible to others
+func (manager *ClientManager) appearsOnline(username string) bool {
+	client, exists := manager.UserClients[username]
+	return exists && client.AppearsOnline()
+}
+
+// SetAppearOffline changes the visibility of a connected user. Others see the change as the
+// user going offline or coming online.
+func (manager *ClientManager) SetAppearOffline(username string, appearOffline bool) {
+	manager.mu.RLock()
+	client, exists := manager.UserClients[username]
+	manager.mu.RUnlock()
+	if !exists || client.appearOffline.Swap(appearOffline) == appearOffline {
+		return
+	}
+
+	key, status := "user_joined_chat", "online"
+	if appearOffline {
+		key, status = "user_left_chat", "offline"
+	}
+	manager.Publish(BroadcastMessage{
+		Message: (&Message{
+			ID:        generateMessageID(),
+			Type:      "system",
+			UserID:    client.User.ID,
+			Username:  username,
+			Timestamp: time.Now(),
+		}).localizable(key, map[string]string{"username": username}),
+		ExcludeUser: username,
+		MessageType: "broadcast_all",
+	})
+	manager.notifyPresenceSubscribers(username, status)
+}
+
+// SetStatus persists a connected user's chosen status and announces it with a status_changed
+// frame to the rooms they are in and to their presence subscribers. The user is sent the frame
+// as confirmation. Users appearing offline change status silently.
+func (manager *ClientManager) SetStatus(client *Client, status string) error {
+	if err := manager.UserRepo.UpdateUserStatus(client.User.ID, status); err != nil {
+		return err
+	}
+
+	statusMsg := &Message{
+		ID:        generateMessageID(),
+		Type:      "status_changed",
+		UserID:    client.User.ID,
+		Username:  client.User.Username,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"username": client.User.Username,
+			"status":   status,
+		},
+	}
+	client.SendMessage(statusMsg)
+
+	if !client.AppearsOnline() {
+		return nil
+	}
+
+	for _, roomID := range client.roomIDs() {
+		roomMsg := *statusMsg
+		roomMsg.RoomID = roomID
+		manager.Publish(BroadcastMessage{
+			Message:     &roomMsg,
+			RoomID:      roomID,
+			ExcludeUser: client.User.Username,
+			MessageType: "broadcast_room",
+		})
+	}
+	manager.notifyPresenceSubscribers(client.User.Username, status)
+	return nil
+}
+
+// checkPrivateRoomAccess reports whether a user may join a room over the WebSocket: anyone may
+// join a public room, while private rooms admit their members and invited users. invited is
+// set when joining uses up an invite.
+func (manager *ClientManager) checkPrivateRoomAccess(roomID string, userID uint) (allowed, invited bool, err error) {
+	room, err := manager.RoomRepo.GetRoomByID(roomID)
+	if err != nil || room == nil || room.Type != "private" {
+		return err == nil, false, err
+	}
+
+	isMember, err := manager.RoomRepo.IsUserInRoom(roomID, userID)
+	if err != nil || isMember {
+		return err == nil, false, err
+	}
+
+	invited, err = manager.RoomRepo.HasInvite(roomID, userID)
+	return invited, invited, err
+}
+
+// CloseRoom tears down a deleted room's live state: every connected member is removed from it
+// and sent a room_deleted event. Members are notified directly because the room itself is gone
+// by the time the broadcast is delivered.
+func (manager *ClientManager) CloseRoom(roomID, roomName string, actorID uint) {
+	manager.mu.Lock()
+	members := make([]string, 0, len(manager.Rooms[roomID]))
+	for client := range manager.Rooms[roomID] {
+		client.leaveRoom(roomID)
+		members = append(members, client.User.Username)
+	}
+	delete(manager.Rooms, roomID)
+	manager.mu.Unlock()
+
+	manager.forgetMemberCount(roomID)
+
+	for _, username := range members {
+		manager.Publish(BroadcastMessage{
+			Message: &Message{
+				ID:        generateMessageID(),
+				Type:      "room_deleted",
+				UserID:    actorID,
+				RoomID:    roomID,
+				Username:  "System",
+				Timestamp: time.Now(),
+				Data: map[string]interface{}{
+					"room_name": roomName,
+				},
+			},
+			TargetUsername: username,
+			MessageType:    "direct_message",
+		})
+	}
+	Log.Info("Room %s closed, %d live members removed", roomID, len(members))
+}
+
+// EvictFromRoom removes a user's live connection from a room whose membership was ended for
+// them, and sends them a room_removed event explaining why using the given catalog key
+func (manager *ClientManager) EvictFromRoom(username, roomID, reasonKey string, params map[string]string) {
+	manager.mu.RLock()
+	client, exists := manager.UserClients[username]
+	manager.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	manager.RemoveClientFromRoom(client, roomID)
+	manager.Publish(BroadcastMessage{
+		Message: (&Message{
+			ID:        generateMessageID(),
+			Type:      "room_removed",
+			RoomID:    roomID,
+			Username:  "System",
+			Timestamp: time.Now(),
+		}).localizable(reasonKey, params),
+		TargetUsername: username,
+		MessageType:    "direct_message",
+	})
+}
+
+// IsUserOnline checks if a user is currently connected, whether or not they appear offline
 func (manager *ClientManager) IsUserOnline(username string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
 	_, exists := manager.UserClients[username]
 	return exists
 }
@@ -360,11 +1084,7 @@ func (manager *ClientManager) AddClientToRoom(client *Client, roomID string) {
 	}
 
 	manager.Rooms[roomID][client] = true
-
-	if client.Rooms == nil {
-		client.Rooms = make(map[string]bool)
-	}
-	client.Rooms[roomID] = true
+	client.joinRoom(roomID)
 
 	Log.Info("User %s added to room %s", client.User.Username, roomID)
 }
@@ -381,9 +1101,7 @@ func (manager *ClientManager) RemoveClientFromRoom(client *Client, roomID string
 		}
 	}
 
-	if client.Rooms != nil {
-		delete(client.Rooms, roomID)
-	}
+	client.leaveRoom(roomID)
 
 	Log.Info("User %s removed from room %s", client.User.Username, roomID)
 }
@@ -398,3 +1116,16 @@ func (manager *ClientManager) IsClientInRoom(client *Client, roomID string) bool
 	}
 	return manager.Rooms[roomID][client]
 }
+
+// RecordActivity appends an entry to the activity log. Failures are logged rather than returned
+// so auditing never blocks the action being audited. It is shared by the WebSocket and HTTP paths.
+func RecordActivity(repo repository.ActivityLogRepository, userID uint, action, details, ipAddress string) {
+	if repo == nil {
+		return
+	}
+
+	entry := &model.ActivityLog{UserID: userID, Action: action, Details: details, IPAddress: ipAddress}
+	if err := repo.CreateLog(entry); err != nil {
+		Log.Error("Failed to record %s activity for user %d: %v", action, userID, err)
+	}
+}
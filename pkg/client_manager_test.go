@@ -0,0 +1,472 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTypingIsShedWhileChatStillQueues(t *testing.T) {
+	manager := &ClientManager{
+		Broadcast:         make(chan BroadcastMessage, 64),
+		ShedHighWaterMark: 8,
+	}
+	chat := func() BroadcastMessage {
+		return BroadcastMessage{Message: &Message{Type: "chat_message"}, RoomID: "lobby", MessageType: "broadcast_room"}
+	}
+
+	// Nothing drains the queue, so it backs up the way it would behind a stalled manager loop
+	for i := 0; i < 8; i++ {
+		manager.Publish(chat())
+	}
+	for i := 0; i < 20; i++ {
+		manager.publishTyping(1, "alice", "lobby", "start")
+	}
+	for i := 0; i < 4; i++ {
+		manager.Publish(chat())
+	}
+
+	if got := manager.GetDroppedBroadcastCount(); got != 20 {
+		t.Fatalf("%d broadcasts shed, want all 20 typing events", got)
+	}
+	if got := len(manager.Broadcast); got != 12 {
+		t.Fatalf("%d broadcasts queued, want the 12 chat messages", got)
+	}
+	for len(manager.Broadcast) > 0 {
+		if queued := <-manager.Broadcast; queued.Message.Type != "chat_message" {
+			t.Fatalf("a %s event was queued above the high-water mark", queued.Message.Type)
+		}
+	}
+}
+
+func TestTypingIsQueuedBelowHighWaterMark(t *testing.T) {
+	manager := &ClientManager{
+		Broadcast:         make(chan BroadcastMessage, 64),
+		ShedHighWaterMark: 8,
+	}
+	manager.publishTyping(1, "alice", "lobby", "start")
+
+	if manager.GetDroppedBroadcastCount() != 0 || len(manager.Broadcast) != 1 {
+		t.Fatal("a typing event was shed with an almost empty queue")
+	}
+}
+
+// connectClients opens a socket per username against a test server and registers the server side
+// of each with the manager, returning the client ends
+func connectClients(t *testing.T, manager *ClientManager, usernames ...string) []*websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		username := r.URL.Query().Get("user")
+		client := NewClient(&model.User{Username: username}, conn, DefaultClientConfig())
+		manager.mu.Lock()
+		manager.Clients[client] = true
+		manager.UserClients[username] = client
+		manager.mu.Unlock()
+		go client.Write()
+	}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conns := make([]*websocket.Conn, 0, len(usernames))
+	for _, username := range usernames {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?user="+username, nil)
+		if err != nil {
+			t.Fatalf("dial as %s: %v", username, err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		conns = append(conns, conn)
+	}
+
+	// The upgrade handler registers asynchronously of the dial returning
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		manager.mu.RLock()
+		registered := len(manager.Clients)
+		manager.mu.RUnlock()
+		if registered == len(usernames) {
+			return conns
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d clients registered", registered, len(usernames))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownClosesEveryClient(t *testing.T) {
+	manager := &ClientManager{
+		Broadcast:   make(chan BroadcastMessage, 16),
+		Clients:     make(map[*Client]bool),
+		Rooms:       make(map[string]map[*Client]bool),
+		UserClients: make(map[string]*Client),
+	}
+	stopped := make(chan struct{})
+	go func() {
+		manager.Start()
+		close(stopped)
+	}()
+	conns := connectClients(t, manager, "alice", "bob", "carol")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the manager loop is still running after Shutdown")
+	}
+	for i, conn := range conns {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("client %d got %v, want a close frame", i, err)
+		}
+	}
+	if manager.RegisterClient(NewClient(&model.User{Username: "dave"}, nil, DefaultClientConfig())) {
+		t.Fatal("a client was registered after Shutdown")
+	}
+}
+
+func TestStatsReflectRegisteredClients(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob", "carol")
+	manager.mu.Lock()
+	manager.Rooms["lobby"] = map[*Client]bool{clients["alice"]: true, clients["bob"]: true}
+	manager.Rooms["general"] = map[*Client]bool{clients["carol"]: true}
+	manager.mu.Unlock()
+
+	manager.Publish(BroadcastMessage{Message: &Message{Type: "chat_message"}, RoomID: "lobby", MessageType: "broadcast_room"})
+	nextFrame(t, clients["alice"])
+
+	stats := manager.Stats()
+	if stats.Connections != 3 || stats.ActiveRooms != 2 {
+		t.Fatalf("got %d connections in %d rooms, want 3 in 2", stats.Connections, stats.ActiveRooms)
+	}
+	if stats.RoomOccupancy["lobby"] != 2 || stats.RoomOccupancy["general"] != 1 {
+		t.Fatalf("occupancy %v", stats.RoomOccupancy)
+	}
+	if stats.BroadcastsRouted != 1 {
+		t.Fatalf("%d broadcasts routed, want 1", stats.BroadcastsRouted)
+	}
+}
+
+func TestPresenceOnlyReachesSubscribers(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob", "carol")
+	alice := clients["alice"]
+
+	statuses, err := manager.SubscribePresence(alice, []string{"bob", "dave"})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if statuses["bob"] != "online" || statuses["dave"] != "offline" {
+		t.Fatalf("unexpected initial statuses %v", statuses)
+	}
+
+	manager.notifyPresenceSubscribers("carol", "offline")
+	manager.notifyPresenceSubscribers("bob", "away")
+
+	update := nextFrame(t, alice)
+	if update.Type != "presence_update" || update.Data["username"] != "bob" || update.Data["status"] != "away" {
+		t.Fatalf("unexpected frame %+v", update)
+	}
+	expectNoFrame(t, alice, 100*time.Millisecond)
+
+	manager.UnsubscribePresence(alice, []string{"bob"})
+	manager.notifyPresenceSubscribers("bob", "offline")
+	expectNoFrame(t, alice, 100*time.Millisecond)
+}
+
+func TestPresenceSubscriptionsAreCapped(t *testing.T) {
+	manager, clients := startTestManager(t, "alice")
+	alice := clients["alice"]
+
+	usernames := make([]string, maxPresenceSubscriptions+1)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("user%d", i)
+	}
+	if _, err := manager.SubscribePresence(alice, usernames); err == nil {
+		t.Fatal("expected the subscription cap to be enforced")
+	}
+	if len(alice.presenceSubs) != 0 {
+		t.Fatalf("rejected request left %d subscriptions behind", len(alice.presenceSubs))
+	}
+
+	if _, err := manager.SubscribePresence(alice, usernames[:maxPresenceSubscriptions]); err != nil {
+		t.Fatalf("subscribing up to the cap failed: %v", err)
+	}
+	manager.UnsubscribePresence(alice, nil)
+	if len(alice.presenceSubs) != 0 || len(manager.presenceSubscribers) != 0 {
+		t.Fatal("an empty unsubscribe should drop every subscription")
+	}
+}
+
+// statusUserRepository records the status each user was last given
+type statusUserRepository struct {
+	repository.UserRepository
+	mu       sync.Mutex
+	statuses map[uint]string
+}
+
+func (r *statusUserRepository) UpdateUserStatus(userID uint, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[uint]string)
+	}
+	r.statuses[userID] = status
+	return nil
+}
+
+func (r *statusUserRepository) status(userID uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statuses[userID]
+}
+
+// unreadPrivateMessageRepository serves a fixed inbox and reports each MarkDelivered call
+type unreadPrivateMessageRepository struct {
+	repository.PrivateMessageRepository
+	mu        sync.Mutex
+	messages  []model.PrivateMessage
+	delivered chan []uint
+}
+
+func (r *unreadPrivateMessageRepository) GetUnreadMessages(recipientID uint) ([]model.PrivateMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unread []model.PrivateMessage
+	for _, pm := range r.messages {
+		if pm.RecipientID == recipientID && pm.ReadAt == nil {
+			unread = append(unread, pm)
+		}
+	}
+	return unread, nil
+}
+
+func (r *unreadPrivateMessageRepository) MarkDelivered(messageIDs []uint, deliveredAt time.Time) error {
+	r.mu.Lock()
+	for i := range r.messages {
+		if slices.Contains(messageIDs, r.messages[i].ID) && r.messages[i].DeliveredAt == nil {
+			r.messages[i].DeliveredAt = &deliveredAt
+		}
+	}
+	r.mu.Unlock()
+	r.delivered <- messageIDs
+	return nil
+}
+
+func (r *unreadPrivateMessageRepository) GetPrivateMessageByID(messageID uint) (*model.PrivateMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, pm := range r.messages {
+		if pm.ID == messageID {
+			return &pm, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *unreadPrivateMessageRepository) MarkMessageRead(messageID uint) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	readAt := time.Now()
+	for i := range r.messages {
+		if r.messages[i].ID == messageID {
+			r.messages[i].Read, r.messages[i].ReadAt = true, &readAt
+		}
+	}
+	return readAt, nil
+}
+
+// nextFrameOfType skips frames of other types until one of the given type arrives
+func nextFrameOfType(t *testing.T, client *Client, messageType string) *Message {
+	t.Helper()
+	for {
+		if frame := nextFrame(t, client); frame.Type == messageType {
+			return frame
+		}
+	}
+}
+
+func TestOfflinePrivateMessagesAreDeliveredOnReconnect(t *testing.T) {
+	manager, clients := startTestManager(t, "alice")
+	inbox := &unreadPrivateMessageRepository{
+		messages: []model.PrivateMessage{
+			{ID: 5, SenderID: 1, RecipientID: 2, Sender: model.User{Username: "alice"}, Content: "are you there?"},
+		},
+		delivered: make(chan []uint, 1),
+	}
+	manager.UserRepo = &statusUserRepository{}
+	manager.RoomRepo = &fakeRoomRepository{}
+	manager.PrivateMessageRepo = inbox
+
+	bob := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	manager.registerClient(bob)
+
+	pm := nextFrameOfType(t, bob, "private_message")
+	if pm.ID != "5" || pm.Content != "are you there?" || pm.Username != "alice" || pm.RecipientUsername != "bob" {
+		t.Fatalf("unexpected frame %+v", pm)
+	}
+	if receipt := nextFrameOfType(t, clients["alice"], "delivery_receipt"); receipt.Data["message_id"] != float64(5) {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	select {
+	case ids := <-inbox.delivered:
+		if !slices.Equal(ids, []uint{5}) {
+			t.Fatalf("marked %v delivered, want [5]", ids)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the message was never marked delivered")
+	}
+
+	// Still unread, so the next connection gets it again, but the sender is not told twice
+	reconnected := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	manager.registerClient(reconnected)
+
+	if pm := nextFrameOfType(t, reconnected, "private_message"); pm.ID != "5" {
+		t.Fatalf("unexpected frame %+v", pm)
+	}
+	quiet := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case data := <-clients["alice"].Send:
+			if strings.Contains(string(data), "delivery_receipt") {
+				t.Fatalf("receipt re-sent on reconnect: %s", data)
+			}
+		case <-quiet:
+			return
+		}
+	}
+}
+
+func TestUserAppearingOfflineIsHiddenButStillChats(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob")
+	alice, bob := clients["alice"], clients["bob"]
+	manager.mu.Lock()
+	manager.Rooms["lobby"] = map[*Client]bool{alice: true, bob: true}
+	manager.mu.Unlock()
+	if _, err := manager.SubscribePresence(bob, []string{"alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.SetAppearOffline("alice", true)
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		frame := nextFrame(t, bob)
+		seen[frame.Type] = true
+		if frame.Type == "presence_update" && frame.Data["status"] != "offline" {
+			t.Fatalf("unexpected frame %+v", frame)
+		}
+	}
+	if !seen["system"] || !seen["presence_update"] {
+		t.Fatalf("bob saw %v, want a left notice and a presence update", seen)
+	}
+	// Hiding again is not announced twice
+	manager.SetAppearOffline("alice", true)
+	expectNoFrame(t, bob, 100*time.Millisecond)
+
+	if online := manager.GetOnlineUsers(); !slices.Equal(online, []string{"bob"}) {
+		t.Fatalf("online users %v, want only bob", online)
+	}
+	if statuses, _ := manager.SubscribePresence(bob, []string{"alice"}); statuses["alice"] != "offline" {
+		t.Fatalf("alice reported %q to presence subscribers", statuses["alice"])
+	}
+
+	// Room traffic still flows both ways
+	for _, pair := range [][2]*Client{{alice, bob}, {bob, alice}} {
+		sender, recipient := pair[0], pair[1]
+		manager.Publish(BroadcastMessage{
+			Message:     &Message{Type: "chat_message", Username: sender.User.Username, RoomID: "lobby", Content: "hi"},
+			RoomID:      "lobby",
+			ExcludeUser: sender.User.Username,
+			MessageType: "broadcast_room",
+		})
+		if frame := nextFrame(t, recipient); frame.Type != "chat_message" || frame.Username != sender.User.Username {
+			t.Fatalf("unexpected frame %+v", frame)
+		}
+	}
+}
+
+func TestSetStatusIsStoredAndBroadcastToRooms(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob", "carol")
+	users := &statusUserRepository{}
+	manager.UserRepo = users
+	alice, bob, carol := clients["alice"], clients["bob"], clients["carol"]
+	alice.User.ID = 1
+	alice.joinRoom("lobby")
+	manager.mu.Lock()
+	manager.Rooms["lobby"] = map[*Client]bool{alice: true, bob: true}
+	manager.mu.Unlock()
+
+	alice.handleSetStatus(IncomingMessage{Type: "set_status", Content: "sleeping"}, manager)
+	if frame := nextFrame(t, alice); frame.Type != "error" {
+		t.Fatalf("invalid status answered with %+v, want an error", frame)
+	}
+	if status := users.status(1); status != "" {
+		t.Fatalf("an invalid status was stored as %q", status)
+	}
+
+	alice.handleSetStatus(IncomingMessage{Type: "set_status", Content: "away"}, manager)
+	if status := users.status(1); status != "away" {
+		t.Fatalf("stored status %q, want away", status)
+	}
+	if frame := nextFrame(t, alice); frame.Type != "status_changed" || frame.Data["status"] != "away" {
+		t.Fatalf("alice got %+v, want her status_changed confirmation", frame)
+	}
+	frame := nextFrame(t, bob)
+	if frame.Type != "status_changed" || frame.RoomID != "lobby" || frame.Data["username"] != "alice" || frame.Data["status"] != "away" {
+		t.Fatalf("room member got %+v, want alice's status_changed", frame)
+	}
+	expectNoFrame(t, carol, 100*time.Millisecond)
+}
+
+func TestConnectingAndDisconnectingUpdateStoredStatus(t *testing.T) {
+	manager, _ := startTestManager(t)
+	users := &statusUserRepository{}
+	manager.UserRepo = users
+	manager.RoomRepo = &fakeRoomRepository{}
+	unregister := func(client *Client) {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		manager.unregisterClient(client)
+	}
+
+	first := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	manager.registerClient(first)
+	if status := users.status(2); status != "online" {
+		t.Fatalf("status after connecting %q, want online", status)
+	}
+
+	// A replaced connection closing does not take the user offline
+	second := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	manager.registerClient(second)
+	unregister(first)
+	if status := users.status(2); status != "online" {
+		t.Fatalf("status after the old connection closed %q, want online", status)
+	}
+
+	unregister(second)
+	if status := users.status(2); status != "offline" {
+		t.Fatalf("status after disconnecting %q, want offline", status)
+	}
+}
@@ -0,0 +1,34 @@
+package pkg
+
+import (
+	"time"
+
+	"live-chatter/pkg/metrics"
+)
+
+// RegisterMetrics exposes the manager's connection state and broadcast activity on the registry.
+// Until it is called the manager records no metrics.
+func (manager *ClientManager) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("chatter_active_connections", "Number of connected WebSocket clients.", func() float64 {
+		manager.mu.RLock()
+		defer manager.mu.RUnlock()
+		return float64(len(manager.Clients))
+	})
+	registry.NewGaugeFunc("chatter_active_rooms", "Number of rooms with at least one connected member.", func() float64 {
+		manager.mu.RLock()
+		defer manager.mu.RUnlock()
+		return float64(len(manager.Rooms))
+	})
+	manager.messagesTotal = registry.NewCounterVec("chatter_messages_total",
+		"Messages routed to clients, by message type.", "type")
+	registry.NewCounterFunc("chatter_broadcast_dropped_total", "Low-priority broadcasts shed under load.", func() float64 {
+		return float64(manager.droppedBroadcasts.Load())
+	})
+	manager.fanoutSeconds = registry.NewHistogram("chatter_broadcast_fanout_seconds",
+		"Time taken to hand a broadcast to every recipient.", metrics.DefaultBuckets)
+}
+
+// observeFanout records how long a broadcast took to reach its recipients
+func (manager *ClientManager) observeFanout(start time.Time) {
+	manager.fanoutSeconds.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+
+	"live-chatter/pkg/metrics"
+)
+
+// scrape renders the registry and parses each sample line into its value, keyed by the metric
+// name with its labels
+func scrape(t *testing.T, registry *metrics.Registry) (map[string]float64, map[string]string) {
+	t.Helper()
+	var out strings.Builder
+	registry.WritePrometheus(&out)
+
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			types[name] = kind
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx < 0 {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		samples[line[:idx]] = value
+	}
+	return samples, types
+}
+
+func TestMetricsExposition(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob")
+	registry := metrics.NewRegistry()
+	manager.RegisterMetrics(registry)
+	manager.mu.Lock()
+	manager.Rooms["lobby"] = map[*Client]bool{clients["alice"]: true, clients["bob"]: true}
+	manager.mu.Unlock()
+
+	manager.Publish(BroadcastMessage{Message: &Message{Type: "chat_message"}, RoomID: "lobby", MessageType: "broadcast_room"})
+	manager.Publish(BroadcastMessage{Message: &Message{Type: "chat_message"}, RoomID: "lobby", MessageType: "broadcast_room"})
+	manager.Publish(BroadcastMessage{Message: &Message{Type: "typing"}, RoomID: "lobby", MessageType: "broadcast_room"})
+	for i := 0; i < 3; i++ {
+		nextFrame(t, clients["bob"])
+	}
+	// The loop holds the lock until a broadcast's fan-out has been observed
+	manager.mu.Lock()
+	manager.mu.Unlock()
+
+	samples, types := scrape(t, registry)
+	for name, kind := range map[string]string{
+		"chatter_active_connections":       "gauge",
+		"chatter_active_rooms":             "gauge",
+		"chatter_messages_total":           "counter",
+		"chatter_broadcast_dropped_total":  "counter",
+		"chatter_broadcast_fanout_seconds": "histogram",
+	} {
+		if types[name] != kind {
+			t.Errorf("%s has type %q, want %s", name, types[name], kind)
+		}
+	}
+
+	want := map[string]float64{
+		"chatter_active_connections":                         2,
+		"chatter_active_rooms":                               1,
+		`chatter_messages_total{type="chat_message"}`:        2,
+		`chatter_messages_total{type="typing"}`:              1,
+		"chatter_broadcast_dropped_total":                    0,
+		"chatter_broadcast_fanout_seconds_count":             3,
+		`chatter_broadcast_fanout_seconds_bucket{le="+Inf"}`: 3,
+	}
+	for sample, value := range want {
+		if got, ok := samples[sample]; !ok || got != value {
+			t.Errorf("%s = %v (present %v), want %v", sample, got, ok, value)
+		}
+	}
+}
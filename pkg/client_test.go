@@ -0,0 +1,469 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendMessageAfterCloseSendIsDropped(t *testing.T) {
+	client := NewClient(&model.User{Username: "alice"}, nil, DefaultClientConfig())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client.SendError("late frame")
+			}
+		}()
+	}
+	client.closeSend()
+	client.closeSend() // Closing twice must be harmless too
+	wg.Wait()
+
+	for range client.Send {
+	}
+}
+
+func TestClientRoomsAreSafeForConcurrentUse(t *testing.T) {
+	client := NewClient(&model.User{Username: "alice"}, nil, DefaultClientConfig())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			client.joinRoom("lobby")
+			client.leaveRoom("lobby")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			client.InRoom("lobby")
+			client.roomIDs()
+		}
+	}()
+	wg.Wait()
+
+	client.joinRoom("lobby")
+	if !client.InRoom("lobby") {
+		t.Fatal("expected client to be in lobby after joining")
+	}
+}
+
+func TestCleanupClientKeepsNewerSession(t *testing.T) {
+	manager := &ClientManager{
+		Clients:     make(map[*Client]bool),
+		Rooms:       make(map[string]map[*Client]bool),
+		UserClients: make(map[string]*Client),
+	}
+	older := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+	newer := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+	watcher := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	for _, client := range []*Client{older, newer, watcher} {
+		manager.Clients[client] = true
+	}
+	manager.UserClients["alice"] = newer
+	manager.UserClients["bob"] = watcher
+	if _, err := manager.SubscribePresence(watcher, []string{"alice"}); err != nil {
+		t.Fatalf("SubscribePresence: %v", err)
+	}
+
+	manager.cleanupClient(older)
+	if manager.UserClients["alice"] != newer {
+		t.Fatal("dropping an older session removed the user's current connection")
+	}
+	select {
+	case data := <-watcher.Send:
+		t.Fatalf("watcher was told about a user who is still online: %s", data)
+	default:
+	}
+
+	manager.cleanupClient(newer)
+	if _, ok := manager.UserClients["alice"]; ok {
+		t.Fatal("the user's last connection was not removed")
+	}
+	if frame := nextFrame(t, watcher); frame.Type != "presence_update" || frame.Data["status"] != "offline" {
+		t.Fatalf("got %+v, want an offline presence update", frame)
+	}
+}
+
+func TestFrameBurstIsRateLimited(t *testing.T) {
+	cfg := DefaultClientConfig()
+	cfg.MessageRate = 1
+	cfg.MessageBurst = 3
+	cfg.MaxRateViolations = 0
+	client := NewClient(&model.User{Username: "alice"}, nil, cfg)
+
+	for i := 0; i < 10; i++ {
+		client.HandleMessage([]byte(`{"type":"ping"}`), &ClientManager{})
+	}
+
+	counts := make(map[string]int)
+	for len(client.Send) > 0 {
+		var frame Message
+		if err := json.Unmarshal(<-client.Send, &frame); err != nil {
+			t.Fatalf("undecodable frame: %v", err)
+		}
+		counts[frame.Type]++
+		if frame.Type == "rate_limited" {
+			if retry, _ := frame.Data["retry_after_ms"].(float64); retry <= 0 {
+				t.Fatalf("rate_limited frame without a retry delay: %+v", frame.Data)
+			}
+		}
+	}
+	if counts["pong"] != 3 || counts["rate_limited"] != 7 {
+		t.Fatalf("got %v, want 3 pongs and 7 rate_limited frames", counts)
+	}
+}
+
+// sendingRoomRepository adds the membership bookkeeping done when a message is sent
+type sendingRoomRepository struct {
+	fakeRoomRepository
+}
+
+func (r *sendingRoomRepository) TouchMembership(roomID string, userID uint) error { return nil }
+
+// storingMessageRepository assigns IDs to created messages
+type storingMessageRepository struct {
+	repository.MessageRepository
+	created []model.Message
+	limits  []int
+}
+
+func (r *storingMessageRepository) CreateMessage(message *model.Message) error {
+	message.ID = uint(len(r.created) + 1)
+	r.created = append(r.created, *message)
+	return nil
+}
+
+// newChatManager returns a manager whose loop is not running, so published broadcasts stay queued
+func newChatManager(members map[string][]uint) (*ClientManager, *storingMessageRepository) {
+	messages := &storingMessageRepository{}
+	return &ClientManager{
+		Broadcast:   make(chan BroadcastMessage, 16),
+		Rooms:       make(map[string]map[*Client]bool),
+		RoomRepo:    &sendingRoomRepository{fakeRoomRepository{members: members}},
+		MessageRepo: messages,
+	}, messages
+}
+
+func TestChatMessageToUnjoinedRoomIsNotBroadcast(t *testing.T) {
+	manager, messages := newChatManager(map[string][]uint{"lobby": {2}})
+	client := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+
+	client.HandleMessage([]byte(`{"type":"chat_message","room_id":"lobby","content":"spam"}`), manager)
+
+	frame := nextFrame(t, client)
+	if frame.Type != "error" || frame.Data["code"] != "not_a_member" {
+		t.Fatalf("got %+v, want a not_a_member error", frame)
+	}
+	if len(manager.Broadcast) != 0 || len(messages.created) != 0 {
+		t.Fatalf("%d broadcasts queued and %d messages stored for a room the sender never joined",
+			len(manager.Broadcast), len(messages.created))
+	}
+}
+
+func TestOversizedChatMessageGetsErrorFrame(t *testing.T) {
+	manager, messages := newChatManager(map[string][]uint{"lobby": {1}})
+	cfg := DefaultClientConfig()
+	cfg.MaxMessageSize = 10
+	client := NewClient(&model.User{ID: 1, Username: "alice"}, nil, cfg)
+
+	client.HandleMessage([]byte(`{"type":"chat_message","room_id":"lobby","content":"eleven char"}`), manager)
+
+	frame := nextFrame(t, client)
+	if frame.Type != "error" || frame.Data["code"] != "message_too_large" {
+		t.Fatalf("got %+v, want a message_too_large error", frame)
+	}
+	if len(manager.Broadcast) != 0 || len(messages.created) != 0 {
+		t.Fatal("an oversized message was sent on")
+	}
+
+	// The connection stays usable for messages within the limit
+	client.HandleMessage([]byte(`{"type":"chat_message","room_id":"lobby","content":"ten chars!"}`), manager)
+	if frame := nextFrame(t, client); frame.Type != "message_ack" {
+		t.Fatalf("got %+v after a message within the limit, want an ack", frame)
+	}
+}
+
+func TestMessageAckCarriesReceivedAndCreatedTimes(t *testing.T) {
+	manager, messages := newChatManager(map[string][]uint{"lobby": {1}})
+	client := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+
+	before := time.Now()
+	client.HandleMessage([]byte(`{"type":"chat_message","room_id":"lobby","content":"hello"}`), manager)
+
+	ack := nextFrame(t, client)
+	if ack.Type != "message_ack" || ack.Data["message_id"] != float64(messages.created[0].ID) {
+		t.Fatalf("got %+v, want an ack for the stored message", ack)
+	}
+
+	parse := func(key string) time.Time {
+		value, _ := ack.Data[key].(string)
+		parsed, err := model.ParseTimestamp(value)
+		if err != nil {
+			t.Fatalf("ack %s = %v: %v", key, ack.Data[key], err)
+		}
+		return parsed
+	}
+	receivedAt, createdAt := parse("received_at"), parse("created_at")
+	// Timestamps are sent with millisecond precision
+	if receivedAt.Before(before.Truncate(time.Millisecond)) || createdAt.Before(receivedAt) || ack.Timestamp.Before(createdAt) {
+		t.Fatalf("received %v, created %v, acked %v; want them in that order", receivedAt, createdAt, ack.Timestamp)
+	}
+}
+
+// dialWriter starts the write pump of a client configured with cfg and returns the far end of its socket
+func dialWriter(t *testing.T, cfg ClientConfig) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		go NewClient(&model.User{Username: "alice"}, conn, cfg).Write()
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestIdleConnectionGetsHeartbeats(t *testing.T) {
+	cfg := DefaultClientConfig()
+	cfg.HeartbeatInterval = 20 * time.Millisecond
+	conn := dialWriter(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("no heartbeat arrived: %v", err)
+		}
+		var frame Message
+		if err := json.Unmarshal(data, &frame); err != nil || frame.Type != MessageTypeHeartbeat {
+			t.Fatalf("unexpected frame %s", data)
+		}
+	}
+}
+
+func TestHeartbeatsAreOffByDefault(t *testing.T) {
+	conn := dialWriter(t, DefaultClientConfig())
+
+	_ = conn.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("unexpected frame %s", data)
+	}
+
+	cfg := DefaultClientConfig()
+	cfg.HeartbeatInterval = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("a negative heartbeat interval should be rejected")
+	}
+}
+
+func TestOnlyTheRecipientCanMarkAMessageRead(t *testing.T) {
+	manager, clients := startTestManager(t, "alice")
+	inbox := &unreadPrivateMessageRepository{messages: []model.PrivateMessage{
+		{ID: 5, SenderID: 1, RecipientID: 2, Sender: model.User{Username: "alice"}},
+	}}
+	manager.PrivateMessageRepo = inbox
+	bob := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	carol := NewClient(&model.User{ID: 3, Username: "carol"}, nil, DefaultClientConfig())
+
+	carol.HandleMessage([]byte(`{"type":"mark_read","message_id":5}`), manager)
+	if frame := nextFrame(t, carol); frame.Type != "error" || frame.Data["code"] != "not_recipient" {
+		t.Fatalf("got %+v, want a not_recipient error", frame)
+	}
+	bob.HandleMessage([]byte(`{"type":"mark_read","message_id":6}`), manager)
+	if frame := nextFrame(t, bob); frame.Type != "error" || frame.Data["code"] != "message_not_found" {
+		t.Fatalf("got %+v, want a message_not_found error", frame)
+	}
+	if inbox.messages[0].Read {
+		t.Fatal("a refused request marked the message read")
+	}
+
+	bob.HandleMessage([]byte(`{"type":"mark_read","message_id":5}`), manager)
+	receipt := nextFrame(t, clients["alice"])
+	if receipt.Type != "read_receipt" || receipt.Username != "bob" || receipt.Data["message_id"] != float64(5) {
+		t.Fatalf("unexpected frame %+v", receipt)
+	}
+	if !inbox.messages[0].Read {
+		t.Fatal("the message was not marked read")
+	}
+}
+
+// GetMessagesByRoomID pages through the created messages newest first and records the limit asked for
+func (r *storingMessageRepository) GetMessagesByRoomID(roomID string, limit, offset int, before *time.Time) ([]model.Message, error) {
+	r.limits = append(r.limits, limit)
+	var messages []model.Message
+	for i := len(r.created) - 1; i >= 0; i-- {
+		message := r.created[i]
+		if message.RoomID == roomID && (before == nil || message.CreatedAt.Before(*before)) {
+			messages = append(messages, message)
+		}
+	}
+	if offset >= len(messages) {
+		return nil, nil
+	}
+	return messages[offset:min(offset+limit, len(messages))], nil
+}
+
+func TestFetchHistoryFrame(t *testing.T) {
+	manager, messages := newChatManager(map[string][]uint{"lobby": {1}})
+	posted := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	for i, content := range []string{"first", "second", "third"} {
+		messages.created = append(messages.created, model.Message{
+			ID: uint(i + 1), RoomID: "lobby", UserID: 2, Username: "bob", Content: content, CreatedAt: posted.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	alice := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+	contents := func(frame *Message) []string {
+		t.Helper()
+		if frame.Type != MessageTypeHistory || frame.RoomID != "lobby" {
+			t.Fatalf("got %+v, want a history frame for the room", frame)
+		}
+		var got []string
+		entries, _ := frame.Data["messages"].([]interface{})
+		for _, entry := range entries {
+			message, _ := entry.(map[string]interface{})
+			got = append(got, message["content"].(string))
+		}
+		return got
+	}
+
+	alice.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby","limit":2}`), manager)
+	frame := nextFrame(t, alice)
+	if got := contents(frame); !slices.Equal(got, []string{"third", "second"}) || frame.Data["has_more"] != true {
+		t.Fatalf("first page %v, has_more %v; want the two newest with more to come", got, frame.Data["has_more"])
+	}
+
+	before := model.FormatTimestamp(messages.created[2].CreatedAt)
+	alice.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby","before":"`+before+`"}`), manager)
+	frame = nextFrame(t, alice)
+	if got := contents(frame); !slices.Equal(got, []string{"second", "first"}) || frame.Data["has_more"] != false {
+		t.Fatalf("older page %v, has_more %v; want the two oldest and no more", got, frame.Data["has_more"])
+	}
+
+	alice.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby","limit":100000}`), manager)
+	nextFrame(t, alice)
+	if last := messages.limits[len(messages.limits)-1]; last != config.DefaultMaxPageSize+1 {
+		t.Fatalf("an oversized limit reached the repository as %d, want it capped at %d", last, config.DefaultMaxPageSize+1)
+	}
+
+	// The configured pagination applies as it does to REST history
+	manager.Pagination = config.PaginationConfig{PageSize: 2, MaxPageSize: 5}
+	for request, want := range map[string]int{`"limit":0`: 2, `"limit":4`: 4, `"limit":500`: 5} {
+		alice.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby",`+request+`}`), manager)
+		nextFrame(t, alice)
+		if last := messages.limits[len(messages.limits)-1]; last != want+1 {
+			t.Fatalf("%s reached the repository as %d, want %d", request, last, want+1)
+		}
+	}
+
+	bob := NewClient(&model.User{ID: 2, Username: "bob"}, nil, DefaultClientConfig())
+	bob.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby"}`), manager)
+	if frame := nextFrame(t, bob); frame.Type != "error" || frame.Data["code"] != "not_a_member" {
+		t.Fatalf("got %+v, want a not_a_member error", frame)
+	}
+}
+
+func TestHistoryFramesKeepTheStoredMessageType(t *testing.T) {
+	manager, messages := newChatManager(map[string][]uint{"lobby": {1}})
+	posted := time.Now().Add(-time.Hour)
+	for i, stored := range []model.Message{
+		{Type: "text", Content: "hello"},
+		{Type: "image", AttachmentURL: "/download/a1"},
+		{Type: "file", AttachmentURL: "/download/a2"},
+		{Type: "system", Content: "topic changed"},
+	} {
+		stored.ID, stored.RoomID, stored.CreatedAt = uint(i+1), "lobby", posted.Add(time.Duration(i)*time.Minute)
+		messages.created = append(messages.created, stored)
+	}
+	alice := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+
+	alice.HandleMessage([]byte(`{"type":"fetch_history","room_id":"lobby"}`), manager)
+	frame := nextFrame(t, alice)
+	entries, _ := frame.Data["messages"].([]interface{})
+	var types, urls []string
+	for _, entry := range entries {
+		message, _ := entry.(map[string]interface{})
+		url, _ := message["attachment_url"].(string)
+		types, urls = append(types, message["type"].(string)), append(urls, url)
+	}
+	if want := []string{"system", "file", "image", "chat_message"}; !slices.Equal(types, want) {
+		t.Fatalf("history frame types %v, want %v", types, want)
+	}
+	if want := []string{"", "/download/a2", "/download/a1", ""}; !slices.Equal(urls, want) {
+		t.Fatalf("history attachment URLs %v, want %v", urls, want)
+	}
+}
+
+func (r *mentionUserRepository) GetUserByUsername(username string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *unreadPrivateMessageRepository) CreatePrivateMessage(pm *model.PrivateMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pm.ID = uint(len(r.messages) + 1)
+	r.messages = append(r.messages, *pm)
+	return nil
+}
+
+func TestPrivateMessageToOfflineUserIsStoredAsNotification(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob")
+	notifications := &fakeNotificationRepository{}
+	manager.NotificationRepo = notifications
+	manager.PrivateMessageRepo = &unreadPrivateMessageRepository{}
+	manager.UserRepo = &mentionUserRepository{users: []model.User{
+		{ID: 2, Username: "bob"},
+		{ID: 3, Username: "dave"},
+	}}
+	alice := clients["alice"]
+	alice.User.ID = 1
+
+	alice.HandleMessage([]byte(`{"type":"private_message","recipient_username":"bob","content":"hi bob"}`), manager)
+	if frame := nextFrameOfType(t, clients["bob"], "private_message"); frame.Content != "hi bob" {
+		t.Fatalf("bob got %+v", frame)
+	}
+	alice.HandleMessage([]byte(`{"type":"private_message","recipient_username":"dave","content":"hi dave"}`), manager)
+
+	notifications.mu.Lock()
+	defer notifications.mu.Unlock()
+	if len(notifications.stored) != 1 {
+		t.Fatalf("stored %+v, want one notification for dave", notifications.stored)
+	}
+	stored := notifications.stored[0]
+	if stored.UserID != 3 || stored.Type != model.NotificationPrivateMessage || stored.ActorID != 1 || stored.Content != "hi dave" {
+		t.Fatalf("stored %+v, want dave's private message notification", stored)
+	}
+	if !strings.Contains(stored.Payload, `"username":"alice"`) || !strings.Contains(stored.Payload, `"private_message_id":2`) {
+		t.Fatalf("payload %s does not name the sender and message", stored.Payload)
+	}
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// FilterAction is what a content filter does with a message containing disallowed words
+type FilterAction string
+
+const (
+	FilterOff    FilterAction = "off"    // Let messages through unchanged
+	FilterMask   FilterAction = "mask"   // Replace disallowed words with asterisks
+	FilterReject FilterAction = "reject" // Refuse the message
+)
+
+// ParseFilterAction validates a configured action; an empty value yields the fallback
+func ParseFilterAction(value string, fallback FilterAction) (FilterAction, error) {
+	switch action := FilterAction(strings.ToLower(strings.TrimSpace(value))); action {
+	case "":
+		return fallback, nil
+	case FilterOff, FilterMask, FilterReject:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown content filter action %q, must be off, mask or reject", value)
+	}
+}
+
+// FilterVerdict is the outcome of filtering a message
+type FilterVerdict int
+
+const (
+	FilterPassed FilterVerdict = iota
+	FilterMasked
+	FilterRejected
+)
+
+// FilterResult carries the verdict and, when masked, the content to deliver instead
+type FilterResult struct {
+	Verdict FilterVerdict
+	Content string
+}
+
+// ContentFilter decides whether a message may be delivered as written. roomID is empty for
+// private messages.
+type ContentFilter interface {
+	Filter(roomID, content string) FilterResult
+}
+
+// filterPolicy is the action and word list applied to one scope
+type filterPolicy struct {
+	action FilterAction
+	words  map[string]bool
+}
+
+// WordListFilter matches whole words case-insensitively against a list. Rooms may override the
+// action and add words of their own on top of the global list.
+type WordListFilter struct {
+	global filterPolicy
+	rooms  map[string]filterPolicy
+}
+
+// NewWordListFilter returns a filter applying action to the given words everywhere
+func NewWordListFilter(action FilterAction, words []string) *WordListFilter {
+	return &WordListFilter{
+		global: filterPolicy{action: action, words: wordSet(nil, words)},
+		rooms:  make(map[string]filterPolicy),
+	}
+}
+
+// SetRoomPolicy overrides the action in one room and adds words blocked only there
+func (f *WordListFilter) SetRoomPolicy(roomID string, action FilterAction, words []string) {
+	f.rooms[roomID] = filterPolicy{action: action, words: wordSet(f.global.words, words)}
+}
+
+// Filter applies the room's policy, or the global one, to the content
+func (f *WordListFilter) Filter(roomID, content string) FilterResult {
+	policy, ok := f.rooms[roomID]
+	if !ok || roomID == "" {
+		policy = f.global
+	}
+	if policy.action == FilterOff || len(policy.words) == 0 {
+		return FilterResult{Verdict: FilterPassed, Content: content}
+	}
+
+	masked, matches := maskWords(content, policy.words)
+	switch {
+	case matches == 0:
+		return FilterResult{Verdict: FilterPassed, Content: content}
+	case policy.action == FilterReject:
+		return FilterResult{Verdict: FilterRejected}
+	default:
+		return FilterResult{Verdict: FilterMasked, Content: masked}
+	}
+}
+
+// wordSet lowercases the words into a set, starting from a copy of base
+func wordSet(base map[string]bool, words []string) map[string]bool {
+	set := make(map[string]bool, len(base)+len(words))
+	for word := range base {
+		set[word] = true
+	}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+// maskWords replaces every listed word in content with asterisks and counts the replacements.
+// Words are runs of letters and digits, so "darn!" matches "darn" but "darning" does not.
+func maskWords(content string, blocked map[string]bool) (string, int) {
+	matches := 0
+	var out strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) > 0 && blocked[strings.ToLower(string(word))] {
+			out.WriteString(strings.Repeat("*", len(word)))
+			matches++
+		} else {
+			out.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range content {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+	return out.String(), matches
+}
+
+// NewContentFilterHook runs a content filter as a pre-send hook. Masked messages are delivered
+// with the sanitized content and a "filtered" annotation; rejected ones are refused.
+func NewContentFilterHook(name string, filter ContentFilter) PreSendHook {
+	return PreSendHookFunc{
+		HookName: name,
+		Fn: func(msg *PreSendMessage) error {
+			result := filter.Filter(msg.RoomID, msg.Content)
+			switch result.Verdict {
+			case FilterRejected:
+				return &HookRejection{Code: "content_rejected", Reason: "Message contains disallowed words"}
+			case FilterMasked:
+				msg.Content = result.Content
+				msg.Annotations["filtered"] = true
+			}
+			return nil
+		},
+	}
+}
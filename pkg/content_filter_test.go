@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWordListFilterOutcomes(t *testing.T) {
+	filter := NewWordListFilter(FilterMask, []string{"darn"})
+	filter.SetRoomPolicy("strict", FilterReject, []string{"spoiler"})
+
+	tests := []struct {
+		name    string
+		roomID  string
+		content string
+		verdict FilterVerdict
+		want    string
+	}{
+		{"clean message passes", "lobby", "hello there", FilterPassed, "hello there"},
+		{"listed word is masked", "lobby", "Darn it!", FilterMasked, "**** it!"},
+		{"longer word is left alone", "lobby", "darning socks", FilterPassed, "darning socks"},
+		{"room policy rejects", "strict", "darn", FilterRejected, ""},
+		{"room words only apply in the room", "lobby", "spoiler alert", FilterPassed, "spoiler alert"},
+		{"room words are blocked in the room", "strict", "spoiler alert", FilterRejected, ""},
+		{"private messages use the global policy", "", "darn", FilterMasked, "****"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := filter.Filter(tt.roomID, tt.content)
+			if result.Verdict != tt.verdict || result.Content != tt.want {
+				t.Fatalf("Filter(%q, %q) = %v %q, want %v %q", tt.roomID, tt.content, result.Verdict, result.Content, tt.verdict, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentFilterHook(t *testing.T) {
+	manager := &ClientManager{}
+	filter := NewWordListFilter(FilterMask, []string{"darn"})
+	filter.SetRoomPolicy("strict", FilterReject, nil)
+	manager.RegisterPreSendHook(NewContentFilterHook("content_filter", filter))
+
+	masked := &PreSendMessage{Kind: "message_edit", RoomID: "lobby", Content: "darn"}
+	if err := manager.RunPreSendHooks(masked); err != nil {
+		t.Fatalf("masked message rejected: %v", err)
+	}
+	if masked.Content != "****" || masked.Annotations["filtered"] != true {
+		t.Fatalf("expected masked content with a filtered annotation, got %q %v", masked.Content, masked.Annotations)
+	}
+
+	err := manager.RunPreSendHooks(&PreSendMessage{Kind: "chat_message", RoomID: "strict", Content: "darn"})
+	var rejection *HookRejection
+	if !errors.As(err, &rejection) || rejection.Code != "content_rejected" {
+		t.Fatalf("expected a content_rejected rejection, got %v", err)
+	}
+}
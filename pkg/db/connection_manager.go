@@ -31,6 +31,12 @@ const (
 	MaxBackoff           = 32 * time.Second
 	HealthCheckTimeout   = 5 * time.Second
 	IdleThresholdForSkip = 5 * time.Minute
+
+	// IdleKeepaliveInterval is how often the connection is still pinged while idle, so one that
+	// dies during a quiet period is replaced before the next request needs it. It is well below
+	// IdleThresholdForSkip: a drop goes unnoticed for at most this long, while an idle server
+	// still pings half as often as a busy one.
+	IdleKeepaliveInterval = 1 * time.Minute
 )
 
 var lastActivityTime time.Time
@@ -44,6 +50,24 @@ func debugLog(context, message string, args ...interface{}) {
 	}
 }
 
+func buildDSN(cfg *config.APIConfig, password string) string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		cfg.DB.Host,
+		cfg.DB.Username,
+		password,
+		cfg.DB.Names.LIVECHAT,
+		cfg.DB.Port,
+		cfg.DB.SSLMode,
+		cfg.Context.TimeZone,
+	)
+}
+
+// RedactedDSN returns the connection string for cfg with the password masked, safe for logging
+func RedactedDSN(cfg *config.APIConfig) string {
+	return buildDSN(cfg, "****")
+}
+
 func InitDBFromConfig(cfg *config.APIConfig) error {
 	connMutex.Lock()
 	dbConfig = cfg
@@ -63,16 +87,7 @@ func InitDBFromConfig(cfg *config.APIConfig) error {
 	fmt.Printf(" Database Port         : %d\n", cfg.DB.Port)
 	fmt.Printf(" Debug Mode            : %v\n", debugMode)
 
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-		cfg.DB.Host,
-		cfg.DB.Username,
-		cfg.DB.Password.Value,
-		cfg.DB.Names.LIVECHAT,
-		cfg.DB.Port,
-		cfg.DB.SSLMode,
-		cfg.Context.TimeZone,
-	)
+	dsn := buildDSN(cfg, cfg.DB.Password.Value)
 
 	debugLog("InitDBFromConfig", "Attempting to open database connection")
 
@@ -145,62 +160,75 @@ func monitorConnectionPool() {
 	ticker := time.NewTicker(PingInterval)
 	defer ticker.Stop()
 
+	var lastCheck time.Time
 	for range ticker.C {
-		activityMutex.RLock()
-		timeSinceActivity := time.Since(lastActivityTime)
-		activityMutex.RUnlock()
+		lastCheck = checkConnection(lastCheck)
+	}
+}
 
-		if timeSinceActivity > IdleThresholdForSkip {
-			debugLog("monitorConnectionPool", "Skipping health check - DB idle for %v (threshold: %v)",
-				timeSinceActivity, IdleThresholdForSkip)
-			continue
-		}
+// checkConnection runs one scheduled health check, reconnecting when the connection is missing or
+// does not answer. While the database is idle it only checks once IdleKeepaliveInterval has passed
+// since lastCheck. It returns when the check ran, or lastCheck when it was skipped.
+func checkConnection(lastCheck time.Time) time.Time {
+	activityMutex.RLock()
+	timeSinceActivity := time.Since(lastActivityTime)
+	activityMutex.RUnlock()
+
+	// While idle, ping only at the keepalive interval rather than skipping outright
+	if timeSinceActivity > IdleThresholdForSkip && time.Since(lastCheck) < IdleKeepaliveInterval {
+		debugLog("checkConnection", "Skipping health check - DB idle for %v (threshold: %v)",
+			timeSinceActivity, IdleThresholdForSkip)
+		return lastCheck
+	}
+	lastCheck = time.Now()
 
-		debugLog("monitorConnectionPool", "Performing scheduled health check (last activity: %v ago)",
-			timeSinceActivity)
+	debugLog("checkConnection", "Performing scheduled health check (last activity: %v ago)",
+		timeSinceActivity)
 
-		db := GetDB()
-		if db == nil {
-			debugLog("monitorConnectionPool", "WARNING: Global connection is nil, triggering reconnect")
-			ReconnectDB("monitorConnectionPool - nil connection")
-			continue
-		}
+	// Read the connection without GetDB so the monitor's own pings do not count as activity
+	connMutex.RLock()
+	db := conn
+	connMutex.RUnlock()
+	if db == nil {
+		debugLog("checkConnection", "WARNING: Global connection is nil, triggering reconnect")
+		ReconnectDB("monitorConnectionPool - nil connection")
+		return lastCheck
+	}
 
-		sqlDB, err := db.DB()
-		if err != nil {
-			debugLog("monitorConnectionPool", "ERROR: Failed to get sql.DB: %v, triggering reconnect", err)
-			ReconnectDB("monitorConnectionPool - failed to get sql.DB")
-			continue
-		}
+	sqlDB, err := db.DB()
+	if err != nil {
+		debugLog("checkConnection", "ERROR: Failed to get sql.DB: %v, triggering reconnect", err)
+		ReconnectDB("monitorConnectionPool - failed to get sql.DB")
+		return lastCheck
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
-		pingStart := time.Now()
-		err = sqlDB.PingContext(ctx)
-		pingDuration := time.Since(pingStart)
-		cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+	pingStart := time.Now()
+	err = sqlDB.PingContext(ctx)
+	pingDuration := time.Since(pingStart)
+	cancel()
 
-		if err != nil {
-			debugLog("monitorConnectionPool", "Health check FAILED after %v: %v", pingDuration, err)
-			log.Printf("Database connection unhealthy: %v\n", err)
-
-			debugLog("monitorConnectionPool", "Closing unhealthy connection before reconnect")
-			err := sqlDB.Close()
-			if err != nil {
-				debugLog("monitorConnectionPool", "Error closing unhealthy connection", err)
-				return
-			}
+	if err != nil {
+		debugLog("checkConnection", "Health check FAILED after %v: %v", pingDuration, err)
+		log.Printf("Database connection unhealthy: %v\n", err)
 
-			ReconnectDB("monitorConnectionPool - unhealthy connection")
-		} else {
-			debugLog("monitorConnectionPool", "Health check SUCCESS in %v", pingDuration)
+		debugLog("checkConnection", "Closing unhealthy connection before reconnect")
+		if err := sqlDB.Close(); err != nil {
+			// Reconnecting matters more than a clean close; stopping here would end monitoring
+			debugLog("checkConnection", "Error closing unhealthy connection: %v", err)
+		}
 
-			if debugMode {
-				stats := sqlDB.Stats()
-				debugLog("monitorConnectionPool", "Pool stats: Open=%d, InUse=%d, Idle=%d",
-					stats.OpenConnections, stats.InUse, stats.Idle)
-			}
+		ReconnectDB("monitorConnectionPool - unhealthy connection")
+	} else {
+		debugLog("checkConnection", "Health check SUCCESS in %v", pingDuration)
+
+		if debugMode {
+			stats := sqlDB.Stats()
+			debugLog("checkConnection", "Pool stats: Open=%d, InUse=%d, Idle=%d",
+				stats.OpenConnections, stats.InUse, stats.Idle)
 		}
 	}
+	return lastCheck
 }
 
 func ReconnectDB(callerContext string) {
@@ -223,16 +251,7 @@ func ReconnectDB(callerContext string) {
 		debugLog("ReconnectDB", "Reconnection attempt %d/%d (backoff: %v)",
 			attempt, MaxReconnectAttempts, backoff)
 
-		dsn := fmt.Sprintf(
-			"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-			dbConfig.DB.Host,
-			dbConfig.DB.Username,
-			dbConfig.DB.Password.Value,
-			dbConfig.DB.Names.LIVECHAT,
-			dbConfig.DB.Port,
-			dbConfig.DB.SSLMode,
-			dbConfig.Context.TimeZone,
-		)
+		dsn := buildDSN(dbConfig, dbConfig.DB.Password.Value)
 
 		debugLog("ReconnectDB", "Opening new connection (attempt %d)", attempt)
 
@@ -446,3 +465,57 @@ func CloseDB() error {
 
 	return nil
 }
+
+// PoolStats is a JSON-friendly snapshot of the connection pool
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// Health checks the shared connection; its zero value is ready to use
+type Health struct{}
+
+func (Health) sqlDB() (*sql.DB, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("database connection is not initialized")
+	}
+	return db.DB()
+}
+
+// Ping checks that the database answers within ctx's deadline
+func (h Health) Ping(ctx context.Context) error {
+	sqlDB, err := h.sqlDB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// PoolStats returns the current connection pool statistics
+func (h Health) PoolStats() (PoolStats, error) {
+	sqlDB, err := h.sqlDB()
+	if err != nil {
+		return PoolStats{}, err
+	}
+
+	stats := sqlDB.Stats()
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// unreachableConfig points at a local port nothing is listening on
+func unreachableConfig(t *testing.T) *config.APIConfig {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	cfg := &config.APIConfig{}
+	cfg.Context.Mode = gin.ReleaseMode
+	cfg.DB.Host = "127.0.0.1"
+	cfg.DB.Port = port
+	cfg.DB.Username = "chatter"
+	cfg.DB.Password = config.DBPassword{Value: "s3cret-password"}
+	cfg.DB.SSLMode = "disable"
+	cfg.DB.Names.LIVECHAT = "livechat"
+	return cfg
+}
+
+func TestUnreachableDatabaseFailsInitialization(t *testing.T) {
+	cfg := unreachableConfig(t)
+
+	err := InitDBFromConfig(cfg)
+	if err == nil {
+		t.Fatal("expected the initial connection to fail")
+	}
+	if !strings.Contains(err.Error(), "failed to connect to database") {
+		t.Fatalf("error %q does not say the connection failed", err)
+	}
+	if GetDB() != nil {
+		t.Fatal("a failed initialization left a connection behind")
+	}
+}
+
+func TestRedactedDSNHidesThePassword(t *testing.T) {
+	cfg := unreachableConfig(t)
+
+	dsn := RedactedDSN(cfg)
+	if strings.Contains(dsn, "s3cret-password") || !strings.Contains(dsn, "password=****") {
+		t.Fatalf("DSN %q is not redacted", dsn)
+	}
+	if !strings.Contains(dsn, "host=127.0.0.1") || !strings.Contains(dsn, "user=chatter") {
+		t.Fatalf("DSN %q lost the connection details", dsn)
+	}
+}
+
+// testDatabaseConfig connects to the disposable database named by LIVE_CHATTER_TEST_DSN, as the
+// repository tests do, skipping the test without one
+func testDatabaseConfig(t *testing.T) *config.APIConfig {
+	t.Helper()
+	dsn := os.Getenv("LIVE_CHATTER_TEST_DSN")
+	if dsn == "" {
+		t.Skip("LIVE_CHATTER_TEST_DSN is not set")
+	}
+	parsed, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.APIConfig{}
+	cfg.Context.Mode = gin.ReleaseMode
+	cfg.Context.TimeZone = "UTC"
+	cfg.DB.Host = parsed.Host
+	cfg.DB.Port = int(parsed.Port)
+	cfg.DB.Username = parsed.User
+	cfg.DB.Password = config.DBPassword{Value: parsed.Password}
+	cfg.DB.Names.LIVECHAT = parsed.Database
+	cfg.DB.SSLMode = "disable"
+	if parsed.TLSConfig != nil {
+		cfg.DB.SSLMode = "require"
+	}
+	cfg.DB.Pool = config.DBPoolConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: 300}
+	return cfg
+}
+
+// goIdle makes the database look unused for longer than the idle threshold
+func goIdle() {
+	activityMutex.Lock()
+	lastActivityTime = time.Now().Add(-2 * IdleThresholdForSkip)
+	activityMutex.Unlock()
+}
+
+func TestIdleChecksWaitForTheKeepaliveInterval(t *testing.T) {
+	if IdleKeepaliveInterval >= IdleThresholdForSkip {
+		t.Fatalf("keepalive every %v would leave a drop unnoticed as long as the idle threshold", IdleKeepaliveInterval)
+	}
+
+	goIdle()
+	lastCheck := time.Now().Add(-IdleKeepaliveInterval / 2)
+	if got := checkConnection(lastCheck); !got.Equal(lastCheck) {
+		t.Fatalf("an idle check %v after the last one ran", time.Since(lastCheck))
+	}
+}
+
+func TestConnectionDroppedWhileIdleIsReplacedBeforeTheNextQuery(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+	if err := InitDBFromConfig(cfg); err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { _ = CloseDB() })
+
+	// Lose the connection during a quiet period
+	connMutex.RLock()
+	dropped := conn
+	connMutex.RUnlock()
+	sqlDB, err := dropped.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	goIdle()
+
+	lastCheck := time.Now().Add(-IdleKeepaliveInterval)
+	if got := checkConnection(lastCheck); !got.After(lastCheck) {
+		t.Fatal("the idle keepalive check was skipped")
+	}
+
+	db := GetDB()
+	if db == nil || db == dropped {
+		t.Fatal("the dropped connection was not replaced")
+	}
+	var one int
+	if err := db.Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		t.Fatalf("the next query = %d, %v, want it to succeed", one, err)
+	}
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"time"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+
+	Log "live-chatter/pkg/logger"
+)
+
+// maxShortcodesPerMessage bounds the custom emoji looked up for a single message
+const maxShortcodesPerMessage = 20
+
+// NewCustomEmojiHook expands ":name:" shortcodes that refer to custom emoji available where the
+// message is sent. The text is left as written; a "custom_emoji" annotation maps each shortcode
+// to its image URL so clients can render it. Private messages can use global emoji only.
+func NewCustomEmojiHook(repo repository.EmojiRepository) PreSendHook {
+	return PreSendHookFunc{
+		HookName: "custom_emoji",
+		Fn: func(msg *PreSendMessage) error {
+			resolved := make(map[string]string)
+			seen := make(map[string]bool)
+			for _, match := range shortcodePattern.FindAllStringSubmatch(msg.Content, -1) {
+				shortcode, name := match[0], match[1]
+				if seen[shortcode] {
+					continue
+				}
+				if len(seen) == maxShortcodesPerMessage {
+					break
+				}
+				seen[shortcode] = true
+
+				emoji, err := ResolveCustomEmoji(repo, name, msg.RoomID)
+				if err != nil {
+					Log.Error("Failed to look up custom emoji %s: %v", shortcode, err)
+					continue
+				}
+				if emoji != nil {
+					resolved[shortcode] = emoji.URL
+				}
+			}
+			if len(resolved) > 0 {
+				msg.Annotations["custom_emoji"] = resolved
+			}
+			return nil
+		},
+	}
+}
+
+// loadCustomEmoji fetches the global emoji and those of the given rooms for a connecting client
+func (manager *ClientManager) loadCustomEmoji(rooms []model.Room) []model.CustomEmoji {
+	if manager.EmojiRepo == nil {
+		return nil
+	}
+
+	roomIDs := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	emoji, err := manager.EmojiRepo.ListEmojiForRooms(roomIDs)
+	if err != nil {
+		Log.Error("Failed to load custom emoji: %v", err)
+		return nil
+	}
+	return emoji
+}
+
+// sendCapabilities tells a freshly connected client which custom emoji it may use, so it can
+// render shortcodes and offer them as reactions
+func (manager *ClientManager) sendCapabilities(client *Client, emoji []model.CustomEmoji) {
+	if emoji == nil {
+		emoji = []model.CustomEmoji{}
+	}
+	client.SendMessage(&Message{
+		ID:        generateMessageID(),
+		Type:      MessageTypeCapabilities,
+		Username:  "System",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"custom_emoji": emoji,
+		},
+	})
+}
+
+// roomEmoji lists the custom emoji usable in a room for its room_joined frame, or nil if they
+// cannot be loaded
+func (manager *ClientManager) roomEmoji(roomID string) []model.CustomEmoji {
+	if manager.EmojiRepo == nil {
+		return nil
+	}
+	emoji, err := manager.EmojiRepo.ListEmoji(roomID)
+	if err != nil {
+		Log.Error("Failed to load custom emoji of room %s: %v", roomID, err)
+		return nil
+	}
+	return emoji
+}
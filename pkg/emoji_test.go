@@ -0,0 +1,161 @@
+package pkg
+
+import (
+	"testing"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// fakeEmojiRepository holds emoji in memory; RoomID nil is the global scope
+type fakeEmojiRepository struct {
+	emoji []model.CustomEmoji
+}
+
+func (r *fakeEmojiRepository) CreateEmoji(emoji *model.CustomEmoji) error {
+	r.emoji = append(r.emoji, *emoji)
+	return nil
+}
+
+func (r *fakeEmojiRepository) GetEmojiByID(id uint) (*model.CustomEmoji, error) {
+	for i := range r.emoji {
+		if r.emoji[i].ID == id {
+			return &r.emoji[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeEmojiRepository) FindEmoji(name string, roomID *string) (*model.CustomEmoji, error) {
+	for i, emoji := range r.emoji {
+		sameScope := (roomID == nil && emoji.RoomID == nil) || (roomID != nil && emoji.RoomID != nil && *roomID == *emoji.RoomID)
+		if emoji.Name == name && sameScope {
+			return &r.emoji[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeEmojiRepository) ListEmoji(roomID string) ([]model.CustomEmoji, error) {
+	return r.ListEmojiForRooms([]string{roomID})
+}
+
+func (r *fakeEmojiRepository) ListEmojiForRooms(roomIDs []string) ([]model.CustomEmoji, error) {
+	var found []model.CustomEmoji
+	for _, emoji := range r.emoji {
+		if emoji.RoomID == nil {
+			found = append(found, emoji)
+			continue
+		}
+		for _, roomID := range roomIDs {
+			if *emoji.RoomID == roomID {
+				found = append(found, emoji)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeEmojiRepository) DeleteEmoji(uint) error { return nil }
+
+func newFakeEmojiRepository() *fakeEmojiRepository {
+	lobby := "lobby"
+	return &fakeEmojiRepository{emoji: []model.CustomEmoji{
+		{ID: 1, Name: "party_parrot", URL: "https://cdn.example.com/parrot.gif"},
+		{ID: 2, Name: "lobby_wave", URL: "https://cdn.example.com/wave.gif", RoomID: &lobby},
+	}}
+}
+
+func TestCustomEmojiHookAnnotatesShortcodes(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(NewCustomEmojiHook(newFakeEmojiRepository()))
+
+	msg := &PreSendMessage{Kind: "chat_message", RoomID: "lobby", Content: "hi :lobby_wave: :party_parrot: :unknown: :party_parrot:"}
+	if err := manager.RunPreSendHooks(msg); err != nil {
+		t.Fatalf("RunPreSendHooks: %v", err)
+	}
+	resolved, _ := msg.Annotations["custom_emoji"].(map[string]string)
+	if len(resolved) != 2 || resolved[":lobby_wave:"] != "https://cdn.example.com/wave.gif" || resolved[":party_parrot:"] == "" {
+		t.Fatalf("custom_emoji annotation = %v", msg.Annotations["custom_emoji"])
+	}
+	if msg.Content != "hi :lobby_wave: :party_parrot: :unknown: :party_parrot:" {
+		t.Fatalf("content was rewritten: %q", msg.Content)
+	}
+}
+
+func TestCustomEmojiHookKeepsRoomEmojiInTheirRoom(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(NewCustomEmojiHook(newFakeEmojiRepository()))
+
+	msg := &PreSendMessage{Kind: "private_message", RecipientUsername: "bob", Content: ":lobby_wave:"}
+	if err := manager.RunPreSendHooks(msg); err != nil {
+		t.Fatalf("RunPreSendHooks: %v", err)
+	}
+	if _, ok := msg.Annotations["custom_emoji"]; ok {
+		t.Fatalf("room emoji expanded outside its room: %v", msg.Annotations)
+	}
+}
+
+func TestNormalizeReactionChecksCustomEmojiScope(t *testing.T) {
+	manager := &ClientManager{EmojiRepo: newFakeEmojiRepository()}
+
+	if _, err := manager.normalizeReaction(":lobby_wave:", "lobby", true); err != nil {
+		t.Fatalf("room emoji rejected in its room: %v", err)
+	}
+	if _, err := manager.normalizeReaction(":lobby_wave:", "general", true); err == nil {
+		t.Fatal("room emoji accepted in another room")
+	}
+	if _, err := manager.normalizeReaction(":nope:", "lobby", true); err == nil {
+		t.Fatal("unknown custom emoji accepted")
+	}
+}
+
+type fakeMessageRepository struct {
+	repository.MessageRepository
+	messages map[uint]*model.Message
+}
+
+func (r *fakeMessageRepository) GetMessageByID(id uint) (*model.Message, error) {
+	return r.messages[id], nil
+}
+
+// fakeReactionRepository keeps one user's reactions as a set of emoji
+type fakeReactionRepository struct {
+	repository.ReactionRepository
+	reactions map[string]bool
+}
+
+func (r *fakeReactionRepository) RemoveReaction(messageID, userID uint, emoji string) (bool, error) {
+	removed := r.reactions[emoji]
+	delete(r.reactions, emoji)
+	return removed, nil
+}
+
+func (r *fakeReactionRepository) CountReactions(messageID uint) ([]repository.ReactionCount, error) {
+	var counts []repository.ReactionCount
+	for emoji := range r.reactions {
+		counts = append(counts, repository.ReactionCount{Emoji: emoji, Count: 1})
+	}
+	return counts, nil
+}
+
+func TestReactionWithDeletedCustomEmojiCanBeRemoved(t *testing.T) {
+	manager, _ := startTestManager(t)
+	manager.EmojiRepo = newFakeEmojiRepository()
+	manager.MessageRepo = &fakeMessageRepository{messages: map[uint]*model.Message{5: {ID: 5, RoomID: "lobby"}}}
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1}}}
+	reactions := &fakeReactionRepository{reactions: map[string]bool{":retired:": true}}
+	manager.ReactionRepo = reactions
+
+	counts, err := manager.React(1, 5, ":retired:", false)
+	if err != nil {
+		t.Fatalf("React: %v", err)
+	}
+	if len(counts) != 0 || reactions.reactions[":retired:"] {
+		t.Fatalf("reaction with a deleted emoji was not removed: %v", counts)
+	}
+
+	if _, err := manager.React(1, 5, ":retired:", true); err == nil {
+		t.Fatal("reaction with a deleted emoji was added")
+	}
+}
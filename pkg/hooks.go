@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"live-chatter/pkg/model"
+)
+
+// PreSendMessage is what a pre-send hook sees for each chat message, direct message or edit before
+// it is persisted and delivered. Hooks may rewrite Content and add Annotations, which are passed to
+// recipients in the message's data.
+type PreSendMessage struct {
+	Kind              string      // "chat_message", "private_message" or "message_edit"
+	Sender            *model.User // Only ID and Username are guaranteed to be set
+	RoomID            string      // Set for chat messages and edits
+	RecipientUsername string      // Set for private messages
+	Content           string
+	HasAttachment     bool // The message carries an attachment, so it may have no text
+	Annotations       map[string]interface{}
+}
+
+// PreSendHook inspects an outgoing message. Returning an error rejects the message; a
+// *HookRejection controls the code and reason reported to the sender.
+type PreSendHook interface {
+	Name() string
+	PreSend(msg *PreSendMessage) error
+}
+
+// PreSendHookFunc adapts a function into a PreSendHook
+type PreSendHookFunc struct {
+	HookName string
+	Fn       func(msg *PreSendMessage) error
+}
+
+func (h PreSendHookFunc) Name() string                      { return h.HookName }
+func (h PreSendHookFunc) PreSend(msg *PreSendMessage) error { return h.Fn(msg) }
+
+// HookRejection is returned by a hook to refuse a message with a reason shown to the sender
+type HookRejection struct {
+	Hook   string
+	Code   string
+	Reason string
+}
+
+func (r *HookRejection) Error() string {
+	return fmt.Sprintf("message rejected by %s: %s", r.Hook, r.Reason)
+}
+
+// data returns the annotations for a message's data field, or nil when no hook added any
+func (msg *PreSendMessage) data() map[string]interface{} {
+	if len(msg.Annotations) == 0 {
+		return nil
+	}
+	return msg.Annotations
+}
+
+// RegisterPreSendHook appends a hook; hooks run in registration order
+func (manager *ClientManager) RegisterPreSendHook(hook PreSendHook) {
+	manager.preSendHooks = append(manager.preSendHooks, hook)
+}
+
+// RunPreSendHooks passes the message through every registered hook in order, stopping at the
+// first rejection. Plain errors are wrapped into a HookRejection naming the hook. A message left
+// without text is rejected unless it carries an attachment.
+func (manager *ClientManager) RunPreSendHooks(msg *PreSendMessage) error {
+	if msg.Annotations == nil {
+		msg.Annotations = make(map[string]interface{})
+	}
+
+	for _, hook := range manager.preSendHooks {
+		if err := hook.PreSend(msg); err != nil {
+			var rejection *HookRejection
+			if errors.As(err, &rejection) {
+				if rejection.Hook == "" {
+					rejection.Hook = hook.Name()
+				}
+				return rejection
+			}
+			return &HookRejection{Hook: hook.Name(), Code: "message_rejected", Reason: err.Error()}
+		}
+	}
+
+	if strings.TrimSpace(msg.Content) == "" && !msg.HasAttachment {
+		return &HookRejection{Hook: "pre-send", Code: "message_rejected", Reason: "Message is empty after filtering"}
+	}
+	return nil
+}
+
+// htmlMarkupPattern matches tags so they can be stripped from message content
+var htmlMarkupPattern = regexp.MustCompile(`<[^>]*>`)
+
+// NewHTMLSanitizerHook strips markup from message content so it cannot be rendered as HTML by clients
+func NewHTMLSanitizerHook() PreSendHook {
+	return PreSendHookFunc{
+		HookName: "html_sanitizer",
+		Fn: func(msg *PreSendMessage) error {
+			sanitized := htmlMarkupPattern.ReplaceAllString(msg.Content, "")
+			sanitized = strings.NewReplacer("<", "", ">", "").Replace(sanitized)
+			if sanitized != msg.Content {
+				msg.Content = sanitized
+				msg.Annotations["sanitized"] = true
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunPreSendHooksAllowsUncaptionedAttachments(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(NewHTMLSanitizerHook())
+
+	msg := &PreSendMessage{Kind: "chat_message", RoomID: "lobby", HasAttachment: true}
+	if err := manager.RunPreSendHooks(msg); err != nil {
+		t.Fatalf("attachment without caption rejected: %v", err)
+	}
+}
+
+func TestRunPreSendHooksRejectsEmptyText(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(NewHTMLSanitizerHook())
+
+	err := manager.RunPreSendHooks(&PreSendMessage{Kind: "chat_message", RoomID: "lobby", Content: "<b></b>"})
+	var rejection *HookRejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("expected a HookRejection for content emptied by filtering, got %v", err)
+	}
+}
+
+func TestRunPreSendHooksWrapsPlainErrors(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(PreSendHookFunc{
+		HookName: "failing",
+		Fn:       func(*PreSendMessage) error { return errors.New("boom") },
+	})
+
+	err := manager.RunPreSendHooks(&PreSendMessage{Content: "hello"})
+	var rejection *HookRejection
+	if !errors.As(err, &rejection) || rejection.Hook != "failing" {
+		t.Fatalf("expected a rejection naming the hook, got %v", err)
+	}
+}
+
+// recordingHook appends its name to calls and then runs fn, if any
+func recordingHook(name string, calls *[]string, fn func(*PreSendMessage) error) PreSendHook {
+	return PreSendHookFunc{HookName: name, Fn: func(msg *PreSendMessage) error {
+		*calls = append(*calls, name)
+		if fn != nil {
+			return fn(msg)
+		}
+		return nil
+	}}
+}
+
+func TestPreSendHooksRunInOrderAndMutate(t *testing.T) {
+	var calls []string
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(recordingHook("upper", &calls, func(msg *PreSendMessage) error {
+		msg.Content = strings.ToUpper(msg.Content)
+		return nil
+	}))
+	manager.RegisterPreSendHook(recordingHook("exclaim", &calls, func(msg *PreSendMessage) error {
+		msg.Content += "!"
+		msg.Annotations["shouted"] = true
+		return nil
+	}))
+
+	msg := &PreSendMessage{Kind: "chat_message", Content: "hello"}
+	if err := manager.RunPreSendHooks(msg); err != nil {
+		t.Fatalf("RunPreSendHooks: %v", err)
+	}
+	if strings.Join(calls, ",") != "upper,exclaim" {
+		t.Fatalf("hooks ran as %v, want registration order", calls)
+	}
+	// The second hook saw the first one's rewrite
+	if msg.Content != "HELLO!" || msg.data()["shouted"] != true {
+		t.Fatalf("got content %q and data %v", msg.Content, msg.data())
+	}
+}
+
+func TestRejectingHookShortCircuits(t *testing.T) {
+	var calls []string
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(recordingHook("first", &calls, nil))
+	manager.RegisterPreSendHook(recordingHook("gate", &calls, func(*PreSendMessage) error {
+		return &HookRejection{Code: "off_topic", Reason: "Stay on topic"}
+	}))
+	manager.RegisterPreSendHook(recordingHook("never", &calls, nil))
+
+	err := manager.RunPreSendHooks(&PreSendMessage{Kind: "chat_message", Content: "hello"})
+	var rejection *HookRejection
+	if !errors.As(err, &rejection) || rejection.Hook != "gate" || rejection.Code != "off_topic" || rejection.Reason != "Stay on topic" {
+		t.Fatalf("got %v, want the gate hook's rejection", err)
+	}
+	if strings.Join(calls, ",") != "first,gate" {
+		t.Fatalf("hooks ran as %v, want none after the rejection", calls)
+	}
+}
+
+func TestHTMLSanitizerHookStripsMarkup(t *testing.T) {
+	manager := &ClientManager{}
+	manager.RegisterPreSendHook(NewHTMLSanitizerHook())
+
+	msg := &PreSendMessage{Kind: "chat_message", Content: `hi <script>alert(1)</script><b>there</b>`}
+	if err := manager.RunPreSendHooks(msg); err != nil {
+		t.Fatalf("RunPreSendHooks: %v", err)
+	}
+	if strings.ContainsAny(msg.Content, "<>") {
+		t.Fatalf("markup survived: %q", msg.Content)
+	}
+}
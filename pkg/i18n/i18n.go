@@ -0,0 +1,122 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used when a user has no locale or a key is missing from theirs
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+var (
+	catalogs = make(map[string]map[string]string)
+	mu       sync.RWMutex
+)
+
+func init() {
+	if err := load(builtinLocales, "locales"); err != nil {
+		panic(fmt.Sprintf("failed to load built-in locales: %v", err))
+	}
+}
+
+// LoadDir merges every <locale>.json catalog in dir over the built-in ones,
+// letting operators add locales or override individual strings
+func LoadDir(dir string) error {
+	return load(os.DirFS(dir), ".")
+}
+
+func load(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("invalid catalog %s: %w", entry.Name(), err)
+		}
+
+		locale := normalize(strings.TrimSuffix(entry.Name(), ".json"))
+		mu.Lock()
+		if catalogs[locale] == nil {
+			catalogs[locale] = make(map[string]string)
+		}
+		for key, text := range messages {
+			catalogs[locale][key] = text
+		}
+		mu.Unlock()
+	}
+
+	return nil
+}
+
+// Supported returns the catalog locale that serves the requested one ("pt-BR" falls back to
+// "pt"), or DefaultLocale when neither is available
+func Supported(locale string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, candidate := range candidates(locale) {
+		if _, ok := catalogs[candidate]; ok {
+			return candidate
+		}
+	}
+	return DefaultLocale
+}
+
+// Translate renders key in the given locale, substituting {name} placeholders from params.
+// Missing translations fall back to the base language, then English, then the key itself.
+func Translate(locale, key string, params map[string]string) string {
+	mu.RLock()
+	text, found := "", false
+	for _, candidate := range append(candidates(locale), DefaultLocale) {
+		if text, found = catalogs[candidate][key]; found {
+			break
+		}
+	}
+	mu.RUnlock()
+
+	if !found {
+		text = key
+	}
+	for name, value := range params {
+		text = strings.ReplaceAll(text, "{"+name+"}", value)
+	}
+	return text
+}
+
+// candidates lists the catalog names to try for a locale, most specific first
+func candidates(locale string) []string {
+	locale = normalize(locale)
+	if locale == "" {
+		return nil
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		return []string{locale, base}
+	}
+	return []string{locale}
+}
+
+// normalize turns "pt_BR" or "PT-br" into "pt-br"
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
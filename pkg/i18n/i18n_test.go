@@ -0,0 +1,71 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranslateSelectsLocaleWithFallback(t *testing.T) {
+	params := map[string]string{"username": "alice"}
+	tests := []struct {
+		name   string
+		locale string
+		want   string
+	}{
+		{"english", "en", "alice joined the room"},
+		{"spanish", "es", "alice se unió a la sala"},
+		{"region falls back to its language", "fr-CA", "alice a rejoint le salon"},
+		{"underscores and case are normalized", "ES_mx", "alice se unió a la sala"},
+		{"unknown locale falls back to english", "xx", "alice joined the room"},
+		{"no locale is english", "", "alice joined the room"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.locale, "user_joined_room", params); got != tt.want {
+				t.Fatalf("Translate(%q) = %q, want %q", tt.locale, got, tt.want)
+			}
+		})
+	}
+
+	if got := Translate("es", "no_such_key", nil); got != "no_such_key" {
+		t.Fatalf("missing key rendered as %q, want the key itself", got)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for locale, want := range map[string]string{"fr": "fr", "pt-BR": DefaultLocale, "sw_KE": "sw", "": DefaultLocale} {
+		if got := Supported(locale); got != want {
+			t.Errorf("Supported(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestLoadDirAddsLocalesAndFallsBackPerKey(t *testing.T) {
+	dir := t.TempDir()
+	catalog := `{"user_joined_room": "{username} ist dem Raum beigetreten"}`
+	if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(catalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+
+	if got := Translate("de-AT", "user_joined_room", map[string]string{"username": "alice"}); got != "alice ist dem Raum beigetreten" {
+		t.Fatalf("loaded locale rendered %q", got)
+	}
+	// Keys the catalog leaves out come from English
+	if got := Translate("de", "room_joined", nil); got != "Successfully joined room" {
+		t.Fatalf("missing key rendered %q, want the English text", got)
+	}
+}
+
+func TestLoadDirRejectsInvalidCatalog(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "it.json"), []byte(`{"welcome": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDir(dir); err == nil {
+		t.Fatal("an invalid catalog was loaded")
+	}
+}
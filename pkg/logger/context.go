@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"context"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID used by the *Ctx log functions
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none. A gin context
+// is also searched for the "request_id" key set by the request ID middleware.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value("request_id").(string); ok {
+		return id
+	}
+	return ""
+}
+
+// ctxFields returns the request ID field of ctx, or nil if it carries none
+func ctxFields(ctx context.Context) Fields {
+	if id := RequestID(ctx); id != "" {
+		return Fields{"request_id": id}
+	}
+	return nil
+}
+
+// FromContext returns an entry carrying the context's request ID, if any
+func FromContext(ctx context.Context) *Entry {
+	return &Entry{fields: ctxFields(ctx)}
+}
+
+func InfoCtx(ctx context.Context, format string, v ...interface{}) {
+	output(3, "INFO", ctxFields(ctx), format, v...)
+}
+
+func WarnCtx(ctx context.Context, format string, v ...interface{}) {
+	output(3, "WARNING", ctxFields(ctx), format, v...)
+}
+
+func ErrorCtx(ctx context.Context, format string, v ...interface{}) {
+	output(3, "ERROR", ctxFields(ctx), format, v...)
+}
+
+func DebugCtx(ctx context.Context, format string, v ...interface{}) {
+	if debugMode {
+		output(3, "DEBUG", ctxFields(ctx), format, v...)
+	}
+}
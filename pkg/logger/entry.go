@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fields are key/value pairs attached to every line logged through an Entry
+type Fields map[string]any
+
+// Entry logs with a fixed set of fields, such as the user a request is acting for
+type Entry struct {
+	fields Fields
+}
+
+// With returns an entry that adds the fields to every line it logs
+func With(fields Fields) *Entry {
+	return (&Entry{}).With(fields)
+}
+
+// With returns a copy of the entry with more fields; later values win on key clashes
+func (e *Entry) With(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for key, value := range e.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Entry{fields: merged}
+}
+
+func (e *Entry) Info(format string, v ...interface{})  { output(3, "INFO", e.fields, format, v...) }
+func (e *Entry) Warn(format string, v ...interface{})  { output(3, "WARNING", e.fields, format, v...) }
+func (e *Entry) Error(format string, v ...interface{}) { output(3, "ERROR", e.fields, format, v...) }
+func (e *Entry) Debug(format string, v ...interface{}) {
+	if debugMode {
+		output(3, "DEBUG", e.fields, format, v...)
+	}
+}
+
+// formatText renders fields as " key=value" pairs in key order, quoting values with spaces
+func formatText(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, key := range sortedKeys(fields) {
+		value := fmt.Sprint(fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		b.WriteString(" " + key + "=" + value)
+	}
+	return b.String()
+}
+
+// formatJSON renders a line as one JSON object. Fields sit beside the standard keys and
+// cannot overwrite them.
+func formatJSON(level, caller, message string, fields Fields) string {
+	line := make(map[string]any, len(fields)+4)
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		line[key] = value
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["caller"] = caller
+	line["msg"] = message
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{"time": line["time"], "level": level, "caller": caller,
+			"msg": message, "fields_error": err.Error()})
+	}
+	return string(data)
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
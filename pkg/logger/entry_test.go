@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEntryFieldsInTextMode(t *testing.T) {
+	dir := setupTestLogging(t, DefaultLoggingOptions("", false))
+
+	entry := With(Fields{"user_id": 7, "username": "alice"})
+	entry.With(Fields{"room": "the lobby"}).Error("failed to send")
+	Info("plain line")
+	FlushLogs()
+
+	got := readLog(t, dir, "error.log")
+	if !strings.Contains(got, `failed to send room="the lobby" user_id=7 username=alice`) {
+		t.Fatalf("error.log = %q, want the fields in key order after the message", got)
+	}
+	if info := readLog(t, dir, "info.log"); !strings.Contains(info, "] plain line\n") {
+		t.Fatalf("info.log = %q, want the plain line without fields", info)
+	}
+}
+
+func TestEntryFieldsInJSONMode(t *testing.T) {
+	opts := DefaultLoggingOptions("", false)
+	opts.JSON = true
+	dir := setupTestLogging(t, opts)
+
+	With(Fields{"user_id": 7, "error": errors.New("boom"), "msg": "clobbered"}).Warn("failed to send")
+	FlushLogs()
+
+	var line map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(readLog(t, dir, "warn.log"))), &line); err != nil {
+		t.Fatalf("warn.log is not one JSON line: %v", err)
+	}
+	if line["user_id"] != float64(7) || line["error"] != "boom" {
+		t.Fatalf("fields missing from %v", line)
+	}
+	if line["msg"] != "failed to send" || line["level"] != "WARNING" {
+		t.Fatalf("a field overwrote a standard key: %v", line)
+	}
+}
@@ -14,12 +14,17 @@ import (
 )
 
 var (
-	infoLog   *log.Logger
-	warnLog   *log.Logger
-	errorLog  *log.Logger
+	// Until SetupLogging runs, messages go to the console so startup errors are not lost
+	infoLog   = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime)
+	warnLog   = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime)
+	errorLog  = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime)
 	debugLog  *log.Logger
 	logMutex  = &sync.Mutex{}
 	debugMode = false
+	jsonMode  = false
+
+	// rotateWriters are the log files opened by SetupLogging, closed by FlushLogs and Close
+	rotateWriters []*lumberjack.Logger
 )
 
 type LoggingOptions struct {
@@ -28,12 +33,42 @@ type LoggingOptions struct {
 		Relative bool
 	}
 	EnableDebug  bool
+	JSON         bool // One JSON object per line instead of text, for log shippers
 	MaxSizeMB    int
 	MaxBackups   int
 	MaxAgeDays   int
 	CompressLogs bool
 }
 
+// Rotation defaults used by SetupDefaultLogging
+const (
+	DefaultMaxSizeMB  = 100
+	DefaultMaxBackups = 5
+	DefaultMaxAgeDays = 30
+)
+
+// DefaultLoggingOptions returns rotating, compressed logs in dir, resolved against the
+// working directory when relative
+func DefaultLoggingOptions(dir string, debug bool) LoggingOptions {
+	opts := LoggingOptions{
+		EnableDebug:  debug,
+		MaxSizeMB:    DefaultMaxSizeMB,
+		MaxBackups:   DefaultMaxBackups,
+		MaxAgeDays:   DefaultMaxAgeDays,
+		CompressLogs: true,
+	}
+	opts.LogDir.Path = dir
+	return opts
+}
+
+// SetupDefaultLogging is the short form of SetupLogging for callers without a logging config,
+// such as tools and older call sites that passed only a directory and debug flag
+func SetupDefaultLogging(dir string, debug bool) {
+	SetupLogging(DefaultLoggingOptions(dir, debug))
+}
+
+// SetupLogging sends each level to the console and its own rotating file in the configured
+// directory. It is the canonical entry point; the server calls it with the <LOGGING> config.
 func SetupLogging(cfg LoggingOptions) {
 	logDir := cfg.LogDir.Path
 
@@ -55,37 +90,87 @@ func SetupLogging(cfg LoggingOptions) {
 	}
 
 	debugMode = cfg.EnableDebug
+	jsonMode = cfg.JSON
 
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		log.Fatalf("Failed to create log directory: %v", err)
 	}
 
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	for _, writer := range rotateWriters {
+		_ = writer.Close()
+	}
+	rotateWriters = nil
+
 	newRotateWriter := func(filename string) io.Writer {
-		return &lumberjack.Logger{
+		writer := &lumberjack.Logger{
 			Filename:   filepath.Join(logDir, filename),
 			MaxSize:    cfg.MaxSizeMB,
 			MaxBackups: cfg.MaxBackups,
 			MaxAge:     cfg.MaxAgeDays,
 			Compress:   cfg.CompressLogs,
 		}
+		rotateWriters = append(rotateWriters, writer)
+		return writer
 	}
 
 	infoWriter := io.MultiWriter(os.Stdout, newRotateWriter("info.log"))
 	warnWriter := io.MultiWriter(os.Stdout, newRotateWriter("warn.log"))
 	errorWriter := io.MultiWriter(os.Stderr, newRotateWriter("error.log"))
 
-	infoLog = log.New(infoWriter, "INFO: ", log.Ldate|log.Ltime)
-	warnLog = log.New(warnWriter, "WARNING: ", log.Ldate|log.Ltime)
-	errorLog = log.New(errorWriter, "ERROR: ", log.Ldate|log.Ltime)
+	infoLog = newLevelLogger(infoWriter, "INFO")
+	warnLog = newLevelLogger(warnWriter, "WARNING")
+	errorLog = newLevelLogger(errorWriter, "ERROR")
 
 	if cfg.EnableDebug {
 		debugWriter := io.MultiWriter(os.Stdout, newRotateWriter("debug.log"))
-		debugLog = log.New(debugWriter, "DEBUG: ", log.Ldate|log.Ltime)
+		debugLog = newLevelLogger(debugWriter, "DEBUG")
 	}
 
 	log.SetOutput(infoWriter)
 }
 
+// FlushLogs pushes buffered output to disk. The log files are closed, which writes out
+// everything lumberjack holds, and are reopened by the next log call, so logging may continue.
+func FlushLogs() {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	flushLocked()
+}
+
+// Close flushes the logs and stops writing to the log files; later messages go to the console
+// only. Call it last during shutdown.
+func Close() {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	flushLocked()
+	rotateWriters = nil
+
+	infoLog = newLevelLogger(os.Stdout, "INFO")
+	warnLog = newLevelLogger(os.Stdout, "WARNING")
+	errorLog = newLevelLogger(os.Stderr, "ERROR")
+	if debugLog != nil {
+		debugLog = newLevelLogger(os.Stdout, "DEBUG")
+	}
+	log.SetOutput(os.Stdout)
+}
+
+// flushLocked closes the log files and syncs the console; callers must hold logMutex
+func flushLocked() {
+	for _, writer := range rotateWriters {
+		if err := writer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to flush log file %s: %v\n", writer.Filename, err)
+		}
+	}
+	// Syncing a terminal or pipe fails harmlessly
+	_ = os.Stdout.Sync()
+	_ = os.Stderr.Sync()
+}
+
 func getFuncName(skip int) string {
 	pc, _, _, ok := runtime.Caller(skip)
 	if !ok {
@@ -106,18 +191,37 @@ func getFileLine(skip int) string {
 	return filepath.Base(file) + ":" + fmt.Sprint(line)
 }
 
+// newLevelLogger creates the logger for one level; JSON lines carry the level and time themselves
+func newLevelLogger(w io.Writer, level string) *log.Logger {
+	if jsonMode {
+		return log.New(w, "", 0)
+	}
+	return log.New(w, level+": ", log.Ldate|log.Ltime)
+}
+
 func Log(level string, format string, v ...interface{}) {
+	output(4, level, nil, format, v...)
+}
+
+// output writes one log line. skip is the number of stack frames between output and the
+// function whose name is reported as the caller.
+func output(skip int, level string, fields Fields, format string, v ...interface{}) {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
 	message := fmt.Sprintf(format, v...)
-	caller := getFuncName(3)
+	caller := getFuncName(skip)
 
 	if level == "DEBUG" && debugMode {
-		caller = caller + " " + getFileLine(3)
+		caller = caller + " " + getFileLine(skip)
 	}
 
-	logEntry := "[" + caller + "] " + message
+	var logEntry string
+	if jsonMode {
+		logEntry = formatJSON(level, caller, message, fields)
+	} else {
+		logEntry = "[" + caller + "] " + message + formatText(fields)
+	}
 
 	switch level {
 	case "INFO":
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setupTestLogging logs to files in a temporary directory until the test ends
+func setupTestLogging(t *testing.T, opts LoggingOptions) string {
+	t.Helper()
+	dir := t.TempDir()
+	opts.LogDir.Path = dir
+	SetupLogging(opts)
+	t.Cleanup(func() {
+		Close()
+		jsonMode = false
+	})
+	return dir
+}
+
+// readLog returns the contents of one of the level files in dir
+func readLog(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestFlushLogsWritesFilesToDisk(t *testing.T) {
+	dir := setupTestLogging(t, DefaultLoggingOptions("", false))
+
+	Info("info before flush")
+	Warn("warning before flush")
+	Error("error before flush")
+	FlushLogs()
+
+	for name, want := range map[string]string{
+		"info.log":  "info before flush",
+		"warn.log":  "warning before flush",
+		"error.log": "error before flush",
+	} {
+		if got := readLog(t, dir, name); !strings.Contains(got, want) {
+			t.Fatalf("%s = %q, want it to contain %q", name, got, want)
+		}
+	}
+
+	// The files are reopened by the next call after a flush
+	Info("info after flush")
+	FlushLogs()
+	if got := readLog(t, dir, "info.log"); !strings.Contains(got, "info after flush") {
+		t.Fatalf("info.log = %q, want the line logged after the flush", got)
+	}
+}
+
+func TestFlushLogsDuringConcurrentLogging(t *testing.T) {
+	dir := setupTestLogging(t, DefaultLoggingOptions("", false))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				Info("line %d", j)
+				Error("line %d", j)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		FlushLogs()
+	}
+	wg.Wait()
+	FlushLogs()
+
+	if got := strings.Count(readLog(t, dir, "info.log"), "line "); got != 800 {
+		t.Fatalf("info.log has %d lines, want 800", got)
+	}
+}
+
+func TestCloseStopsWritingFiles(t *testing.T) {
+	dir := setupTestLogging(t, DefaultLoggingOptions("", false))
+
+	Info("before close")
+	Close()
+	Info("after close")
+
+	got := readLog(t, dir, "info.log")
+	if !strings.Contains(got, "before close") || strings.Contains(got, "after close") {
+		t.Fatalf("info.log = %q, want only the line logged before Close", got)
+	}
+}
+
+func TestBothSetupEntryPointsLogToTheDirectory(t *testing.T) {
+	for name, setup := range map[string]func(dir string){
+		"SetupLogging":        func(dir string) { SetupLogging(DefaultLoggingOptions(dir, true)) },
+		"SetupDefaultLogging": func(dir string) { SetupDefaultLogging(dir, true) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			setup(dir)
+			t.Cleanup(func() {
+				Close()
+				debugMode = false
+			})
+
+			Info("info line")
+			Debug("debug line")
+			FlushLogs()
+
+			if got := readLog(t, dir, "info.log"); !strings.Contains(got, "info line") {
+				t.Fatalf("info.log = %q", got)
+			}
+			if got := readLog(t, dir, "debug.log"); !strings.Contains(got, "debug line") {
+				t.Fatalf("debug.log = %q", got)
+			}
+		})
+	}
+}
+
+func TestDefaultLoggingOptions(t *testing.T) {
+	opts := DefaultLoggingOptions("logs", true)
+	if opts.LogDir.Path != "logs" || !opts.EnableDebug || !opts.CompressLogs ||
+		opts.MaxSizeMB != DefaultMaxSizeMB || opts.MaxBackups != DefaultMaxBackups || opts.MaxAgeDays != DefaultMaxAgeDays {
+		t.Fatalf("unexpected defaults %+v", opts)
+	}
+}
@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"live-chatter/internal/config"
+	Log "live-chatter/pkg/logger"
+)
+
+// Mailer delivers plain-text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer records messages in the log instead of sending them; it is used when no SMTP
+// server is configured. Bodies are left out because they carry secrets such as reset links.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	Log.Info("Email to %s not sent, no SMTP server configured: %s (%d bytes)", to, subject, len(body))
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, authenticating when a username is set
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// NewMailer returns an SMTPMailer when a host is configured and a LogMailer otherwise
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.SMTPHost == "" {
+		Log.Warn("No MAIL/SMTP_HOST configured, emails such as password reset links will not be delivered")
+		return LogMailer{}
+	}
+
+	port := cfg.SMTPPort
+	if port <= 0 {
+		port = 587
+	}
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+		From:     cfg.From,
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+}
+
+// Send delivers one message
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	// Header injection would let a crafted address add recipients or rewrite the message
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(message))
+}
@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"time"
+
+	Log "live-chatter/pkg/logger"
+)
+
+// DefaultMemberCountCoalesce is the merge window used when none is configured
+const DefaultMemberCountCoalesce = 500 * time.Millisecond
+
+// AdjustMemberCount applies a membership change to the room's maintained member count and
+// schedules a member_count_changed event. Changes arriving within the coalesce window are
+// merged, so a mass join produces one event carrying the final count.
+func (manager *ClientManager) AdjustMemberCount(roomID string, delta int) {
+	if !manager.MemberCountEvents {
+		return
+	}
+
+	manager.memberCountMu.Lock()
+	defer manager.memberCountMu.Unlock()
+
+	if manager.memberCounts == nil {
+		manager.memberCounts = make(map[string]int)
+		manager.memberCountPending = make(map[string]bool)
+	}
+
+	count, known := manager.memberCounts[roomID]
+	if known {
+		count += delta
+	} else {
+		// The first change seen for a room seeds the counter; the query already includes it
+		total, err := manager.RoomRepo.CountActiveMembers(roomID)
+		if err != nil {
+			Log.Error("Failed to count members of room %s: %v", roomID, err)
+			return
+		}
+		count = int(total)
+	}
+	if count < 0 {
+		count = 0
+	}
+	manager.memberCounts[roomID] = count
+
+	if manager.memberCountPending[roomID] {
+		return
+	}
+	manager.memberCountPending[roomID] = true
+
+	window := manager.MemberCountCoalesce
+	if window <= 0 {
+		window = DefaultMemberCountCoalesce
+	}
+	time.AfterFunc(window, func() { manager.publishMemberCount(roomID) })
+}
+
+// publishMemberCount sends the room's current member count to its live members
+func (manager *ClientManager) publishMemberCount(roomID string) {
+	manager.memberCountMu.Lock()
+	count := manager.memberCounts[roomID]
+	delete(manager.memberCountPending, roomID)
+	manager.memberCountMu.Unlock()
+
+	manager.Publish(BroadcastMessage{
+		Message: &Message{
+			ID:        generateMessageID(),
+			Type:      "member_count_changed",
+			RoomID:    roomID,
+			Username:  "System",
+			Timestamp: time.Now(),
+			Data:      map[string]interface{}{"member_count": count},
+		},
+		RoomID:      roomID,
+		MessageType: "broadcast_room",
+	})
+}
+
+// forgetMemberCount drops the maintained count of a room that no longer exists
+func (manager *ClientManager) forgetMemberCount(roomID string) {
+	manager.memberCountMu.Lock()
+	defer manager.memberCountMu.Unlock()
+
+	delete(manager.memberCounts, roomID)
+}
@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMassJoinIsCoalescedIntoOneEvent(t *testing.T) {
+	manager, bob := startTypingRoom(t, time.Hour, time.Hour)
+	manager.MemberCountEvents = true
+	manager.MemberCountCoalesce = 50 * time.Millisecond
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1, 2, 3}}}
+
+	// The first join seeds the counter from the repository, which already includes it
+	manager.AdjustMemberCount("lobby", 1)
+	for i := 0; i < 9; i++ {
+		manager.AdjustMemberCount("lobby", 1)
+	}
+	manager.AdjustMemberCount("lobby", -2)
+
+	event := nextFrame(t, bob)
+	if event.Type != "member_count_changed" || event.RoomID != "lobby" || event.Data["member_count"] != float64(10) {
+		t.Fatalf("unexpected frame %+v", event)
+	}
+	expectNoFrame(t, bob, 150*time.Millisecond)
+
+	// A later change opens a new window
+	manager.AdjustMemberCount("lobby", -1)
+	if event := nextFrame(t, bob); event.Data["member_count"] != float64(9) {
+		t.Fatalf("unexpected frame %+v", event)
+	}
+}
+
+func TestMemberCountEventsAreOffByDefault(t *testing.T) {
+	manager, bob := startTypingRoom(t, time.Hour, time.Hour)
+	manager.MemberCountCoalesce = 10 * time.Millisecond
+
+	manager.AdjustMemberCount("lobby", 1)
+	expectNoFrame(t, bob, 100*time.Millisecond)
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+
+	"live-chatter/pkg/model"
+
+	Log "live-chatter/pkg/logger"
+)
+
+// maxMentionsPerMessage caps how many users one message can notify
+const maxMentionsPerMessage = 20
+
+// mentionPattern matches @username where the @ starts a word. Addresses such as a@b.com are
+// not mentions, and a backslash before the @ escapes it.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@\\])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// ParseMentions returns the usernames mentioned in content, lowercased, without duplicates and
+// in order of first mention. Trailing separators are dropped since usernames cannot end in
+// one, so "@bob." mentions bob.
+func ParseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := strings.ToLower(strings.TrimRight(match[2], "._-"))
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentionsPerMessage {
+			break
+		}
+	}
+	return usernames
+}
+
+// NotifyMentions notifies the room members mentioned in a message. Unknown usernames, users
+// outside the room and self-mentions are ignored. The lookups run in the background so the
+// sender's read loop is not held up by the database.
+func (manager *ClientManager) NotifyMentions(message *model.Message) {
+	usernames := ParseMentions(message.Content)
+	if len(usernames) == 0 || manager.UserRepo == nil {
+		return
+	}
+	go manager.notifyMentioned(*message, usernames)
+}
+
+// notifyMentioned resolves the mentioned usernames and notifies those who belong to the room
+func (manager *ClientManager) notifyMentioned(message model.Message, usernames []string) {
+	users, err := manager.UserRepo.GetUsersByUsernames(usernames)
+	if err != nil {
+		Log.Error("Failed to resolve mentions in message %d: %v", message.ID, err)
+		return
+	}
+
+	for _, user := range users {
+		if user.ID == message.UserID {
+			continue
+		}
+		isMember, err := manager.RoomRepo.IsUserInRoom(message.RoomID, user.ID)
+		if err != nil {
+			Log.Error("Failed to check membership of %s in room %s: %v", user.Username, message.RoomID, err)
+			continue
+		}
+		if !isMember {
+			continue
+		}
+
+		messageID := message.ID
+		manager.Notify(user.Username, model.Notification{
+			UserID:    user.ID,
+			Type:      model.NotificationMention,
+			RoomID:    message.RoomID,
+			MessageID: &messageID,
+			ActorID:   message.UserID,
+			Content:   message.Content,
+		}, map[string]interface{}{
+			"username": message.Username,
+		})
+	}
+}
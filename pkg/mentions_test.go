@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// blockingUserRepository resolves usernames only once release is closed
+type blockingUserRepository struct {
+	repository.UserRepository
+	users   []model.User
+	release chan struct{}
+}
+
+func (r *blockingUserRepository) GetUsersByUsernames(usernames []string) ([]model.User, error) {
+	<-r.release
+	return r.users, nil
+}
+
+func TestNotifyMentionsDoesNotWaitForLookups(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob")
+	users := &blockingUserRepository{users: []model.User{{ID: 2, Username: "bob"}}, release: make(chan struct{})}
+	manager.UserRepo = users
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1, 2}}}
+
+	returned := make(chan struct{})
+	go func() {
+		manager.NotifyMentions(&model.Message{ID: 7, RoomID: "lobby", UserID: 1, Username: "alice", Content: "hi @Bob"})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("NotifyMentions waited for the user lookup")
+	}
+
+	close(users.release)
+	frame := nextFrame(t, clients["bob"])
+	if frame.Type != "notification" || frame.Data["type"] != model.NotificationMention {
+		t.Fatalf("got %+v, want a mention notification", frame)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"hi @bob", []string{"bob"}},
+		{"@Bob, @carol and @dave.", []string{"bob", "carol", "dave"}},
+		{"@bob @BOB @bob", []string{"bob"}},
+		{"mail bob@example.com", nil},
+		{`not a mention: \@bob`, nil},
+		{"@@bob", nil},
+		{"(@bob)", []string{"bob"}},
+		{"@alice.smith_2 said so", []string{"alice.smith_2"}},
+		{"@ nobody", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := ParseMentions(tt.content)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+// mentionUserRepository resolves the usernames it knows, as the lowercase index lookup does
+type mentionUserRepository struct {
+	repository.UserRepository
+	users []model.User
+}
+
+func (r *mentionUserRepository) GetUsersByUsernames(usernames []string) ([]model.User, error) {
+	var found []model.User
+	for _, user := range r.users {
+		for _, username := range usernames {
+			if user.Username == username {
+				found = append(found, user)
+			}
+		}
+	}
+	return found, nil
+}
+
+// fakeNotificationRepository records the notifications stored for offline users
+type fakeNotificationRepository struct {
+	repository.NotificationRepository
+	mu     sync.Mutex
+	stored []model.Notification
+}
+
+func (r *fakeNotificationRepository) CreateNotifications(notifications []model.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stored = append(r.stored, notifications...)
+	return nil
+}
+
+func TestMultipleMentionsNotifyEachMember(t *testing.T) {
+	manager, clients := startTestManager(t, "alice", "bob", "carol", "erin")
+	notifications := &fakeNotificationRepository{}
+	manager.NotificationRepo = notifications
+	manager.UserRepo = &mentionUserRepository{users: []model.User{
+		{ID: 1, Username: "alice"},
+		{ID: 2, Username: "bob"},
+		{ID: 3, Username: "carol"},
+		{ID: 4, Username: "dave"}, // In the room but offline
+		{ID: 5, Username: "erin"}, // Online but not in the room
+	}}
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1, 2, 3, 4}}}
+
+	manager.NotifyMentions(&model.Message{ID: 7, RoomID: "lobby", UserID: 1, Username: "alice",
+		Content: "@bob @carol @dave @erin @alice @nobody look"})
+
+	for _, username := range []string{"bob", "carol"} {
+		frame := nextFrame(t, clients[username])
+		if frame.Type != "notification" || frame.Data["type"] != model.NotificationMention || frame.Data["message_id"] != float64(7) {
+			t.Fatalf("%s got %+v, want a mention of message 7", username, frame)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		notifications.mu.Lock()
+		stored := append([]model.Notification(nil), notifications.stored...)
+		notifications.mu.Unlock()
+		if len(stored) == 1 {
+			if stored[0].UserID != 4 || stored[0].Type != model.NotificationMention {
+				t.Fatalf("stored %+v, want a mention for dave", stored[0])
+			}
+			break
+		}
+		if len(stored) > 1 || time.Now().After(deadline) {
+			t.Fatalf("stored %d notifications, want one for dave", len(stored))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, username := range []string{"alice", "erin"} {
+		select {
+		case data := <-clients[username].Send:
+			t.Fatalf("%s was notified: %s", username, data)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
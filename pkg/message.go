@@ -1,6 +1,12 @@
 package pkg
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"live-chatter/pkg/i18n"
+	"live-chatter/pkg/model"
+)
 
 // Message represents a chat message with enhanced fields
 type Message struct {
@@ -11,16 +17,60 @@ type Message struct {
 	Username          string                 `json:"username"`
 	RoomID            string                 `json:"room_id,omitempty"`
 	RecipientUsername string                 `json:"recipient_username,omitempty"`
+	ParentID          *uint                  `json:"parent_id,omitempty"` // Set on threaded replies
+	AttachmentURL     string                 `json:"attachment_url,omitempty"`
 	Timestamp         time.Time              `json:"timestamp"`
 	Data              map[string]interface{} `json:"data,omitempty"` // For additional metadata
+
+	// Catalog key and parameters for system text, so clients can localize it themselves;
+	// Content carries the server rendering in the recipient's locale
+	Key    string            `json:"key,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// MarshalJSON writes the timestamp, and any times in Data, in the API-wide timestamp format
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	return json.Marshal(struct {
+		alias
+		Timestamp model.Timestamp        `json:"timestamp"`
+		Data      map[string]interface{} `json:"data,omitempty"`
+	}{alias(m), model.Timestamp(m.Timestamp), model.NormalizeTimestamps(m.Data)})
+}
+
+// localizable marks the message as system text from the catalog and fills Content with the default rendering
+func (m *Message) localizable(key string, params map[string]string) *Message {
+	m.Key = key
+	m.Params = params
+	m.Content = i18n.Translate(i18n.DefaultLocale, key, params)
+	return m
+}
+
+// localize returns the message with Content rendered for locale when it carries a catalog key
+func (m *Message) localize(locale string) *Message {
+	if m.Key == "" {
+		return m
+	}
+	localized := *m
+	localized.Content = i18n.Translate(locale, m.Key, m.Params)
+	return &localized
 }
 
 // IncomingMessage represents messages received from clients
 type IncomingMessage struct {
-	Type              string `json:"type"`
-	Content           string `json:"content"`
-	RoomID            string `json:"room_id,omitempty"`
-	RecipientUsername string `json:"recipient_username,omitempty"`
+	Type              string   `json:"type"`
+	Content           string   `json:"content"`
+	RoomID            string   `json:"room_id,omitempty"`
+	RecipientUsername string   `json:"recipient_username,omitempty"`
+	Usernames         []string `json:"usernames,omitempty"`  // For presence subscriptions
+	ParentID          *uint    `json:"parent_id,omitempty"`  // For threaded replies
+	MessageID         uint     `json:"message_id,omitempty"` // For read receipts and reactions
+	Emoji             string   `json:"emoji,omitempty"`      // For reactions
+	Before            string   `json:"before,omitempty"`     // For history: only messages older than this
+	Limit             int      `json:"limit,omitempty"`      // For history: page size
+	AttachmentID      *string  `json:"attachment_id,omitempty"`
+
+	receivedAt time.Time // When the server read the frame off the socket; never persisted
 }
 
 // MessageType constants for different message types
@@ -28,6 +78,13 @@ const (
 	// Chat related messages
 	MessageTypeChatMessage    = "chat_message"
 	MessageTypePrivateMessage = "private_message"
+	MessageTypeMarkRead       = "mark_read"
+	MessageTypeReadReceipt    = "read_receipt"
+	MessageTypeMessageEdited  = "message_edited"
+	MessageTypeMessageDeleted = "message_deleted"
+	MessageTypeMessageAck     = "message_ack"
+	MessageTypeFetchHistory   = "fetch_history"
+	MessageTypeHistory        = "history"
 
 	// System messages
 	MessageTypeSystemMessage = "system_message"
@@ -40,6 +97,13 @@ const (
 	MessageTypeUserJoined       = "user_joined"
 	MessageTypeUserLeft         = "user_left"
 
+	// Presence subscription messages
+	MessageTypeSubscribePresence    = "subscribe_presence"
+	MessageTypeUnsubscribePresence  = "unsubscribe_presence"
+	MessageTypePresenceSubscribed   = "presence_subscribed"
+	MessageTypePresenceUnsubscribed = "presence_unsubscribed"
+	MessageTypePresenceUpdate       = "presence_update"
+
 	// Room management messages
 	MessageTypeRoomJoined  = "room_joined"
 	MessageTypeRoomLeft    = "room_left"
@@ -50,8 +114,10 @@ const (
 	MessageTypeOnlineUsers = "online_users"
 
 	// Connection management
-	MessageTypePing = "ping"
-	MessageTypePong = "pong"
+	MessageTypePing         = "ping"
+	MessageTypePong         = "pong"
+	MessageTypeHeartbeat    = "heartbeat"
+	MessageTypeCapabilities = "capabilities"
 )
 
 // TypingStatus represents typing indicator states
@@ -80,6 +146,7 @@ type RoomInfo struct {
 	ID          string     `json:"id"`
 	Name        string     `json:"name"`
 	Description string     `json:"description,omitempty"`
+	Type        string     `json:"type,omitempty"`
 	UserCount   int        `json:"user_count"`
 	Users       []UserInfo `json:"users,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
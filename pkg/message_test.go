@@ -0,0 +1,34 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEventTimestampsUseTheAPIFormat(t *testing.T) {
+	at := time.Date(2024, 5, 1, 14, 30, 0, 123456789, time.FixedZone("UTC+2", 2*60*60))
+	data, err := json.Marshal(&Message{
+		Type:      "chat_message",
+		Timestamp: at,
+		Data:      map[string]interface{}{"received_at": at, "edited_at": &at, "count": 2},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var event struct {
+		Timestamp string                 `json:"timestamp"`
+		Data      map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	const want = "2024-05-01T12:30:00.123Z"
+	if event.Timestamp != want || event.Data["received_at"] != want || event.Data["edited_at"] != want {
+		t.Fatalf("event timestamps %s, %v, %v; want %s", event.Timestamp, event.Data["received_at"], event.Data["edited_at"], want)
+	}
+	if event.Data["count"] != float64(2) {
+		t.Fatalf("other data changed: %v", event.Data)
+	}
+}
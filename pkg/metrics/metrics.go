@@ -0,0 +1,227 @@
+// Package metrics is a minimal registry of counters, gauges and histograms rendered in the
+// Prometheus text exposition format, so the server can be scraped without extra dependencies.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, from 100µs to 1s
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// collector renders one metric family
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics exposed by a /metrics endpoint
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default is the registry served by the server's /metrics endpoint
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus renders every registered metric in registration order
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry in the text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Counter is a monotonically increasing count
+type Counter struct {
+	name, help string
+	value      atomic.Int64
+}
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(c)
+	return c
+}
+
+// Add increases the counter; a nil counter ignores it so optional metrics need no checks
+func (c *Counter) Add(n int64) {
+	if c != nil {
+		c.value.Add(n)
+	}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.value.Load())
+}
+
+// CounterVec is a family of counters partitioned by the value of one label
+type CounterVec struct {
+	name, help, label string
+	mu                sync.RWMutex
+	values            map[string]*atomic.Int64
+}
+
+// NewCounterVec registers a counter family keyed by label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]*atomic.Int64)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter for the label value; a nil family ignores it
+func (c *CounterVec) Inc(labelValue string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.RLock()
+	value, ok := c.values[labelValue]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if value, ok = c.values[labelValue]; !ok {
+			value = &atomic.Int64{}
+			c.values[labelValue] = value
+		}
+		c.mu.Unlock()
+	}
+	value.Add(1)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.RLock()
+	labels := make([]string, 0, len(c.values))
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	c.mu.RUnlock()
+	sort.Strings(labels)
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, label := range labels {
+		c.mu.RLock()
+		value := c.values[label].Load()
+		c.mu.RUnlock()
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.name, c.label, labelEscaper.Replace(label), value)
+	}
+}
+
+// funcMetric reports a value read at scrape time, for state owned elsewhere
+type funcMetric struct {
+	name, help, kind string
+	fn               func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter kept elsewhere, read from fn on every scrape
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	writeHeader(w, m.name, m.help, m.kind)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatValue(m.fn()))
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	name, help string
+	buckets    []float64
+	mu         sync.Mutex
+	counts     []uint64 // Per bucket, non-cumulative; the last entry is +Inf
+	sum        float64
+	count      uint64
+}
+
+// NewHistogram registers a histogram with the given ascending bucket upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	r.register(h)
+	return h
+}
+
+// Observe records one value; a nil histogram ignores it
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatValue(sum), h.name, count)
+}
@@ -10,16 +10,19 @@ import (
 // CORSMiddleware is a middleware for handling CORS
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		origin := getValidOrigin(c)
-
-		// Set CORS headers
+		// Responses differ per origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
 		c.Writer.Header().Set("Content-Type", "application/json")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, ngrok-skip-browser-warning")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "")
-		c.Writer.Header().Set("Access-Control-Max-Age", "86400") // Cache for 24 hours
+
+		// Only allow-listed origins get CORS headers; browsers block every other cross-origin caller
+		if origin := c.GetHeader("Origin"); origin != "" && IsOriginAllowed(origin) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, Idempotency-Key, X-Request-ID, ngrok-skip-browser-warning")
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+			c.Writer.Header().Set("Access-Control-Max-Age", "86400") // Cache for 24 hours
+		}
 
 		// Handle preflight requests
 		if strings.ToUpper(c.Request.Method) == "OPTIONS" {
@@ -30,40 +33,3 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-// getValidOrigin determines the appropriate origin
-func getValidOrigin(c *gin.Context) string {
-	origin := c.GetHeader("Origin")
-	remoteIP := c.ClientIP()
-
-	if origin == "" {
-		if isValidIP(remoteIP) {
-			origin = c.GetHeader("Referer")
-			if origin == "" {
-				origin = c.GetHeader("Host")
-			}
-		} else {
-			blockRequest(c)
-			return ""
-		}
-	}
-
-	if origin == "" {
-		return "*"
-	}
-	return origin
-}
-
-// isValidIP checks if the request comes from a trusted IP
-//
-//goland:noinspection GoUnusedParameter
-func isValidIP(ip string) bool {
-	// TODO Implement specific IP validation
-	// return strings.Contains(ip, "127.0.0.1") || strings.HasPrefix(ip, "192.168.")
-	return true
-}
-
-// blockRequest denies access to unauthorized requests
-func blockRequest(c *gin.Context) {
-	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Unauthorized request"})
-}
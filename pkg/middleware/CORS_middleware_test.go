@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"live-chatter/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	cfg := &config.APIConfig{}
+	cfg.Context.Mode = gin.ReleaseMode
+	cfg.Context.AllowedOrigins.Origins = []string{"https://chat.example.com"}
+	InitOriginConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSMiddleware())
+	router.GET("/rooms", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		wantOrigin string
+		wantStatus int
+	}{
+		{"allowed origin", http.MethodGet, "https://chat.example.com", "https://chat.example.com", http.StatusOK},
+		{"disallowed origin", http.MethodGet, "https://evil.example.net", "", http.StatusOK},
+		{"empty origin", http.MethodGet, "", "", http.StatusOK},
+		{"allowed preflight", http.MethodOptions, "https://chat.example.com", "https://chat.example.com", http.StatusNoContent},
+		{"disallowed preflight", http.MethodOptions, "https://evil.example.net", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/rooms", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", res.Code, tt.wantStatus)
+			}
+			header := res.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" && header.Get("Access-Control-Allow-Credentials") != "" {
+				t.Fatal("credentials were allowed for an origin off the list")
+			}
+			if header.Get("Vary") != "Origin" {
+				t.Fatalf("Vary = %q, want Origin", header.Get("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"live-chatter/pkg/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleAdmin is the user role allowed through AdminMiddleware
+const RoleAdmin = "admin"
+
+// UserLookup loads the stored profile of an authenticated user
+type UserLookup interface {
+	GetUserByID(id uint) (*model.User, error)
+}
+
+// AdminMiddleware only lets through users whose role is admin. It must run after AuthMiddleware.
+// Tokens without the admin role claim are turned away without a lookup; the rest are confirmed
+// against the database so a demotion takes effect before the token expires.
+func AdminMiddleware(users UserLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("user_id")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			c.Abort()
+			return
+		}
+
+		if c.GetString("role") != RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+
+		user, err := users.GetUserByID(userID.(uint))
+		if err != nil || user == nil || user.Role != RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeUserLookup serves stored users by ID
+type fakeUserLookup map[uint]*model.User
+
+func (users fakeUserLookup) GetUserByID(id uint) (*model.User, error) {
+	return users[id], nil
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	SetSessionStore(nil)
+	accessSecret, accessExpiry = []byte("test-secret"), time.Minute
+
+	admin := &model.User{ID: 1, Username: "root", Role: RoleAdmin}
+	member := &model.User{ID: 2, Username: "alice", Role: "user"}
+	demoted := &model.User{ID: 3, Username: "bob", Role: RoleAdmin}
+	users := fakeUserLookup{
+		1: admin,
+		2: member,
+		3: {ID: 3, Username: "bob", Role: "user"}, // Demoted after the token was issued
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AuthMiddleware(), AdminMiddleware(users))
+	router.GET("/admin/stats", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name string
+		user *model.User
+		want int
+	}{
+		{"admin token", admin, http.StatusOK},
+		{"normal token", member, http.StatusForbidden},
+		{"admin token of a demoted user", demoted, http.StatusForbidden},
+		{"admin token of a deleted user", &model.User{ID: 9, Username: "gone", Role: RoleAdmin}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := GenerateTokens(tt.user, "session-1")
+			if err != nil {
+				t.Fatalf("GenerateTokens: %v", err)
+			}
+			if res := serveWithToken(router, "/admin/stats", token); res.Code != tt.want {
+				t.Fatalf("status %d, want %d", res.Code, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,53 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// publicPaths are the top-level path segments served without authentication. The middleware is
+// only mounted on /api groups and /download, so these never match today; they guard against it
+// being applied to the whole engine. Downloads are not public: attachments are only served to
+// members of their room.
+var publicPaths = []string{"/static", "/auth"}
+
+// isPublicPath reports whether path is one of publicPaths or lies beneath one. Matching is by
+// whole segment after cleaning, so /auth/login is public while /authoritative and
+// /auth/../api are not.
+func isPublicPath(requestPath string) bool {
+	cleaned := path.Clean(requestPath)
+	for _, public := range publicPaths {
+		if cleaned == public || strings.HasPrefix(cleaned, public+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectToken aborts with 401. Expired tokens get a distinct body and a WWW-Authenticate
+// challenge so clients know to refresh rather than log in again.
+func rejectToken(c *gin.Context, err error) {
+	if errors.Is(err, ErrTokenExpired) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+		c.Abort()
+		return
+	}
+
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	c.Abort()
+}
+
 // AuthMiddleware ensures each request is authenticated
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Request.URL.Path
 		// Allow unauthenticated access to static files and auth endpoints
-		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/auth") || strings.HasPrefix(path, "/download") {
+		if isPublicPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
@@ -33,8 +68,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenStr := parts[1]
 		claims, err := ValidateToken(tokenStr, false)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+			rejectToken(c, err)
 			return
 		}
 
@@ -42,6 +76,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.ID)
 
 		c.Next()
 	}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authRouter answers 200 on any path that gets through the middleware
+func authRouter(middleware gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware)
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+// serveWithToken requests path with the token as a bearer credential, if one is given
+func serveWithToken(router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestIsPublicPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		public bool
+	}{
+		{"/auth", true},
+		{"/auth/login", true},
+		{"/static/app.js", true},
+		{"/authoritative", false},
+		{"/auth-admin", false},
+		{"/static-admin/users", false},
+		{"/staticfiles", false},
+		{"/api/v1/authoritative", false},
+		{"/api/v1/auth/login", false},
+		{"/auth/../api/v1/rooms", false},
+		{"/static/../admin", false},
+		{"/download", false},
+		{"/downloads-admin", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicPath(tt.path); got != tt.public {
+			t.Errorf("isPublicPath(%q) = %v, want %v", tt.path, got, tt.public)
+		}
+	}
+}
+
+func TestAuthMiddlewareRejectsPrefixBypass(t *testing.T) {
+	SetSessionStore(nil)
+	router := authRouter(AuthMiddleware())
+
+	for _, path := range []string{"/authoritative", "/auth-admin", "/api/v1/authoritative", "/downloads-admin", "/auth/../admin"} {
+		if res := serveWithToken(router, path, ""); res.Code != http.StatusUnauthorized {
+			t.Errorf("%s served unauthenticated with status %d", path, res.Code)
+		}
+	}
+	if res := serveWithToken(router, "/auth/login", ""); res.Code != http.StatusOK {
+		t.Errorf("/auth/login needed a token, status %d", res.Code)
+	}
+}
+
+func TestExpiredTokenGetsExpiryResponse(t *testing.T) {
+	SetSessionStore(nil)
+	user := &model.User{ID: 7, Username: "alice"}
+	accessSecret = []byte("test-secret")
+
+	accessExpiry = -time.Minute
+	expired, _, err := GenerateTokens(user, "session-1")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	accessExpiry = time.Minute
+	valid, _, err := GenerateTokens(user, "session-1")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+
+	for name, middleware := range map[string]gin.HandlerFunc{
+		"AuthMiddleware":          AuthMiddleware(),
+		"WebSocketAuthMiddleware": WebSocketAuthMiddleware(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := authRouter(middleware)
+
+			tests := []struct {
+				name      string
+				token     string
+				wantError string
+			}{
+				{"expired", expired, "token expired"},
+				{"bad signature", valid + "x", "invalid token"},
+				{"malformed", "not-a-jwt", "invalid token"},
+			}
+			for _, tt := range tests {
+				res := serveWithToken(router, "/api/v1/rooms", tt.token)
+				var body struct{ Error string }
+				_ = json.Unmarshal(res.Body.Bytes(), &body)
+
+				if res.Code != http.StatusUnauthorized || body.Error != tt.wantError {
+					t.Fatalf("%s token: status %d, error %q; want 401, %q", tt.name, res.Code, body.Error, tt.wantError)
+				}
+				challenge := res.Header().Get("WWW-Authenticate")
+				if (tt.wantError == "token expired") != strings.Contains(challenge, `error_description="token expired"`) {
+					t.Fatalf("%s token: WWW-Authenticate = %q", tt.name, challenge)
+				}
+			}
+
+			if res := serveWithToken(router, "/api/v1/rooms", valid); res.Code != http.StatusOK {
+				t.Fatalf("valid token: status %d", res.Code)
+			}
+		})
+	}
+}
@@ -17,8 +17,34 @@ var (
 	refreshSecret []byte
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
+
+	// sessionStore, when set, is consulted so tokens of logged-out sessions are rejected
+	sessionStore SessionStore
 )
 
+// Errors returned by ValidateToken. An expired token can be renewed with the refresh token;
+// any other failure means the client must log in again.
+var (
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrTokenInvalid   = errors.New("invalid or malformed token")
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
+
+// SessionStore reports whether a login session is still live
+type SessionStore interface {
+	IsSessionActive(sessionID string) (bool, error)
+}
+
+// SetSessionStore enables session revocation checks in ValidateToken
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// SessionLifetime is how long a login session lasts, matching the refresh token expiry
+func SessionLifetime() time.Duration {
+	return refreshExpiry
+}
+
 // InitAuthConfig Initialize config values once
 func InitAuthConfig(cfg *config.APIConfig) {
 	if cfg == nil {
@@ -53,17 +79,19 @@ type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role,omitempty"` // The user's role when the token was issued
 	jwt.RegisteredClaims
 }
 
-// GenerateTokens creates both access and refresh tokens
-func GenerateTokens(user *model.User) (string, string, error) {
-	accessToken, err := generateToken(user, accessSecret, accessExpiry)
+// GenerateTokens creates both access and refresh tokens bound to a login session.
+// The session ID travels in the standard "jti" claim.
+func GenerateTokens(user *model.User, sessionID string) (string, string, error) {
+	accessToken, err := generateToken(user, sessionID, accessSecret, accessExpiry)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err := generateToken(user, refreshSecret, refreshExpiry)
+	refreshToken, err := generateToken(user, sessionID, refreshSecret, refreshExpiry)
 	if err != nil {
 		return "", "", err
 	}
@@ -71,8 +99,41 @@ func GenerateTokens(user *model.User) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-// ValidateToken verifies the token and extracts claims
+// tokenParserOptions pin the signing method and require an expiry and an issue time not in
+// the future
+var tokenParserOptions = []jwt.ParserOption{
+	jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	jwt.WithExpirationRequired(),
+	jwt.WithIssuedAt(),
+}
+
+// ValidateToken verifies the token and extracts claims. Expired tokens yield ErrTokenExpired,
+// tokens of logged-out sessions ErrSessionRevoked, and every other rejection ErrTokenInvalid.
 func ValidateToken(tokenStr string, isRefresh bool) (*Claims, error) {
+	claims, err := parseClaims(tokenStr, isRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if sessionStore != nil {
+		if claims.ID == "" {
+			return nil, fmt.Errorf("%w: not bound to a session", ErrTokenInvalid)
+		}
+		active, err := sessionStore.IsSessionActive(claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session: %w", err)
+		}
+		if !active {
+			return nil, ErrSessionRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// parseClaims checks the token's signature and expiry without asking the session store whether
+// its session is still live, which only ValidateToken does
+func parseClaims(tokenStr string, isRefresh bool) (*Claims, error) {
 	secret := accessSecret
 	if isRefresh {
 		secret = refreshSecret
@@ -80,60 +141,34 @@ func ValidateToken(tokenStr string, isRefresh bool) (*Claims, error) {
 
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return secret, nil
-	})
+	}, tokenParserOptions...)
 
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrTokenExpired
+	}
 	if err != nil {
-		return nil, errors.New("invalid or malformed token")
+		return nil, ErrTokenInvalid
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return nil, errors.New("invalid token claims")
+		return nil, ErrTokenInvalid
 	}
-
-	// Explicitly check expiration
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return nil, errors.New("token has expired")
-	}
-
 	return claims, nil
 }
 
-// RefreshTokens generates a new access and refresh token using a valid refresh token
-func RefreshTokens(refreshToken string) (string, string, error) {
-	claims, err := ValidateToken(refreshToken, true)
-	if err != nil {
-		return "", "", errors.New("invalid or expired refresh token")
-	}
-
-	// Explicitly check if the refresh token is expired
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return "", "", errors.New("refresh token has expired")
-	}
-
-	// Generate new tokens
-	newAccessToken, newRefreshToken, err := GenerateTokens(&model.User{
-		ID:       claims.UserID,
-		Username: claims.Username,
-		Email:    claims.Email,
-	})
-	if err != nil {
-		return "", "", errors.New("failed to generate new tokens")
-	}
-
-	return newAccessToken, newRefreshToken, nil
-}
-
 // Helper function to generate JWT token
-func generateToken(user *model.User, secret []byte, expiry time.Duration) (string, error) {
+func generateToken(user *model.User, sessionID string, secret []byte, expiry time.Duration) (string, error) {
 	claims := &Claims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Email:    user.Email,
+		Role:     user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.Email,
+			ID:        sessionID,
 		},
 	}
 
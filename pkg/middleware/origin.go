@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"live-chatter/internal/config"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	Log "live-chatter/pkg/logger"
+)
+
+var (
+	allowedOrigins map[string]bool
+	allowAnyOrigin bool
+	originMu       sync.RWMutex
+)
+
+// InitOriginConfig loads the origin allow-list. The "*" wildcard is honoured only outside release mode.
+func InitOriginConfig(cfg *config.APIConfig) {
+	origins := make(map[string]bool)
+	wildcard := false
+
+	for _, origin := range cfg.Context.AllowedOrigins.Origins {
+		origin = normalizeOrigin(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			if cfg.Context.Mode == gin.ReleaseMode {
+				Log.Warn("Ignoring wildcard ALLOWED_ORIGINS entry in release mode")
+				continue
+			}
+			wildcard = true
+			continue
+		}
+		origins[origin] = true
+	}
+
+	originMu.Lock()
+	allowedOrigins = origins
+	allowAnyOrigin = wildcard
+	originMu.Unlock()
+}
+
+// IsOriginAllowed reports whether a browser Origin header matches the configured allow-list
+func IsOriginAllowed(origin string) bool {
+	originMu.RLock()
+	defer originMu.RUnlock()
+
+	if allowAnyOrigin {
+		return true
+	}
+	return allowedOrigins[normalizeOrigin(origin)]
+}
+
+// normalizeOrigin lowercases an origin and strips any trailing slash so entries compare reliably
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
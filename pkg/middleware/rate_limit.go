@@ -1,6 +1,12 @@
 package middleware
 
 import (
+	"container/list"
+	"live-chatter/internal/config"
+	Log "live-chatter/pkg/logger"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -8,41 +14,165 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// Defaults used when the RATE_LIMIT section leaves values unset
+const (
+	defaultAnonRPS        = 5
+	defaultAnonBurst      = 10
+	defaultAuthRPS        = 20
+	defaultAuthBurst      = 40
+	defaultLimiterIdleTTL = 3 * time.Minute
+	defaultMaxLimiters    = 10000
+)
+
+// ipLimiter pairs a client's token bucket with the last time it was used.
+// Despite the name, key is "user:<id>" for authenticated callers and "ip:<addr>" otherwise.
+type ipLimiter struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateTier is the quota handed to a class of callers
+type rateTier struct {
+	rps   rate.Limit
+	burst int
+}
+
 var (
-	rateLimiters = make(map[string]*rate.Limiter)
+	// rateLimiters indexes the entries of limiterLRU, which is ordered most recently used first.
+	// Bounding it stops a flood of rotating or spoofed IPs from growing memory without limit.
+	rateLimiters = make(map[string]*list.Element)
+	limiterLRU   = list.New()
 	mu           sync.Mutex
+
+	anonTier       = rateTier{rps: defaultAnonRPS, burst: defaultAnonBurst}
+	authTier       = rateTier{rps: defaultAuthRPS, burst: defaultAuthBurst}
+	limiterIdleTTL = defaultLimiterIdleTTL
+	maxLimiters    = defaultMaxLimiters
+	sweeperOnce    sync.Once
 )
 
-func getLimiter(ip string) *rate.Limiter {
+// InitRateLimitConfig applies the configured tiers, idle TTL and cap and starts the sweeper.
+// Unset values go back to their defaults, and callers already being tracked move to the new
+// tiers, so it can be called again when the config is reloaded.
+func InitRateLimitConfig(cfg *config.APIConfig) {
+	mu.Lock()
+	anonTier = rateTier{rps: defaultAnonRPS, burst: defaultAnonBurst}
+	authTier = rateTier{rps: defaultAuthRPS, burst: defaultAuthBurst}
+	limiterIdleTTL = defaultLimiterIdleTTL
+	maxLimiters = defaultMaxLimiters
+	anonRPS, anonBurst := cfg.RateLimit.AnonRPS, cfg.RateLimit.AnonBurst
+	if cfg.RateLimit.RequestsPerSecond > 0 || cfg.RateLimit.Burst > 0 {
+		Log.Warn("RATE_LIMIT/REQUESTS_PER_SECOND and BURST are deprecated, use ANON_RPS and ANON_BURST")
+		if anonRPS <= 0 {
+			anonRPS = cfg.RateLimit.RequestsPerSecond
+		}
+		if anonBurst <= 0 {
+			anonBurst = cfg.RateLimit.Burst
+		}
+	}
+	if anonRPS > 0 {
+		anonTier.rps = rate.Limit(anonRPS)
+	}
+	if anonBurst > 0 {
+		anonTier.burst = anonBurst
+	}
+	if cfg.RateLimit.AuthRPS > 0 {
+		authTier.rps = rate.Limit(cfg.RateLimit.AuthRPS)
+	}
+	if cfg.RateLimit.AuthBurst > 0 {
+		authTier.burst = cfg.RateLimit.AuthBurst
+	}
+	if cfg.RateLimit.IdleTTL > 0 {
+		limiterIdleTTL = time.Duration(cfg.RateLimit.IdleTTL) * time.Second
+	}
+	if cfg.RateLimit.MaxEntries > 0 {
+		maxLimiters = cfg.RateLimit.MaxEntries
+	}
+	for _, element := range rateLimiters {
+		entry := element.Value.(*ipLimiter)
+		tier := &anonTier
+		if strings.HasPrefix(entry.key, "user:") {
+			tier = &authTier
+		}
+		entry.limiter.SetLimit(tier.rps)
+		entry.limiter.SetBurst(tier.burst)
+	}
+	mu.Unlock()
+
+	startSweeper()
+}
+
+func getLimiter(key string, tier *rateTier) *rate.Limiter {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if limiter, exists := rateLimiters[ip]; exists {
-		return limiter
+	now := time.Now()
+	if element, exists := rateLimiters[key]; exists {
+		entry := element.Value.(*ipLimiter)
+		entry.lastSeen = now
+		limiterLRU.MoveToFront(element)
+		return entry.limiter
 	}
 
-	// Allow 5 requests per second with burst of 10
-	limiter := rate.NewLimiter(5, 10)
-	rateLimiters[ip] = limiter
+	// Evict the least recently used callers once the cap is reached
+	for limiterLRU.Len() >= maxLimiters {
+		oldest := limiterLRU.Back()
+		limiterLRU.Remove(oldest)
+		delete(rateLimiters, oldest.Value.(*ipLimiter).key)
+	}
 
-	// Cleanup expired entries
-	go func() {
-		time.Sleep(time.Minute)
-		mu.Lock()
-		delete(rateLimiters, ip)
-		mu.Unlock()
-	}()
+	limiter := rate.NewLimiter(tier.rps, tier.burst)
+	rateLimiters[key] = limiterLRU.PushFront(&ipLimiter{key: key, limiter: limiter, lastSeen: now})
 
 	return limiter
 }
 
+// startSweeper launches the single background goroutine that evicts idle limiters.
+// Active clients keep their bucket, so bursts are not reset while they are still sending.
+func startSweeper() {
+	sweeperOnce.Do(func() {
+		go func() {
+			for {
+				mu.Lock()
+				interval := limiterIdleTTL / 2
+				mu.Unlock()
+
+				time.Sleep(interval)
+				sweepIdleLimiters(time.Now())
+			}
+		}()
+	})
+}
+
+// sweepIdleLimiters drops limiters that have not been used within the idle TTL
+func sweepIdleLimiters(now time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The list is ordered by use, so idle entries are all at the back
+	for element := limiterLRU.Back(); element != nil; element = limiterLRU.Back() {
+		entry := element.Value.(*ipLimiter)
+		if now.Sub(entry.lastSeen) <= limiterIdleTTL {
+			return
+		}
+		limiterLRU.Remove(element)
+		delete(rateLimiters, entry.key)
+	}
+}
+
 func RateLimitMiddleware() gin.HandlerFunc {
+	startSweeper()
+
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := getLimiter(ip)
+		key, tier := "ip:"+c.ClientIP(), &anonTier
+		if userID, ok := rateLimitUser(c); ok {
+			key, tier = "user:"+strconv.FormatUint(uint64(userID), 10), &authTier
+		}
+		limiter := getLimiter(key, tier)
 
 		if !limiter.Allow() {
-			c.JSON(429, gin.H{"error": "Too many requests"})
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
 			c.Abort()
 			return
 		}
@@ -50,3 +180,25 @@ func RateLimitMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// rateLimitUser identifies the caller for the authenticated tier. The limiter runs ahead of
+// AuthMiddleware, so a bearer token's signature and expiry are checked here; anything else is
+// treated as anonymous. The session lookup is left to AuthMiddleware so that rate limiting
+// costs no database query, and a revoked session only keeps its quota until the token expires.
+func rateLimitUser(c *gin.Context) (uint, bool) {
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			return id, true
+		}
+	}
+
+	parts := strings.Fields(c.GetHeader("Authorization"))
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return 0, false
+	}
+	claims, err := parseClaims(parts[1], false)
+	if err != nil {
+		return 0, false
+	}
+	return claims.UserID, true
+}
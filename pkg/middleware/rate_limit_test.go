@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"live-chatter/internal/config"
+	"live-chatter/pkg/model"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// failingSessionStore fails the test if rate limiting asks it about a session
+type failingSessionStore struct{ t *testing.T }
+
+func (s failingSessionStore) IsSessionActive(string) (bool, error) {
+	s.t.Error("rate limiter looked up the session")
+	return true, nil
+}
+
+func TestRateLimitUserSkipsSessionLookup(t *testing.T) {
+	accessSecret, accessExpiry = []byte("test-secret"), time.Minute
+	SetSessionStore(failingSessionStore{t})
+	defer SetSessionStore(nil)
+
+	access, _, err := GenerateTokens(&model.User{ID: 42, Username: "alice"}, "session-1")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/v1/rooms", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+access)
+	if id, ok := rateLimitUser(c); !ok || id != 42 {
+		t.Fatalf("rateLimitUser = %d, %v; want 42, true", id, ok)
+	}
+
+	c.Request.Header.Set("Authorization", "Bearer "+access+"x")
+	if _, ok := rateLimitUser(c); ok {
+		t.Fatal("a token with a bad signature was given the authenticated tier")
+	}
+}
+
+func TestInitRateLimitConfigReadsDeprecatedKeys(t *testing.T) {
+	cfg := &config.APIConfig{}
+	cfg.RateLimit.RequestsPerSecond = 3
+	cfg.RateLimit.Burst = 6
+	InitRateLimitConfig(cfg)
+
+	if anonTier.rps != rate.Limit(3) || anonTier.burst != 6 {
+		t.Fatalf("anonymous tier = %+v, want the REQUESTS_PER_SECOND and BURST values", anonTier)
+	}
+
+	cfg.RateLimit.AnonRPS = 8
+	InitRateLimitConfig(cfg)
+	if anonTier.rps != rate.Limit(8) {
+		t.Fatalf("ANON_RPS did not take precedence over REQUESTS_PER_SECOND, got %v", anonTier.rps)
+	}
+}
+
+// resetRateLimits applies cfg to an empty limiter table
+func resetRateLimits(cfg *config.APIConfig) {
+	mu.Lock()
+	rateLimiters = make(map[string]*list.Element)
+	limiterLRU = list.New()
+	mu.Unlock()
+	InitRateLimitConfig(cfg)
+}
+
+// rateLimitedRouter serves /ping behind the rate limiter
+func rateLimitedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimitMiddleware())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func ping(router *gin.Engine, addr, authorization string) int {
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.RemoteAddr = addr
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res.Code
+}
+
+func TestRateLimitThrottlesOneIP(t *testing.T) {
+	cfg := &config.APIConfig{}
+	cfg.RateLimit.AnonRPS = 1
+	cfg.RateLimit.AnonBurst = 5
+	resetRateLimits(cfg)
+	router := rateLimitedRouter()
+
+	// Hammer one address from many goroutines; only the burst gets through
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ping(router, "198.51.100.7:4000", "") == http.StatusOK {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 5 {
+		t.Fatalf("%d requests allowed, want the burst of 5", got)
+	}
+
+	if ping(router, "198.51.100.8:4000", "") != http.StatusOK {
+		t.Fatal("another address was throttled with the first")
+	}
+}
+
+func TestIdleLimitersAreSwept(t *testing.T) {
+	resetRateLimits(&config.APIConfig{})
+	router := rateLimitedRouter()
+	ping(router, "198.51.100.7:4000", "")
+
+	sweepIdleLimiters(time.Now())
+	if _, ok := rateLimiters["ip:198.51.100.7"]; !ok {
+		t.Fatal("a recently used limiter was swept")
+	}
+	sweepIdleLimiters(time.Now().Add(limiterIdleTTL + time.Second))
+	if _, ok := rateLimiters["ip:198.51.100.7"]; ok {
+		t.Fatal("an idle limiter was not swept")
+	}
+}
+
+func TestLimiterTableIsCapped(t *testing.T) {
+	cfg := &config.APIConfig{}
+	cfg.RateLimit.MaxEntries = 10
+	resetRateLimits(cfg)
+	router := rateLimitedRouter()
+
+	for i := 0; i < 25; i++ {
+		ping(router, fmt.Sprintf("203.0.113.%d:4000", i), "")
+	}
+	if len(rateLimiters) != 10 || limiterLRU.Len() != 10 {
+		t.Fatalf("%d limiters tracked (%d in the LRU list), want the cap of 10", len(rateLimiters), limiterLRU.Len())
+	}
+	if _, ok := rateLimiters["ip:203.0.113.0"]; ok {
+		t.Fatal("the oldest address was not evicted")
+	}
+	if _, ok := rateLimiters["ip:203.0.113.24"]; !ok {
+		t.Fatal("the newest address was evicted")
+	}
+}
+
+func TestAuthenticatedCallersGetTheHigherTier(t *testing.T) {
+	accessSecret, accessExpiry = []byte("test-secret"), time.Minute
+	cfg := &config.APIConfig{}
+	cfg.RateLimit.AnonRPS, cfg.RateLimit.AnonBurst = 1, 2
+	cfg.RateLimit.AuthRPS, cfg.RateLimit.AuthBurst = 1, 6
+	resetRateLimits(cfg)
+	router := rateLimitedRouter()
+
+	access, _, err := GenerateTokens(&model.User{ID: 7, Username: "alice"}, "session-1")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+
+	count := func(addr, authorization string) int {
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			if ping(router, addr, authorization) == http.StatusOK {
+				allowed++
+			}
+		}
+		return allowed
+	}
+	if got := count("198.51.100.20:4000", ""); got != 2 {
+		t.Fatalf("anonymous caller allowed %d requests, want 2", got)
+	}
+	if got := count("198.51.100.21:4000", "Bearer "+access); got != 6 {
+		t.Fatalf("authenticated caller allowed %d requests, want 6", got)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	Log "live-chatter/pkg/logger"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern bounds caller-supplied IDs so they cannot inject text into log lines
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware tags every request with a correlation ID, reusing a well-formed
+// X-Request-ID from the caller or generating one. The ID is echoed in the response header,
+// stored as "request_id" in the gin context and carried by the request context for the *Ctx
+// log functions, WebSocket handlers included.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(Log.WithRequestID(c.Request.Context(), requestID))
+		c.Writer.Header().Set(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
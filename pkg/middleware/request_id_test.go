@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	Log "live-chatter/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDReachesHeaderAndLogs(t *testing.T) {
+	dir := t.TempDir()
+	Log.SetupLogging(Log.DefaultLoggingOptions(dir, false))
+	t.Cleanup(Log.Close)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		Log.InfoCtx(c.Request.Context(), "handled ping")
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(requestID string) string {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Header().Get(RequestIDHeader)
+	}
+
+	generated := serve("")
+	if generated == "" {
+		t.Fatal("no request ID in the response")
+	}
+	if reused := serve("trace-42"); reused != "trace-42" {
+		t.Fatalf("caller's ID came back as %q", reused)
+	}
+	if replaced := serve("bad id\nINFO: forged"); replaced == "" || strings.ContainsAny(replaced, " \n") {
+		t.Fatalf("malformed caller ID was echoed as %q", replaced)
+	}
+
+	Log.FlushLogs()
+	data, err := os.ReadFile(filepath.Join(dir, "info.log"))
+	if err != nil {
+		t.Fatalf("read info.log: %v", err)
+	}
+	for _, id := range []string{generated, "trace-42"} {
+		if !strings.Contains(string(data), "handled ping request_id="+id) {
+			t.Fatalf("info.log has no line tagged with %s:\n%s", id, data)
+		}
+	}
+}
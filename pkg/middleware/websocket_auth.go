@@ -32,8 +32,7 @@ func WebSocketAuthMiddleware() gin.HandlerFunc {
 		// Validate the token
 		claims, err := ValidateToken(token, false)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+			rejectToken(c, err)
 			return
 		}
 
@@ -42,6 +41,7 @@ func WebSocketAuthMiddleware() gin.HandlerFunc {
 		ctx := context.WithValue(c.Request.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "username", claims.Username)
 		ctx = context.WithValue(ctx, "email", claims.Email)
+		ctx = context.WithValue(ctx, "client_ip", c.ClientIP())
 
 		c.Request = c.Request.WithContext(ctx)
 		c.Next()
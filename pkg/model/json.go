@@ -0,0 +1,137 @@
+package model
+
+import "encoding/json"
+
+// The MarshalJSON methods below override each model's time fields with Timestamp so that every
+// response uses the same format. The alias types drop the methods to avoid recursing.
+
+func (u User) MarshalJSON() ([]byte, error) {
+	type alias User
+	return json.Marshal(struct {
+		alias
+		LastSeen  *Timestamp `json:"last_seen"`
+		CreatedAt Timestamp  `json:"created_at"`
+		UpdatedAt Timestamp  `json:"updated_at"`
+	}{alias(u), stampPtr(u.LastSeen), stamp(u.CreatedAt), stamp(u.UpdatedAt)})
+}
+
+func (r Room) MarshalJSON() ([]byte, error) {
+	type alias Room
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+		UpdatedAt Timestamp `json:"updated_at"`
+	}{alias(r), stamp(r.CreatedAt), stamp(r.UpdatedAt)})
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	return json.Marshal(struct {
+		alias
+		EditedAt  *Timestamp `json:"edited_at"`
+		CreatedAt Timestamp  `json:"created_at"`
+		UpdatedAt Timestamp  `json:"updated_at"`
+	}{alias(m), stampPtr(m.EditedAt), stamp(m.CreatedAt), stamp(m.UpdatedAt)})
+}
+
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	type alias Attachment
+	return json.Marshal(struct {
+		alias
+		URL          string    `json:"url"`
+		ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+		CreatedAt    Timestamp `json:"created_at"`
+	}{alias(a), a.URL(), a.ThumbnailURL(), stamp(a.CreatedAt)})
+}
+
+func (pm PrivateMessage) MarshalJSON() ([]byte, error) {
+	type alias PrivateMessage
+	return json.Marshal(struct {
+		alias
+		ReadAt      *Timestamp `json:"read_at"`
+		DeliveredAt *Timestamp `json:"delivered_at"`
+		CreatedAt   Timestamp  `json:"created_at"`
+		UpdatedAt   Timestamp  `json:"updated_at"`
+	}{alias(pm), stampPtr(pm.ReadAt), stampPtr(pm.DeliveredAt), stamp(pm.CreatedAt), stamp(pm.UpdatedAt)})
+}
+
+func (s UserSession) MarshalJSON() ([]byte, error) {
+	type alias UserSession
+	return json.Marshal(struct {
+		alias
+		ExpiresAt Timestamp `json:"expires_at"`
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(s), stamp(s.ExpiresAt), stamp(s.CreatedAt)})
+}
+
+func (a ActivityLog) MarshalJSON() ([]byte, error) {
+	type alias ActivityLog
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(a), stamp(a.CreatedAt)})
+}
+
+// Notification also inlines its stored payload so clients receive an object, not a string
+func (n Notification) MarshalJSON() ([]byte, error) {
+	type alias Notification
+	var payload json.RawMessage
+	if n.Payload != "" {
+		payload = json.RawMessage(n.Payload)
+	}
+	return json.Marshal(struct {
+		alias
+		Payload   json.RawMessage `json:"payload"`
+		ReadAt    *Timestamp      `json:"read_at"`
+		CreatedAt Timestamp       `json:"created_at"`
+	}{alias(n), payload, stampPtr(n.ReadAt), stamp(n.CreatedAt)})
+}
+
+func (e CustomEmoji) MarshalJSON() ([]byte, error) {
+	type alias CustomEmoji
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(e), stamp(e.CreatedAt)})
+}
+
+func (r MessageReaction) MarshalJSON() ([]byte, error) {
+	type alias MessageReaction
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(r), stamp(r.CreatedAt)})
+}
+
+func (b RoomBan) MarshalJSON() ([]byte, error) {
+	type alias RoomBan
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(b), stamp(b.CreatedAt)})
+}
+
+func (p PinnedMessage) MarshalJSON() ([]byte, error) {
+	type alias PinnedMessage
+	return json.Marshal(struct {
+		alias
+		PinnedAt Timestamp `json:"pinned_at"`
+	}{alias(p), stamp(p.PinnedAt)})
+}
+
+func (i RoomInvite) MarshalJSON() ([]byte, error) {
+	type alias RoomInvite
+	return json.Marshal(struct {
+		alias
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(i), stamp(i.CreatedAt)})
+}
+
+func (t InviteToken) MarshalJSON() ([]byte, error) {
+	type alias InviteToken
+	return json.Marshal(struct {
+		alias
+		ExpiresAt Timestamp `json:"expires_at"`
+		CreatedAt Timestamp `json:"created_at"`
+	}{alias(t), stamp(t.ExpiresAt), stamp(t.CreatedAt)})
+}
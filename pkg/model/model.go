@@ -10,32 +10,51 @@ import (
 type User struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	Username  string         `json:"username" gorm:"uniqueIndex;not null"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
+	Email     string         `json:"email" gorm:"uniqueIndex:idx_users_email_present,where:email <> '';not null"`
 	Password  string         `json:"password,omitempty" gorm:"not null"` // Exclude from JSON responses
 	FirstName string         `json:"first_name"`
 	LastName  string         `json:"last_name"`
 	Status    string         `json:"status" gorm:"default:'offline'"` // online, offline, away, busy
+	Locale    string         `json:"locale" gorm:"default:'en'"`      // Language for system messages
+	Role      string         `json:"role" gorm:"default:'user'"`      // user, admin
 	LastSeen  *time.Time     `json:"last_seen"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	AppearOffline bool `json:"appear_offline" gorm:"default:false"` // Hide from online lists and presence
+
 	// Relationships
 	Messages     []Message `json:"-" gorm:"foreignKey:UserID"`
 	Rooms        []Room    `json:"-" gorm:"many2many:user_rooms;"`
 	SentMessages []Message `json:"-" gorm:"foreignKey:UserID"`
 }
 
+// userStatuses are the values User.Status may take
+var userStatuses = map[string]bool{
+	"online":  true,
+	"offline": true,
+	"away":    true,
+	"busy":    true,
+}
+
+// IsValidStatus reports whether status is one a user may be in
+func IsValidStatus(status string) bool {
+	return userStatuses[status]
+}
+
 // Room represents a chat room
 type Room struct {
-	ID          string         `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	Type        string         `json:"type" gorm:"default:'public'"` // public, private
-	CreatedBy   uint           `json:"created_by"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             string         `json:"id" gorm:"primaryKey"`
+	Name           string         `json:"name" gorm:"not null"`
+	Description    string         `json:"description"`
+	Type           string         `json:"type" gorm:"default:'public'"` // public, private
+	CreatedBy      uint           `json:"created_by"`
+	NotifyOnChange bool           `json:"notify_on_change" gorm:"default:false"` // Notify offline members of edits/deletes
+	AutoLeave      bool           `json:"auto_leave" gorm:"default:false"`       // Remove members after a period of inactivity
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Creator  User      `json:"creator" gorm:"foreignKey:CreatedBy"`
@@ -45,19 +64,23 @@ type Room struct {
 
 // Message represents a chat message
 type Message struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
+	ID        uint           `json:"id" gorm:"primaryKey;index:idx_messages_room_keyset,priority:3"`
 	Content   string         `json:"content" gorm:"not null"`
 	Type      string         `json:"type" gorm:"default:'text'"` // text, image, file, system
 	UserID    uint           `json:"user_id"`
 	Username  string         `json:"username"`
-	RoomID    string         `json:"room_id"`
+	RoomID    string         `json:"room_id" gorm:"index:idx_messages_room_keyset,priority:1"`
 	ParentID  *uint          `json:"parent_id"` // For threaded messages
 	Edited    bool           `json:"edited" gorm:"default:false"`
 	EditedAt  *time.Time     `json:"edited_at"`
-	CreatedAt time.Time      `json:"created_at"`
+	Version   uint           `json:"version" gorm:"not null;default:1"` // Incremented on every edit, for conflict detection
+	CreatedAt time.Time      `json:"created_at" gorm:"index:idx_messages_room_keyset,priority:2"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	AttachmentID  *string `json:"attachment_id" gorm:"size:36;index"` // Set on image and file messages
+	AttachmentURL string  `json:"attachment_url,omitempty"`
+
 	// Relationships
 	User    User      `json:"user" gorm:"foreignKey:UserID"`
 	Room    Room      `json:"room" gorm:"foreignKey:RoomID"`
@@ -65,18 +88,101 @@ type Message struct {
 	Replies []Message `json:"replies" gorm:"foreignKey:ParentID"`
 }
 
+// Attachment is a file uploaded to a room for use in an image or file message
+type Attachment struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:36"`
+	RoomID      string    `json:"room_id" gorm:"not null;index"`
+	UploaderID  uint      `json:"uploader_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	ThumbnailType string `json:"-"` // Content type of the stored thumbnail; empty when there is none
+}
+
+// URL is where the attachment can be downloaded
+func (a Attachment) URL() string {
+	return "/download/" + a.ID
+}
+
+// ThumbnailURL is where the attachment's thumbnail can be downloaded, or empty without one
+func (a Attachment) ThumbnailURL() string {
+	if a.ThumbnailType == "" {
+		return ""
+	}
+	return a.URL() + "?size=thumb"
+}
+
+// ThumbnailKey is the storage key of the attachment's thumbnail
+func (a Attachment) ThumbnailKey() string {
+	return a.ID + ".thumb"
+}
+
 // UserRoom represents the many-to-many relationship between users and rooms
 type UserRoom struct {
 	UserID   uint      `gorm:"primaryKey"`
 	RoomID   string    `gorm:"primaryKey"`
 	Role     string    `gorm:"default:'member'"` // admin, moderator, member
+	Muted    bool      `gorm:"default:false"`    // Suppresses notifications from this room
+	Favorite bool      `gorm:"default:false"`    // Exempts the membership from auto-leave
 	JoinedAt time.Time `gorm:"autoCreateTime"`
 	LeftAt   *time.Time
 
+	LastActiveAt *time.Time // Last message sent or history read in the room; JoinedAt stands in until then
+
 	User User `gorm:"foreignKey:UserID"`
 	Room Room `gorm:"foreignKey:RoomID"`
 }
 
+// RoomBan keeps a user kicked from a room from joining it again until they are unbanned
+type RoomBan struct {
+	RoomID    string    `json:"room_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	BannedBy  uint      `json:"banned_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PinnedMessage highlights a message at the top of its room; a message is pinned at most once
+type PinnedMessage struct {
+	MessageID uint      `json:"message_id" gorm:"primaryKey"`
+	RoomID    string    `json:"room_id" gorm:"not null;index"`
+	PinnedBy  uint      `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+
+	Message Message `json:"message" gorm:"foreignKey:MessageID"`
+}
+
+// RoomInvite lets a user join a private room; it is used up when they join
+type RoomInvite struct {
+	RoomID    string    `json:"room_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	InvitedBy uint      `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InviteToken is a shareable link that lets anyone holding it join a room, public or private,
+// until it expires or has been used MaxUses times
+type InviteToken struct {
+	Token     string    `json:"token" gorm:"primaryKey;size:64"`
+	RoomID    string    `json:"room_id" gorm:"not null;index"`
+	CreatedBy uint      `json:"created_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxUses   int       `json:"max_uses" gorm:"default:0"` // 0 means unlimited
+	Uses      int       `json:"uses" gorm:"default:0"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one. Only a hash of the
+// token is stored; the token itself is emailed to the user.
+type PasswordResetToken struct {
+	TokenHash string     `json:"-" gorm:"primaryKey;size:64"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // PrivateMessage represents direct messages between users
 type PrivateMessage struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
@@ -86,6 +192,7 @@ type PrivateMessage struct {
 	RecipientID uint           `json:"recipient_id"`
 	Read        bool           `json:"read" gorm:"default:false"`
 	ReadAt      *time.Time     `json:"read_at"`
+	DeliveredAt *time.Time     `json:"delivered_at"` // When it first reached a connection of the recipient
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -117,7 +224,67 @@ type ActivityLog struct {
 	IPAddress string    `json:"ip_address"`
 	CreatedAt time.Time `json:"created_at"`
 
-	User User `json:"user" gorm:"foreignKey:UserID"`
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// Activity log actions
+const (
+	ActivityLogin       = "login"
+	ActivityLogout      = "logout"
+	ActivityJoinRoom    = "join_room"
+	ActivityLeaveRoom   = "leave_room"
+	ActivitySendMessage = "send_message"
+
+	ActivityPasswordReset = "password_reset"
+)
+
+// Notification represents a stored notice for a user who was not online to see an event
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Type      string     `json:"type"` // See the Notification* constants
+	RoomID    string     `json:"room_id"`
+	MessageID *uint      `json:"message_id"`
+	ActorID   uint       `json:"actor_id"`
+	Content   string     `json:"content"`            // Message content, or the room name for room notices
+	Payload   string     `json:"-" gorm:"type:text"` // JSON object with type-specific details
+	Read      bool       `json:"read" gorm:"default:false"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// Notification types
+const (
+	NotificationMessageEdited  = "message_edited"
+	NotificationMessageDeleted = "message_deleted"
+	NotificationRoomAutoLeft   = "room_auto_left"
+	NotificationRoomInvite     = "room_invite"
+	NotificationRoomKick       = "room_kick"
+	NotificationMention        = "mention"
+	NotificationPrivateMessage = "private_message"
+)
+
+// CustomEmoji is an admin-defined emoji usable by name in reactions. Global emoji have no
+// RoomID; room-scoped ones are only available to members of that room.
+type CustomEmoji struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"not null;index"`
+	URL       string         `json:"url" gorm:"not null"`
+	RoomID    *string        `json:"room_id" gorm:"index"`
+	CreatedBy uint           `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// MessageReaction is one user's emoji reaction to a message. Custom emoji are stored as ":name:".
+type MessageReaction struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MessageID uint      `json:"message_id" gorm:"not null;uniqueIndex:idx_message_reactions_unique"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_message_reactions_unique"`
+	Emoji     string    `json:"emoji" gorm:"size:64;not null;uniqueIndex:idx_message_reactions_unique"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // TableName methods for custom table names
@@ -133,6 +300,10 @@ func (Message) TableName() string {
 	return "messages"
 }
 
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
 func (UserRoom) TableName() string {
 	return "user_rooms"
 }
@@ -148,3 +319,27 @@ func (UserSession) TableName() string {
 func (ActivityLog) TableName() string {
 	return "activity_logs"
 }
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+func (CustomEmoji) TableName() string {
+	return "custom_emoji"
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reactions"
+}
+
+func (RoomBan) TableName() string {
+	return "room_bans"
+}
+
+func (RoomInvite) TableName() string {
+	return "room_invites"
+}
+
+func (InviteToken) TableName() string {
+	return "invite_tokens"
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampLayout is the wire format of every timestamp in REST responses and WebSocket events:
+// RFC3339 in UTC with millisecond precision, e.g. 2024-05-01T12:30:00.000Z
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp is a time that serializes in TimestampLayout and parses tolerantly
+type Timestamp time.Time
+
+// FormatTimestamp renders t in TimestampLayout
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+// ParseTimestamp accepts RFC3339 with or without fractional seconds, a zone-less date-time
+// (taken as UTC), a bare date, or Unix time in seconds or milliseconds
+func ParseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Values this large are milliseconds; in seconds they would lie thousands of years ahead
+		if n > 1e11 || n < -1e11 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + FormatTimestamp(time.Time(t)) + `"`), nil
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var parsed time.Time
+	var err error
+	switch v := raw.(type) {
+	case string:
+		parsed, err = ParseTimestamp(v)
+	case float64:
+		parsed, err = ParseTimestamp(strconv.FormatInt(int64(v), 10))
+	case nil:
+		return nil
+	default:
+		err = fmt.Errorf("unrecognized timestamp %s", data)
+	}
+	if err != nil {
+		return err
+	}
+
+	*t = Timestamp(parsed)
+	return nil
+}
+
+// stamp converts a time for serialization
+func stamp(t time.Time) Timestamp {
+	return Timestamp(t)
+}
+
+// stampPtr converts an optional time for serialization, keeping nil as null
+func stampPtr(t *time.Time) *Timestamp {
+	if t == nil {
+		return nil
+	}
+	ts := Timestamp(*t)
+	return &ts
+}
+
+// NormalizeTimestamps returns a copy of data with time values converted to Timestamp, so
+// timestamps carried in free-form event data serialize like every other one
+func NormalizeTimestamps(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	normalized := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		switch v := value.(type) {
+		case time.Time:
+			normalized[key] = stamp(v)
+		case *time.Time:
+			normalized[key] = stampPtr(v)
+		default:
+			normalized[key] = value
+		}
+	}
+	return normalized
+}
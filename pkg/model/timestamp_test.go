@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// wireTimestamp is the shape every serialized timestamp must have
+var wireTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z$`)
+
+// timeFields decodes v's JSON and returns the values of the named fields
+func timeFields(t *testing.T, v any, names ...string) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", v, err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal %T: %v", v, err)
+	}
+	fields := make(map[string]any, len(names))
+	for _, name := range names {
+		fields[name] = decoded[name]
+	}
+	return fields
+}
+
+func TestModelTimestampsShareOneFormat(t *testing.T) {
+	// A non-UTC zone with sub-millisecond precision, as a database in another zone could return
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	at := time.Date(2024, 5, 1, 14, 30, 0, 123456789, zone)
+	const want = "2024-05-01T12:30:00.123Z"
+
+	models := map[string]struct {
+		value  any
+		fields []string
+	}{
+		"message":         {Message{CreatedAt: at, UpdatedAt: at, EditedAt: &at}, []string{"created_at", "updated_at", "edited_at"}},
+		"room":            {Room{CreatedAt: at, UpdatedAt: at}, []string{"created_at", "updated_at"}},
+		"user":            {User{CreatedAt: at, UpdatedAt: at, LastSeen: &at}, []string{"created_at", "updated_at", "last_seen"}},
+		"private message": {PrivateMessage{CreatedAt: at, UpdatedAt: at, ReadAt: &at}, []string{"created_at", "updated_at", "read_at"}},
+	}
+	for name, m := range models {
+		for field, value := range timeFields(t, m.value, m.fields...) {
+			if value != want {
+				t.Errorf("%s %s = %v, want %s", name, field, value, want)
+			}
+		}
+	}
+}
+
+func TestUnsetOptionalTimestampIsNull(t *testing.T) {
+	fields := timeFields(t, Message{}, "edited_at", "created_at")
+	if fields["edited_at"] != nil {
+		t.Fatalf("edited_at = %v, want null", fields["edited_at"])
+	}
+	if s, _ := fields["created_at"].(string); !wireTimestamp.MatchString(s) {
+		t.Fatalf("zero created_at = %v, want the wire format", fields["created_at"])
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	for _, value := range []string{
+		"2024-05-01T12:30:00Z",
+		"2024-05-01T12:30:00.000Z",
+		"2024-05-01T14:30:00+02:00",
+		"2024-05-01T12:30:00",
+		"2024-05-01 12:30:00",
+		" 1714566600 ",
+		"1714566600000",
+	} {
+		got, err := ParseTimestamp(value)
+		if err != nil || !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("ParseTimestamp(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	if got, err := ParseTimestamp("2024-05-01"); err != nil || !got.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseTimestamp of a bare date = %v, %v", got, err)
+	}
+	if _, err := ParseTimestamp("yesterday"); err == nil {
+		t.Error("ParseTimestamp accepted yesterday")
+	}
+}
+
+func TestTimestampRoundTrips(t *testing.T) {
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`1714566600000`), &ts); err != nil {
+		t.Fatalf("unmarshal milliseconds: %v", err)
+	}
+	data, _ := json.Marshal(ts)
+	if string(data) != `"2024-05-01T12:30:00.000Z"` {
+		t.Fatalf("round trip = %s", data)
+	}
+}
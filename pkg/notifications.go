@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"encoding/json"
+	"time"
+
+	"live-chatter/pkg/model"
+
+	Log "live-chatter/pkg/logger"
+)
+
+// Notify delivers a notification to a user: connected users get a notification frame, others
+// have it stored for them to list later. payload holds type-specific details and may be nil.
+func (manager *ClientManager) Notify(username string, notification model.Notification, payload map[string]interface{}) {
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	if manager.IsUserOnline(username) {
+		data := map[string]interface{}{
+			"type":       notification.Type,
+			"room_id":    notification.RoomID,
+			"message_id": notification.MessageID,
+			"actor_id":   notification.ActorID,
+			"content":    notification.Content,
+		}
+		if payload != nil {
+			data["payload"] = payload
+		}
+		manager.Publish(BroadcastMessage{
+			Message: &Message{
+				ID:        generateMessageID(),
+				Type:      "notification",
+				RoomID:    notification.RoomID,
+				Timestamp: notification.CreatedAt,
+				Data:      data,
+			},
+			TargetUsername: username,
+			MessageType:    "direct_message",
+		})
+		return
+	}
+
+	if manager.NotificationRepo == nil {
+		return
+	}
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			Log.Error("Failed to encode %s notification payload for %s: %v", notification.Type, username, err)
+			return
+		}
+		notification.Payload = string(encoded)
+	}
+	if err := manager.NotificationRepo.CreateNotifications([]model.Notification{notification}); err != nil {
+		Log.Error("Failed to store %s notification for %s: %v", notification.Type, username, err)
+	}
+}
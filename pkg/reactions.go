@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// customEmojiPattern matches a custom emoji reference such as ":party_parrot:"
+var customEmojiPattern = regexp.MustCompile(`^:([a-z0-9_]{2,32}):$`)
+
+// shortcodePattern finds custom emoji references within message text
+var shortcodePattern = regexp.MustCompile(`:([a-z0-9_]{2,32}):`)
+
+// maxEmojiRunes bounds unicode reactions; the longest ZWJ sequences stay well below it
+const maxEmojiRunes = 16
+
+// ReactionError is returned when a reaction is refused
+type ReactionError struct {
+	Code   string // message_not_found, not_room_member, invalid_emoji, emoji_not_found
+	Reason string
+}
+
+func (e *ReactionError) Error() string {
+	return e.Reason
+}
+
+// ResolveCustomEmoji finds the emoji a name refers to in a room, preferring the room's own emoji
+// over a global one. Emoji scoped to other rooms are never returned. It returns nil if none match.
+func ResolveCustomEmoji(repo repository.EmojiRepository, name, roomID string) (*model.CustomEmoji, error) {
+	if roomID != "" {
+		emoji, err := repo.FindEmoji(name, &roomID)
+		if err != nil || emoji != nil {
+			return emoji, err
+		}
+	}
+	return repo.FindEmoji(name, nil)
+}
+
+// normalizeReaction checks a reaction emoji: either unicode emoji or a ":name:" custom emoji
+// available in the room. Only adding requires the custom emoji to exist, so reactions whose
+// emoji has since been deleted can still be removed.
+func (manager *ClientManager) normalizeReaction(emoji, roomID string, add bool) (string, error) {
+	emoji = strings.TrimSpace(emoji)
+
+	if match := customEmojiPattern.FindStringSubmatch(emoji); match != nil {
+		if !add {
+			return emoji, nil
+		}
+		if manager.EmojiRepo == nil {
+			return "", &ReactionError{Code: "emoji_not_found", Reason: "Custom emoji are not available"}
+		}
+		custom, err := ResolveCustomEmoji(manager.EmojiRepo, match[1], roomID)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up emoji: %v", err)
+		}
+		if custom == nil {
+			return "", &ReactionError{Code: "emoji_not_found", Reason: "Custom emoji " + emoji + " is not available in this room"}
+		}
+		return emoji, nil
+	}
+
+	count := utf8.RuneCountInString(emoji)
+	hasSymbol := false
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || (r < utf8.RuneSelf && unicode.IsLetter(r)) {
+			count = 0
+			break
+		}
+		if r >= utf8.RuneSelf {
+			hasSymbol = true
+		}
+	}
+	if count == 0 || count > maxEmojiRunes || !hasSymbol {
+		return "", &ReactionError{Code: "invalid_emoji", Reason: "Reactions must be an emoji or a :custom_emoji:"}
+	}
+	return emoji, nil
+}
+
+// React adds or removes a user's reaction to a message they can see, then broadcasts the
+// message's updated counts to its room. Repeating an add or remove changes nothing and
+// broadcasts nothing. It returns the current counts either way.
+func (manager *ClientManager) React(userID, messageID uint, emoji string, add bool) ([]repository.ReactionCount, error) {
+	message, err := manager.MessageRepo.GetMessageByID(messageID)
+	if err != nil || message == nil {
+		return nil, &ReactionError{Code: "message_not_found", Reason: "Message not found"}
+	}
+
+	isMember, err := manager.RoomRepo.IsUserInRoom(message.RoomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %v", err)
+	}
+	if !isMember {
+		return nil, &ReactionError{Code: "not_room_member", Reason: "You are not a member of this room"}
+	}
+
+	emoji, err = manager.normalizeReaction(emoji, message.RoomID, add)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed bool
+	if add {
+		changed, err = manager.ReactionRepo.AddReaction(&model.MessageReaction{MessageID: messageID, UserID: userID, Emoji: emoji})
+	} else {
+		changed, err = manager.ReactionRepo.RemoveReaction(messageID, userID, emoji)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update reaction: %v", err)
+	}
+
+	counts, err := manager.ReactionRepo.CountReactions(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %v", err)
+	}
+
+	if changed {
+		action := "added"
+		if !add {
+			action = "removed"
+		}
+		manager.Publish(BroadcastMessage{
+			Message: &Message{
+				ID:        generateMessageID(),
+				Type:      "reaction_updated",
+				UserID:    userID,
+				Username:  "System",
+				RoomID:    message.RoomID,
+				Timestamp: time.Now(),
+				Data: map[string]interface{}{
+					"message_id": messageID,
+					"emoji":      emoji,
+					"action":     action,
+					"reactions":  counts,
+				},
+			},
+			RoomID:      message.RoomID,
+			MessageType: "broadcast_room",
+		})
+	}
+
+	return counts, nil
+}
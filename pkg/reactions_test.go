@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+func (r *fakeReactionRepository) AddReaction(reaction *model.MessageReaction) (bool, error) {
+	added := !r.reactions[reaction.Emoji]
+	r.reactions[reaction.Emoji] = true
+	return added, nil
+}
+
+func TestReactionsAreAddedOnceAndRemoved(t *testing.T) {
+	manager, bob := startTypingRoom(t, time.Hour, time.Hour)
+	manager.MessageRepo = &fakeMessageRepository{messages: map[uint]*model.Message{5: {ID: 5, RoomID: "lobby"}}}
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1}}}
+	manager.ReactionRepo = &fakeReactionRepository{reactions: map[string]bool{}}
+	thumbsUp := "\U0001F44D"
+
+	counts, err := manager.React(1, 5, thumbsUp, true)
+	if err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+	if len(counts) != 1 || counts[0] != (repository.ReactionCount{Emoji: thumbsUp, Count: 1}) {
+		t.Fatalf("counts after adding = %v", counts)
+	}
+	update := nextFrame(t, bob)
+	if update.Type != "reaction_updated" || update.Data["action"] != "added" || update.Data["emoji"] != thumbsUp {
+		t.Fatalf("unexpected frame %+v", update)
+	}
+
+	// Reacting again with the same emoji changes nothing
+	if counts, err := manager.React(1, 5, thumbsUp, true); err != nil || len(counts) != 1 {
+		t.Fatalf("duplicate add = %v, %v", counts, err)
+	}
+	expectNoFrame(t, bob, 100*time.Millisecond)
+
+	if counts, err := manager.React(1, 5, thumbsUp, false); err != nil || len(counts) != 0 {
+		t.Fatalf("remove = %v, %v", counts, err)
+	}
+	if update := nextFrame(t, bob); update.Data["action"] != "removed" {
+		t.Fatalf("unexpected frame %+v", update)
+	}
+}
+
+func TestInvalidReactionsAreRefused(t *testing.T) {
+	manager, _ := startTestManager(t)
+	manager.MessageRepo = &fakeMessageRepository{messages: map[uint]*model.Message{5: {ID: 5, RoomID: "lobby"}}}
+	manager.RoomRepo = &fakeRoomRepository{members: map[string][]uint{"lobby": {1}}}
+	manager.ReactionRepo = &fakeReactionRepository{reactions: map[string]bool{}}
+
+	tests := []struct {
+		name      string
+		userID    uint
+		messageID uint
+		emoji     string
+		code      string
+	}{
+		{"plain text", 1, 5, "lol", "invalid_emoji"},
+		{"unknown message", 1, 6, "\U0001F44D", "message_not_found"},
+		{"not a member", 2, 5, "\U0001F44D", "not_room_member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := manager.React(tt.userID, tt.messageID, tt.emoji, true)
+			reactionErr, ok := err.(*ReactionError)
+			if !ok || reactionErr.Code != tt.code {
+				t.Fatalf("React = %v, want a %s error", err, tt.code)
+			}
+		})
+	}
+}
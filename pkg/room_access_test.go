@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"fmt"
+	"testing"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+)
+
+// fakeRoomRepository knows a fixed set of rooms and their members. Methods the tests do not
+// need fall through to the nil embedded interface.
+type fakeRoomRepository struct {
+	repository.RoomRepository
+	members map[string][]uint
+}
+
+func (r *fakeRoomRepository) CountActiveMembers(roomID string) (int64, error) {
+	return int64(len(r.members[roomID])), nil
+}
+
+func (r *fakeRoomRepository) GetUserRooms(userID uint) ([]model.Room, error) {
+	var rooms []model.Room
+	for roomID, members := range r.members {
+		for _, member := range members {
+			if member == userID {
+				rooms = append(rooms, model.Room{ID: roomID})
+			}
+		}
+	}
+	return rooms, nil
+}
+
+func (r *fakeRoomRepository) GetRoomByID(roomID string) (*model.Room, error) {
+	if _, ok := r.members[roomID]; !ok {
+		return nil, nil
+	}
+	return &model.Room{ID: roomID}, nil
+}
+
+func (r *fakeRoomRepository) IsUserInRoom(roomID string, userID uint) (bool, error) {
+	for _, member := range r.members[roomID] {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeRoomRepository) IsUserBanned(roomID string, userID uint) (bool, error) {
+	return false, nil
+}
+
+func TestCheckRoomAccessErrorCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		rejectUnknown bool
+		roomID        string
+		code          string
+	}{
+		{"unknown room is reported", true, "nowhere", "room_not_found"},
+		{"existing room without membership", true, "lobby", "not_a_member"},
+		{"unknown room when not rejected", false, "nowhere", "not_a_member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &ClientManager{
+				Rooms:              make(map[string]map[*Client]bool),
+				RoomRepo:           &fakeRoomRepository{members: map[string][]uint{"lobby": {2}}},
+				RejectUnknownRooms: tt.rejectUnknown,
+			}
+			client := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+
+			if client.checkRoomAccess(tt.roomID, manager) {
+				t.Fatal("access granted")
+			}
+			frame := nextFrame(t, client)
+			if frame.Type != "error" || frame.Data["code"] != tt.code {
+				t.Fatalf("got %+v, want an error with code %s", frame, tt.code)
+			}
+		})
+	}
+}
+
+func TestJoinRoomOverLimitIsRefused(t *testing.T) {
+	manager := &ClientManager{
+		Rooms:    make(map[string]map[*Client]bool),
+		RoomRepo: &fakeRoomRepository{members: map[string][]uint{"lobby": {2}}},
+		JoinLimit: func(roomID string, userID uint) error {
+			return fmt.Errorf("%w (maximum %d)", ErrRoomLimitReached, 1)
+		},
+	}
+	client := NewClient(&model.User{ID: 1, Username: "alice"}, nil, DefaultClientConfig())
+
+	client.handleJoinRoom(IncomingMessage{Type: "join_room", RoomID: "lobby"}, manager)
+	frame := nextFrame(t, client)
+	if frame.Type != "error" || frame.Data["code"] != "room_limit_reached" {
+		t.Fatalf("got %+v, want an error with code room_limit_reached", frame)
+	}
+	if client.InRoom("lobby") {
+		t.Fatal("client joined the room despite the limit")
+	}
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"fmt"
+
+	"live-chatter/internal/repository"
+)
+
+// DefaultMaxThreadDepth is the number of ancestors a reply may have when none is configured
+const DefaultMaxThreadDepth = 32
+
+// ThreadPolicy controls which messages a reply may hang under
+type ThreadPolicy struct {
+	AllowDeletedParent bool // Accept replies to messages that have since been deleted
+	MaxDepth           int  // Maximum ancestors above a reply; 0 uses DefaultMaxThreadDepth
+}
+
+// ThreadViolation is returned when a reply would break the thread tree's invariants
+type ThreadViolation struct {
+	Code   string // parent_not_found, parent_deleted, parent_other_room, thread_cycle, thread_too_deep
+	Reason string
+}
+
+func (v *ThreadViolation) Error() string {
+	return v.Reason
+}
+
+// ValidateReplyParent checks that parentID can parent a reply in roomID: it must exist in the same
+// room, not be deleted unless the policy allows it, and sit shallow enough in its thread. messageID
+// is the reply itself when re-parenting an existing message, and 0 for a new one; a parent below
+// it in the tree would create a cycle and is refused.
+func ValidateReplyParent(repo repository.MessageRepository, policy ThreadPolicy, parentID uint, roomID string, messageID uint) error {
+	maxDepth := policy.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxThreadDepth
+	}
+
+	if messageID != 0 && parentID == messageID {
+		return &ThreadViolation{Code: "thread_cycle", Reason: "A message cannot reply to itself"}
+	}
+
+	parent, err := repo.GetThreadParent(parentID)
+	if err != nil {
+		return fmt.Errorf("failed to load parent message: %v", err)
+	}
+	if parent == nil {
+		return &ThreadViolation{Code: "parent_not_found", Reason: "Parent message not found"}
+	}
+	if parent.RoomID != roomID {
+		return &ThreadViolation{Code: "parent_other_room", Reason: "Parent message belongs to a different room"}
+	}
+	if parent.DeletedAt.Valid && !policy.AllowDeletedParent {
+		return &ThreadViolation{Code: "parent_deleted", Reason: "Parent message has been deleted"}
+	}
+
+	// The chain is bounded, so even a cycle already present in stored data cannot loop forever
+	ancestors, err := repo.GetAncestorIDs(parentID, maxDepth+1)
+	if err != nil {
+		return fmt.Errorf("failed to load thread ancestry: %v", err)
+	}
+	for _, id := range ancestors {
+		if messageID != 0 && id == messageID {
+			return &ThreadViolation{Code: "thread_cycle", Reason: "A message cannot reply to its own reply"}
+		}
+	}
+	if len(ancestors) > maxDepth {
+		return &ThreadViolation{Code: "thread_too_deep", Reason: fmt.Sprintf("Threads may be at most %d replies deep", maxDepth)}
+	}
+
+	return nil
+}
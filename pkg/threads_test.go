@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"live-chatter/internal/repository"
+	"live-chatter/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+// threadRepository holds a message tree in memory, deleted messages included
+type threadRepository struct {
+	repository.MessageRepository
+	messages map[uint]*model.Message
+}
+
+func (r *threadRepository) GetThreadParent(messageID uint) (*model.Message, error) {
+	return r.messages[messageID], nil
+}
+
+func (r *threadRepository) GetAncestorIDs(messageID uint, maxDepth int) ([]uint, error) {
+	var ids []uint
+	for id := messageID; len(ids) < maxDepth; {
+		message := r.messages[id]
+		if message == nil {
+			break
+		}
+		ids = append(ids, id)
+		if message.ParentID == nil {
+			break
+		}
+		id = *message.ParentID
+	}
+	return ids, nil
+}
+
+// newThreadRepository builds 1 <- 2 <- 3 in lobby, a deleted 4 in lobby and 5 in general
+func newThreadRepository() *threadRepository {
+	parent := func(id uint) *uint { return &id }
+	return &threadRepository{messages: map[uint]*model.Message{
+		1: {ID: 1, RoomID: "lobby"},
+		2: {ID: 2, RoomID: "lobby", ParentID: parent(1)},
+		3: {ID: 3, RoomID: "lobby", ParentID: parent(2)},
+		4: {ID: 4, RoomID: "lobby", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}},
+		5: {ID: 5, RoomID: "general"},
+	}}
+}
+
+func TestValidateReplyParent(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    ThreadPolicy
+		parentID  uint
+		messageID uint // The reply being re-parented, 0 for a new reply
+		code      string
+	}{
+		{"reply in the same room", ThreadPolicy{}, 3, 0, ""},
+		{"parent in another room", ThreadPolicy{}, 5, 0, "parent_other_room"},
+		{"missing parent", ThreadPolicy{}, 99, 0, "parent_not_found"},
+		{"deleted parent", ThreadPolicy{}, 4, 0, "parent_deleted"},
+		{"deleted parent when allowed", ThreadPolicy{AllowDeletedParent: true}, 4, 0, ""},
+		{"own parent", ThreadPolicy{}, 2, 2, "thread_cycle"},
+		{"under its own reply", ThreadPolicy{}, 3, 1, "thread_cycle"},
+		{"re-parented elsewhere", ThreadPolicy{}, 1, 3, ""},
+		{"too deep", ThreadPolicy{MaxDepth: 2}, 3, 0, "thread_too_deep"},
+		{"at the depth limit", ThreadPolicy{MaxDepth: 3}, 3, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReplyParent(newThreadRepository(), tt.policy, tt.parentID, "lobby", tt.messageID)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("ValidateReplyParent = %v, want it accepted", err)
+				}
+				return
+			}
+			var violation *ThreadViolation
+			if !errors.As(err, &violation) || violation.Code != tt.code {
+				t.Fatalf("ValidateReplyParent = %v, want a %s violation", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestValidateReplyParentStopsOnStoredCycle(t *testing.T) {
+	repo := newThreadRepository()
+	loop := uint(3)
+	repo.messages[1].ParentID = &loop // Corrupt data: 1 <- 2 <- 3 <- 1
+
+	err := ValidateReplyParent(repo, ThreadPolicy{MaxDepth: 5}, 3, "lobby", 0)
+	var violation *ThreadViolation
+	if !errors.As(err, &violation) || violation.Code != "thread_too_deep" {
+		t.Fatalf("ValidateReplyParent = %v, want the bounded walk to refuse the reply", err)
+	}
+}
@@ -0,0 +1,141 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	// Register the GIF decoder with image.Decode; PNG and JPEG are registered by the imports above
+	_ "image/gif"
+)
+
+// Defaults used when the processor is not configured
+const (
+	DefaultMaxEdge      = 256  // Longest side of a thumbnail in pixels
+	DefaultMaxSourceDim = 8192 // Longest side of an image that will be decoded
+)
+
+var (
+	// ErrUnsupported is returned for content the processor does not make thumbnails of
+	ErrUnsupported = errors.New("unsupported image type")
+	// ErrSourceTooLarge is returned, before decoding, for images whose dimensions exceed the cap
+	ErrSourceTooLarge = errors.New("image dimensions exceed the limit")
+)
+
+// Thumbnail is an encoded, downscaled image
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+}
+
+// Processor makes thumbnails of uploaded images. It returns ErrUnsupported for anything it
+// cannot handle, so callers can skip those uploads.
+type Processor interface {
+	Thumbnail(src io.ReadSeeker, contentType string) (*Thumbnail, error)
+}
+
+// StdProcessor makes thumbnails of PNG, JPEG and GIF images with the standard library. JPEG
+// sources produce JPEG thumbnails; the others produce PNG so transparency is kept.
+type StdProcessor struct {
+	MaxEdge      int
+	MaxSourceDim int
+}
+
+// NewStdProcessor returns a StdProcessor, applying the defaults to unset limits
+func NewStdProcessor(maxEdge, maxSourceDim int) *StdProcessor {
+	if maxEdge <= 0 {
+		maxEdge = DefaultMaxEdge
+	}
+	if maxSourceDim <= 0 {
+		maxSourceDim = DefaultMaxSourceDim
+	}
+	return &StdProcessor{MaxEdge: maxEdge, MaxSourceDim: maxSourceDim}
+}
+
+// Thumbnail checks the image's declared dimensions before decoding it, so a small file that
+// claims a huge canvas is refused without allocating for it
+func (p *StdProcessor) Thumbnail(src io.ReadSeeker, contentType string) (*Thumbnail, error) {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return nil, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid image dimensions %dx%d", config.Width, config.Height)
+	}
+	if config.Width > p.MaxSourceDim || config.Height > p.MaxSourceDim {
+		return nil, fmt.Errorf("%w: %dx%d", ErrSourceTooLarge, config.Width, config.Height)
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	scaled := downscale(img, p.MaxEdge)
+
+	var buf bytes.Buffer
+	if strings.HasSuffix(contentType, "/jpeg") {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		contentType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, scaled)
+		contentType = "image/png"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return &Thumbnail{Data: buf.Bytes(), ContentType: contentType}, nil
+}
+
+// downscale shrinks img so its longest side is at most maxEdge, averaging the source pixels
+// covered by each target pixel. Images already small enough are returned unchanged.
+func downscale(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxEdge && height <= maxEdge {
+		return img
+	}
+
+	targetWidth, targetHeight := maxEdge, maxEdge
+	if width >= height {
+		targetHeight = max(1, height*maxEdge/width)
+	} else {
+		targetWidth = max(1, width*maxEdge/height)
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0 := bounds.Min.Y + y*height/targetHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/targetHeight)
+		for x := 0; x < targetWidth; x++ {
+			x0 := bounds.Min.X + x*width/targetWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/targetWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
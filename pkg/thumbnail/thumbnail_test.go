@@ -0,0 +1,66 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// fixturePNG encodes a width by height PNG, red on the left half and blue on the right
+func fixturePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnailOfPNGKeepsAspectRatio(t *testing.T) {
+	thumb, err := NewStdProcessor(64, 0).Thumbnail(bytes.NewReader(fixturePNG(t, 200, 100)), "image/png")
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if thumb.ContentType != "image/png" {
+		t.Fatalf("content type %q, want image/png", thumb.ContentType)
+	}
+	img, err := png.Decode(bytes.NewReader(thumb.Data))
+	if err != nil {
+		t.Fatalf("thumbnail is not a PNG: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(64, 32) {
+		t.Fatalf("thumbnail is %v, want 64x32", size)
+	}
+	if r, _, b, _ := img.At(0, 0).RGBA(); r>>8 != 255 || b != 0 {
+		t.Fatalf("left edge is not red: %v", img.At(0, 0))
+	}
+	if r, _, b, _ := img.At(63, 31).RGBA(); r != 0 || b>>8 != 255 {
+		t.Fatalf("right edge is not blue: %v", img.At(63, 31))
+	}
+}
+
+func TestThumbnailRefusals(t *testing.T) {
+	processor := NewStdProcessor(64, 150)
+	if _, err := processor.Thumbnail(bytes.NewReader(fixturePNG(t, 200, 100)), "image/png"); !errors.Is(err, ErrSourceTooLarge) {
+		t.Fatalf("image over the dimension cap = %v, want ErrSourceTooLarge", err)
+	}
+	if _, err := processor.Thumbnail(bytes.NewReader([]byte("plain text")), "text/plain"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("text = %v, want ErrUnsupported", err)
+	}
+	if _, err := processor.Thumbnail(bytes.NewReader([]byte("\x89PNG not really")), "image/png"); err == nil {
+		t.Fatal("a corrupt PNG produced a thumbnail")
+	}
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import "time"
+
+// Typing indicator defaults used when none are configured
+const (
+	DefaultTypingThrottle = time.Second     // Minimum gap between start broadcasts per user and room
+	DefaultTypingTimeout  = 5 * time.Second // Silence after which a stop is sent on the typist's behalf
+)
+
+// typingKey identifies one user typing in one room
+type typingKey struct {
+	userID uint
+	roomID string
+}
+
+// typingState tracks an active typist so repeated start frames can be collapsed
+type typingState struct {
+	username      string
+	lastBroadcast time.Time
+	expiry        *time.Timer
+}
+
+// Typing relays a typing indicator from a user to a room. Start frames are rebroadcast at most
+// once per throttle window; each one pushes back the expiry, after which a stop is broadcast
+// for a client that went quiet. A stop from a user who is not typing is dropped.
+func (manager *ClientManager) Typing(userID uint, username, roomID string, typing bool) {
+	key := typingKey{userID: userID, roomID: roomID}
+
+	manager.typingMu.Lock()
+	if manager.typists == nil {
+		manager.typists = make(map[typingKey]*typingState)
+	}
+	state := manager.typists[key]
+
+	if !typing {
+		if state == nil {
+			manager.typingMu.Unlock()
+			return
+		}
+		state.expiry.Stop()
+		delete(manager.typists, key)
+		manager.typingMu.Unlock()
+
+		manager.publishTyping(userID, username, roomID, "stop")
+		return
+	}
+
+	throttle := manager.TypingThrottle
+	if throttle <= 0 {
+		throttle = DefaultTypingThrottle
+	}
+	timeout := manager.TypingTimeout
+	if timeout <= 0 {
+		timeout = DefaultTypingTimeout
+	}
+
+	now := time.Now()
+	if state != nil {
+		state.expiry.Reset(timeout)
+		if now.Sub(state.lastBroadcast) < throttle {
+			manager.typingMu.Unlock()
+			return
+		}
+		state.lastBroadcast = now
+		manager.typingMu.Unlock()
+
+		manager.publishTyping(userID, username, roomID, "start")
+		return
+	}
+
+	state = &typingState{username: username, lastBroadcast: now}
+	state.expiry = time.AfterFunc(timeout, func() { manager.expireTyping(key, state) })
+	manager.typists[key] = state
+	manager.typingMu.Unlock()
+
+	manager.publishTyping(userID, username, roomID, "start")
+}
+
+// expireTyping sends the stop a typist never did, unless they stopped or started over meanwhile
+func (manager *ClientManager) expireTyping(key typingKey, state *typingState) {
+	manager.typingMu.Lock()
+	if manager.typists[key] != state {
+		manager.typingMu.Unlock()
+		return
+	}
+	delete(manager.typists, key)
+	manager.typingMu.Unlock()
+
+	manager.publishTyping(key.userID, state.username, key.roomID, "stop")
+}
+
+// clearTyping forgets every room a disconnecting user was typing in and returns those rooms so
+// the caller can tell them the user stopped
+func (manager *ClientManager) clearTyping(userID uint) []string {
+	manager.typingMu.Lock()
+	defer manager.typingMu.Unlock()
+
+	var rooms []string
+	for key, state := range manager.typists {
+		if key.userID != userID {
+			continue
+		}
+		state.expiry.Stop()
+		delete(manager.typists, key)
+		rooms = append(rooms, key.roomID)
+	}
+	return rooms
+}
+
+// typingMessage builds the typing event sent to the other members of a room
+func typingMessage(userID uint, username, roomID, content string) *Message {
+	return &Message{
+		ID:        generateMessageID(),
+		Type:      "typing",
+		UserID:    userID,
+		Username:  username,
+		RoomID:    roomID,
+		Content:   content, // "start" or "stop"
+		Timestamp: time.Now(),
+	}
+}
+
+// publishTyping queues a typing event for the room, excluding the typist
+func (manager *ClientManager) publishTyping(userID uint, username, roomID, content string) {
+	manager.Publish(BroadcastMessage{
+		Message:     typingMessage(userID, username, roomID, content),
+		RoomID:      roomID,
+		ExcludeUser: username,
+		MessageType: "broadcast_room",
+	})
+}
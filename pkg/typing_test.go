@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// startTypingRoom connects alice and bob to a running manager, both members of lobby
+func startTypingRoom(t *testing.T, throttle, timeout time.Duration) (*ClientManager, *Client) {
+	t.Helper()
+	manager, clients := startTestManager(t, "alice", "bob")
+	manager.TypingThrottle = throttle
+	manager.TypingTimeout = timeout
+
+	manager.mu.Lock()
+	manager.Rooms["lobby"] = map[*Client]bool{clients["alice"]: true, clients["bob"]: true}
+	manager.mu.Unlock()
+	return manager, clients["bob"]
+}
+
+// expectNoFrame fails if the client receives anything within wait
+func expectNoFrame(t *testing.T, client *Client, wait time.Duration) {
+	t.Helper()
+	select {
+	case data := <-client.Send:
+		t.Fatalf("unexpected frame %s", data)
+	case <-time.After(wait):
+	}
+}
+
+func TestRapidTypingFramesAreThrottled(t *testing.T) {
+	manager, bob := startTypingRoom(t, time.Hour, time.Hour)
+
+	for i := 0; i < 50; i++ {
+		manager.Typing(1, "alice", "lobby", true)
+	}
+
+	start := nextFrame(t, bob)
+	if start.Type != "typing" || start.Content != "start" || start.Username != "alice" {
+		t.Fatalf("unexpected frame %+v", start)
+	}
+	expectNoFrame(t, bob, 100*time.Millisecond)
+
+	manager.Typing(1, "alice", "lobby", false)
+	if stop := nextFrame(t, bob); stop.Content != "stop" {
+		t.Fatalf("expected a stop, got %+v", stop)
+	}
+
+	// Stopping twice is not repeated to the room
+	manager.Typing(1, "alice", "lobby", false)
+	expectNoFrame(t, bob, 100*time.Millisecond)
+}
+
+func TestTypingIsRebroadcastOncePerThrottleWindow(t *testing.T) {
+	manager, bob := startTypingRoom(t, 50*time.Millisecond, time.Hour)
+
+	manager.Typing(1, "alice", "lobby", true)
+	nextFrame(t, bob)
+	time.Sleep(60 * time.Millisecond)
+	manager.Typing(1, "alice", "lobby", true)
+
+	if again := nextFrame(t, bob); again.Content != "start" {
+		t.Fatalf("expected a second start after the window, got %+v", again)
+	}
+}
+
+func TestSilentTypistExpires(t *testing.T) {
+	manager, bob := startTypingRoom(t, time.Hour, 50*time.Millisecond)
+
+	manager.Typing(1, "alice", "lobby", true)
+	if start := nextFrame(t, bob); start.Content != "start" {
+		t.Fatalf("expected a start, got %+v", start)
+	}
+	if stop := nextFrame(t, bob); stop.Content != "stop" || stop.Username != "alice" {
+		t.Fatalf("expected a stop on alice's behalf, got %+v", stop)
+	}
+}